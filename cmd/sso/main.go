@@ -22,15 +22,21 @@ func main() {
 
 	log.Info("starting application", slog.Any("cfg", cfg))
 
-	application := app.NewApp(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTl)
+	application := app.NewApp(log, cfg)
 	go application.GRPCServer.MustRun()
+	if application.HTTPServer != nil {
+		go application.HTTPServer.MustRun()
+	}
+	if application.MetricsServer != nil {
+		go application.MetricsServer.MustRun()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
-	application.GRPCServer.Stop()
+	application.Stop()
 	log.Info("application stopped")
 }
 
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/mailer"
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/storage/sqlite"
+	ssov1 "github.com/KRYST4L614/auth_service_protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// operatorId is the actor recorded in the audit log for changes made offline.
+// Whoever can open the storage file is trusted as an admin.
+const operatorId int64 = 0
+
+var errOnlineUnsupported = errors.New("not available over gRPC, run offline with -storage-path")
+
+// backend carries out the commands, either through the gRPC API or on the storage directly.
+type backend interface {
+	CreateApp(ctx context.Context, name string) (entity.App, error)
+	ListApps(ctx context.Context) ([]entity.App, error)
+	SetRedirectURIs(ctx context.Context, appId int, uris []string, loopbackAnyPort bool) error
+	SetPostLogoutRedirectURIs(ctx context.Context, appId int, uris []string) error
+	SetWebOrigins(ctx context.Context, appId int, origins []string) error
+	SetClientCredentials(ctx context.Context, appId int, scopes []string, publicKey string) (entity.App, error)
+	SetUserScopes(ctx context.Context, appId int, scopes []string) (entity.App, error)
+	SetTokenExchangeFrom(ctx context.Context, appId int, sourceIds []int) (entity.App, error)
+	SetThirdParty(ctx context.Context, appId int, thirdParty bool) (entity.App, error)
+	CreateUser(ctx context.Context, email string, password string, appId int) (int64, error)
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+	Promote(ctx context.Context, userId int64) error
+	ResetPassword(ctx context.Context, userId int64, password string) error
+	RevokeSessions(ctx context.Context, userId int64) (int64, error)
+	ListConsents(ctx context.Context, userId int64) ([]entity.Consent, error)
+	RevokeConsent(ctx context.Context, userId int64, appId int) error
+	Close() error
+}
+
+type online struct {
+	conn   *grpc.ClientConn
+	client ssov1.AuthClient
+}
+
+func newOnline(addr string) (*online, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &online{conn: conn, client: ssov1.NewAuthClient(conn)}, nil
+}
+
+// CreateUser registers the user through the app if one is given, which
+// RegisterRequest has no field for.
+func (o *online) CreateUser(ctx context.Context, email string, password string, appId int) (int64, error) {
+	if appId != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-app-id", strconv.Itoa(appId))
+	}
+	resp, err := o.client.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: password})
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetUserId(), nil
+}
+
+func (o *online) IsAdmin(ctx context.Context, userId int64) (bool, error) {
+	resp, err := o.client.IsAdmin(ctx, &ssov1.IsAdminRequest{UserId: userId})
+	if err != nil {
+		return false, err
+	}
+
+	return resp.GetIsAdmin(), nil
+}
+
+func (o *online) CreateApp(context.Context, string) (entity.App, error) {
+	return entity.App{}, errOnlineUnsupported
+}
+
+func (o *online) ListApps(context.Context) ([]entity.App, error) {
+	return nil, errOnlineUnsupported
+}
+
+func (o *online) SetRedirectURIs(context.Context, int, []string, bool) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) SetPostLogoutRedirectURIs(context.Context, int, []string) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) SetWebOrigins(context.Context, int, []string) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) SetClientCredentials(context.Context, int, []string, string) (entity.App, error) {
+	return entity.App{}, errOnlineUnsupported
+}
+
+func (o *online) SetUserScopes(context.Context, int, []string) (entity.App, error) {
+	return entity.App{}, errOnlineUnsupported
+}
+
+func (o *online) SetTokenExchangeFrom(context.Context, int, []int) (entity.App, error) {
+	return entity.App{}, errOnlineUnsupported
+}
+
+func (o *online) SetThirdParty(context.Context, int, bool) (entity.App, error) {
+	return entity.App{}, errOnlineUnsupported
+}
+
+func (o *online) Promote(context.Context, int64) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) ResetPassword(context.Context, int64, string) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) RevokeSessions(context.Context, int64) (int64, error) {
+	return 0, errOnlineUnsupported
+}
+
+func (o *online) ListConsents(context.Context, int64) ([]entity.Consent, error) {
+	return nil, errOnlineUnsupported
+}
+
+func (o *online) RevokeConsent(context.Context, int64, int) error {
+	return errOnlineUnsupported
+}
+
+func (o *online) Close() error {
+	return o.conn.Close()
+}
+
+// operatorStorage is the storage as seen by the services offline: the operator
+// passes every admin check.
+type operatorStorage struct {
+	*sqlite.Storage
+}
+
+func (s operatorStorage) IsAdmin(ctx context.Context, userId int64) (bool, error) {
+	if userId == operatorId {
+		return true, nil
+	}
+
+	return s.Storage.IsAdmin(ctx, userId)
+}
+
+type offline struct {
+	storage *sqlite.Storage
+	hasher  *auth.PasswordHasher
+	auth    *auth.Auth
+	apps    *apps.Apps
+}
+
+func newOffline(log *slog.Logger, storagePath string, hashCost int, tokenTTL time.Duration) (*offline, error) {
+	storage, err := sqlite.NewStorage(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	operator := operatorStorage{storage}
+	hasher := auth.NewPasswordHasher(1, 1, hashCost)
+	// Notifications are only logged: there's no SMTP setup for a one-off command.
+	mail := mailer.New(log, "", "", "", "", "", 0)
+	// Nor is there a signing key: no command issues or verifies tokens offline.
+
+	return &offline{
+		storage: storage,
+		hasher:  hasher,
+		auth:    auth.New(log, storage, operator, storage, storage, mail, hasher, nil, nil, tokenTTL),
+		apps:    apps.New(log, storage, operator),
+	}, nil
+}
+
+func (o *offline) CreateApp(ctx context.Context, name string) (entity.App, error) {
+	return o.apps.CreateApp(ctx, operatorId, entity.App{Name: name, Settings: entity.AppSettings{AllowRegistration: true}})
+}
+
+func (o *offline) ListApps(ctx context.Context) ([]entity.App, error) {
+	return o.apps.ListApps(ctx, operatorId)
+}
+
+func (o *offline) SetRedirectURIs(ctx context.Context, appId int, uris []string, loopbackAnyPort bool) error {
+	if err := o.apps.SetRedirectURIs(ctx, operatorId, appId, uris); err != nil {
+		return err
+	}
+
+	app, err := o.apps.GetApp(ctx, operatorId, appId)
+	if err != nil {
+		return err
+	}
+	if app.Settings.LoopbackAnyPort == loopbackAnyPort {
+		return nil
+	}
+
+	app.Settings.LoopbackAnyPort = loopbackAnyPort
+
+	return o.apps.UpdateApp(ctx, operatorId, app)
+}
+
+func (o *offline) SetPostLogoutRedirectURIs(ctx context.Context, appId int, uris []string) error {
+	return o.apps.SetPostLogoutRedirectURIs(ctx, operatorId, appId, uris)
+}
+
+func (o *offline) SetWebOrigins(ctx context.Context, appId int, origins []string) error {
+	return o.apps.SetWebOrigins(ctx, operatorId, appId, origins)
+}
+
+func (o *offline) SetClientCredentials(ctx context.Context, appId int, scopes []string, publicKey string) (entity.App, error) {
+	app, err := o.apps.GetApp(ctx, operatorId, appId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	app.Settings.ClientScopes = scopes
+	app.Settings.ClientPublicKey = publicKey
+
+	return app, o.apps.UpdateApp(ctx, operatorId, app)
+}
+
+func (o *offline) SetUserScopes(ctx context.Context, appId int, scopes []string) (entity.App, error) {
+	app, err := o.apps.GetApp(ctx, operatorId, appId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	app.Settings.UserScopes = scopes
+
+	return app, o.apps.UpdateApp(ctx, operatorId, app)
+}
+
+func (o *offline) SetTokenExchangeFrom(ctx context.Context, appId int, sourceIds []int) (entity.App, error) {
+	app, err := o.apps.GetApp(ctx, operatorId, appId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	app.Settings.TokenExchangeFrom = sourceIds
+
+	return app, o.apps.UpdateApp(ctx, operatorId, app)
+}
+
+func (o *offline) SetThirdParty(ctx context.Context, appId int, thirdParty bool) (entity.App, error) {
+	app, err := o.apps.GetApp(ctx, operatorId, appId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	app.Settings.ThirdParty = thirdParty
+
+	return app, o.apps.UpdateApp(ctx, operatorId, app)
+}
+
+// CreateUser registers the user through the app if one is given, so its
+// registration policy applies.
+func (o *offline) CreateUser(ctx context.Context, email string, password string, appId int) (int64, error) {
+	if appId != 0 {
+		return o.auth.Register(ctx, email, password, auth.WithApp(appId))
+	}
+
+	return o.auth.Register(ctx, email, password)
+}
+
+func (o *offline) IsAdmin(ctx context.Context, userId int64) (bool, error) {
+	return o.storage.IsAdmin(ctx, userId)
+}
+
+func (o *offline) Promote(ctx context.Context, userId int64) error {
+	return o.auth.SetAdmin(ctx, operatorId, userId)
+}
+
+func (o *offline) ResetPassword(ctx context.Context, userId int64, password string) error {
+	return o.auth.ResetPassword(ctx, operatorId, userId, password)
+}
+
+func (o *offline) RevokeSessions(ctx context.Context, userId int64) (int64, error) {
+	return o.auth.RevokeSessions(ctx, operatorId, userId)
+}
+
+func (o *offline) ListConsents(ctx context.Context, userId int64) ([]entity.Consent, error) {
+	return o.storage.Consents(ctx, userId)
+}
+
+// RevokeConsent revokes the consent in the storage, as the OAuth service would:
+// the tokens issued under it are inactive at introspection from then on.
+func (o *offline) RevokeConsent(ctx context.Context, userId int64, appId int) error {
+	return o.storage.RevokeConsent(ctx, userId, appId)
+}
+
+func (o *offline) Close() error {
+	o.hasher.Stop()
+	return nil
+}
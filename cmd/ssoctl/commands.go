@@ -0,0 +1,673 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+)
+
+type appView struct {
+	ID                int      `json:"id"`
+	Name              string   `json:"name"`
+	Secret            string   `json:"secret,omitempty"`
+	AccessTokenTTL    string   `json:"access_token_ttl,omitempty"`
+	AllowRegistration bool     `json:"allow_registration"`
+	LoginMethods      []string `json:"login_methods,omitempty"`
+	RequiredACR       string   `json:"required_acr,omitempty"`
+	EmailDomains      []string `json:"allowed_email_domains,omitempty"`
+	ClientScopes      []string `json:"client_scopes,omitempty"`
+	UserScopes        []string `json:"user_scopes,omitempty"`
+	TokenExchangeFrom []int    `json:"token_exchange_from,omitempty"`
+	ThirdParty        bool     `json:"third_party"`
+	GrantTypes        []string `json:"grant_types,omitempty"`
+	TokenAuthMethod   string   `json:"token_auth_method,omitempty"`
+	LoopbackAnyPort   bool     `json:"loopback_any_port"`
+}
+
+func newAppView(app entity.App) appView {
+	view := appView{
+		ID:                app.ID,
+		Name:              app.Name,
+		Secret:            app.Secret,
+		AllowRegistration: app.Settings.AllowRegistration,
+		LoginMethods:      app.Settings.LoginMethods,
+		RequiredACR:       app.Settings.RequiredACR,
+		EmailDomains:      app.Settings.AllowedEmailDomains,
+		ClientScopes:      app.Settings.ClientScopes,
+		UserScopes:        app.Settings.UserScopes,
+		TokenExchangeFrom: app.Settings.TokenExchangeFrom,
+		ThirdParty:        app.Settings.ThirdParty,
+		GrantTypes:        app.Settings.GrantTypes,
+		TokenAuthMethod:   app.Settings.TokenAuthMethod,
+		LoopbackAnyPort:   app.Settings.LoopbackAnyPort,
+	}
+	if app.Settings.AccessTokenTTL > 0 {
+		view.AccessTokenTTL = app.Settings.AccessTokenTTL.String()
+	}
+
+	return view
+}
+
+func appsCreate(ctx context.Context, e *env, args []string) error {
+	var name string
+	parse("apps create", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&name, "name", "", "Name of the app")
+	})
+
+	return e.withBackend(func(b backend) error {
+		app, err := b.CreateApp(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(newAppView(app), []string{"ID", "NAME", "SECRET"},
+			[][]string{{strconv.Itoa(app.ID), app.Name, app.Secret}})
+	})
+}
+
+func appsList(ctx context.Context, e *env, args []string) error {
+	parse("apps list", args, nil)
+
+	return e.withBackend(func(b backend) error {
+		apps, err := b.ListApps(ctx)
+		if err != nil {
+			return err
+		}
+
+		views := make([]appView, 0, len(apps))
+		rows := make([][]string, 0, len(apps))
+		for _, app := range apps {
+			view := newAppView(app)
+			views = append(views, view)
+			rows = append(rows, []string{
+				strconv.Itoa(app.ID),
+				app.Name,
+				strconv.FormatBool(view.AllowRegistration),
+				view.AccessTokenTTL,
+				strings.Join(view.LoginMethods, ","),
+			})
+		}
+
+		return e.out.print(views, []string{"ID", "NAME", "REGISTRATION", "TOKEN TTL", "LOGIN METHODS"}, rows)
+	})
+}
+
+func appsRedirectURIs(ctx context.Context, e *env, args []string) error {
+	var (
+		appId           int
+		loopbackAnyPort bool
+	)
+	uris := parse("apps redirect-uris", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+		fs.BoolVar(&loopbackAnyPort, "any-loopback-port", false,
+			"Accept http loopback redirect URIs on any port, for native apps")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.SetRedirectURIs(ctx, appId, uris, loopbackAnyPort); err != nil {
+			return err
+		}
+
+		return printList(e, uris, "REDIRECT URI")
+	})
+}
+
+func appsPostLogoutRedirectURIs(ctx context.Context, e *env, args []string) error {
+	var appId int
+	uris := parse("apps post-logout-redirect-uris", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.SetPostLogoutRedirectURIs(ctx, appId, uris); err != nil {
+			return err
+		}
+
+		return printList(e, uris, "POST-LOGOUT REDIRECT URI")
+	})
+}
+
+func appsWebOrigins(ctx context.Context, e *env, args []string) error {
+	var appId int
+	origins := parse("apps web-origins", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.SetWebOrigins(ctx, appId, origins); err != nil {
+			return err
+		}
+
+		return printList(e, origins, "WEB ORIGIN")
+	})
+}
+
+// printList prints the values one per row under the header.
+func printList(e *env, values []string, header string) error {
+	rows := make([][]string, 0, len(values))
+	for _, value := range values {
+		rows = append(rows, []string{value})
+	}
+
+	return e.out.print(values, []string{header}, rows)
+}
+
+func appsClientCredentials(ctx context.Context, e *env, args []string) error {
+	var (
+		appId         int
+		scopes        string
+		publicKeyFile string
+	)
+	parse("apps client-credentials", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+		fs.StringVar(&scopes, "scopes", "", "Space-separated scopes the app may request, empty disables the grant")
+		fs.StringVar(&publicKeyFile, "public-key-file", "", "PEM public key for private key JWT client authentication")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	var publicKey string
+	if publicKeyFile != "" {
+		raw, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return err
+		}
+		publicKey = string(raw)
+	}
+
+	return e.withBackend(func(b backend) error {
+		app, err := b.SetClientCredentials(ctx, appId, strings.Fields(scopes), publicKey)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(newAppView(app), []string{"ID", "NAME", "CLIENT SCOPES", "PUBLIC KEY"},
+			[][]string{{strconv.Itoa(app.ID), app.Name, strings.Join(app.Settings.ClientScopes, " "),
+				strconv.FormatBool(app.Settings.ClientPublicKey != "")}})
+	})
+}
+
+func appsUserScopes(ctx context.Context, e *env, args []string) error {
+	var appId int
+	scopes := parse("apps user-scopes", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		app, err := b.SetUserScopes(ctx, appId, scopes)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(newAppView(app), []string{"ID", "NAME", "USER SCOPES"},
+			[][]string{{strconv.Itoa(app.ID), app.Name, strings.Join(app.Settings.UserScopes, " ")}})
+	})
+}
+
+func appsTokenExchange(ctx context.Context, e *env, args []string) error {
+	var appId int
+	from := parse("apps token-exchange", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	sourceIds := make([]int, 0, len(from))
+	for _, arg := range from {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid app id %q", arg)
+		}
+		sourceIds = append(sourceIds, id)
+	}
+
+	return e.withBackend(func(b backend) error {
+		app, err := b.SetTokenExchangeFrom(ctx, appId, sourceIds)
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(app.Settings.TokenExchangeFrom))
+		for _, id := range app.Settings.TokenExchangeFrom {
+			rows = append(rows, []string{strconv.Itoa(id)})
+		}
+
+		return e.out.print(newAppView(app), []string{"ACCEPTS TOKENS OF APP"}, rows)
+	})
+}
+
+func appsThirdParty(ctx context.Context, e *env, args []string) error {
+	var (
+		appId int
+		off   bool
+	)
+	parse("apps third-party", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&appId, "id", 0, "Id of the app")
+		fs.BoolVar(&off, "off", false, "Make the app first-party again")
+	})
+
+	if appId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		app, err := b.SetThirdParty(ctx, appId, !off)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(newAppView(app), []string{"ID", "NAME", "THIRD PARTY"},
+			[][]string{{strconv.Itoa(app.ID), app.Name, strconv.FormatBool(app.Settings.ThirdParty)}})
+	})
+}
+
+type userView struct {
+	ID       int64  `json:"id"`
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+	Admin    *bool  `json:"admin,omitempty"`
+}
+
+func usersCreate(ctx context.Context, e *env, args []string) error {
+	var email, password string
+	var appId int
+	parse("users create", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&email, "email", "", "Email of the user")
+		fs.StringVar(&password, "password", "", "Password, generated and printed when empty")
+		fs.IntVar(&appId, "app", 0, "App the user registers through, whose policy applies")
+	})
+
+	if email == "" {
+		return errors.New("-email is required")
+	}
+
+	view := userView{Email: email}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return err
+		}
+		password, view.Password = generated, generated
+	}
+
+	return e.withBackend(func(b backend) error {
+		userId, err := b.CreateUser(ctx, email, password, appId)
+		if err != nil {
+			return err
+		}
+		view.ID = userId
+
+		return e.out.print(view, []string{"ID", "EMAIL", "PASSWORD"},
+			[][]string{{strconv.FormatInt(userId, 10), email, view.Password}})
+	})
+}
+
+func usersIsAdmin(ctx context.Context, e *env, args []string) error {
+	userId, err := userIdFlag("users is-admin", "id", args)
+	if err != nil {
+		return err
+	}
+
+	return e.withBackend(func(b backend) error {
+		isAdmin, err := b.IsAdmin(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(userView{ID: userId, Admin: &isAdmin}, []string{"ID", "ADMIN"},
+			[][]string{{strconv.FormatInt(userId, 10), strconv.FormatBool(isAdmin)}})
+	})
+}
+
+func usersPromote(ctx context.Context, e *env, args []string) error {
+	userId, err := userIdFlag("users promote", "id", args)
+	if err != nil {
+		return err
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.Promote(ctx, userId); err != nil {
+			return err
+		}
+
+		isAdmin := true
+		return e.out.print(userView{ID: userId, Admin: &isAdmin}, []string{"ID", "ADMIN"},
+			[][]string{{strconv.FormatInt(userId, 10), "true"}})
+	})
+}
+
+func usersResetPassword(ctx context.Context, e *env, args []string) error {
+	var (
+		userId   int64
+		password string
+	)
+	parse("users reset-password", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&userId, "id", 0, "Id of the user")
+		fs.StringVar(&password, "password", "", "New password, generated and printed when empty")
+	})
+
+	if userId <= 0 {
+		return errors.New("-id is required")
+	}
+
+	view := userView{ID: userId}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return err
+		}
+		password, view.Password = generated, generated
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.ResetPassword(ctx, userId, password); err != nil {
+			return err
+		}
+
+		return e.out.print(view, []string{"ID", "PASSWORD"},
+			[][]string{{strconv.FormatInt(userId, 10), view.Password}})
+	})
+}
+
+func sessionsRevoke(ctx context.Context, e *env, args []string) error {
+	userId, err := userIdFlag("sessions revoke", "user-id", args)
+	if err != nil {
+		return err
+	}
+
+	return e.withBackend(func(b backend) error {
+		revoked, err := b.RevokeSessions(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		return e.out.print(
+			struct {
+				UserID        int64 `json:"user_id"`
+				RevokedTokens int64 `json:"revoked_tokens"`
+			}{userId, revoked},
+			[]string{"USER ID", "REVOKED TOKENS"},
+			[][]string{{strconv.FormatInt(userId, 10), strconv.FormatInt(revoked, 10)}},
+		)
+	})
+}
+
+type consentView struct {
+	AppID     int       `json:"app_id"`
+	AppName   string    `json:"app_name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func consentsList(ctx context.Context, e *env, args []string) error {
+	userId, err := userIdFlag("consents list", "user-id", args)
+	if err != nil {
+		return err
+	}
+
+	return e.withBackend(func(b backend) error {
+		consents, err := b.ListConsents(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		views := make([]consentView, 0, len(consents))
+		rows := make([][]string, 0, len(consents))
+		for _, consent := range consents {
+			views = append(views, consentView{
+				AppID:     consent.AppID,
+				AppName:   consent.AppName,
+				Scopes:    consent.Scopes,
+				CreatedAt: consent.CreatedAt,
+				UpdatedAt: consent.UpdatedAt,
+			})
+			rows = append(rows, []string{
+				strconv.Itoa(consent.AppID),
+				consent.AppName,
+				strings.Join(consent.Scopes, " "),
+				consent.UpdatedAt.Format(time.RFC3339),
+			})
+		}
+
+		return e.out.print(views, []string{"APP ID", "APP", "SCOPES", "UPDATED"}, rows)
+	})
+}
+
+func consentsRevoke(ctx context.Context, e *env, args []string) error {
+	var (
+		userId int64
+		appId  int
+	)
+	parse("consents revoke", args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&userId, "user-id", 0, "Id of the user")
+		fs.IntVar(&appId, "app", 0, "Id of the app")
+	})
+
+	if userId <= 0 {
+		return errors.New("-user-id is required")
+	}
+	if appId <= 0 {
+		return errors.New("-app is required")
+	}
+
+	return e.withBackend(func(b backend) error {
+		if err := b.RevokeConsent(ctx, userId, appId); err != nil {
+			return err
+		}
+
+		return e.out.print(
+			struct {
+				UserID  int64 `json:"user_id"`
+				AppID   int   `json:"app_id"`
+				Revoked bool  `json:"revoked"`
+			}{userId, appId, true},
+			[]string{"USER ID", "APP ID", "REVOKED"},
+			[][]string{{strconv.FormatInt(userId, 10), strconv.Itoa(appId), "true"}},
+		)
+	})
+}
+
+type tokenView struct {
+	Header map[string]any `json:"header"`
+	Claims map[string]any `json:"claims"`
+	Valid  *bool          `json:"valid,omitempty"`
+}
+
+func tokenDecode(_ context.Context, e *env, args []string) error {
+	rest := parse("token decode", args, nil)
+	if len(rest) != 1 {
+		return errors.New("expected exactly one token")
+	}
+
+	view, err := decodeToken(rest[0])
+	if err != nil {
+		return err
+	}
+
+	return printToken(e, view)
+}
+
+func tokenVerify(ctx context.Context, e *env, args []string) error {
+	var jwksURL string
+	rest := parse("token verify", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&jwksURL, "jwks", "", "JWKS URL of the server, e.g. http://localhost:44046/jwks.json")
+	})
+	if len(rest) != 1 || jwksURL == "" {
+		return errors.New("expected -jwks and exactly one token")
+	}
+	token := rest[0]
+
+	view, err := decodeToken(token)
+	if err != nil {
+		return err
+	}
+
+	kid, _ := view.Header["kid"].(string)
+	key, err := fetchKey(ctx, jwksURL, kid)
+	if err != nil {
+		return err
+	}
+
+	_, verifyErr := jwt.Parse(token, key)
+	valid := verifyErr == nil
+	view.Valid = &valid
+
+	if err := printToken(e, view); err != nil {
+		return err
+	}
+
+	return verifyErr
+}
+
+// fetchKey returns the RSA key with the id from the key set the server publishes.
+func fetchKey(ctx context.Context, jwksURL string, kid string) (*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch key set: %s", resp.Status)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode key set: %w", err)
+	}
+
+	for _, key := range set.Keys {
+		if key.KeyID == kid {
+			return key.RSA()
+		}
+	}
+
+	return nil, fmt.Errorf("%w: signed with an unknown key %q", jwt.ErrInvalidToken, kid)
+}
+
+// decodeToken reads the header and the claims of a JWT without verifying it.
+func decodeToken(token string) (tokenView, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenView{}, fmt.Errorf("%w: expected three parts", jwt.ErrInvalidToken)
+	}
+
+	var view tokenView
+	for i, dst := range []*map[string]any{&view.Header, &view.Claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			return tokenView{}, fmt.Errorf("%w: %s", jwt.ErrInvalidToken, err)
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return tokenView{}, fmt.Errorf("%w: %s", jwt.ErrInvalidToken, err)
+		}
+	}
+
+	return view, nil
+}
+
+func printToken(e *env, view tokenView) error {
+	var rows [][]string
+	for _, part := range []struct {
+		name   string
+		values map[string]any
+	}{{"header", view.Header}, {"claim", view.Claims}} {
+		keys := make([]string, 0, len(part.values))
+		for key := range part.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			rows = append(rows, []string{part.name, key, formatClaim(key, part.values[key])})
+		}
+	}
+	if view.Valid != nil {
+		rows = append(rows, []string{"", "valid", strconv.FormatBool(*view.Valid)})
+	}
+
+	return e.out.print(view, []string{"PART", "NAME", "VALUE"}, rows)
+}
+
+// formatClaim renders a claim for the table, with timestamps as dates.
+func formatClaim(key string, value any) string {
+	switch key {
+	case "exp", "iat", "nbf", "auth_time":
+		if seconds, ok := value.(float64); ok {
+			return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+func userIdFlag(name string, flagName string, args []string) (int64, error) {
+	var userId int64
+	parse(name, args, func(fs *flag.FlagSet) {
+		fs.Int64Var(&userId, flagName, 0, "Id of the user")
+	})
+
+	if userId <= 0 {
+		return 0, fmt.Errorf("-%s is required", flagName)
+	}
+
+	return userId, nil
+}
+
+func generatePassword() (string, error) {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,187 @@
+// Command ssoctl runs day-to-day administrative tasks against the SSO service.
+//
+// It talks to the gRPC API given with -addr, or works on the storage directly
+// with -storage-path (offline mode). Only registering users and checking admins
+// are part of the gRPC API so far; everything else needs offline mode.
+//
+//	ssoctl -storage-path ./storage/sso.db apps create -name shop
+//	ssoctl -addr localhost:44044 -o json users create -email a@b.c
+//	ssoctl token decode <token>
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const usage = `usage: ssoctl [global flags] <command> [flags]
+
+commands:
+  apps create -name NAME         register an app and print its secret
+  apps list                      list apps
+  apps redirect-uris -id ID [-any-loopback-port] URI...
+                                 replace the redirect URIs of an app
+  apps post-logout-redirect-uris -id ID URI...
+                                 replace where an app may send users after logout
+  apps web-origins -id ID ORIGIN...
+                                 replace the origins browser code of an app may call from
+  apps client-credentials -id ID -scopes SCOPES [-public-key-file FILE]
+                                 enable the client credentials grant for an app
+  apps user-scopes -id ID [SCOPE...]
+                                 replace the scopes an app may request for its users
+  apps token-exchange -id ID [APP_ID...]
+                                 replace the apps whose user tokens an app accepts
+  apps third-party -id ID [-off] make users consent before an app gets their tokens
+  users create -email EMAIL [-app ID]
+                                 register a user (password generated unless -password)
+  users is-admin -id ID          tell whether a user is an admin
+  users promote -id ID           make a user an admin
+  users reset-password -id ID    set a new password (generated unless -password)
+  sessions revoke -user-id ID    revoke personal access tokens and forget devices
+  consents list -user-id ID      list the third-party apps a user consented to
+  consents revoke -user-id ID -app ID
+                                 withdraw the consent of a user to an app
+  token decode TOKEN             print the claims of a token without verifying it
+  token verify -jwks URL TOKEN   verify a token with the key the server publishes
+
+global flags:
+`
+
+// command runs one subcommand with its own arguments.
+type command func(ctx context.Context, env *env, args []string) error
+
+var commands = map[string]command{
+	"apps create":                    appsCreate,
+	"apps list":                      appsList,
+	"apps redirect-uris":             appsRedirectURIs,
+	"apps post-logout-redirect-uris": appsPostLogoutRedirectURIs,
+	"apps web-origins":               appsWebOrigins,
+	"apps client-credentials":        appsClientCredentials,
+	"apps user-scopes":               appsUserScopes,
+	"apps token-exchange":            appsTokenExchange,
+	"apps third-party":               appsThirdParty,
+	"users create":                   usersCreate,
+	"users is-admin":                 usersIsAdmin,
+	"users promote":                  usersPromote,
+	"users reset-password":           usersResetPassword,
+	"sessions revoke":                sessionsRevoke,
+	"consents list":                  consentsList,
+	"consents revoke":                consentsRevoke,
+	"token decode":                   tokenDecode,
+	"token verify":                   tokenVerify,
+}
+
+// env is what the commands run with.
+type env struct {
+	out     printer
+	backend func() (backend, error)
+}
+
+func main() {
+	var (
+		addr        string
+		storagePath string
+		configPath  string
+		output      string
+		timeout     time.Duration
+	)
+
+	fs := flag.NewFlagSet("ssoctl", flag.ExitOnError)
+	fs.StringVar(&addr, "addr", "", "Address of the gRPC API, e.g. localhost:44044")
+	fs.StringVar(&storagePath, "storage-path", "", "Work on this storage directly instead of the gRPC API")
+	fs.StringVar(&configPath, "config", "", "Service config to take the storage path and hashing cost from")
+	fs.StringVar(&output, "o", "table", "Output format: table or json")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "Timeout of the whole command")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	run, ok := commands[args[0]+" "+args[1]]
+	if !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if output != outputTable && output != outputJSON {
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", output)
+		os.Exit(2)
+	}
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	hashCost, tokenTTL := bcrypt.DefaultCost, time.Hour
+	if configPath != "" {
+		cfg := config.MustLoadByPath(configPath)
+		if storagePath == "" {
+			storagePath = cfg.StoragePath
+		}
+		if cfg.Hashing.Cost > 0 {
+			hashCost = cfg.Hashing.Cost
+		}
+		tokenTTL = cfg.TokenTTl
+	}
+
+	e := &env{
+		out: printer{w: os.Stdout, json: output == outputJSON},
+		backend: func() (backend, error) {
+			switch {
+			case addr != "" && storagePath != "":
+				return nil, errors.New("-addr and -storage-path are mutually exclusive")
+			case addr != "":
+				return newOnline(addr)
+			case storagePath != "":
+				return newOffline(log, storagePath, hashCost, tokenTTL)
+			}
+			return nil, errors.New("either -addr or -storage-path is required")
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err := run(ctx, e, args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// withBackend opens the backend for the duration of fn.
+func (e *env) withBackend(fn func(b backend) error) error {
+	b, err := e.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	return fn(b)
+}
+
+func parse(name string, args []string, define func(fs *flag.FlagSet)) []string {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	if define != nil {
+		define(fs)
+	}
+	_ = fs.Parse(args)
+
+	return fs.Args()
+}
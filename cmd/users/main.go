@@ -0,0 +1,226 @@
+// Command users imports users into the storage and exports them in bulk.
+//
+//	users import -storage-path ./storage/sso.db -file users.csv [-dry-run] [-report errors.csv]
+//	users export -storage-path ./storage/sso.db -file users.jsonl
+//
+// The format is taken from the file extension (.csv, .jsonl or .ndjson) unless
+// -format is given. "-" reads from stdin or writes to stdout.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/userio"
+	"github.com/KRYST4L614/auth_service/internal/services/bulk"
+	"github.com/KRYST4L614/auth_service/internal/storage/sqlite"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(ctx, log, os.Args[2:])
+	case "export":
+		err = runExport(ctx, log, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: users import|export -storage-path PATH -file PATH [flags]")
+}
+
+type commonFlags struct {
+	storagePath string
+	file        string
+	format      string
+	batchSize   int
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.storagePath, "storage-path", "", "Path to the storage")
+	fs.StringVar(&c.file, "file", "", `File to read or write, "-" for stdin or stdout`)
+	fs.StringVar(&c.format, "format", "", "csv or jsonl, taken from the file extension by default")
+	fs.IntVar(&c.batchSize, "batch-size", bulk.DefaultBatchSize, "Users per transaction or query")
+}
+
+func (c *commonFlags) validate() error {
+	if c.storagePath == "" {
+		return fmt.Errorf("storage-path is required")
+	}
+	if c.file == "" {
+		return fmt.Errorf("file is required")
+	}
+
+	if c.format == "" {
+		format, err := userio.FormatFromPath(c.file)
+		if err != nil {
+			return err
+		}
+		c.format = format
+	}
+
+	return nil
+}
+
+func (c *commonFlags) service(log *slog.Logger) (*bulk.Bulk, error) {
+	storage, err := sqlite.NewStorage(c.storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return bulk.New(log, storage, c.batchSize), nil
+}
+
+func runImport(ctx context.Context, log *slog.Logger, args []string) error {
+	var (
+		common     commonFlags
+		dryRun     bool
+		reportPath string
+	)
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	common.register(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "Validate and import in rolled back transactions")
+	fs.StringVar(&reportPath, "report", "", "Write rejected records to this CSV file")
+	_ = fs.Parse(args)
+
+	if err := common.validate(); err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if common.file != "-" {
+		f, err := os.Open(common.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	reader, err := userio.NewReader(in, common.format)
+	if err != nil {
+		return err
+	}
+
+	service, err := common.service(log)
+	if err != nil {
+		return err
+	}
+
+	report, importErr := service.Import(ctx, reader, dryRun)
+
+	if reportPath != "" {
+		if err := writeReport(reportPath, report); err != nil {
+			return err
+		}
+	} else {
+		for _, rowErr := range report.Errors {
+			fmt.Fprintln(os.Stderr, rowErr.Error())
+		}
+	}
+
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	fmt.Fprintf(os.Stderr, "processed %d, %s %d, rejected %d\n", report.Processed, verb, report.Imported, report.Failed)
+
+	if importErr != nil {
+		return importErr
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d records rejected", report.Failed)
+	}
+
+	return nil
+}
+
+func writeReport(path string, report bulk.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{"line", "email", "error"})
+	for _, rowErr := range report.Errors {
+		_ = w.Write([]string{strconv.Itoa(rowErr.Line), rowErr.Email, rowErr.Err.Error()})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func runExport(ctx context.Context, log *slog.Logger, args []string) error {
+	var common commonFlags
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	common.register(fs)
+	_ = fs.Parse(args)
+
+	if err := common.validate(); err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if common.file != "-" {
+		f, err := os.Create(common.file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	writer, err := userio.NewWriter(out, common.format)
+	if err != nil {
+		return err
+	}
+
+	service, err := common.service(log)
+	if err != nil {
+		return err
+	}
+
+	count, err := service.Export(ctx, writer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d users\n", count)
+
+	return nil
+}
@@ -1,33 +1,255 @@
 package app
 
 import (
+	"errors"
+	"expvar"
 	grpcapp "github.com/KRYST4L614/auth_service/internal/app/grpc"
+	httpapp "github.com/KRYST4L614/auth_service/internal/app/http"
+	metricsapp "github.com/KRYST4L614/auth_service/internal/app/metrics"
+	"github.com/KRYST4L614/auth_service/internal/config"
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/http/api"
+	oauthhttp "github.com/KRYST4L614/auth_service/internal/http/oauth"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/ldap"
+	"github.com/KRYST4L614/auth_service/internal/lib/mailer"
+	"github.com/KRYST4L614/auth_service/internal/lib/oidc"
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
 	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/federation"
+	"github.com/KRYST4L614/auth_service/internal/services/impersonation"
+	"github.com/KRYST4L614/auth_service/internal/services/invitations"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/KRYST4L614/auth_service/internal/services/org"
+	"github.com/KRYST4L614/auth_service/internal/services/pat"
+	"github.com/KRYST4L614/auth_service/internal/services/rbac"
 	"github.com/KRYST4L614/auth_service/internal/storage/sqlite"
+	"io/fs"
 	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
 	"time"
 )
 
 type App struct {
-	GRPCServer *grpcapp.App
+	GRPCServer    *grpcapp.App
+	HTTPServer    *httpapp.App
+	MetricsServer *metricsapp.App
+	authService   *auth.Auth
+	hasher        *auth.PasswordHasher
+	auditWriter   *rbac.AuditWriter
 }
 
 func NewApp(
 	log *slog.Logger,
-	grpcPort string,
-	storagePath string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
-	storage, err := sqlite.NewStorage(storagePath)
+	storage, err := sqlite.NewStorage(cfg.StoragePath)
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, storage, storage, tokenTTL)
+	mail := mailer.New(
+		log,
+		cfg.Mailer.Host,
+		cfg.Mailer.Port,
+		cfg.Mailer.Username,
+		cfg.Mailer.Password,
+		cfg.Mailer.From,
+		cfg.Mailer.Timeout,
+	)
 
-	grpcApp := grpcapp.NewApp(log, authService, grpcPort)
+	workers := cfg.Hashing.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	hasher := auth.NewPasswordHasher(workers, cfg.Hashing.QueueSize, cfg.Hashing.Cost)
+	expvar.Publish("password_hasher", hasher.Metrics())
+
+	signingKey := mustLoadSigningKey(log, cfg.OAuth)
+
+	authService := auth.New(log, storage, storage, storage, storage, mail, hasher, newDirectory(log, cfg.LDAP, storage),
+		signingKey, cfg.TokenTTl)
+
+	grpcApp := grpcapp.NewApp(log, authService, cfg.GRPC.Port)
+
+	var httpApp *httpapp.App
+	var auditWriter *rbac.AuditWriter
+	if cfg.HTTP.Port != "" {
+		oauthService := oauth.New(log, authService, storage, storage, storage, storage, storage, storage, signingKey, oauth.Config{
+			Issuer:             cfg.OAuth.Issuer,
+			CodeTTL:            cfg.OAuth.CodeTTL,
+			DeviceCodeTTL:      cfg.OAuth.DeviceCodeTTL,
+			DevicePollInterval: cfg.OAuth.DevicePollInterval,
+			ConsentTTL:         cfg.OAuth.ConsentTTL,
+			Registration:       cfg.OAuth.InitialAccessToken != "",
+		})
+		federationService := mustNewFederation(log, cfg, storage)
+
+		var registrationService oauthhttp.Registration
+		if cfg.OAuth.InitialAccessToken != "" {
+			registrationService = apps.NewRegistration(log, storage, storage, cfg.OAuth.InitialAccessToken,
+				strings.TrimSuffix(cfg.OAuth.Issuer, "/")+oauth.RegistrationPath, cfg.OAuth.RegistrableScopes)
+		}
+
+		auditWriter = rbac.NewAuditWriter(log, storage, cfg.Audit.QueueSize)
+
+		apiServices := api.Services{
+			Apps:     apps.New(log, storage, storage),
+			Consents: oauthService,
+			Impersonation: impersonation.New(log, storage, storage, storage, signingKey,
+				cfg.Impersonation.Enabled, cfg.Impersonation.TokenTTL),
+			Invitations: invitations.New(log, storage, storage, storage, storage, hasher, mail,
+				cfg.Invitations.TTL),
+			MFA:      authService,
+			Orgs:     org.New(log, storage, storage, mail, cfg.Organizations.InvitationTTL),
+			PAT:      pat.New(log, storage, storage, storage, signingKey, cfg.PAT.MaxTTL, cfg.TokenTTl, cfg.PAT.Scopes),
+			RBAC:     rbac.New(log, storage, storage, auditWriter),
+			Sessions: authService,
+			Users:    authService,
+		}
+
+		httpApp = httpapp.NewApp(log, oauthService, federationService, registrationService,
+			authService, cfg.HTTP.APIAppID, apiServices, cfg.HTTP.Port)
+	}
+
+	var metricsApp *metricsapp.App
+	if cfg.Metrics.Port != "" {
+		metricsApp = metricsapp.NewApp(log, cfg.Metrics.Port)
+	}
 
 	return &App{
-		GRPCServer: grpcApp,
+		GRPCServer:    grpcApp,
+		HTTPServer:    httpApp,
+		MetricsServer: metricsApp,
+		authService:   authService,
+		hasher:        hasher,
+		auditWriter:   auditWriter,
+	}
+}
+
+// mustLoadSigningKey reads the key tokens are signed with. A missing key is
+// only generated when the config asks for it, and then saved, so that the
+// tokens it signs still verify after a restart.
+func mustLoadSigningKey(log *slog.Logger, cfg config.OAuthConfig) *jwk.Key {
+	path := cfg.SigningKeyPath
+	if path == "" {
+		panic("oauth.signing_key_path is required")
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && cfg.GenerateSigningKey {
+		return mustGenerateSigningKey(log, path)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	key, err := jwk.Parse(raw)
+	if err != nil {
+		panic("failed to parse oauth signing key: " + err.Error())
+	}
+
+	return key
+}
+
+func mustGenerateSigningKey(log *slog.Logger, path string) *jwk.Key {
+	key, err := jwk.Generate()
+	if err != nil {
+		panic(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write(key.PEM()); err != nil {
+		panic(err)
+	}
+
+	log.Warn("generated a new oauth signing key", slog.String("path", path), slog.String("kid", key.ID))
+
+	return key
+}
+
+// newDirectory returns the LDAP backend of the auth service, nil if it isn't configured.
+func newDirectory(log *slog.Logger, cfg config.LDAPConfig, storage *sqlite.Storage) *auth.DirectoryBackend {
+	if cfg.URL == "" {
+		return nil
+	}
+
+	groupRoles := make(map[string][]entity.RoleRef)
+	for _, g := range cfg.GroupRoles {
+		role := entity.RoleRef{Name: g.Role, AppID: g.AppID}
+		if role.Admin() {
+			log.Warn("ldap groups can't grant the admin role, mapping ignored", slog.String("group", g.Group))
+			continue
+		}
+		groupRoles[g.Group] = append(groupRoles[g.Group], role)
+	}
+
+	return &auth.DirectoryBackend{
+		Directory: ldap.New(ldap.Config{
+			URL:            cfg.URL,
+			StartTLS:       cfg.StartTLS,
+			BindDN:         cfg.BindDN,
+			BindPassword:   cfg.BindPassword,
+			BaseDN:         cfg.BaseDN,
+			UserFilter:     cfg.UserFilter,
+			GroupAttribute: cfg.GroupAttribute,
+			Attributes:     cfg.Attributes,
+			Timeout:        cfg.Timeout,
+		}),
+		Storage:    storage,
+		Domains:    cfg.EmailDomains,
+		GroupRoles: groupRoles,
+	}
+}
+
+func mustNewFederation(log *slog.Logger, cfg *config.Config, storage *sqlite.Storage) *federation.Federation {
+	providers := make([]federation.ProviderConfig, 0, len(cfg.Federation.Providers))
+	for _, p := range cfg.Federation.Providers {
+		providers = append(providers, federation.ProviderConfig{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			OIDC: oidc.Config{
+				Issuer:       p.Issuer,
+				ClientID:     p.ClientID,
+				ClientSecret: p.ClientSecret,
+				RedirectURI:  strings.TrimSuffix(cfg.OAuth.Issuer, "/") + federation.CallbackPath,
+				Scopes:       p.Scopes,
+			},
+			CreateUsers: p.CreateUsers,
+			LinkByEmail: p.LinkByEmail,
+		})
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	federationService, err := federation.New(log, storage, storage, storage, providers, client, cfg.Federation.StateTTL)
+	if err != nil {
+		panic(err)
+	}
+
+	return federationService
+}
+
+// Stop stops the servers and then the background workers they use.
+func (a *App) Stop() {
+	a.GRPCServer.Stop()
+	if a.HTTPServer != nil {
+		a.HTTPServer.Stop()
+	}
+	if a.MetricsServer != nil {
+		a.MetricsServer.Stop()
+	}
+	a.authService.Stop()
+	a.hasher.Stop()
+	if a.auditWriter != nil {
+		a.auditWriter.Stop()
 	}
 }
@@ -3,6 +3,7 @@ package grpc
 import (
 	"fmt"
 	authgrpc "github.com/KRYST4L614/auth_service/internal/grpc/auth"
+	"github.com/KRYST4L614/auth_service/internal/grpc/interceptors"
 	"google.golang.org/grpc"
 	"log/slog"
 	"net"
@@ -19,7 +20,9 @@ func NewApp(
 	authService authgrpc.Auth,
 	port string,
 ) *App {
-	gRPCServer := grpc.NewServer()
+	gRPCServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors.ClientInfo()),
+	)
 	authgrpc.Register(gRPCServer, authService)
 	return &App{
 		log:        log,
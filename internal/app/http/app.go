@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/http/api"
+	oauthhttp "github.com/KRYST4L614/auth_service/internal/http/oauth"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       string
+}
+
+// NewApp returns a server for the HTTP endpoints of the OAuth authorization server,
+// and of the management API when it has the app its access tokens are issued to.
+func NewApp(
+	log *slog.Logger,
+	oauthService oauthhttp.OAuth,
+	federationService oauthhttp.Federation,
+	registrationService oauthhttp.Registration,
+	authenticator api.Authenticator,
+	apiAppId int,
+	apiServices api.Services,
+	port string,
+) *App {
+	mux := http.NewServeMux()
+	oauthhttp.Register(mux, log, oauthService, federationService, registrationService)
+	if apiAppId != 0 {
+		api.Register(mux, log, authenticator, apiAppId, apiServices)
+	}
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("port", a.port))
+
+	lis, err := net.Listen("tcp", ":"+a.port)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("http server started", slog.String("addr", lis.Addr().String()))
+
+	if err := a.httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(
+		slog.String("op", op)).Info("stopping http server")
+
+	_ = a.httpServer.Shutdown(context.Background())
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       string
+}
+
+// NewApp returns a server exposing published expvar metrics on /debug/vars.
+func NewApp(
+	log *slog.Logger,
+	port string,
+) *App {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &App{
+		log:        log,
+		httpServer: &http.Server{Handler: mux},
+		port:       port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "metricsapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.String("port", a.port))
+
+	lis, err := net.Listen("tcp", ":"+a.port)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("metrics server started", slog.String("addr", lis.Addr().String()))
+
+	if err := a.httpServer.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "metricsapp.Stop"
+
+	a.log.With(
+		slog.String("op", op)).Info("stopping metrics server")
+
+	_ = a.httpServer.Shutdown(context.Background())
+}
@@ -9,10 +9,22 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTl    time.Duration `yaml:"token_ttl" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
+	Env           string              `yaml:"env" env-default:"local"`
+	StoragePath   string              `yaml:"storage_path" env-required:"true"`
+	TokenTTl      time.Duration       `yaml:"token_ttl" env-required:"true"`
+	GRPC          GRPCConfig          `yaml:"grpc"`
+	HTTP          HTTPConfig          `yaml:"http"`
+	OAuth         OAuthConfig         `yaml:"oauth"`
+	Mailer        MailerConfig        `yaml:"mailer"`
+	Impersonation ImpersonationConfig `yaml:"impersonation"`
+	PAT           PATConfig           `yaml:"personal_access_tokens"`
+	Organizations OrganizationsConfig `yaml:"organizations"`
+	Invitations   InvitationsConfig   `yaml:"invitations"`
+	Audit         AuditConfig         `yaml:"audit"`
+	Hashing       HashingConfig       `yaml:"hashing"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Federation    FederationConfig    `yaml:"federation"`
+	LDAP          LDAPConfig          `yaml:"ldap"`
 }
 
 type GRPCConfig struct {
@@ -20,6 +32,138 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// HTTPConfig configures the HTTP server of the OAuth endpoints. They are not served when port is empty.
+type HTTPConfig struct {
+	Port string `yaml:"port"`
+	// APIAppID is the app whose access tokens the management API under /api/
+	// accepts. The API is not served when it is zero.
+	APIAppID int `yaml:"api_app_id"`
+}
+
+type OAuthConfig struct {
+	// Issuer is the public base URL of the HTTP server.
+	Issuer  string        `yaml:"issuer" env-default:"http://localhost:44046"`
+	CodeTTL time.Duration `yaml:"code_ttl" env-default:"1m"`
+	// DeviceCodeTTL is how long a user has to approve a device, and
+	// DevicePollInterval how often the device may poll in the meantime.
+	DeviceCodeTTL      time.Duration `yaml:"device_code_ttl" env-default:"10m"`
+	DevicePollInterval time.Duration `yaml:"device_poll_interval" env-default:"5s"`
+	// ConsentTTL is how long a user has to consent to a third-party app after logging in.
+	ConsentTTL time.Duration `yaml:"consent_ttl" env-default:"10m"`
+	// SigningKeyPath is a PEM RSA private key access and ID tokens are signed
+	// with. It is required: the server doesn't start without a key.
+	SigningKeyPath string `yaml:"signing_key_path"`
+	// GenerateSigningKey writes a new key to SigningKeyPath when there is no
+	// file there yet. It is meant for local runs; in production the key is
+	// provisioned, so that a missing file is an error rather than a new key
+	// that invalidates every token issued so far.
+	GenerateSigningKey bool `yaml:"generate_signing_key"`
+	// InitialAccessToken authorizes the registration of apps at /register by
+	// their owners. Dynamic client registration is disabled when empty.
+	InitialAccessToken string `yaml:"initial_access_token" env:"OAUTH_INITIAL_ACCESS_TOKEN"`
+	// RegistrableScopes are the client credentials scopes apps registered at
+	// /register may ask for. They can ask for none when empty.
+	RegistrableScopes []string `yaml:"registrable_scopes"`
+}
+
+// FederationConfig configures logging in with upstream OpenID Connect providers
+// on the login page. The providers redirect back to the issuer's
+// /federation/callback.
+type FederationConfig struct {
+	// StateTTL is how long a user has to log in at the provider.
+	StateTTL  time.Duration            `yaml:"state_ttl" env-default:"10m"`
+	Providers []UpstreamProviderConfig `yaml:"providers"`
+}
+
+type UpstreamProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities, it must not change.
+	Name         string   `yaml:"name"`
+	DisplayName  string   `yaml:"display_name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	// CreateUsers creates a local user at the first login with the provider.
+	CreateUsers bool `yaml:"create_users"`
+	// LinkByEmail links the first login to the user with the same email, if the
+	// provider verified it. Only enable it for providers trusted with emails.
+	LinkByEmail bool `yaml:"link_by_email"`
+}
+
+// LDAPConfig checks the passwords of the users of some email domains with an
+// LDAP directory, like Active Directory. It is disabled when url is empty.
+type LDAPConfig struct {
+	URL      string `yaml:"url"`
+	StartTLS bool   `yaml:"start_tls"`
+	// BindDN and BindPassword are the account users are searched with.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password" env:"LDAP_BIND_PASSWORD"`
+	BaseDN       string `yaml:"base_dn"`
+	// UserFilter finds a user by email, %s is replaced with the email.
+	UserFilter     string `yaml:"user_filter" env-default:"(mail=%s)"`
+	GroupAttribute string `yaml:"group_attribute" env-default:"memberOf"`
+	// Attributes are synced to the user at every login.
+	Attributes   []string        `yaml:"attributes"`
+	EmailDomains []string        `yaml:"email_domains"`
+	GroupRoles   []LDAPGroupRole `yaml:"group_roles"`
+	Timeout      time.Duration   `yaml:"timeout" env-default:"5s"`
+}
+
+// LDAPGroupRole grants the role to the members of the group.
+type LDAPGroupRole struct {
+	Group string `yaml:"group"`
+	Role  string `yaml:"role"`
+	AppID int    `yaml:"app_id"`
+}
+
+type ImpersonationConfig struct {
+	Enabled  bool          `yaml:"enabled" env-default:"false"`
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"15m"`
+}
+
+// AuditConfig bounds the permission check audit events waiting to be written.
+// Events that don't fit are dropped.
+type AuditConfig struct {
+	QueueSize int `yaml:"queue_size" env-default:"1024"`
+}
+
+// HashingConfig bounds the CPU spent on password hashing.
+// Zero workers means one worker per CPU.
+type HashingConfig struct {
+	Workers   int `yaml:"workers" env-default:"0"`
+	QueueSize int `yaml:"queue_size" env-default:"64"`
+	Cost      int `yaml:"cost" env-default:"10"`
+}
+
+// MetricsConfig configures the metrics endpoint. Metrics are not served when port is empty.
+type MetricsConfig struct {
+	Port string `yaml:"port"`
+}
+
+type PATConfig struct {
+	MaxTTL time.Duration `yaml:"max_ttl" env-default:"8760h"`
+	// Scopes are the scopes personal access tokens may carry. They can carry
+	// none when empty.
+	Scopes []string `yaml:"scopes"`
+}
+
+type OrganizationsConfig struct {
+	InvitationTTL time.Duration `yaml:"invitation_ttl" env-default:"168h"`
+}
+
+type InvitationsConfig struct {
+	TTL time.Duration `yaml:"ttl" env-default:"168h"`
+}
+
+type MailerConfig struct {
+	Host     string        `yaml:"host"`
+	Port     string        `yaml:"port" env-default:"25"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password" env:"MAILER_PASSWORD"`
+	From     string        `yaml:"from" env-default:"no-reply@sso.local"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
 func MustLoad() *Config {
 	path := fetchConfigPath()
 	if path == "" {
@@ -1,7 +1,102 @@
 package entity
 
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Methods a client can authenticate with at the token endpoint.
+const (
+	TokenAuthNone              = "none"
+	TokenAuthClientSecretBasic = "client_secret_basic"
+	TokenAuthClientSecretPost  = "client_secret_post"
+)
+
 type App struct {
-	ID     int
-	Name   string
-	Secret string
+	ID       int
+	Name     string
+	Secret   string
+	Settings AppSettings
+}
+
+// AppSettings are the per-app login and token policies. Zero durations and
+// empty lists fall back to the service-wide behavior.
+type AppSettings struct {
+	// AccessTokenTTL overrides the global token TTL when positive.
+	AccessTokenTTL time.Duration
+	// AllowRegistration lets users sign up on their own through the app.
+	AllowRegistration bool
+	// LoginMethods lists the authentication methods (amr values) the app accepts.
+	// Any method is accepted when empty.
+	LoginMethods []string
+	// RequiredACR is the minimal authentication context class for a login.
+	RequiredACR string
+	// AllowedEmailDomains restricts the users of the app by email domain.
+	// Any domain is allowed when empty.
+	AllowedEmailDomains []string
+	// ClientScopes lists the scopes the app may request for itself with the
+	// client credentials grant. The grant is disabled when empty.
+	ClientScopes []string
+	// UserScopes lists the scopes the app may request on behalf of its users
+	// with the authorization code and device code grants, besides the OpenID
+	// Connect scopes, which every app may request. Only those are allowed when empty.
+	UserScopes []string
+	// ClientPublicKey is the PEM public key the app signs its client assertions
+	// with, for private key JWT authentication. Only the secret is accepted when empty.
+	ClientPublicKey string
+	// TokenExchangeFrom lists the apps whose user tokens may be exchanged for
+	// tokens of this app. Tokens of other apps are never accepted when empty.
+	TokenExchangeFrom []int
+	// ThirdParty marks an app run by someone else. Users must consent before
+	// it gets tokens for them.
+	ThirdParty bool
+	// GrantTypes lists the OAuth grant types the app may use. Any grant is
+	// allowed when empty.
+	GrantTypes []string
+	// TokenAuthMethod is how the app authenticates at the token endpoint:
+	// TokenAuthNone for a public client, or one of the client secret methods,
+	// which are accepted alike. Any method is accepted when empty.
+	TokenAuthMethod string
+	// LoopbackAnyPort lets a native app redirect to an http loopback redirect URI
+	// on any port, since it listens on one the OS picks (RFC 8252, section 7.3).
+	// The rest of the URI must still match exactly.
+	LoopbackAnyPort bool
+}
+
+// AllowsMethod reports whether the app accepts the authentication method.
+func (s AppSettings) AllowsMethod(amr string) bool {
+	return len(s.LoginMethods) == 0 || slices.Contains(s.LoginMethods, amr)
+}
+
+// AllowsGrant reports whether the app may use the OAuth grant type.
+func (s AppSettings) AllowsGrant(grantType string) bool {
+	return len(s.GrantTypes) == 0 || slices.Contains(s.GrantTypes, grantType)
+}
+
+// AllowsEmail reports whether users with the email may use the app.
+func (s AppSettings) AllowsEmail(email string) bool {
+	if len(s.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+
+	for _, allowed := range s.AllowedEmailDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AcceptsTokensOf reports whether user tokens of the app with the given id may
+// be exchanged for tokens of this app. An app always accepts its own tokens.
+func (a App) AcceptsTokensOf(appId int) bool {
+	return appId == a.ID || slices.Contains(a.Settings.TokenExchangeFrom, appId)
 }
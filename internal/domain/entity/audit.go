@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+const (
+	AuditActionImpersonate    = "impersonate"
+	AuditActionGrantAdmin     = "admin.grant"
+	AuditActionRevokeAdmin    = "admin.revoke"
+	AuditActionCheck          = "permission.check"
+	AuditActionResetPassword  = "password.reset"
+	AuditActionRevokeSessions = "sessions.revoke"
+	AuditActionGrantRole      = "role.grant"
+	AuditActionJoinOrg        = "org.join"
+)
+
+type AuditEvent struct {
+	ID           int64
+	ActorID      int64
+	Action       string
+	TargetUserID int64
+	AppID        int
+	Details      string
+	CreatedAt    time.Time
+}
@@ -0,0 +1,108 @@
+package entity
+
+import "slices"
+
+// Authentication method references (RFC 8176).
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRHardwareKey = "hwk"
+	// AMRFederated means the user logged in at an upstream identity provider.
+	// It is not registered by RFC 8176 but is in common use.
+	AMRFederated = "fed"
+	// AMRPersonalAccessToken means the token was given for a personal access token.
+	AMRPersonalAccessToken = "pat"
+)
+
+// Authentication context class references.
+const (
+	ACRSingleFactor = "1"
+	ACRMultiFactor  = "2"
+	ACRHardwareKey  = "3"
+)
+
+// acrLevels ranks the context classes by strength. The values are opaque
+// strings to relying parties, so they are never compared as text.
+var acrLevels = map[string]int{
+	ACRSingleFactor: 1,
+	ACRMultiFactor:  2,
+	ACRHardwareKey:  3,
+}
+
+// Authentication factor classes: something the user knows, has or is.
+const (
+	factorKnowledge  = "knowledge"
+	factorPossession = "possession"
+	factorInherence  = "inherence"
+)
+
+// factorClasses maps the RFC 8176 methods to the factor class they prove.
+// Methods missing here, like fed, prove no factor of their own.
+var factorClasses = map[string]string{
+	AMRPassword:    factorKnowledge,
+	"pin":          factorKnowledge,
+	"kba":          factorKnowledge,
+	AMROTP:         factorPossession,
+	AMRHardwareKey: factorPossession,
+	"swk":          factorPossession,
+	"sms":          factorPossession,
+	"tel":          factorPossession,
+	"sc":           factorPossession,
+	"fpt":          factorInherence,
+	"face":         factorInherence,
+	"iris":         factorInherence,
+	"retina":       factorInherence,
+	"vbm":          factorInherence,
+}
+
+// issuableACRs are the context classes a login at this server can reach.
+// A password is a single factor, a password and a TOTP code are two; no
+// login uses a hardware key.
+var issuableACRs = []string{ACRSingleFactor, ACRMultiFactor}
+
+// ValidACR reports whether the context class is a known one.
+func ValidACR(acr string) bool {
+	_, ok := acrLevels[acr]
+	return ok
+}
+
+// IssuableACR reports whether some login at this server reaches the context class.
+func IssuableACR(acr string) bool {
+	return slices.Contains(issuableACRs, acr)
+}
+
+// ACRForMethods returns the context class achieved by the given authentication methods.
+// Multi-factor takes methods of at least two different factor classes: a password
+// and a PIN are still a single factor. The hardware key class is multi-factor
+// with a hardware key as one of the factors; a hardware key alone is a single factor.
+func ACRForMethods(amr []string) string {
+	classes := make(map[string]struct{}, len(amr))
+	for _, method := range amr {
+		if class, ok := factorClasses[method]; ok {
+			classes[class] = struct{}{}
+		}
+	}
+	if len(classes) < 2 {
+		return ACRSingleFactor
+	}
+	if slices.Contains(amr, AMRHardwareKey) {
+		return ACRHardwareKey
+	}
+
+	return ACRMultiFactor
+}
+
+// ACRSatisfies reports whether the achieved context class is at least as strong as the required one.
+// An empty requirement is always satisfied; an unknown one never is.
+func ACRSatisfies(achieved, required string) bool {
+	if required == "" {
+		return true
+	}
+
+	want, ok := acrLevels[required]
+	if !ok {
+		return false
+	}
+
+	return acrLevels[achieved] >= want
+}
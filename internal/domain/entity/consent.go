@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+// Consent records that a user let a third-party app access their data with
+// the scopes. It is created at the first approval and its scopes grow with the
+// later ones, until the user revokes it.
+type Consent struct {
+	UserID  int64
+	AppID   int
+	AppName string
+	Scopes  []string
+	// GrantID identifies the consent. The tokens issued under it carry it, so
+	// they are refused once it is revoked, even if the user consents again.
+	GrantID   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Covers reports whether the consent grants all the scopes.
+func (c Consent) Covers(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConsentRequest is an authorization request of a third-party app waiting for
+// the user, who already logged in, to consent. It is identified by a challenge
+// sent along the consent form.
+type ConsentRequest struct {
+	ID                  int64
+	ChallengeHash       []byte
+	AppID               int
+	UserID              int64
+	RedirectURI         string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	// AuthTime and AMR describe the login before the consent.
+	AuthTime  time.Time
+	AMR       []string
+	ExpiresAt time.Time
+}
+
+func (r ConsentRequest) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
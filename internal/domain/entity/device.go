@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+type Device struct {
+	ID          int64
+	UserID      int64
+	Fingerprint string
+	UserAgent   string
+	IPPrefix    string
+	CreatedAt   time.Time
+	LastSeenAt  time.Time
+}
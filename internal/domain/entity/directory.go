@@ -0,0 +1,23 @@
+package entity
+
+// DirectoryUser is a user as an LDAP directory describes them at login.
+type DirectoryUser struct {
+	// DN is the distinguished name of the user's entry.
+	DN    string
+	Email string
+	// Attributes are the synced attributes the entry has, by name.
+	Attributes map[string]string
+	// Groups are the DNs of the groups the user is a member of.
+	Groups []string
+}
+
+// RoleRef names a role by its name and app.
+type RoleRef struct {
+	Name  string
+	AppID int
+}
+
+// Admin reports whether the role is the global admin role.
+func (r RoleRef) Admin() bool {
+	return r.Name == RoleAdmin && r.AppID == GlobalAppID
+}
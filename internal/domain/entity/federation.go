@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// FederationState is a login in progress at an upstream identity provider. It
+// is looked up by the state parameter the provider sends back, and used once.
+type FederationState struct {
+	StateHash []byte
+	Provider  string
+	// Nonce and CodeVerifier bind the provider's answer to this login.
+	Nonce        string
+	CodeVerifier string
+	// Resume is what the login was started from, to be resumed once it succeeds.
+	Resume    string
+	ExpiresAt time.Time
+}
+
+func (s FederationState) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// FederatedIdentity links a user of an upstream identity provider, identified
+// by the provider's subject, to a local user.
+type FederatedIdentity struct {
+	ID       int64
+	Provider string
+	Subject  string
+	UserID   int64
+	// Email is the email the provider reported when the identity was linked.
+	Email     string
+	CreatedAt time.Time
+}
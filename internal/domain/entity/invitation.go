@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// Invitation lets a person who has no account yet sign up, optionally with
+// roles and an organization membership granted upfront.
+type Invitation struct {
+	ID         int64
+	Email      string
+	TokenHash  []byte
+	RoleIDs    []int64
+	OrgID      int64
+	OrgRole    string
+	InvitedBy  int64
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	AcceptedAt time.Time
+	RevokedAt  time.Time
+	UserID     int64
+}
+
+func (i Invitation) Accepted() bool {
+	return !i.AcceptedAt.IsZero()
+}
+
+func (i Invitation) Revoked() bool {
+	return !i.RevokedAt.IsZero()
+}
+
+func (i Invitation) Expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+// Pending reports whether the invitation can still be accepted.
+func (i Invitation) Pending(now time.Time) bool {
+	return !i.Accepted() && !i.Revoked() && !i.Expired(now)
+}
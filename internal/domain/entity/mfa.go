@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// TOTPFactor is the authenticator app of a user, a second factor proved with
+// time-based one-time codes. It counts only once confirmed with a code.
+type TOTPFactor struct {
+	UserID      int64
+	Secret      string
+	ConfirmedAt time.Time
+	// LastStep is the time step of the last code accepted. Codes of it and of
+	// earlier steps are refused, so a code can't be used twice.
+	LastStep int64
+}
+
+func (f TOTPFactor) Confirmed() bool {
+	return !f.ConfirmedAt.IsZero()
+}
@@ -0,0 +1,62 @@
+package entity
+
+import "time"
+
+// CodeChallengeS256 is the only PKCE code challenge method accepted: the
+// challenge is the unpadded base64url SHA-256 of the verifier.
+const CodeChallengeS256 = "S256"
+
+// AuthorizationCode is an OAuth authorization code. It is issued to the client
+// at its redirect URI and exchanged once for a token at the token endpoint.
+type AuthorizationCode struct {
+	ID                  int64
+	CodeHash            []byte
+	AppID               int
+	UserID              int64
+	RedirectURI         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is the OpenID Connect nonce of the request, echoed in the ID token.
+	Nonce string
+	// AuthTime and AMR describe the login the code was issued after.
+	AuthTime  time.Time
+	AMR       []string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+}
+
+func (c AuthorizationCode) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// Statuses of a device code.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is a pending OAuth device authorization (RFC 8628). The device
+// polls with the device code while the user approves or denies the user code
+// from another browser.
+type DeviceCode struct {
+	ID             int64
+	DeviceCodeHash []byte
+	UserCode       string
+	AppID          int
+	Scopes         []string
+	Status         string
+	// UserID, AuthTime and AMR are set once the user has approved or denied the code.
+	UserID   int64
+	AuthTime time.Time
+	AMR      []string
+	// PollInterval is the minimal time between two polls of the device.
+	PollInterval time.Duration
+	LastPolledAt time.Time
+	ExpiresAt    time.Time
+}
+
+func (c DeviceCode) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
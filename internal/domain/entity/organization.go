@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// Roles a user can have within an organization.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+type Organization struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+type Membership struct {
+	OrgID     int64
+	UserID    int64
+	Email     string
+	Role      string
+	CreatedAt time.Time
+}
+
+// CanManage reports whether the member can invite others and see the member list.
+func (m Membership) CanManage() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
+
+// ValidOrgRole reports whether the role can be given to an organization member.
+func ValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+type PersonalAccessToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Prefix     string
+	TokenHash  []byte
+	Scopes     []string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
+func (t PersonalAccessToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+func (t PersonalAccessToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// Active reports whether the token is still accepted, and so are the access
+// tokens given in exchange for it.
+func (t PersonalAccessToken) Active(now time.Time) bool {
+	return !t.Revoked() && !t.Expired(now)
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// ClientRegistration is what is kept about an app registered by its owner
+// through dynamic client registration, beyond the app itself.
+type ClientRegistration struct {
+	AppID int
+	// AccessTokenHash is the hash of the registration access token the owner
+	// manages the registration with.
+	AccessTokenHash []byte
+	LogoURI         string
+	Contacts        []string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
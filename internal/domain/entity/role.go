@@ -0,0 +1,35 @@
+package entity
+
+import "time"
+
+// RoleAdmin is the global role granting full administrative access.
+const RoleAdmin = "admin"
+
+// GlobalAppID is the app id of roles that apply to every app.
+const GlobalAppID = 0
+
+type Role struct {
+	ID          int64
+	Name        string
+	AppID       int
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+// Admin reports whether the role is the global admin role.
+func (r Role) Admin() bool {
+	return r.Name == RoleAdmin && r.AppID == GlobalAppID
+}
+
+type Permission struct {
+	ID          int64
+	Name        string
+	Description string
+}
+
+// PermissionCheck asks whether an action on a resource is allowed.
+type PermissionCheck struct {
+	Resource string
+	Action   string
+}
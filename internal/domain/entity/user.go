@@ -1,7 +1,66 @@
 package entity
 
+import "time"
+
+// Statuses a user account can be in.
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+)
+
+// Fields users can be sorted by in the user directory.
+const (
+	UserSortID        = "id"
+	UserSortEmail     = "email"
+	UserSortCreatedAt = "created_at"
+)
+
 type User struct {
-	ID       int64
-	Email    string
-	PassHash []byte
+	ID            int64
+	Email         string
+	PassHash      []byte
+	Status        string
+	EmailVerified bool
+	CreatedAt     time.Time
+	// SessionsRevokedAt is when the sessions of the user were last revoked.
+	SessionsRevokedAt time.Time
+}
+
+// TokenRevoked reports whether a token issued to the user at the time was
+// revoked since. Tokens carry whole seconds, so the ones issued within the
+// second of the revocation count as revoked too.
+func (u User) TokenRevoked(issuedAt time.Time) bool {
+	return !u.SessionsRevokedAt.IsZero() && !issuedAt.After(u.SessionsRevokedAt.Truncate(time.Second))
+}
+
+// UserRecord is a user as it is imported and exported in bulk.
+type UserRecord struct {
+	User
+	Admin bool
+}
+
+// UserFilter narrows down a user listing. Zero fields don't filter.
+type UserFilter struct {
+	EmailPrefix   string
+	Admin         *bool
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Status        string
+}
+
+// UserQuery describes a page of the user directory.
+//
+// After is the last user of the previous page; only its id and the field the
+// listing is sorted by are used. Users sorting equal are ordered by id.
+type UserQuery struct {
+	Filter UserFilter
+	SortBy string
+	Desc   bool
+	After  *User
+	Limit  int
+}
+
+// ValidUserStatus reports whether the status is a known user status.
+func ValidUserStatus(status string) bool {
+	return status == UserStatusActive || status == UserStatusDisabled
 }
@@ -8,16 +8,31 @@ import (
 	ssov1 "github.com/KRYST4L614/auth_service_protos/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"strconv"
+	"time"
 )
 
 const (
 	emptyInt = 0
+
+	acrValuesKey = "x-acr-values"
+	maxAgeKey    = "x-max-age"
+	orgIdKey     = "x-org-id"
+	appIdKey     = "x-app-id"
+	otpKey       = "x-otp"
 )
 
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appId int) (token string, err error)
-	Register(ctx context.Context, email string, password string) (userId int64, err error)
+	Login(
+		ctx context.Context,
+		email string,
+		password string,
+		appId int,
+		opts ...auth.LoginOption,
+	) (token string, err error)
+	Register(ctx context.Context, email string, password string, opts ...auth.RegisterOption) (userId int64, err error)
 	IsAdmin(ctx context.Context, userId int) (isAdmin bool, err error)
 }
 
@@ -35,11 +50,25 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*
 		return nil, err
 	}
 
-	userId, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword())
+	opts, err := registerOptionsFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword(), opts...)
 	if err != nil {
 		if errors.Is(err, auth.ErrUserExists) {
 			return nil, status.Errorf(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, auth.ErrDirectoryUser) {
+			return nil, status.Error(codes.PermissionDenied, "the email is managed by the directory")
+		}
+		if st := appPolicyStatus(err); st != nil {
+			return nil, st
+		}
+		if st := overloadStatus(err); st != nil {
+			return nil, st
+		}
 		return nil, status.Error(codes.Internal, "internal server error")
 	}
 
@@ -51,11 +80,28 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 		return nil, err
 	}
 
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	opts, err := loginOptionsFromMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()), opts...)
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
+		if errors.Is(err, auth.ErrStepUpRequired) {
+			return nil, status.Error(codes.PermissionDenied, "step-up authentication required")
+		}
+		if errors.Is(err, auth.ErrNotOrgMember) {
+			return nil, status.Error(codes.PermissionDenied, "not a member of the organization")
+		}
+		if st := appPolicyStatus(err); st != nil {
+			return nil, st
+		}
+		if st := overloadStatus(err); st != nil {
+			return nil, st
+		}
 		return nil, status.Errorf(codes.Internal, "internal error")
 	}
 
@@ -78,6 +124,96 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest) (*ss
 	return &ssov1.IsAdminResponse{IsAdmin: isAdmin}, nil
 }
 
+// overloadStatus maps errors caused by password hashing back pressure or an
+// unavailable directory, returns nil for any other error.
+func overloadStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrHasherOverloaded):
+		return status.Error(codes.ResourceExhausted, "server is overloaded, retry later")
+	case errors.Is(err, auth.ErrDirectoryUnavailable):
+		return status.Error(codes.Unavailable, "directory unavailable, retry later")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	}
+	return nil
+}
+
+// appPolicyStatus maps errors caused by app settings, returns nil for any other error.
+func appPolicyStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAppId):
+		return status.Error(codes.InvalidArgument, "invalid app id")
+	case errors.Is(err, auth.ErrRegistrationDisabled):
+		return status.Error(codes.PermissionDenied, "registration is disabled for this app")
+	case errors.Is(err, auth.ErrEmailDomainNotAllowed):
+		return status.Error(codes.PermissionDenied, "email domain is not allowed for this app")
+	case errors.Is(err, auth.ErrLoginMethodNotAllowed):
+		return status.Error(codes.PermissionDenied, "login method is not allowed for this app")
+	}
+	return nil
+}
+
+// registerOptionsFromMetadata reads the app the user registers through,
+// which RegisterRequest has no field for, from the request metadata.
+func registerOptionsFromMetadata(ctx context.Context) ([]auth.RegisterOption, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	var opts []auth.RegisterOption
+
+	if values := md.Get(appIdKey); len(values) > 0 && values[0] != "" {
+		appId, err := strconv.Atoi(values[0])
+		if err != nil || appId <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid app id")
+		}
+		opts = append(opts, auth.WithApp(appId))
+	}
+
+	return opts, nil
+}
+
+// loginOptionsFromMetadata reads the requested acr, max age (in seconds), organization
+// and the one-time code of the user's authenticator app, which LoginRequest has no
+// fields for, from the request metadata.
+func loginOptionsFromMetadata(ctx context.Context) ([]auth.LoginOption, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	var opts []auth.LoginOption
+
+	if values := md.Get(acrValuesKey); len(values) > 0 && values[0] != "" {
+		opts = append(opts, auth.WithACR(values[0]))
+	}
+
+	if values := md.Get(maxAgeKey); len(values) > 0 && values[0] != "" {
+		maxAge, err := strconv.Atoi(values[0])
+		if err != nil || maxAge < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid max age")
+		}
+		opts = append(opts, auth.WithMaxAge(time.Duration(maxAge)*time.Second))
+	}
+
+	if values := md.Get(orgIdKey); len(values) > 0 && values[0] != "" {
+		orgId, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil || orgId <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid org id")
+		}
+		opts = append(opts, auth.WithOrg(orgId))
+	}
+
+	if values := md.Get(otpKey); len(values) > 0 && values[0] != "" {
+		opts = append(opts, auth.WithOTP(values[0]))
+	}
+
+	return opts, nil
+}
+
 func validateLoginRequest(req *ssov1.LoginRequest) error {
 	if req.GetEmail() == "" {
 		return status.Error(codes.InvalidArgument, "email required")
@@ -0,0 +1,41 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/clientinfo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const userAgentKey = "user-agent"
+
+// ClientInfo puts the caller's user agent and IP address into the request context.
+func ClientInfo() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		var client clientinfo.ClientInfo
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(userAgentKey); len(values) > 0 {
+				client.UserAgent = values[0]
+			}
+		}
+
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			host, _, err := net.SplitHostPort(p.Addr.String())
+			if err != nil {
+				host = p.Addr.String()
+			}
+			client.IP = host
+		}
+
+		return handler(clientinfo.NewContext(ctx, client), req)
+	}
+}
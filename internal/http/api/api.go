@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+)
+
+//go:generate mockgen -destination=mock_api.go -package=api . Apps,Authenticator,Consents,Impersonation,Invitations,MFA,Orgs,PAT,RBAC,Sessions,Users
+
+// maxBodyBytes bounds the body of a request.
+const maxBodyBytes = 64 << 10
+
+type Authenticator interface {
+	AuthenticateToken(ctx context.Context, token string, appId int) (entity.User, error)
+	AuthenticateClient(ctx context.Context, token string) (entity.App, error)
+}
+
+// Services are the services behind the endpoints. The endpoints of a nil
+// service are not added.
+type Services struct {
+	Apps          Apps
+	Consents      Consents
+	Impersonation Impersonation
+	Invitations   Invitations
+	MFA           MFA
+	Orgs          Orgs
+	PAT           PAT
+	RBAC          RBAC
+	Sessions      Sessions
+	Users         Users
+}
+
+type handler struct {
+	log           *slog.Logger
+	authenticator Authenticator
+	appId         int
+	services      Services
+}
+
+// Register adds the endpoints of the management API to the mux. They take and
+// return JSON.
+//
+// Callers authenticate with an access token of the app as a bearer token,
+// except where a personal access token is exchanged, where an invitation is
+// accepted with its code, where a token of any app is switched to another
+// organization or stepped up with a second factor, and where apps ask for permission checks with their client
+// token. The services behind the endpoints decide what the user may do, e.g.
+// only admins can impersonate.
+func Register(mux *http.ServeMux, log *slog.Logger, authenticator Authenticator, appId int, services Services) {
+	h := &handler{log: log, authenticator: authenticator, appId: appId, services: services}
+
+	if services.Apps != nil {
+		mux.HandleFunc("POST /api/apps", h.authenticated(h.createApp))
+		mux.HandleFunc("GET /api/apps", h.authenticated(h.listApps))
+		mux.HandleFunc("GET /api/apps/{app_id}", h.authenticated(h.getApp))
+		mux.HandleFunc("PUT /api/apps/{app_id}", h.authenticated(h.updateApp))
+		mux.HandleFunc("DELETE /api/apps/{app_id}", h.authenticated(h.deleteApp))
+		mux.HandleFunc("POST /api/apps/{app_id}/secret", h.authenticated(h.rotateAppSecret))
+		mux.HandleFunc("GET /api/apps/{app_id}/redirect-uris", h.authenticated(h.redirectURIs))
+		mux.HandleFunc("PUT /api/apps/{app_id}/redirect-uris", h.authenticated(h.setRedirectURIs))
+		mux.HandleFunc("GET /api/apps/{app_id}/post-logout-redirect-uris", h.authenticated(h.postLogoutRedirectURIs))
+		mux.HandleFunc("PUT /api/apps/{app_id}/post-logout-redirect-uris", h.authenticated(h.setPostLogoutRedirectURIs))
+		mux.HandleFunc("GET /api/apps/{app_id}/web-origins", h.authenticated(h.webOrigins))
+		mux.HandleFunc("PUT /api/apps/{app_id}/web-origins", h.authenticated(h.setWebOrigins))
+	}
+	if services.Consents != nil {
+		mux.HandleFunc("GET /api/consents", h.authenticated(h.listConsents))
+		mux.HandleFunc("DELETE /api/consents/{app_id}", h.authenticated(h.revokeConsent))
+	}
+	if services.Impersonation != nil {
+		mux.HandleFunc("POST /api/users/{user_id}/impersonate", h.authenticated(h.impersonate))
+	}
+	if services.Invitations != nil {
+		mux.HandleFunc("POST /api/invitations", h.authenticated(h.createInvitation))
+		mux.HandleFunc("GET /api/invitations", h.authenticated(h.listInvitations))
+		mux.HandleFunc("DELETE /api/invitations/{invitation_id}", h.authenticated(h.revokeInvitation))
+		// The emailed code authorizes the sign up itself.
+		mux.HandleFunc("POST /api/invitations/accept", h.acceptInvitation)
+	}
+	if services.MFA != nil {
+		mux.HandleFunc("POST /api/mfa/totp", h.authenticated(h.enrollTOTP))
+		mux.HandleFunc("POST /api/mfa/totp/confirm", h.authenticated(h.confirmTOTP))
+		// The token being stepped up authorizes the step-up itself.
+		mux.HandleFunc("POST /api/mfa/verify", h.verifyMFA)
+	}
+	if services.Orgs != nil {
+		mux.HandleFunc("POST /api/orgs", h.authenticated(h.createOrg))
+		mux.HandleFunc("GET /api/orgs", h.authenticated(h.listOrgs))
+		mux.HandleFunc("GET /api/orgs/{org_id}/members", h.authenticated(h.listMembers))
+		mux.HandleFunc("POST /api/orgs/{org_id}/invitations", h.authenticated(h.invite))
+		mux.HandleFunc("POST /api/orgs/invitations/accept", h.authenticated(h.acceptOrgInvitation))
+	}
+	if services.Sessions != nil {
+		// The token being switched authorizes the switch itself.
+		mux.HandleFunc("POST /api/orgs/{org_id}/token", h.switchOrg)
+	}
+	if services.PAT != nil {
+		mux.HandleFunc("POST /api/tokens", h.authenticated(h.createToken))
+		mux.HandleFunc("GET /api/tokens", h.authenticated(h.listTokens))
+		mux.HandleFunc("DELETE /api/tokens/{token_id}", h.authenticated(h.revokeToken))
+		// The personal access token authorizes the exchange itself.
+		mux.HandleFunc("POST /api/tokens/exchange", h.exchangeToken)
+	}
+	if services.RBAC != nil {
+		mux.HandleFunc("POST /api/roles", h.authenticated(h.createRole))
+		mux.HandleFunc("GET /api/roles", h.authenticated(h.listRoles))
+		mux.HandleFunc("DELETE /api/roles/{role_id}", h.authenticated(h.deleteRole))
+		mux.HandleFunc("PUT /api/roles/{role_id}/permissions/{permission_id}", h.authenticated(h.grantPermission))
+		mux.HandleFunc("DELETE /api/roles/{role_id}/permissions/{permission_id}", h.authenticated(h.revokePermission))
+		mux.HandleFunc("POST /api/permissions", h.authenticated(h.createPermission))
+		mux.HandleFunc("GET /api/permissions", h.authenticated(h.listPermissions))
+		mux.HandleFunc("DELETE /api/permissions/{permission_id}", h.authenticated(h.deletePermission))
+		mux.HandleFunc("PUT /api/users/{user_id}/roles/{role_id}", h.authenticated(h.assignRole))
+		mux.HandleFunc("DELETE /api/users/{user_id}/roles/{role_id}", h.authenticated(h.unassignRole))
+		mux.HandleFunc("POST /api/permissions/check", h.client(h.checkPermission))
+		mux.HandleFunc("POST /api/permissions/checks", h.client(h.checkPermissions))
+	}
+	if services.Users != nil {
+		mux.HandleFunc("GET /api/users", h.authenticated(h.listUsers))
+		mux.HandleFunc("PUT /api/users/{user_id}/admin", h.authenticated(h.setAdmin))
+		mux.HandleFunc("DELETE /api/users/{user_id}/admin", h.authenticated(h.revokeAdmin))
+	}
+}
+
+// authenticated passes the user the request is authorized for to the endpoint.
+// Requests without a valid access token are refused (RFC 6750, section 3.1).
+func (h *handler) authenticated(next func(w http.ResponseWriter, r *http.Request, user entity.User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			// No error code when the request has no credentials.
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, http.StatusUnauthorized, "access token required")
+			return
+		}
+
+		user, err := h.authenticator.AuthenticateToken(r.Context(), token, h.appId)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "invalid access token")
+				return
+			}
+			h.serverError(w, "failed to authenticate request", err)
+			return
+		}
+
+		next(w, r, user)
+	}
+}
+
+// client passes the app the request is authorized for with a client token to
+// the endpoint. Requests without a valid client token are refused.
+func (h *handler) client(next func(w http.ResponseWriter, r *http.Request, app entity.App)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeError(w, http.StatusUnauthorized, "client token required")
+			return
+		}
+
+		app, err := h.authenticator.AuthenticateClient(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "invalid client token")
+				return
+			}
+			h.serverError(w, "failed to authenticate client", err)
+			return
+		}
+
+		next(w, r, app)
+	}
+}
+
+// serverError logs an unexpected error and hides it from the caller.
+func (h *handler) serverError(w http.ResponseWriter, msg string, err error) {
+	h.log.Error(msg, slog.Any("error", err))
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// readJSON decodes the body of the request into v. It answers the request and
+// returns false when the body is malformed.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "malformed json")
+		return false
+	}
+
+	return true
+}
+
+// pathID returns the id in the path segment of the name.
+func pathID(r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// bearerToken returns the bearer token the request is authorized with.
+func bearerToken(r *http.Request) string {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// optionalTime leaves a zero time out of the JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func writeNoContent(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	apiAppId = 1
+	token    = "access-token"
+)
+
+var (
+	admin = entity.User{ID: 1, Email: "admin@mail.com", Status: entity.UserStatusActive}
+	user  = entity.User{ID: 2, Email: "user@mail.com", Status: entity.UserStatusActive}
+)
+
+// serve sends the request to the endpoints of the services. The request is
+// authorized with the token unless it is empty.
+func serve(authenticator Authenticator, services Services, method string, target string, bearer string, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	Register(mux, slog.Default(), authenticator, apiAppId, services)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// authenticatedAs returns an authenticator the token is an access token of the user for.
+func authenticatedAs(ctrl *gomock.Controller, caller entity.User) *MockAuthenticator {
+	authenticator := NewMockAuthenticator(ctrl)
+	authenticator.EXPECT().AuthenticateToken(gomock.Any(), token, apiAppId).AnyTimes().Return(caller, nil)
+
+	return authenticator
+}
+
+func TestAPI_authenticated(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name          string
+		bearer        string
+		authenticate  func(context.Context, string, int) (entity.User, error)
+		wantStatus    int
+		wantChallenge string
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "authentication success test"),
+			bearer: token,
+			authenticate: func(context.Context, string, int) (entity.User, error) {
+				return admin, nil
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          fmt.Sprintf("%s: %s", prefixName, "authentication negative test: no token"),
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api"`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "authentication negative test: invalid token"),
+			bearer: "forged",
+			authenticate: func(context.Context, string, int) (entity.User, error) {
+				return entity.User{}, fmt.Errorf("auth.AuthenticateToken: %w", auth.ErrInvalidToken)
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api", error="invalid_token"`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "authentication negative test: storage failure"),
+			bearer: token,
+			authenticate: func(context.Context, string, int) (entity.User, error) {
+				return entity.User{}, errors.New("database is locked")
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			authenticator := NewMockAuthenticator(ctrl)
+			if tt.authenticate != nil {
+				authenticator.EXPECT().AuthenticateToken(gomock.Any(), tt.bearer, apiAppId).DoAndReturn(tt.authenticate)
+			}
+			impersonation := NewMockImpersonation(ctrl)
+			impersonation.EXPECT().Impersonate(gomock.Any(), admin.ID, user.ID, 3, "ticket 42").AnyTimes().Return("token", nil)
+
+			rec := serve(authenticator, Services{Impersonation: impersonation}, http.MethodPost,
+				"/api/users/2/impersonate", tt.bearer, `{"app_id": 3, "reason": "ticket 42"}`)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantChallenge, rec.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
+)
+
+type Apps interface {
+	CreateApp(ctx context.Context, adminId int64, app entity.App) (entity.App, error)
+	GetApp(ctx context.Context, adminId int64, appId int) (entity.App, error)
+	ListApps(ctx context.Context, adminId int64) ([]entity.App, error)
+	UpdateApp(ctx context.Context, adminId int64, app entity.App) error
+	DeleteApp(ctx context.Context, adminId int64, appId int) error
+	RotateAppSecret(ctx context.Context, adminId int64, appId int) (string, error)
+	RedirectURIs(ctx context.Context, adminId int64, appId int) ([]string, error)
+	SetRedirectURIs(ctx context.Context, adminId int64, appId int, uris []string) error
+	PostLogoutRedirectURIs(ctx context.Context, adminId int64, appId int) ([]string, error)
+	SetPostLogoutRedirectURIs(ctx context.Context, adminId int64, appId int, uris []string) error
+	WebOrigins(ctx context.Context, adminId int64, appId int) ([]string, error)
+	SetWebOrigins(ctx context.Context, adminId int64, appId int, origins []string) error
+}
+
+// appSettings are the settings of an app as the API takes and shows them.
+// Token lifetimes are in seconds.
+type appSettings struct {
+	AccessTokenTTL      int64    `json:"access_token_ttl,omitempty"`
+	AllowRegistration   bool     `json:"allow_registration"`
+	LoginMethods        []string `json:"login_methods,omitempty"`
+	RequiredACR         string   `json:"required_acr,omitempty"`
+	AllowedEmailDomains []string `json:"allowed_email_domains,omitempty"`
+	ClientScopes        []string `json:"client_scopes,omitempty"`
+	UserScopes          []string `json:"user_scopes,omitempty"`
+	ClientPublicKey     string   `json:"client_public_key,omitempty"`
+	TokenExchangeFrom   []int    `json:"token_exchange_from,omitempty"`
+	ThirdParty          bool     `json:"third_party"`
+	GrantTypes          []string `json:"grant_types,omitempty"`
+	TokenAuthMethod     string   `json:"token_auth_method,omitempty"`
+	LoopbackAnyPort     bool     `json:"loopback_any_port"`
+}
+
+type appRequest struct {
+	Name     string      `json:"name"`
+	Settings appSettings `json:"settings"`
+}
+
+// appView is an app as the API shows it. The secret is only shown when the app
+// is created.
+type appView struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name"`
+	Secret   string      `json:"secret,omitempty"`
+	Settings appSettings `json:"settings"`
+}
+
+type urisBody struct {
+	URIs []string `json:"uris"`
+}
+
+type originsBody struct {
+	Origins []string `json:"origins"`
+}
+
+func (s appSettings) entity() entity.AppSettings {
+	return entity.AppSettings{
+		AccessTokenTTL:      time.Duration(s.AccessTokenTTL) * time.Second,
+		AllowRegistration:   s.AllowRegistration,
+		LoginMethods:        s.LoginMethods,
+		RequiredACR:         s.RequiredACR,
+		AllowedEmailDomains: s.AllowedEmailDomains,
+		ClientScopes:        s.ClientScopes,
+		UserScopes:          s.UserScopes,
+		ClientPublicKey:     s.ClientPublicKey,
+		TokenExchangeFrom:   s.TokenExchangeFrom,
+		ThirdParty:          s.ThirdParty,
+		GrantTypes:          s.GrantTypes,
+		TokenAuthMethod:     s.TokenAuthMethod,
+		LoopbackAnyPort:     s.LoopbackAnyPort,
+	}
+}
+
+// newAppView leaves the secret out, see createApp.
+func newAppView(app entity.App) appView {
+	settings := app.Settings
+
+	return appView{
+		ID:   app.ID,
+		Name: app.Name,
+		Settings: appSettings{
+			AccessTokenTTL:      int64(settings.AccessTokenTTL / time.Second),
+			AllowRegistration:   settings.AllowRegistration,
+			LoginMethods:        settings.LoginMethods,
+			RequiredACR:         settings.RequiredACR,
+			AllowedEmailDomains: settings.AllowedEmailDomains,
+			ClientScopes:        settings.ClientScopes,
+			UserScopes:          settings.UserScopes,
+			ClientPublicKey:     settings.ClientPublicKey,
+			TokenExchangeFrom:   settings.TokenExchangeFrom,
+			ThirdParty:          settings.ThirdParty,
+			GrantTypes:          settings.GrantTypes,
+			TokenAuthMethod:     settings.TokenAuthMethod,
+			LoopbackAnyPort:     settings.LoopbackAnyPort,
+		},
+	}
+}
+
+// createApp registers an app. Its secret is in the response and can't be
+// read again, only rotated.
+func (h *handler) createApp(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req appRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	app, err := h.services.Apps.CreateApp(r.Context(), user.ID, entity.App{Name: req.Name, Settings: req.Settings.entity()})
+	if err != nil {
+		h.writeAppsError(w, "failed to create app", err)
+		return
+	}
+
+	view := newAppView(app)
+	view.Secret = app.Secret
+
+	writeJSON(w, http.StatusCreated, view)
+}
+
+func (h *handler) listApps(w http.ResponseWriter, r *http.Request, user entity.User) {
+	list, err := h.services.Apps.ListApps(r.Context(), user.ID)
+	if err != nil {
+		h.writeAppsError(w, "failed to list apps", err)
+		return
+	}
+
+	views := make([]appView, 0, len(list))
+	for _, app := range list {
+		views = append(views, newAppView(app))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"apps": views})
+}
+
+func (h *handler) getApp(w http.ResponseWriter, r *http.Request, user entity.User) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	app, err := h.services.Apps.GetApp(r.Context(), user.ID, appId)
+	if err != nil {
+		h.writeAppsError(w, "failed to get app", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAppView(app))
+}
+
+// updateApp replaces the name and settings of the app.
+func (h *handler) updateApp(w http.ResponseWriter, r *http.Request, user entity.User) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	var req appRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	app := entity.App{ID: appId, Name: req.Name, Settings: req.Settings.entity()}
+	if err := h.services.Apps.UpdateApp(r.Context(), user.ID, app); err != nil {
+		h.writeAppsError(w, "failed to update app", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (h *handler) deleteApp(w http.ResponseWriter, r *http.Request, user entity.User) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Apps.DeleteApp(r.Context(), user.ID, appId); err != nil {
+		h.writeAppsError(w, "failed to delete app", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// rotateAppSecret replaces the secret of the app and returns the new one.
+func (h *handler) rotateAppSecret(w http.ResponseWriter, r *http.Request, user entity.User) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := h.services.Apps.RotateAppSecret(r.Context(), user.ID, appId)
+	if err != nil {
+		h.writeAppsError(w, "failed to rotate app secret", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"secret": secret})
+}
+
+func (h *handler) redirectURIs(w http.ResponseWriter, r *http.Request, user entity.User) {
+	h.getList(w, r, user, "failed to get redirect uris", h.services.Apps.RedirectURIs, func(uris []string) any {
+		return urisBody{URIs: uris}
+	})
+}
+
+func (h *handler) setRedirectURIs(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req urisBody
+	h.setList(w, r, user, &req, "failed to set redirect uris", func(ctx context.Context, adminId int64, appId int) error {
+		return h.services.Apps.SetRedirectURIs(ctx, adminId, appId, req.URIs)
+	})
+}
+
+func (h *handler) postLogoutRedirectURIs(w http.ResponseWriter, r *http.Request, user entity.User) {
+	h.getList(w, r, user, "failed to get post logout redirect uris", h.services.Apps.PostLogoutRedirectURIs, func(uris []string) any {
+		return urisBody{URIs: uris}
+	})
+}
+
+func (h *handler) setPostLogoutRedirectURIs(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req urisBody
+	h.setList(w, r, user, &req, "failed to set post logout redirect uris", func(ctx context.Context, adminId int64, appId int) error {
+		return h.services.Apps.SetPostLogoutRedirectURIs(ctx, adminId, appId, req.URIs)
+	})
+}
+
+func (h *handler) webOrigins(w http.ResponseWriter, r *http.Request, user entity.User) {
+	h.getList(w, r, user, "failed to get web origins", h.services.Apps.WebOrigins, func(origins []string) any {
+		return originsBody{Origins: origins}
+	})
+}
+
+func (h *handler) setWebOrigins(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req originsBody
+	h.setList(w, r, user, &req, "failed to set web origins", func(ctx context.Context, adminId int64, appId int) error {
+		return h.services.Apps.SetWebOrigins(ctx, adminId, appId, req.Origins)
+	})
+}
+
+// getList answers with one of the lists registered for the app.
+func (h *handler) getList(
+	w http.ResponseWriter,
+	r *http.Request,
+	user entity.User,
+	msg string,
+	get func(ctx context.Context, adminId int64, appId int) ([]string, error),
+	body func([]string) any,
+) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := get(r.Context(), user.ID, appId)
+	if err != nil {
+		h.writeAppsError(w, msg, err)
+		return
+	}
+	if list == nil {
+		list = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, body(list))
+}
+
+// setList replaces one of the lists registered for the app with the one in
+// the body of the request, which is decoded into req.
+func (h *handler) setList(
+	w http.ResponseWriter,
+	r *http.Request,
+	user entity.User,
+	req any,
+	msg string,
+	set func(ctx context.Context, adminId int64, appId int) error,
+) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	if !readJSON(w, r, req) {
+		return
+	}
+
+	if err := set(r.Context(), user.ID, appId); err != nil {
+		h.writeAppsError(w, msg, err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// pathAppID returns the app id in the path. It answers the request and returns
+// false when the id is malformed.
+func pathAppID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	appId, err := strconv.Atoi(r.PathValue("app_id"))
+	if err != nil || appId <= 0 {
+		writeError(w, http.StatusNotFound, "app not found")
+		return 0, false
+	}
+
+	return appId, true
+}
+
+func (h *handler) writeAppsError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, apps.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, apps.ErrInvalidName):
+		writeError(w, http.StatusBadRequest, "app name required")
+	case errors.Is(err, apps.ErrInvalidSettings):
+		writeError(w, http.StatusBadRequest, validationError(err, apps.ErrInvalidSettings))
+	case errors.Is(err, apps.ErrInvalidURI):
+		writeError(w, http.StatusBadRequest, validationError(err, apps.ErrInvalidURI))
+	case errors.Is(err, apps.ErrInvalidOrigin):
+		writeError(w, http.StatusBadRequest, validationError(err, apps.ErrInvalidOrigin))
+	case errors.Is(err, apps.ErrAppExists):
+		writeError(w, http.StatusConflict, "app already exists")
+	case errors.Is(err, apps.ErrAppNotFound):
+		writeError(w, http.StatusNotFound, "app not found")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
+
+// validationError returns the message of the validation error without the
+// operations it was wrapped in, e.g. "invalid web origin: "http://a.com/" must
+// not have a path, query or fragment".
+func validationError(err error, sentinel error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, sentinel.Error()); i >= 0 {
+		return msg[i:]
+	}
+
+	return sentinel.Error()
+}
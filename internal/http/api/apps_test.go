@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_apps(t *testing.T) {
+	prefixName := "management api"
+	app := entity.App{
+		ID:     3,
+		Name:   "orders",
+		Secret: "secret",
+		Settings: entity.AppSettings{
+			AccessTokenTTL: 15 * time.Minute,
+			GrantTypes:     []string{"authorization_code"},
+			ThirdParty:     true,
+		},
+	}
+	type test struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		prepare    func(m *MockApps)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create app success test"),
+			method: http.MethodPost,
+			target: "/api/apps",
+			body:   `{"name": "orders", "settings": {"access_token_ttl": 900, "grant_types": ["authorization_code"], "third_party": true}}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().CreateApp(gomock.Any(), admin.ID, entity.App{Name: "orders", Settings: app.Settings}).Return(app, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(3), body["id"])
+				assert.Equal(t, "secret", body["secret"])
+				assert.Equal(t, float64(900), body["settings"].(map[string]any)["access_token_ttl"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create app negative test: invalid settings"),
+			method: http.MethodPost,
+			target: "/api/apps",
+			body:   `{"name": "orders", "settings": {"required_acr": "gold"}}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().CreateApp(gomock.Any(), admin.ID, entity.App{Name: "orders", Settings: entity.AppSettings{RequiredACR: "gold"}}).
+					Return(entity.App{}, fmt.Errorf("apps.CreateApp: %w", fmt.Errorf("%w: unknown acr %q", apps.ErrInvalidSettings, "gold")))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, `invalid app settings: unknown acr "gold"`, body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create app negative test: not an admin"),
+			method: http.MethodPost,
+			target: "/api/apps",
+			body:   `{"name": "orders"}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().CreateApp(gomock.Any(), admin.ID, entity.App{Name: "orders"}).
+					Return(entity.App{}, fmt.Errorf("apps.CreateApp: %w", apps.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "get app success test"),
+			method: http.MethodGet,
+			target: "/api/apps/3",
+			prepare: func(m *MockApps) {
+				// The service never returns the secret here, the handler doesn't rely on it.
+				m.EXPECT().GetApp(gomock.Any(), admin.ID, 3).Return(app, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "orders", body["name"])
+				assert.NotContains(t, body, "secret")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list apps success test"),
+			method: http.MethodGet,
+			target: "/api/apps",
+			prepare: func(m *MockApps) {
+				m.EXPECT().ListApps(gomock.Any(), admin.ID).Return([]entity.App{app}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["apps"], 1)
+				assert.NotContains(t, body["apps"].([]any)[0], "secret")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "update app negative test: unknown app"),
+			method: http.MethodPut,
+			target: "/api/apps/9",
+			body:   `{"name": "orders"}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().UpdateApp(gomock.Any(), admin.ID, entity.App{ID: 9, Name: "orders"}).
+					Return(fmt.Errorf("apps.UpdateApp: %w", apps.ErrAppNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "delete app success test"),
+			method: http.MethodDelete,
+			target: "/api/apps/3",
+			prepare: func(m *MockApps) {
+				m.EXPECT().DeleteApp(gomock.Any(), admin.ID, 3).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "rotate app secret success test"),
+			method: http.MethodPost,
+			target: "/api/apps/3/secret",
+			prepare: func(m *MockApps) {
+				m.EXPECT().RotateAppSecret(gomock.Any(), admin.ID, 3).Return("rotated", nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "rotated", body["secret"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "redirect uris success test"),
+			method: http.MethodGet,
+			target: "/api/apps/3/redirect-uris",
+			prepare: func(m *MockApps) {
+				m.EXPECT().RedirectURIs(gomock.Any(), admin.ID, 3).Return(nil, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, []any{}, body["uris"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set redirect uris negative test: invalid uri"),
+			method: http.MethodPut,
+			target: "/api/apps/3/redirect-uris",
+			body:   `{"uris": ["http://example.com/callback"]}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().SetRedirectURIs(gomock.Any(), admin.ID, 3, []string{"http://example.com/callback"}).
+					Return(fmt.Errorf("apps.SetRedirectURIs: %w", apps.ErrInvalidURI))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set post logout redirect uris success test"),
+			method: http.MethodPut,
+			target: "/api/apps/3/post-logout-redirect-uris",
+			body:   `{"uris": ["https://orders.example.com/"]}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().SetPostLogoutRedirectURIs(gomock.Any(), admin.ID, 3, []string{"https://orders.example.com/"}).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "web origins success test"),
+			method: http.MethodGet,
+			target: "/api/apps/3/web-origins",
+			prepare: func(m *MockApps) {
+				m.EXPECT().WebOrigins(gomock.Any(), admin.ID, 3).Return([]string{"https://orders.example.com"}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, []any{"https://orders.example.com"}, body["origins"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: origin with a path"),
+			method: http.MethodPut,
+			target: "/api/apps/3/web-origins",
+			body:   `{"origins": ["https://orders.example.com/"]}`,
+			prepare: func(m *MockApps) {
+				m.EXPECT().SetWebOrigins(gomock.Any(), admin.ID, 3, []string{"https://orders.example.com/"}).
+					Return(fmt.Errorf("apps.SetWebOrigins: %w", apps.ErrInvalidOrigin))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: malformed app id"),
+			method:     http.MethodPut,
+			target:     "/api/apps/orders/web-origins",
+			body:       `{"origins": []}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockApps(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{Apps: service}, tt.method, tt.target, token, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
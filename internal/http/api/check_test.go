@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/rbac"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_checkPermission(t *testing.T) {
+	prefixName := "management api"
+	app := entity.App{ID: 3, Name: "orders"}
+	type test struct {
+		name       string
+		target     string
+		bearer     string
+		body       string
+		prepare    func(m *MockRBAC)
+		wantStatus int
+		wantBody   string
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "check permission success test"),
+			target: "/api/permissions/check",
+			bearer: "client-token",
+			body:   `{"user_id": 2, "resource": "orders/42", "action": "read"}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CheckPermission(gomock.Any(), int64(0), user.ID, app.ID, "orders/42", "read").Return(true, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"allowed": true}`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "check permissions success test"),
+			target: "/api/permissions/checks",
+			bearer: "client-token",
+			body:   `{"user_id": 2, "checks": [{"resource": "orders/42", "action": "read"}, {"resource": "orders/42", "action": "delete"}]}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CheckPermissions(gomock.Any(), int64(0), user.ID, app.ID, []entity.PermissionCheck{
+					{Resource: "orders/42", Action: "read"},
+					{Resource: "orders/42", Action: "delete"},
+				}).Return([]bool{true, false}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"allowed": [true, false]}`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "check permission negative test: no action"),
+			target: "/api/permissions/check",
+			bearer: "client-token",
+			body:   `{"user_id": 2, "resource": "orders/42"}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CheckPermission(gomock.Any(), int64(0), user.ID, app.ID, "orders/42", "").
+					Return(false, fmt.Errorf("rbac.CheckPermission: %w", rbac.ErrInvalidCheck))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "check permission negative test: user token"),
+			target:     "/api/permissions/check",
+			bearer:     token,
+			body:       `{"user_id": 2, "resource": "orders/42", "action": "read"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "check permissions negative test: no token"),
+			target:     "/api/permissions/checks",
+			body:       `{"user_id": 2, "checks": []}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			authenticator := NewMockAuthenticator(ctrl)
+			authenticator.EXPECT().AuthenticateClient(gomock.Any(), "client-token").AnyTimes().Return(app, nil)
+			authenticator.EXPECT().AuthenticateClient(gomock.Any(), token).AnyTimes().
+				Return(entity.App{}, fmt.Errorf("auth.AuthenticateClient: %w", auth.ErrInvalidToken))
+			service := NewMockRBAC(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticator, Services{RBAC: service}, http.MethodPost, tt.target, tt.bearer, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rec.Body.String())
+			} else {
+				var body map[string]string
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.NotEmpty(t, body["error"])
+			}
+		})
+	}
+}
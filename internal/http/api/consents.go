@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+)
+
+type Consents interface {
+	ListConsents(ctx context.Context, userId int64) ([]entity.Consent, error)
+	RevokeConsent(ctx context.Context, userId int64, appId int) error
+}
+
+// consentView is a consent as the API shows it. The grant id stays internal.
+type consentView struct {
+	AppID     int       `json:"app_id"`
+	AppName   string    `json:"app_name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// listConsents lists the third-party apps the user consented to.
+func (h *handler) listConsents(w http.ResponseWriter, r *http.Request, user entity.User) {
+	consents, err := h.services.Consents.ListConsents(r.Context(), user.ID)
+	if err != nil {
+		h.serverError(w, "failed to list consents", err)
+		return
+	}
+
+	views := make([]consentView, 0, len(consents))
+	for _, consent := range consents {
+		scopes := consent.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		views = append(views, consentView{
+			AppID:     consent.AppID,
+			AppName:   consent.AppName,
+			Scopes:    scopes,
+			CreatedAt: consent.CreatedAt,
+			UpdatedAt: consent.UpdatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"consents": views})
+}
+
+// revokeConsent withdraws the consent of the user to the app. The tokens
+// issued under it are inactive at introspection from then on.
+func (h *handler) revokeConsent(w http.ResponseWriter, r *http.Request, user entity.User) {
+	appId, ok := pathAppID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.Consents.RevokeConsent(r.Context(), user.ID, appId); err != nil {
+		if errors.Is(err, oauth.ErrConsentNotFound) {
+			writeError(w, http.StatusNotFound, "consent not found")
+			return
+		}
+		h.serverError(w, "failed to revoke consent", err)
+		return
+	}
+
+	writeNoContent(w)
+}
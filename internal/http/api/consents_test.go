@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_consents(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name       string
+		method     string
+		target     string
+		prepare    func(m *MockConsents)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list consents success test"),
+			method: http.MethodGet,
+			target: "/api/consents",
+			prepare: func(m *MockConsents) {
+				m.EXPECT().ListConsents(gomock.Any(), user.ID).Return([]entity.Consent{
+					{UserID: user.ID, AppID: 3, AppName: "calendar", Scopes: []string{"openid", "email"}, GrantID: "grant"},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				consents := body["consents"].([]any)
+				assert.Len(t, consents, 1)
+				assert.Equal(t, "calendar", consents[0].(map[string]any)["app_name"])
+				assert.NotContains(t, consents[0], "grant_id")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list consents success test: no consents"),
+			method: http.MethodGet,
+			target: "/api/consents",
+			prepare: func(m *MockConsents) {
+				m.EXPECT().ListConsents(gomock.Any(), user.ID).Return(nil, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, []any{}, body["consents"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke consent success test"),
+			method: http.MethodDelete,
+			target: "/api/consents/3",
+			prepare: func(m *MockConsents) {
+				m.EXPECT().RevokeConsent(gomock.Any(), user.ID, 3).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke consent negative test: no consent"),
+			method: http.MethodDelete,
+			target: "/api/consents/4",
+			prepare: func(m *MockConsents) {
+				m.EXPECT().RevokeConsent(gomock.Any(), user.ID, 4).Return(fmt.Errorf("oauth.RevokeConsent: %w", oauth.ErrConsentNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "revoke consent negative test: malformed app id"),
+			method:     http.MethodDelete,
+			target:     "/api/consents/calendar",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockConsents(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, user), Services{Consents: service}, tt.method, tt.target, token, "")
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
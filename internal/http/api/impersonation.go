@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/impersonation"
+)
+
+type Impersonation interface {
+	Impersonate(ctx context.Context, adminId int64, targetUserId int64, appId int, reason string) (string, error)
+}
+
+type impersonateRequest struct {
+	AppID  int    `json:"app_id"`
+	Reason string `json:"reason"`
+}
+
+// impersonate issues an admin a token to use the app as the user, e.g. to see
+// what a customer sees.
+func (h *handler) impersonate(w http.ResponseWriter, r *http.Request, user entity.User) {
+	userId, ok := pathID(r, "user_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	var req impersonateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.services.Impersonation.Impersonate(r.Context(), user.ID, userId, req.AppID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, impersonation.ErrDisabled):
+			writeError(w, http.StatusForbidden, "impersonation is disabled")
+		case errors.Is(err, impersonation.ErrPermissionDenied):
+			writeError(w, http.StatusForbidden, "permission denied")
+		case errors.Is(err, impersonation.ErrReasonRequired):
+			writeError(w, http.StatusBadRequest, "reason required")
+		case errors.Is(err, impersonation.ErrInvalidAppId):
+			writeError(w, http.StatusBadRequest, "invalid app id")
+		case errors.Is(err, impersonation.ErrUserDisabled):
+			writeError(w, http.StatusConflict, "user is disabled")
+		case errors.Is(err, impersonation.ErrUserNotFound):
+			writeError(w, http.StatusNotFound, "user not found")
+		default:
+			h.serverError(w, "failed to impersonate user", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "token_type": "Bearer"})
+}
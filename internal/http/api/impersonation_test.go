@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/services/impersonation"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_impersonate(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name       string
+		target     string
+		body       string
+		prepare    func(m *MockImpersonation)
+		wantStatus int
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "impersonate success test"),
+			target: "/api/users/2/impersonate",
+			body:   `{"app_id": 3, "reason": "ticket 42"}`,
+			prepare: func(m *MockImpersonation) {
+				m.EXPECT().Impersonate(gomock.Any(), admin.ID, user.ID, 3, "ticket 42").Return("impersonation-token", nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: disabled"),
+			target: "/api/users/2/impersonate",
+			body:   `{"app_id": 3, "reason": "ticket 42"}`,
+			prepare: func(m *MockImpersonation) {
+				m.EXPECT().Impersonate(gomock.Any(), admin.ID, user.ID, 3, "ticket 42").
+					Return("", fmt.Errorf("impersonation.Impersonate: %w", impersonation.ErrDisabled))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: not an admin"),
+			target: "/api/users/2/impersonate",
+			body:   `{"app_id": 3, "reason": "ticket 42"}`,
+			prepare: func(m *MockImpersonation) {
+				m.EXPECT().Impersonate(gomock.Any(), admin.ID, user.ID, 3, "ticket 42").
+					Return("", fmt.Errorf("impersonation.Impersonate: %w", impersonation.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: no reason"),
+			target: "/api/users/2/impersonate",
+			body:   `{"app_id": 3}`,
+			prepare: func(m *MockImpersonation) {
+				m.EXPECT().Impersonate(gomock.Any(), admin.ID, user.ID, 3, "").
+					Return("", fmt.Errorf("impersonation.Impersonate: %w", impersonation.ErrReasonRequired))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: unknown user"),
+			target: "/api/users/9/impersonate",
+			body:   `{"app_id": 3, "reason": "ticket 42"}`,
+			prepare: func(m *MockImpersonation) {
+				m.EXPECT().Impersonate(gomock.Any(), admin.ID, int64(9), 3, "ticket 42").
+					Return("", fmt.Errorf("impersonation.Impersonate: %w", impersonation.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: malformed user id"),
+			target:     "/api/users/me/impersonate",
+			body:       `{"app_id": 3, "reason": "ticket 42"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: malformed json"),
+			target:     "/api/users/2/impersonate",
+			body:       `{"app_id": "3"`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockImpersonation(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{Impersonation: service}, http.MethodPost,
+				tt.target, token, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			var body map[string]string
+			assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "impersonation-token", body["access_token"])
+				assert.Equal(t, "Bearer", body["token_type"])
+			} else {
+				assert.NotEmpty(t, body["error"])
+			}
+		})
+	}
+}
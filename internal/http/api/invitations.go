@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/invitations"
+)
+
+type Invitations interface {
+	CreateInvitation(ctx context.Context, adminId int64, invitation entity.Invitation, ttl time.Duration) (entity.Invitation, error)
+	AcceptInvitation(ctx context.Context, token string, password string) (int64, error)
+	ListInvitations(ctx context.Context, adminId int64) ([]entity.Invitation, error)
+	RevokeInvitation(ctx context.Context, adminId int64, invitationId int64) error
+}
+
+// createInvitationRequest invites to sign up. ExpiresIn is in seconds, zero
+// means the configured default.
+type createInvitationRequest struct {
+	Email     string  `json:"email"`
+	RoleIDs   []int64 `json:"role_ids"`
+	OrgID     int64   `json:"org_id"`
+	OrgRole   string  `json:"org_role"`
+	ExpiresIn int64   `json:"expires_in"`
+}
+
+type acceptInvitationRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// createInvitation emails an invitation to sign up. Only admins can invite.
+func (h *handler) createInvitation(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req createInvitationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	invitation := entity.Invitation{Email: req.Email, RoleIDs: req.RoleIDs, OrgID: req.OrgID, OrgRole: req.OrgRole}
+	ttl := time.Duration(req.ExpiresIn) * time.Second
+
+	invitation, err := h.services.Invitations.CreateInvitation(r.Context(), user.ID, invitation, ttl)
+	if err != nil {
+		h.writeInvitationsError(w, "failed to create invitation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newInvitationView(invitation))
+}
+
+func (h *handler) listInvitations(w http.ResponseWriter, r *http.Request, user entity.User) {
+	list, err := h.services.Invitations.ListInvitations(r.Context(), user.ID)
+	if err != nil {
+		h.writeInvitationsError(w, "failed to list invitations", err)
+		return
+	}
+
+	views := make([]invitationView, 0, len(list))
+	for _, invitation := range list {
+		views = append(views, newInvitationView(invitation))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"invitations": views})
+}
+
+func (h *handler) revokeInvitation(w http.ResponseWriter, r *http.Request, user entity.User) {
+	invitationId, ok := pathID(r, "invitation_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "invitation not found")
+		return
+	}
+
+	if err := h.services.Invitations.RevokeInvitation(r.Context(), user.ID, invitationId); err != nil {
+		h.writeInvitationsError(w, "failed to revoke invitation", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// acceptInvitation signs the invited person up with the emailed code. The
+// code authorizes the request, the person has no account to authenticate with.
+func (h *handler) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req acceptInvitationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	userId, err := h.services.Invitations.AcceptInvitation(r.Context(), req.Code, req.Password)
+	if err != nil {
+		h.writeInvitationsError(w, "failed to accept invitation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]int64{"user_id": userId})
+}
+
+func (h *handler) writeInvitationsError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, invitations.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, invitations.ErrAdminRole):
+		writeError(w, http.StatusForbidden, "the admin role can't be granted by invitation")
+	case errors.Is(err, invitations.ErrInvalidEmail):
+		writeError(w, http.StatusBadRequest, "invalid email")
+	case errors.Is(err, invitations.ErrInvalidPassword):
+		writeError(w, http.StatusBadRequest, "password required")
+	case errors.Is(err, invitations.ErrInvalidTTL):
+		writeError(w, http.StatusBadRequest, "invalid expiration")
+	case errors.Is(err, invitations.ErrInvalidOrgRole):
+		writeError(w, http.StatusBadRequest, "invalid organization role")
+	case errors.Is(err, invitations.ErrRoleNotFound):
+		writeError(w, http.StatusBadRequest, validationError(err, invitations.ErrRoleNotFound))
+	case errors.Is(err, invitations.ErrOrgNotFound):
+		writeError(w, http.StatusBadRequest, "organization not found")
+	case errors.Is(err, invitations.ErrInvalidInvitation):
+		writeError(w, http.StatusBadRequest, "invalid or expired invitation")
+	case errors.Is(err, invitations.ErrUserExists):
+		writeError(w, http.StatusConflict, "user already exists")
+	case errors.Is(err, invitations.ErrNotFound):
+		writeError(w, http.StatusNotFound, "invitation not found")
+	case errors.Is(err, auth.ErrHasherOverloaded):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "server is overloaded, retry later")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/invitations"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_invitations(t *testing.T) {
+	prefixName := "management api"
+	invitation := entity.Invitation{
+		ID:        7,
+		Email:     "new@mail.com",
+		RoleIDs:   []int64{5},
+		InvitedBy: admin.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	type test struct {
+		name       string
+		method     string
+		target     string
+		bearer     string
+		body       string
+		prepare    func(m *MockInvitations)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create invitation success test"),
+			method: http.MethodPost,
+			target: "/api/invitations",
+			bearer: token,
+			body:   `{"email": "new@mail.com", "role_ids": [5], "expires_in": 3600}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().CreateInvitation(gomock.Any(), admin.ID, entity.Invitation{Email: "new@mail.com", RoleIDs: []int64{5}}, time.Hour).
+					Return(invitation, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(7), body["id"])
+				assert.Equal(t, []any{float64(5)}, body["role_ids"])
+				assert.NotContains(t, body, "org_id")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create invitation negative test: admin role"),
+			method: http.MethodPost,
+			target: "/api/invitations",
+			bearer: token,
+			body:   `{"email": "new@mail.com", "role_ids": [1]}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().CreateInvitation(gomock.Any(), admin.ID, entity.Invitation{Email: "new@mail.com", RoleIDs: []int64{1}}, time.Duration(0)).
+					Return(entity.Invitation{}, fmt.Errorf("invitations.CreateInvitation: %w", invitations.ErrAdminRole))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create invitation negative test: user exists"),
+			method: http.MethodPost,
+			target: "/api/invitations",
+			bearer: token,
+			body:   `{"email": "user@mail.com"}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().CreateInvitation(gomock.Any(), admin.ID, entity.Invitation{Email: "user@mail.com"}, time.Duration(0)).
+					Return(entity.Invitation{}, fmt.Errorf("invitations.CreateInvitation: %w", invitations.ErrUserExists))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list invitations success test"),
+			method: http.MethodGet,
+			target: "/api/invitations",
+			bearer: token,
+			prepare: func(m *MockInvitations) {
+				accepted := invitation
+				accepted.AcceptedAt = time.Now()
+				m.EXPECT().ListInvitations(gomock.Any(), admin.ID).Return([]entity.Invitation{accepted}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["invitations"], 1)
+				assert.Contains(t, body["invitations"].([]any)[0], "accepted_at")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke invitation negative test: unknown invitation"),
+			method: http.MethodDelete,
+			target: "/api/invitations/9",
+			bearer: token,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().RevokeInvitation(gomock.Any(), admin.ID, int64(9)).
+					Return(fmt.Errorf("invitations.RevokeInvitation: %w", invitations.ErrNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation success test"),
+			method: http.MethodPost,
+			target: "/api/invitations/accept",
+			body:   `{"code": "invitation-code", "password": "secret"}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), "invitation-code", "secret").Return(int64(12), nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(12), body["user_id"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: expired invitation"),
+			method: http.MethodPost,
+			target: "/api/invitations/accept",
+			body:   `{"code": "invitation-code", "password": "secret"}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), "invitation-code", "secret").
+					Return(int64(0), fmt.Errorf("invitations.AcceptInvitation: %w", invitations.ErrInvalidInvitation))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: hasher overloaded"),
+			method: http.MethodPost,
+			target: "/api/invitations/accept",
+			body:   `{"code": "invitation-code", "password": "secret"}`,
+			prepare: func(m *MockInvitations) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), "invitation-code", "secret").
+					Return(int64(0), fmt.Errorf("invitations.AcceptInvitation: %w", auth.ErrHasherOverloaded))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockInvitations(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{Invitations: service}, tt.method, tt.target, tt.bearer, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+)
+
+type MFA interface {
+	EnrollTOTP(ctx context.Context, user entity.User, issuer string) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, userId int64, code string) error
+	VerifyMFA(ctx context.Context, token string, appId int, code string, opts ...auth.LoginOption) (string, error)
+}
+
+type confirmTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type verifyMFARequest struct {
+	AppID     int    `json:"app_id"`
+	Code      string `json:"code"`
+	ACRValues string `json:"acr_values"`
+	// MaxAge is in seconds.
+	MaxAge int `json:"max_age"`
+}
+
+type totpEnrollmentView struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// enrollTOTP starts enrolling an authenticator app for the user. The app is
+// named after the host the request was sent to.
+func (h *handler) enrollTOTP(w http.ResponseWriter, r *http.Request, user entity.User) {
+	secret, uri, err := h.services.MFA.EnrollTOTP(r.Context(), user, r.Host)
+	if err != nil {
+		h.writeMFAError(w, "failed to enroll authenticator app", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, totpEnrollmentView{Secret: secret, URI: uri})
+}
+
+func (h *handler) confirmTOTP(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req confirmTOTPRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.services.MFA.ConfirmTOTP(r.Context(), user.ID, req.Code); err != nil {
+		h.writeMFAError(w, "failed to confirm authenticator app", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// verifyMFA steps up the access token of the app the request is authorized
+// with by a code of the user's authenticator app. Like the organization
+// switch, the token is one of any app, not of the API.
+func (h *handler) verifyMFA(w http.ResponseWriter, r *http.Request) {
+	plain := bearerToken(r)
+	if plain == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, "access token required")
+		return
+	}
+
+	var req verifyMFARequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.MaxAge < 0 {
+		writeError(w, http.StatusBadRequest, "invalid max age")
+		return
+	}
+
+	var opts []auth.LoginOption
+	if req.ACRValues != "" {
+		opts = append(opts, auth.WithACR(req.ACRValues))
+	}
+	if req.MaxAge > 0 {
+		opts = append(opts, auth.WithMaxAge(time.Duration(req.MaxAge)*time.Second))
+	}
+
+	token, err := h.services.MFA.VerifyMFA(r.Context(), plain, req.AppID, req.Code, opts...)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid access token")
+		case errors.Is(err, auth.ErrInvalidAppId):
+			writeError(w, http.StatusBadRequest, "invalid app id")
+		case errors.Is(err, auth.ErrStepUpRequired):
+			writeError(w, http.StatusForbidden, "required acr can't be reached")
+		case errors.Is(err, auth.ErrLoginMethodNotAllowed):
+			writeError(w, http.StatusForbidden, "login method is not allowed by the app")
+		default:
+			h.writeMFAError(w, "failed to verify second factor", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "token_type": "Bearer"})
+}
+
+func (h *handler) writeMFAError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidOTP):
+		writeError(w, http.StatusForbidden, "invalid one-time code")
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		writeError(w, http.StatusNotFound, "no authenticator app enrolled")
+	case errors.Is(err, auth.ErrMFAEnrolled):
+		writeError(w, http.StatusConflict, "authenticator app already enrolled")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
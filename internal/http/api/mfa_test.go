@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_totp(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name       string
+		target     string
+		body       string
+		prepare    func(m *MockMFA)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "enroll authenticator app success test"),
+			target: "/api/mfa/totp",
+			prepare: func(m *MockMFA) {
+				m.EXPECT().EnrollTOTP(gomock.Any(), user, "example.com").Return("SECRET", "otpauth://totp/x", nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "SECRET", body["secret"])
+				assert.Equal(t, "otpauth://totp/x", body["uri"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "enroll authenticator app negative test: already enrolled"),
+			target: "/api/mfa/totp",
+			prepare: func(m *MockMFA) {
+				m.EXPECT().EnrollTOTP(gomock.Any(), user, "example.com").
+					Return("", "", fmt.Errorf("auth.EnrollTOTP: %w", auth.ErrMFAEnrolled))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app success test"),
+			target: "/api/mfa/totp/confirm",
+			body:   `{"code": "123456"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().ConfirmTOTP(gomock.Any(), user.ID, "123456").Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app negative test: wrong code"),
+			target: "/api/mfa/totp/confirm",
+			body:   `{"code": "123456"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().ConfirmTOTP(gomock.Any(), user.ID, "123456").
+					Return(fmt.Errorf("auth.ConfirmTOTP: %w", auth.ErrInvalidOTP))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockMFA(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, user), Services{MFA: service}, http.MethodPost, tt.target, token, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
+
+func TestAPI_verifyMFA(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name          string
+		bearer        string
+		body          string
+		prepare       func(m *MockMFA)
+		wantStatus    int
+		wantChallenge string
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "verify second factor success test"),
+			bearer: "app-token",
+			body:   `{"app_id": 3, "code": "123456"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().VerifyMFA(gomock.Any(), "app-token", 3, "123456").Return("stepped-up-token", nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "verify second factor success test: acr and max age"),
+			bearer: "app-token",
+			body:   `{"app_id": 3, "code": "123456", "acr_values": "2", "max_age": 300}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().VerifyMFA(gomock.Any(), "app-token", 3, "123456", gomock.Any(), gomock.Any()).
+					Return("stepped-up-token", nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: no token"),
+			body:          `{"app_id": 3, "code": "123456"}`,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api"`,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: negative max age"),
+			bearer:     "app-token",
+			body:       `{"app_id": 3, "code": "123456", "max_age": -1}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: invalid token"),
+			bearer: "forged",
+			body:   `{"app_id": 3, "code": "123456"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().VerifyMFA(gomock.Any(), "forged", 3, "123456").
+					Return("", fmt.Errorf("auth.VerifyMFA: %w", auth.ErrInvalidToken))
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api", error="invalid_token"`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: wrong code"),
+			bearer: "app-token",
+			body:   `{"app_id": 3, "code": "654321"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().VerifyMFA(gomock.Any(), "app-token", 3, "654321").
+					Return("", fmt.Errorf("auth.VerifyMFA: %w", auth.ErrInvalidOTP))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: acr unreachable"),
+			bearer: "app-token",
+			body:   `{"app_id": 3, "code": "123456", "acr_values": "3"}`,
+			prepare: func(m *MockMFA) {
+				m.EXPECT().VerifyMFA(gomock.Any(), "app-token", 3, "123456", gomock.Any()).
+					Return("", fmt.Errorf("auth.VerifyMFA: %w", auth.ErrStepUpRequired))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockMFA(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(NewMockAuthenticator(ctrl), Services{MFA: service}, http.MethodPost, "/api/mfa/verify", tt.bearer, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantChallenge, rec.Header().Get("WWW-Authenticate"))
+			if tt.wantStatus == http.StatusOK {
+				var body map[string]string
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.Equal(t, "stepped-up-token", body["access_token"])
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/org"
+)
+
+type Orgs interface {
+	CreateOrganization(ctx context.Context, userId int64, name string) (entity.Organization, error)
+	UserOrganizations(ctx context.Context, userId int64) ([]entity.Membership, error)
+	ListMembers(ctx context.Context, actorId int64, orgId int64) ([]entity.Membership, error)
+	Invite(ctx context.Context, actorId int64, orgId int64, email string, role string) (entity.Invitation, error)
+	AcceptInvitation(ctx context.Context, userId int64, token string) (entity.Membership, error)
+}
+
+type Sessions interface {
+	SwitchOrg(ctx context.Context, token string, appId int, orgId int64) (string, error)
+}
+
+type createOrgRequest struct {
+	Name string `json:"name"`
+}
+
+type inviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type acceptOrgInvitationRequest struct {
+	Code string `json:"code"`
+}
+
+type switchOrgRequest struct {
+	AppID int `json:"app_id"`
+}
+
+type orgView struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type membershipView struct {
+	OrgID     int64     `json:"org_id"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// invitationView is an invitation as the API shows it. Its code is only sent
+// by email.
+type invitationView struct {
+	ID         int64      `json:"id"`
+	Email      string     `json:"email"`
+	OrgID      int64      `json:"org_id,omitempty"`
+	OrgRole    string     `json:"org_role,omitempty"`
+	RoleIDs    []int64    `json:"role_ids,omitempty"`
+	InvitedBy  int64      `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newMembershipView(membership entity.Membership) membershipView {
+	return membershipView{
+		OrgID:     membership.OrgID,
+		UserID:    membership.UserID,
+		Email:     membership.Email,
+		Role:      membership.Role,
+		CreatedAt: membership.CreatedAt,
+	}
+}
+
+func newMembershipViews(memberships []entity.Membership) []membershipView {
+	views := make([]membershipView, 0, len(memberships))
+	for _, membership := range memberships {
+		views = append(views, newMembershipView(membership))
+	}
+
+	return views
+}
+
+func newInvitationView(invitation entity.Invitation) invitationView {
+	return invitationView{
+		ID:         invitation.ID,
+		Email:      invitation.Email,
+		OrgID:      invitation.OrgID,
+		OrgRole:    invitation.OrgRole,
+		RoleIDs:    invitation.RoleIDs,
+		InvitedBy:  invitation.InvitedBy,
+		ExpiresAt:  invitation.ExpiresAt,
+		CreatedAt:  invitation.CreatedAt,
+		AcceptedAt: optionalTime(invitation.AcceptedAt),
+		RevokedAt:  optionalTime(invitation.RevokedAt),
+	}
+}
+
+// createOrg creates an organization owned by the user.
+func (h *handler) createOrg(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req createOrgRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	organization, err := h.services.Orgs.CreateOrganization(r.Context(), user.ID, req.Name)
+	if err != nil {
+		h.writeOrgError(w, "failed to create organization", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, orgView{ID: organization.ID, Name: organization.Name, CreatedAt: organization.CreatedAt})
+}
+
+// listOrgs lists the organizations the user is a member of.
+func (h *handler) listOrgs(w http.ResponseWriter, r *http.Request, user entity.User) {
+	memberships, err := h.services.Orgs.UserOrganizations(r.Context(), user.ID)
+	if err != nil {
+		h.writeOrgError(w, "failed to list organizations", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"memberships": newMembershipViews(memberships)})
+}
+
+func (h *handler) listMembers(w http.ResponseWriter, r *http.Request, user entity.User) {
+	orgId, ok := pathID(r, "org_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+
+	members, err := h.services.Orgs.ListMembers(r.Context(), user.ID, orgId)
+	if err != nil {
+		h.writeOrgError(w, "failed to list members", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"members": newMembershipViews(members)})
+}
+
+// invite emails an invitation to join the organization.
+func (h *handler) invite(w http.ResponseWriter, r *http.Request, user entity.User) {
+	orgId, ok := pathID(r, "org_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+
+	var req inviteRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	invitation, err := h.services.Orgs.Invite(r.Context(), user.ID, orgId, req.Email, req.Role)
+	if err != nil {
+		h.writeOrgError(w, "failed to invite", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newInvitationView(invitation))
+}
+
+// acceptOrgInvitation adds the user to the organization with the code of an
+// invitation sent to their email.
+func (h *handler) acceptOrgInvitation(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req acceptOrgInvitationRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	membership, err := h.services.Orgs.AcceptInvitation(r.Context(), user.ID, req.Code)
+	if err != nil {
+		h.writeOrgError(w, "failed to accept invitation", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newMembershipView(membership))
+}
+
+// switchOrg reissues the access token of the app the request is authorized
+// with scoped to the organization. Like the personal access token exchange,
+// the token is one of any app, not of the API.
+func (h *handler) switchOrg(w http.ResponseWriter, r *http.Request) {
+	plain := bearerToken(r)
+	if plain == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, "access token required")
+		return
+	}
+
+	orgId, ok := pathID(r, "org_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+
+	var req switchOrgRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.services.Sessions.SwitchOrg(r.Context(), plain, req.AppID, orgId)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid access token")
+		case errors.Is(err, auth.ErrInvalidAppId):
+			writeError(w, http.StatusBadRequest, "invalid app id")
+		case errors.Is(err, auth.ErrNotOrgMember):
+			writeError(w, http.StatusForbidden, "user is not a member of the organization")
+		default:
+			h.serverError(w, "failed to switch organization", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "token_type": "Bearer"})
+}
+
+func (h *handler) writeOrgError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, org.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, org.ErrInvalidName):
+		writeError(w, http.StatusBadRequest, "organization name required")
+	case errors.Is(err, org.ErrInvalidEmail):
+		writeError(w, http.StatusBadRequest, "email required")
+	case errors.Is(err, org.ErrInvalidRole):
+		writeError(w, http.StatusBadRequest, "invalid organization role")
+	case errors.Is(err, org.ErrInvalidInvitation):
+		writeError(w, http.StatusBadRequest, "invalid or expired invitation")
+	case errors.Is(err, org.ErrEmailMismatch):
+		writeError(w, http.StatusForbidden, "invitation was sent to another email")
+	case errors.Is(err, org.ErrOrgExists):
+		writeError(w, http.StatusConflict, "organization already exists")
+	case errors.Is(err, org.ErrOrgNotFound):
+		writeError(w, http.StatusNotFound, "organization not found")
+	case errors.Is(err, org.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/services/org"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_orgs(t *testing.T) {
+	prefixName := "management api"
+	membership := entity.Membership{OrgID: 4, UserID: user.ID, Email: user.Email, Role: entity.OrgRoleMember}
+	type test struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		prepare    func(m *MockOrgs)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create organization success test"),
+			method: http.MethodPost,
+			target: "/api/orgs",
+			body:   `{"name": "Acme"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().CreateOrganization(gomock.Any(), user.ID, "Acme").Return(entity.Organization{ID: 4, Name: "Acme"}, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(4), body["id"])
+				assert.Equal(t, "Acme", body["name"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create organization negative test: name taken"),
+			method: http.MethodPost,
+			target: "/api/orgs",
+			body:   `{"name": "Acme"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().CreateOrganization(gomock.Any(), user.ID, "Acme").
+					Return(entity.Organization{}, fmt.Errorf("org.CreateOrganization: %w", org.ErrOrgExists))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list organizations success test"),
+			method: http.MethodGet,
+			target: "/api/orgs",
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().UserOrganizations(gomock.Any(), user.ID).Return([]entity.Membership{membership}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["memberships"], 1)
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list members negative test: not a manager"),
+			method: http.MethodGet,
+			target: "/api/orgs/4/members",
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().ListMembers(gomock.Any(), user.ID, int64(4)).
+					Return(nil, fmt.Errorf("org.ListMembers: %w", org.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "invite success test"),
+			method: http.MethodPost,
+			target: "/api/orgs/4/invitations",
+			body:   `{"email": "new@mail.com", "role": "member"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().Invite(gomock.Any(), user.ID, int64(4), "new@mail.com", entity.OrgRoleMember).Return(entity.Invitation{
+					ID:        7,
+					Email:     "new@mail.com",
+					OrgID:     4,
+					OrgRole:   entity.OrgRoleMember,
+					TokenHash: []byte("hash"),
+					InvitedBy: user.ID,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(7), body["id"])
+				assert.Equal(t, "member", body["org_role"])
+				assert.NotContains(t, body, "token_hash")
+				assert.NotContains(t, body, "accepted_at")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "invite negative test: invalid role"),
+			method: http.MethodPost,
+			target: "/api/orgs/4/invitations",
+			body:   `{"email": "new@mail.com", "role": "king"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().Invite(gomock.Any(), user.ID, int64(4), "new@mail.com", "king").
+					Return(entity.Invitation{}, fmt.Errorf("org.Invite: %w", org.ErrInvalidRole))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "invite negative test: malformed org id"),
+			method:     http.MethodPost,
+			target:     "/api/orgs/acme/invitations",
+			body:       `{"email": "new@mail.com", "role": "member"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation success test"),
+			method: http.MethodPost,
+			target: "/api/orgs/invitations/accept",
+			body:   `{"code": "invitation-code"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), user.ID, "invitation-code").Return(membership, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(4), body["org_id"])
+				assert.Equal(t, "member", body["role"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: another email"),
+			method: http.MethodPost,
+			target: "/api/orgs/invitations/accept",
+			body:   `{"code": "invitation-code"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), user.ID, "invitation-code").
+					Return(entity.Membership{}, fmt.Errorf("org.AcceptInvitation: %w", org.ErrEmailMismatch))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: expired invitation"),
+			method: http.MethodPost,
+			target: "/api/orgs/invitations/accept",
+			body:   `{"code": "invitation-code"}`,
+			prepare: func(m *MockOrgs) {
+				m.EXPECT().AcceptInvitation(gomock.Any(), user.ID, "invitation-code").
+					Return(entity.Membership{}, fmt.Errorf("org.AcceptInvitation: %w", org.ErrInvalidInvitation))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOrgs(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, user), Services{Orgs: service}, tt.method, tt.target, token, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
+
+func TestAPI_switchOrg(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name          string
+		target        string
+		bearer        string
+		prepare       func(m *MockSessions)
+		wantStatus    int
+		wantChallenge string
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "switch organization success test"),
+			target: "/api/orgs/4/token",
+			bearer: "app-token",
+			prepare: func(m *MockSessions) {
+				m.EXPECT().SwitchOrg(gomock.Any(), "app-token", 3, int64(4)).Return("switched-token", nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: no token"),
+			target:        "/api/orgs/4/token",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api"`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: invalid token"),
+			target: "/api/orgs/4/token",
+			bearer: "forged",
+			prepare: func(m *MockSessions) {
+				m.EXPECT().SwitchOrg(gomock.Any(), "forged", 3, int64(4)).Return("", fmt.Errorf("auth.SwitchOrg: %w", auth.ErrInvalidToken))
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="api", error="invalid_token"`,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: not a member"),
+			target: "/api/orgs/5/token",
+			bearer: "app-token",
+			prepare: func(m *MockSessions) {
+				m.EXPECT().SwitchOrg(gomock.Any(), "app-token", 3, int64(5)).Return("", fmt.Errorf("auth.SwitchOrg: %w", auth.ErrNotOrgMember))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockSessions(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(NewMockAuthenticator(ctrl), Services{Sessions: service}, http.MethodPost, tt.target, tt.bearer, `{"app_id": 3}`)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantChallenge, rec.Header().Get("WWW-Authenticate"))
+			if tt.wantStatus == http.StatusOK {
+				var body map[string]string
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				assert.Equal(t, "switched-token", body["access_token"])
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/rbac"
+)
+
+type RBAC interface {
+	CreateRole(ctx context.Context, adminId int64, name string, appId int, description string) (entity.Role, error)
+	ListRoles(ctx context.Context, adminId int64) ([]entity.Role, error)
+	DeleteRole(ctx context.Context, adminId int64, roleId int64) error
+	CreatePermission(ctx context.Context, adminId int64, name string, description string) (entity.Permission, error)
+	ListPermissions(ctx context.Context, adminId int64) ([]entity.Permission, error)
+	DeletePermission(ctx context.Context, adminId int64, permissionId int64) error
+	GrantPermission(ctx context.Context, adminId int64, roleId int64, permissionId int64) error
+	RevokePermission(ctx context.Context, adminId int64, roleId int64, permissionId int64) error
+	AssignRole(ctx context.Context, adminId int64, userId int64, roleId int64) error
+	UnassignRole(ctx context.Context, adminId int64, userId int64, roleId int64) error
+	CheckPermission(ctx context.Context, actorId int64, userId int64, appId int, resource string, action string) (bool, error)
+	CheckPermissions(ctx context.Context, actorId int64, userId int64, appId int, checks []entity.PermissionCheck) ([]bool, error)
+}
+
+type createRoleRequest struct {
+	Name        string `json:"name"`
+	AppID       int    `json:"app_id"`
+	Description string `json:"description"`
+}
+
+type createPermissionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type checkRequest struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+type checkPermissionRequest struct {
+	UserID int64 `json:"user_id"`
+	checkRequest
+}
+
+type checkPermissionsRequest struct {
+	UserID int64          `json:"user_id"`
+	Checks []checkRequest `json:"checks"`
+}
+
+type roleView struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	AppID       int       `json:"app_id"`
+	Description string    `json:"description,omitempty"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type permissionView struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+func newRoleView(role entity.Role) roleView {
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	return roleView{
+		ID:          role.ID,
+		Name:        role.Name,
+		AppID:       role.AppID,
+		Description: role.Description,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+	}
+}
+
+func newPermissionView(permission entity.Permission) permissionView {
+	return permissionView{ID: permission.ID, Name: permission.Name, Description: permission.Description}
+}
+
+func (h *handler) createRole(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req createRoleRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	role, err := h.services.RBAC.CreateRole(r.Context(), user.ID, req.Name, req.AppID, req.Description)
+	if err != nil {
+		h.writeRBACError(w, "failed to create role", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newRoleView(role))
+}
+
+func (h *handler) listRoles(w http.ResponseWriter, r *http.Request, user entity.User) {
+	roles, err := h.services.RBAC.ListRoles(r.Context(), user.ID)
+	if err != nil {
+		h.writeRBACError(w, "failed to list roles", err)
+		return
+	}
+
+	views := make([]roleView, 0, len(roles))
+	for _, role := range roles {
+		views = append(views, newRoleView(role))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"roles": views})
+}
+
+func (h *handler) deleteRole(w http.ResponseWriter, r *http.Request, user entity.User) {
+	roleId, ok := pathID(r, "role_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "role not found")
+		return
+	}
+
+	if err := h.services.RBAC.DeleteRole(r.Context(), user.ID, roleId); err != nil {
+		h.writeRBACError(w, "failed to delete role", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (h *handler) createPermission(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req createPermissionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	permission, err := h.services.RBAC.CreatePermission(r.Context(), user.ID, req.Name, req.Description)
+	if err != nil {
+		h.writeRBACError(w, "failed to create permission", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newPermissionView(permission))
+}
+
+func (h *handler) listPermissions(w http.ResponseWriter, r *http.Request, user entity.User) {
+	permissions, err := h.services.RBAC.ListPermissions(r.Context(), user.ID)
+	if err != nil {
+		h.writeRBACError(w, "failed to list permissions", err)
+		return
+	}
+
+	views := make([]permissionView, 0, len(permissions))
+	for _, permission := range permissions {
+		views = append(views, newPermissionView(permission))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"permissions": views})
+}
+
+func (h *handler) deletePermission(w http.ResponseWriter, r *http.Request, user entity.User) {
+	permissionId, ok := pathID(r, "permission_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "permission not found")
+		return
+	}
+
+	if err := h.services.RBAC.DeletePermission(r.Context(), user.ID, permissionId); err != nil {
+		h.writeRBACError(w, "failed to delete permission", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// grantPermission grants the permission to the role. Granting it twice is not an error.
+func (h *handler) grantPermission(w http.ResponseWriter, r *http.Request, user entity.User) {
+	roleId, permissionId, ok := rolePermissionIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.RBAC.GrantPermission(r.Context(), user.ID, roleId, permissionId); err != nil {
+		h.writeRBACError(w, "failed to grant permission", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (h *handler) revokePermission(w http.ResponseWriter, r *http.Request, user entity.User) {
+	roleId, permissionId, ok := rolePermissionIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.RBAC.RevokePermission(r.Context(), user.ID, roleId, permissionId); err != nil {
+		h.writeRBACError(w, "failed to revoke permission", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// assignRole gives the role to the user. The admin role is refused, it is
+// granted at /api/users/{user_id}/admin.
+func (h *handler) assignRole(w http.ResponseWriter, r *http.Request, user entity.User) {
+	userId, roleId, ok := userRoleIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.RBAC.AssignRole(r.Context(), user.ID, userId, roleId); err != nil {
+		h.writeRBACError(w, "failed to assign role", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (h *handler) unassignRole(w http.ResponseWriter, r *http.Request, user entity.User) {
+	userId, roleId, ok := userRoleIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.services.RBAC.UnassignRole(r.Context(), user.ID, userId, roleId); err != nil {
+		h.writeRBACError(w, "failed to unassign role", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// checkPermission tells the app whether the user may perform the action on the
+// resource in it. The app asks with its own client token, so the decision is
+// audited with no actor.
+func (h *handler) checkPermission(w http.ResponseWriter, r *http.Request, app entity.App) {
+	var req checkPermissionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	allowed, err := h.services.RBAC.CheckPermission(r.Context(), 0, req.UserID, app.ID, req.Resource, req.Action)
+	if err != nil {
+		h.writeRBACError(w, "failed to check permission", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]bool{"allowed": allowed})
+}
+
+// checkPermissions is the batch variant of checkPermission. Decisions are in
+// the order of the checks.
+func (h *handler) checkPermissions(w http.ResponseWriter, r *http.Request, app entity.App) {
+	var req checkPermissionsRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	checks := make([]entity.PermissionCheck, 0, len(req.Checks))
+	for _, check := range req.Checks {
+		checks = append(checks, entity.PermissionCheck{Resource: check.Resource, Action: check.Action})
+	}
+
+	allowed, err := h.services.RBAC.CheckPermissions(r.Context(), 0, req.UserID, app.ID, checks)
+	if err != nil {
+		h.writeRBACError(w, "failed to check permissions", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]bool{"allowed": allowed})
+}
+
+func rolePermissionIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	roleId, ok := pathID(r, "role_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "role not found")
+		return 0, 0, false
+	}
+	permissionId, ok := pathID(r, "permission_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "permission not found")
+		return 0, 0, false
+	}
+
+	return roleId, permissionId, true
+}
+
+func userRoleIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	userId, ok := pathID(r, "user_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return 0, 0, false
+	}
+	roleId, ok := pathID(r, "role_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "role not found")
+		return 0, 0, false
+	}
+
+	return userId, roleId, true
+}
+
+func (h *handler) writeRBACError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, rbac.ErrInvalidCheck):
+		writeError(w, http.StatusBadRequest, "resource and action required")
+	case errors.Is(err, rbac.ErrTooManyChecks):
+		writeError(w, http.StatusBadRequest, "too many permission checks")
+	case errors.Is(err, rbac.ErrInvalidName):
+		writeError(w, http.StatusBadRequest, "invalid name")
+	case errors.Is(err, rbac.ErrAdminRole):
+		writeError(w, http.StatusBadRequest, "the admin role is granted and revoked at /api/users/{user_id}/admin")
+	case errors.Is(err, rbac.ErrBuiltinRole):
+		writeError(w, http.StatusConflict, "built-in role can't be deleted")
+	case errors.Is(err, rbac.ErrRoleExists):
+		writeError(w, http.StatusConflict, "role already exists")
+	case errors.Is(err, rbac.ErrPermissionExists):
+		writeError(w, http.StatusConflict, "permission already exists")
+	case errors.Is(err, rbac.ErrRoleNotFound):
+		writeError(w, http.StatusNotFound, "role not found")
+	case errors.Is(err, rbac.ErrPermissionMissing):
+		writeError(w, http.StatusNotFound, "permission not found")
+	case errors.Is(err, rbac.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
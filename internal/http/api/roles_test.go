@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/rbac"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_roles(t *testing.T) {
+	prefixName := "management api"
+	role := entity.Role{ID: 5, Name: "support", AppID: 3, Permissions: []string{"tickets:read"}}
+	type test struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		prepare    func(m *MockRBAC)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create role success test"),
+			method: http.MethodPost,
+			target: "/api/roles",
+			body:   `{"name": "support", "app_id": 3}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CreateRole(gomock.Any(), admin.ID, "support", 3, "").Return(role, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, float64(5), body["id"])
+				assert.Equal(t, []any{"tickets:read"}, body["permissions"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create role negative test: not an admin"),
+			method: http.MethodPost,
+			target: "/api/roles",
+			body:   `{"name": "support", "app_id": 3}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CreateRole(gomock.Any(), admin.ID, "support", 3, "").
+					Return(entity.Role{}, fmt.Errorf("rbac.CreateRole: %w", rbac.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create role negative test: name taken"),
+			method: http.MethodPost,
+			target: "/api/roles",
+			body:   `{"name": "support", "app_id": 3}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CreateRole(gomock.Any(), admin.ID, "support", 3, "").
+					Return(entity.Role{}, fmt.Errorf("rbac.CreateRole: %w", rbac.ErrRoleExists))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list roles success test"),
+			method: http.MethodGet,
+			target: "/api/roles",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().ListRoles(gomock.Any(), admin.ID).Return([]entity.Role{role, {ID: 1, Name: entity.RoleAdmin}}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["roles"], 2)
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "delete role negative test: admin role"),
+			method: http.MethodDelete,
+			target: "/api/roles/1",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().DeleteRole(gomock.Any(), admin.ID, int64(1)).Return(fmt.Errorf("rbac.DeleteRole: %w", rbac.ErrBuiltinRole))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create permission success test"),
+			method: http.MethodPost,
+			target: "/api/permissions",
+			body:   `{"name": "tickets:read", "description": "Read tickets"}`,
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().CreatePermission(gomock.Any(), admin.ID, "tickets:read", "Read tickets").
+					Return(entity.Permission{ID: 9, Name: "tickets:read", Description: "Read tickets"}, nil)
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list permissions success test"),
+			method: http.MethodGet,
+			target: "/api/permissions",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().ListPermissions(gomock.Any(), admin.ID).Return(nil, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, []any{}, body["permissions"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "delete permission negative test: unknown permission"),
+			method: http.MethodDelete,
+			target: "/api/permissions/9",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().DeletePermission(gomock.Any(), admin.ID, int64(9)).
+					Return(fmt.Errorf("rbac.DeletePermission: %w", rbac.ErrPermissionMissing))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "grant permission success test"),
+			method: http.MethodPut,
+			target: "/api/roles/5/permissions/9",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().GrantPermission(gomock.Any(), admin.ID, int64(5), int64(9)).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke permission success test"),
+			method: http.MethodDelete,
+			target: "/api/roles/5/permissions/9",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().RevokePermission(gomock.Any(), admin.ID, int64(5), int64(9)).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "assign role success test"),
+			method: http.MethodPut,
+			target: "/api/users/2/roles/5",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().AssignRole(gomock.Any(), admin.ID, user.ID, int64(5)).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "assign role negative test: admin role"),
+			method: http.MethodPut,
+			target: "/api/users/2/roles/1",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().AssignRole(gomock.Any(), admin.ID, user.ID, int64(1)).Return(fmt.Errorf("rbac.AssignRole: %w", rbac.ErrAdminRole))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "assign role negative test: unknown user"),
+			method: http.MethodPut,
+			target: "/api/users/9/roles/5",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().AssignRole(gomock.Any(), admin.ID, int64(9), int64(5)).Return(fmt.Errorf("rbac.AssignRole: %w", rbac.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "unassign role negative test: role not assigned"),
+			method: http.MethodDelete,
+			target: "/api/users/2/roles/5",
+			prepare: func(m *MockRBAC) {
+				m.EXPECT().UnassignRole(gomock.Any(), admin.ID, user.ID, int64(5)).Return(fmt.Errorf("rbac.UnassignRole: %w", rbac.ErrRoleNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockRBAC(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{RBAC: service}, tt.method, tt.target, token, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
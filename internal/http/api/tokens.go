@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/pat"
+)
+
+type PAT interface {
+	Create(ctx context.Context, userId int64, name string, scopes []string, ttl time.Duration) (string, entity.PersonalAccessToken, error)
+	List(ctx context.Context, userId int64) ([]entity.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userId int64, tokenId int64) error
+	Exchange(ctx context.Context, plain string, appId int) (string, error)
+}
+
+type createTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is the lifetime of the token, in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type exchangeTokenRequest struct {
+	AppID int `json:"app_id"`
+}
+
+// tokenView is a personal access token as the API shows it. The token itself
+// is only shown when it is created.
+type tokenView struct {
+	ID         int64      `json:"id"`
+	Token      string     `json:"token,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newTokenView(token entity.PersonalAccessToken) tokenView {
+	scopes := token.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return tokenView{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  token.ExpiresAt,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: optionalTime(token.LastUsedAt),
+		RevokedAt:  optionalTime(token.RevokedAt),
+	}
+}
+
+// createToken creates a personal access token of the user.
+func (h *handler) createToken(w http.ResponseWriter, r *http.Request, user entity.User) {
+	var req createTokenRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	plain, token, err := h.services.PAT.Create(r.Context(), user.ID, req.Name, req.Scopes,
+		time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		switch {
+		case errors.Is(err, pat.ErrInvalidName):
+			writeError(w, http.StatusBadRequest, "token name required")
+		case errors.Is(err, pat.ErrInvalidTTL):
+			writeError(w, http.StatusBadRequest, "invalid expires_in")
+		case errors.Is(err, pat.ErrInvalidScope):
+			writeError(w, http.StatusBadRequest, "invalid scope")
+		case errors.Is(err, pat.ErrTokenExists):
+			writeError(w, http.StatusConflict, "token with this name already exists")
+		default:
+			h.serverError(w, "failed to create personal access token", err)
+		}
+		return
+	}
+
+	view := newTokenView(token)
+	view.Token = plain
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// listTokens lists the personal access tokens of the user, revoked and expired ones included.
+func (h *handler) listTokens(w http.ResponseWriter, r *http.Request, user entity.User) {
+	tokens, err := h.services.PAT.List(r.Context(), user.ID)
+	if err != nil {
+		h.serverError(w, "failed to list personal access tokens", err)
+		return
+	}
+
+	views := make([]tokenView, 0, len(tokens))
+	for _, token := range tokens {
+		views = append(views, newTokenView(token))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"tokens": views})
+}
+
+// revokeToken revokes a personal access token of the user.
+func (h *handler) revokeToken(w http.ResponseWriter, r *http.Request, user entity.User) {
+	tokenId, ok := pathID(r, "token_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	}
+
+	if err := h.services.PAT.Revoke(r.Context(), user.ID, tokenId); err != nil {
+		if errors.Is(err, pat.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "token not found")
+			return
+		}
+		h.serverError(w, "failed to revoke personal access token", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// exchangeToken gives an access token of the app for the personal access
+// token the request is authorized with, so scripts can call what expects one.
+func (h *handler) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	plain := bearerToken(r)
+	if plain == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, "personal access token required")
+		return
+	}
+
+	var req exchangeTokenRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	token, err := h.services.PAT.Exchange(r.Context(), plain, req.AppID)
+	if err != nil {
+		switch {
+		case errors.Is(err, pat.ErrInvalidToken):
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "invalid personal access token")
+		case errors.Is(err, pat.ErrInvalidAppId):
+			writeError(w, http.StatusBadRequest, "invalid app id")
+		case errors.Is(err, pat.ErrEmailDomainNotAllowed):
+			writeError(w, http.StatusForbidden, "email domain is not allowed by app")
+		case errors.Is(err, pat.ErrLoginMethodNotAllowed):
+			writeError(w, http.StatusForbidden, "personal access tokens are not allowed by app")
+		case errors.Is(err, pat.ErrStepUpRequired):
+			writeError(w, http.StatusForbidden, "app requires a stronger authentication")
+		default:
+			h.serverError(w, "failed to exchange personal access token", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "token_type": "Bearer"})
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/pat"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_tokens(t *testing.T) {
+	prefixName := "management api"
+	stored := entity.PersonalAccessToken{
+		ID:        7,
+		UserID:    user.ID,
+		Name:      "ci",
+		Prefix:    "ssopat_abcdefgh",
+		TokenHash: []byte("hash"),
+		Scopes:    []string{"repo:read"},
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now(),
+	}
+	type test struct {
+		name       string
+		method     string
+		target     string
+		bearer     string
+		body       string
+		prepare    func(m *MockPAT)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create token success test"),
+			method: http.MethodPost,
+			target: "/api/tokens",
+			body:   `{"name": "ci", "scopes": ["repo:read"], "expires_in": 3600}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Create(gomock.Any(), user.ID, "ci", []string{"repo:read"}, time.Hour).
+					Return("ssopat_abcdefgh-secret", stored, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "ssopat_abcdefgh-secret", body["token"])
+				assert.Equal(t, float64(7), body["id"])
+				assert.Nil(t, body["token_hash"])
+				assert.Nil(t, body["revoked_at"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create token negative test: scope not allowed"),
+			method: http.MethodPost,
+			target: "/api/tokens",
+			body:   `{"name": "ci", "scopes": ["admin"], "expires_in": 3600}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Create(gomock.Any(), user.ID, "ci", []string{"admin"}, time.Hour).
+					Return("", entity.PersonalAccessToken{}, fmt.Errorf("pat.Create: %w: %q", pat.ErrInvalidScope, "admin"))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "create token negative test: name taken"),
+			method: http.MethodPost,
+			target: "/api/tokens",
+			body:   `{"name": "ci", "expires_in": 3600}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Create(gomock.Any(), user.ID, "ci", nil, time.Hour).
+					Return("", entity.PersonalAccessToken{}, fmt.Errorf("pat.Create: %w", pat.ErrTokenExists))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list tokens success test"),
+			method: http.MethodGet,
+			target: "/api/tokens",
+			prepare: func(m *MockPAT) {
+				m.EXPECT().List(gomock.Any(), user.ID).Return([]entity.PersonalAccessToken{stored}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				tokens, ok := body["tokens"].([]any)
+				assert.True(t, ok)
+				assert.Len(t, tokens, 1)
+				listed := tokens[0].(map[string]any)
+				assert.Nil(t, listed["token"])
+				assert.Equal(t, "ssopat_abcdefgh", listed["prefix"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke token success test"),
+			method: http.MethodDelete,
+			target: "/api/tokens/7",
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Revoke(gomock.Any(), user.ID, int64(7)).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke token negative test: token of another user"),
+			method: http.MethodDelete,
+			target: "/api/tokens/8",
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Revoke(gomock.Any(), user.ID, int64(8)).Return(fmt.Errorf("pat.Revoke: %w", pat.ErrNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "exchange token success test"),
+			method: http.MethodPost,
+			target: "/api/tokens/exchange",
+			bearer: "ssopat_abcdefgh-secret",
+			body:   `{"app_id": 3}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Exchange(gomock.Any(), "ssopat_abcdefgh-secret", 3).Return("jwt", nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "jwt", body["access_token"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: revoked token"),
+			method: http.MethodPost,
+			target: "/api/tokens/exchange",
+			bearer: "ssopat_revoked",
+			body:   `{"app_id": 3}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Exchange(gomock.Any(), "ssopat_revoked", 3).
+					Return("", fmt.Errorf("pat.Exchange: %w", pat.ErrInvalidToken))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: app requires a stronger authentication"),
+			method: http.MethodPost,
+			target: "/api/tokens/exchange",
+			bearer: "ssopat_abcdefgh-secret",
+			body:   `{"app_id": 3}`,
+			prepare: func(m *MockPAT) {
+				m.EXPECT().Exchange(gomock.Any(), "ssopat_abcdefgh-secret", 3).
+					Return("", fmt.Errorf("pat.Exchange: %w", pat.ErrStepUpRequired))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: no token"),
+			method:     http.MethodPost,
+			target:     "/api/tokens/exchange",
+			body:       `{"app_id": 3}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockPAT(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			bearer := tt.bearer
+			if bearer == "" && tt.target != "/api/tokens/exchange" {
+				bearer = token
+			}
+			rec := serve(authenticatedAs(ctrl, user), Services{PAT: service}, tt.method, tt.target, bearer, tt.body)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
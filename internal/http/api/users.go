@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+)
+
+type Users interface {
+	ListUsers(ctx context.Context, actorId int64, query entity.UserQuery, pageToken string) ([]entity.User, string, error)
+	SetAdmin(ctx context.Context, actorId int64, userId int64) error
+	RevokeAdmin(ctx context.Context, actorId int64, userId int64) error
+}
+
+// userView is a user as the API shows it. The password hash is never shown.
+type userView struct {
+	ID            int64     `json:"id"`
+	Email         string    `json:"email"`
+	Status        string    `json:"status"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type usersPage struct {
+	Users         []userView `json:"users"`
+	NextPageToken string     `json:"next_page_token,omitempty"`
+}
+
+// listUsers returns a page of the user directory. The query parameters are
+// email_prefix, admin, status, created_after and created_before (RFC 3339) to
+// filter, sort_by (id, email or created_at) and desc to sort, and limit and
+// page_token to page.
+func (h *handler) listUsers(w http.ResponseWriter, r *http.Request, user entity.User) {
+	query, ok := userQuery(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid user query")
+		return
+	}
+
+	users, next, err := h.services.Users.ListUsers(r.Context(), user.ID, query, r.URL.Query().Get("page_token"))
+	if err != nil {
+		h.writeUsersError(w, "failed to list users", err)
+		return
+	}
+
+	page := usersPage{Users: make([]userView, 0, len(users)), NextPageToken: next}
+	for _, u := range users {
+		page.Users = append(page.Users, userView{
+			ID:            u.ID,
+			Email:         u.Email,
+			Status:        u.Status,
+			EmailVerified: u.EmailVerified,
+			CreatedAt:     u.CreatedAt,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// userQuery reads the user query from the query parameters of the request.
+func userQuery(r *http.Request) (entity.UserQuery, bool) {
+	params := r.URL.Query()
+	query := entity.UserQuery{
+		Filter: entity.UserFilter{
+			EmailPrefix: params.Get("email_prefix"),
+			Status:      params.Get("status"),
+		},
+		SortBy: params.Get("sort_by"),
+	}
+
+	if v := params.Get("admin"); v != "" {
+		admin, err := strconv.ParseBool(v)
+		if err != nil {
+			return entity.UserQuery{}, false
+		}
+		query.Filter.Admin = &admin
+	}
+	for name, t := range map[string]*time.Time{
+		"created_after":  &query.Filter.CreatedAfter,
+		"created_before": &query.Filter.CreatedBefore,
+	} {
+		if v := params.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return entity.UserQuery{}, false
+			}
+			*t = parsed
+		}
+	}
+	if v := params.Get("desc"); v != "" {
+		desc, err := strconv.ParseBool(v)
+		if err != nil {
+			return entity.UserQuery{}, false
+		}
+		query.Desc = desc
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return entity.UserQuery{}, false
+		}
+		query.Limit = limit
+	}
+
+	return query, true
+}
+
+// setAdmin makes the user an admin. Making an admin one again is not an error.
+func (h *handler) setAdmin(w http.ResponseWriter, r *http.Request, user entity.User) {
+	userId, ok := pathID(r, "user_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.services.Users.SetAdmin(r.Context(), user.ID, userId); err != nil {
+		h.writeUsersError(w, "failed to grant admin", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+// revokeAdmin takes admin away from the user, unless they are the last admin.
+func (h *handler) revokeAdmin(w http.ResponseWriter, r *http.Request, user entity.User) {
+	userId, ok := pathID(r, "user_id")
+	if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.services.Users.RevokeAdmin(r.Context(), user.ID, userId); err != nil {
+		h.writeUsersError(w, "failed to revoke admin", err)
+		return
+	}
+
+	writeNoContent(w)
+}
+
+func (h *handler) writeUsersError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrPermissionDenied):
+		writeError(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, auth.ErrInvalidQuery):
+		writeError(w, http.StatusBadRequest, "invalid user query")
+	case errors.Is(err, auth.ErrInvalidPageToken):
+		writeError(w, http.StatusBadRequest, "invalid page token")
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user not found")
+	case errors.Is(err, auth.ErrNotAdmin):
+		writeError(w, http.StatusConflict, "user is not an admin")
+	case errors.Is(err, auth.ErrLastAdmin):
+		writeError(w, http.StatusConflict, "can't revoke the last admin")
+	default:
+		h.serverError(w, msg, err)
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_admin(t *testing.T) {
+	prefixName := "management api"
+	type test struct {
+		name       string
+		method     string
+		target     string
+		prepare    func(m *MockUsers)
+		wantStatus int
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set admin success test"),
+			method: http.MethodPut,
+			target: "/api/users/2/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().SetAdmin(gomock.Any(), admin.ID, user.ID).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set admin negative test: not an admin"),
+			method: http.MethodPut,
+			target: "/api/users/2/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().SetAdmin(gomock.Any(), admin.ID, user.ID).Return(fmt.Errorf("auth.SetAdmin: %w", auth.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set admin negative test: unknown user"),
+			method: http.MethodPut,
+			target: "/api/users/9/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().SetAdmin(gomock.Any(), admin.ID, int64(9)).Return(fmt.Errorf("auth.SetAdmin: %w", auth.ErrUserNotFound))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke admin success test"),
+			method: http.MethodDelete,
+			target: "/api/users/2/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().RevokeAdmin(gomock.Any(), admin.ID, user.ID).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke admin negative test: last admin"),
+			method: http.MethodDelete,
+			target: "/api/users/1/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().RevokeAdmin(gomock.Any(), admin.ID, admin.ID).Return(fmt.Errorf("auth.RevokeAdmin: %w", auth.ErrLastAdmin))
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "revoke admin negative test: not an admin"),
+			method: http.MethodDelete,
+			target: "/api/users/2/admin",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().RevokeAdmin(gomock.Any(), admin.ID, user.ID).Return(fmt.Errorf("auth.RevokeAdmin: %w", auth.ErrNotAdmin))
+			},
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockUsers(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{Users: service}, tt.method, tt.target, token, "")
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestAPI_listUsers(t *testing.T) {
+	prefixName := "management api"
+	isAdmin := true
+	type test struct {
+		name       string
+		target     string
+		prepare    func(m *MockUsers)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list users success test"),
+			target: "/api/users",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().ListUsers(gomock.Any(), admin.ID, entity.UserQuery{}, "").
+					Return([]entity.User{admin, user}, "", nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["users"], 2)
+				assert.NotContains(t, body, "next_page_token")
+				assert.NotContains(t, body["users"].([]any)[0], "pass_hash")
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "list users with query success test"),
+			target: "/api/users?email_prefix=adm&admin=true&status=active&created_after=2026-01-01T00:00:00Z" +
+				"&sort_by=email&desc=true&limit=1&page_token=cursor",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().ListUsers(gomock.Any(), admin.ID, entity.UserQuery{
+					Filter: entity.UserFilter{
+						EmailPrefix:  "adm",
+						Admin:        &isAdmin,
+						CreatedAfter: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+						Status:       entity.UserStatusActive,
+					},
+					SortBy: entity.UserSortEmail,
+					Desc:   true,
+					Limit:  1,
+				}, "cursor").Return([]entity.User{admin}, "next", nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Len(t, body["users"], 1)
+				assert.Equal(t, "next", body["next_page_token"])
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "list users negative test: malformed time"),
+			target:     "/api/users?created_before=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list users negative test: unknown sort field"),
+			target: "/api/users?sort_by=password",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().ListUsers(gomock.Any(), admin.ID, entity.UserQuery{SortBy: "password"}, "").
+					Return(nil, "", fmt.Errorf("auth.ListUsers: %w", auth.ErrInvalidQuery))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list users negative test: invalid page token"),
+			target: "/api/users?page_token=forged",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().ListUsers(gomock.Any(), admin.ID, entity.UserQuery{}, "forged").
+					Return(nil, "", fmt.Errorf("auth.ListUsers: %w", auth.ErrInvalidPageToken))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "list users negative test: not an admin"),
+			target: "/api/users",
+			prepare: func(m *MockUsers) {
+				m.EXPECT().ListUsers(gomock.Any(), admin.ID, entity.UserQuery{}, "").
+					Return(nil, "", fmt.Errorf("auth.ListUsers: %w", auth.ErrPermissionDenied))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockUsers(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(authenticatedAs(ctrl, admin), Services{Users: service}, http.MethodGet, tt.target, token, "")
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.check != nil {
+				var body map[string]any
+				assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+				tt.check(t, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package oauth
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/clientinfo"
+)
+
+// clientInfo puts the user agent and IP address of the browser into the
+// request context, so that the logins of the endpoint track the device the
+// user signs in from, as the gRPC logins do.
+func clientInfo(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		client := clientinfo.ClientInfo{UserAgent: r.UserAgent(), IP: host}
+
+		next(w, r.WithContext(clientinfo.NewContext(r.Context(), client)))
+	}
+}
@@ -0,0 +1,87 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/clientinfo"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_clientInfo(t *testing.T) {
+	prefixName := "oauth handler"
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+	want := clientinfo.ClientInfo{UserAgent: userAgent, IP: "192.0.2.1"}
+	authorizeReq := oauth.AuthorizeRequest{
+		ResponseType:        oauth.ResponseTypeCode,
+		ClientID:            3,
+		RedirectURI:         "https://app.example.com/callback",
+		Scopes:              []string{"openid"},
+		State:               "xyz",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+	}
+	type test struct {
+		name    string
+		req     func() *http.Request
+		prepare func(m *MockOAuth, got *clientinfo.ClientInfo)
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client info success test: authorize"),
+			req: func() *http.Request {
+				form := authorizeQuery(authorizeReq)
+				form.Set("email", "user@mail.com")
+				form.Set("password", "password")
+				return formRequest(oauth.AuthorizePath, form)
+			},
+			prepare: func(m *MockOAuth, got *clientinfo.ClientInfo) {
+				m.EXPECT().Authorize(gomock.Any(), authorizeReq, "user@mail.com", "password").
+					DoAndReturn(func(ctx context.Context, _ oauth.AuthorizeRequest, _ string, _ string) (oauth.Authorization, error) {
+						*got, _ = clientinfo.FromContext(ctx)
+						return oauth.Authorization{Code: "code"}, nil
+					})
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client info success test: verify device"),
+			req: func() *http.Request {
+				return formRequest(oauth.DeviceVerificationPath, url.Values{
+					"user_code": {"BCDF-GHJK"},
+					"email":     {"user@mail.com"},
+					"password":  {"password"},
+					"action":    {"approve"},
+				})
+			},
+			prepare: func(m *MockOAuth, got *clientinfo.ClientInfo) {
+				m.EXPECT().VerifyDevice(gomock.Any(), "BCDF-GHJK", "user@mail.com", "password", true).
+					DoAndReturn(func(ctx context.Context, _ string, _ string, _ string, _ bool) error {
+						*got, _ = clientinfo.FromContext(ctx)
+						return nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var got clientinfo.ClientInfo
+			service := NewMockOAuth(ctrl)
+			tt.prepare(service, &got)
+
+			req := tt.req()
+			req.Header.Set("User-Agent", userAgent)
+			serve(service, nil, nil, req)
+
+			assert.Equal(t, want, got)
+		})
+	}
+}
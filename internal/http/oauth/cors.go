@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response, in seconds.
+const corsMaxAge = "600"
+
+// cors lets browser code call the endpoint from the web origins of the apps.
+// The origin is only checked against all apps here, as a preflight request
+// doesn't name the client; the endpoint then checks it against the client of
+// the request and refuses it otherwise.
+func (h *handler) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.allowOrigin(w, r)
+		next(w, r)
+	}
+}
+
+// preflight answers a CORS preflight request (Fetch Standard, section 3.2.2).
+// Disallowed origins get no CORS headers, which makes the browser fail the call.
+func (h *handler) preflight(w http.ResponseWriter, r *http.Request) {
+	if h.allowOrigin(w, r) {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowOrigin sets the CORS headers when the request comes from a web origin
+// of an app, compared exactly, and reports whether it does.
+func (h *handler) allowOrigin(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	allowed, err := h.oauth.OriginAllowed(r.Context(), origin)
+	if err != nil {
+		h.log.Error("failed to check origin", slog.Any("error", err))
+		return false
+	}
+	if !allowed {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+
+	return true
+}
+
+// publicCORS lets any origin read a document that is the same for everyone.
+func publicCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		next(w, r)
+	}
+}
@@ -0,0 +1,154 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_cors(t *testing.T) {
+	prefixName := "oauth handler"
+	appOrigin := "https://app.example.com"
+	preflightRequest := func(target string, origin string) func() *http.Request {
+		return func() *http.Request {
+			req := httptest.NewRequest(http.MethodOptions, target, nil)
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			return req
+		}
+	}
+	type test struct {
+		name            string
+		req             func() *http.Request
+		prepare         func(m *MockOAuth)
+		wantStatus      int
+		wantAllowOrigin string
+		wantMethods     string
+		wantMaxAge      string
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "preflight success test"),
+			req:  preflightRequest(oauth.TokenPath, appOrigin),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), appOrigin).Return(true, nil)
+			},
+			wantStatus:      http.StatusNoContent,
+			wantAllowOrigin: appOrigin,
+			wantMethods:     "GET, POST",
+			wantMaxAge:      corsMaxAge,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "preflight success test: device authorization"),
+			req:  preflightRequest(oauth.DeviceAuthorizationPath, appOrigin),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), appOrigin).Return(true, nil)
+			},
+			wantStatus:      http.StatusNoContent,
+			wantAllowOrigin: appOrigin,
+			wantMethods:     "GET, POST",
+			wantMaxAge:      corsMaxAge,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "preflight negative test: disallowed origin"),
+			req:  preflightRequest(oauth.UserInfoPath, "https://evil.example.com"),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), "https://evil.example.com").Return(false, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "preflight negative test: no origin"),
+			req:        preflightRequest(oauth.TokenPath, ""),
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "preflight negative test: origin check failed"),
+			req:  preflightRequest(oauth.TokenPath, appOrigin),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), appOrigin).Return(false, errors.New("database is locked"))
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token request success test: allowed origin"),
+			req: func() *http.Request {
+				req := formRequest(oauth.TokenPath, url.Values{"grant_type": {"password"}, "client_id": {"3"}})
+				req.Header.Set("Origin", appOrigin)
+				return req
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), appOrigin).Return(true, nil)
+			},
+			wantStatus:      http.StatusBadRequest,
+			wantAllowOrigin: appOrigin,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token request negative test: disallowed origin"),
+			req: func() *http.Request {
+				req := formRequest(oauth.TokenPath, url.Values{"grant_type": {"password"}, "client_id": {"3"}})
+				req.Header.Set("Origin", "https://evil.example.com")
+				return req
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().OriginAllowed(gomock.Any(), "https://evil.example.com").Return(false, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "jwks success test: any origin"),
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, oauth.JWKSPath, nil)
+				req.Header.Set("Origin", "https://evil.example.com")
+				return req
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().JWKS().Return(jwk.Set{Keys: []jwk.PublicKey{}})
+			},
+			wantStatus:      http.StatusOK,
+			wantAllowOrigin: "*",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "discovery success test: any origin"),
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, oauth.DiscoveryPath, nil)
+				req.Header.Set("Origin", "https://evil.example.com")
+				return req
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Metadata().Return(oauth.ProviderMetadata{Issuer: "https://sso.example.com"})
+			},
+			wantStatus:      http.StatusOK,
+			wantAllowOrigin: "*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(service, nil, nil, tt.req())
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantAllowOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.wantMethods, rec.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tt.wantMaxAge, rec.Header().Get("Access-Control-Max-Age"))
+		})
+	}
+}
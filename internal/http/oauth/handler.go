@@ -0,0 +1,824 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/services/federation"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+)
+
+//go:generate mockgen -destination=mock_oauth.go -package=oauth . OAuth,Federation,Registration
+
+// stateCookie ties a login at an upstream provider to the browser it was started in.
+const stateCookie = "federation_state"
+
+type OAuth interface {
+	CheckAuthorizeRequest(ctx context.Context, req oauth.AuthorizeRequest) error
+	Authorize(ctx context.Context, req oauth.AuthorizeRequest, email string, password string) (oauth.Authorization, error)
+	AuthorizeUser(ctx context.Context, req oauth.AuthorizeRequest, userId int64, amr []string) (oauth.Authorization, error)
+	Consent(ctx context.Context, challenge string, approve bool) (req oauth.AuthorizeRequest, code string, err error)
+	Exchange(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error)
+	ClientCredentials(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error)
+	AuthorizeDevice(ctx context.Context, req oauth.TokenRequest) (oauth.DeviceAuthorization, error)
+	LookupDevice(ctx context.Context, userCode string) (oauth.DeviceRequest, error)
+	VerifyDevice(ctx context.Context, userCode string, email string, password string, approve bool) error
+	DeviceToken(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error)
+	TokenExchange(ctx context.Context, req oauth.TokenRequest) (oauth.TokenResponse, error)
+	UserInfo(ctx context.Context, accessToken string, origin string) (map[string]any, error)
+	Introspect(ctx context.Context, req oauth.TokenRequest) (map[string]any, error)
+	Logout(ctx context.Context, req oauth.LogoutRequest) (string, error)
+	OriginAllowed(ctx context.Context, origin string) (bool, error)
+	Metadata() oauth.ProviderMetadata
+	JWKS() jwk.Set
+}
+
+type Federation interface {
+	Providers() []federation.Provider
+	Start(ctx context.Context, providerName string, resume string) (target string, state string, err error)
+	Finish(ctx context.Context, state string, code string) (federation.Login, error)
+}
+
+type handler struct {
+	log          *slog.Logger
+	oauth        OAuth
+	federation   Federation
+	registration Registration
+}
+
+// Register adds the OAuth and OpenID Connect endpoints to the mux, and the
+// endpoints of logins at upstream providers. The client registration
+// endpoints are only added with a registration service.
+//
+// The endpoints browser code calls answer CORS requests from the web origins
+// of the apps; the public documents answer them from anywhere. The endpoints
+// users log in at pass on the device they log in from.
+func Register(
+	mux *http.ServeMux,
+	log *slog.Logger,
+	oauthService OAuth,
+	federationService Federation,
+	registrationService Registration,
+) {
+	h := &handler{log: log, oauth: oauthService, federation: federationService, registration: registrationService}
+
+	mux.HandleFunc("GET "+oauth.AuthorizePath, h.authorizeForm)
+	mux.HandleFunc("POST "+oauth.AuthorizePath, clientInfo(h.authorize))
+	mux.HandleFunc("POST "+oauth.ConsentPath, h.consent)
+	mux.HandleFunc("POST "+oauth.TokenPath, h.cors(h.token))
+	mux.HandleFunc("OPTIONS "+oauth.TokenPath, h.preflight)
+	mux.HandleFunc("GET "+oauth.UserInfoPath, h.cors(h.userInfo))
+	mux.HandleFunc("POST "+oauth.UserInfoPath, h.cors(h.userInfo))
+	mux.HandleFunc("OPTIONS "+oauth.UserInfoPath, h.preflight)
+	mux.HandleFunc("POST "+oauth.IntrospectionPath, h.introspect)
+	mux.HandleFunc("GET "+oauth.LogoutPath, h.logout)
+	mux.HandleFunc("POST "+oauth.LogoutPath, h.logout)
+	mux.HandleFunc("GET "+oauth.JWKSPath, publicCORS(h.jwks))
+	mux.HandleFunc("GET "+oauth.DiscoveryPath, publicCORS(h.discovery))
+	mux.HandleFunc("POST "+oauth.DeviceAuthorizationPath, h.cors(h.deviceAuthorization))
+	mux.HandleFunc("OPTIONS "+oauth.DeviceAuthorizationPath, h.preflight)
+	mux.HandleFunc("GET "+oauth.DeviceVerificationPath, h.deviceForm)
+	mux.HandleFunc("POST "+oauth.DeviceVerificationPath, clientInfo(h.verifyDevice))
+	mux.HandleFunc("GET "+federation.StartPath, h.federationStart)
+	mux.HandleFunc("GET "+federation.CallbackPath, clientInfo(h.federationCallback))
+
+	if registrationService != nil {
+		mux.HandleFunc("POST "+oauth.RegistrationPath, h.registerClient)
+		mux.HandleFunc("GET "+oauth.RegistrationPath+"/{client_id}", h.readClient)
+		mux.HandleFunc("PUT "+oauth.RegistrationPath+"/{client_id}", h.updateClient)
+		mux.HandleFunc("DELETE "+oauth.RegistrationPath+"/{client_id}", h.deleteClient)
+	}
+}
+
+// authorizeForm validates the authorization request and shows the login form.
+func (h *handler) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	req, err := authorizeRequest(r.URL.Query())
+	if err == nil {
+		err = h.oauth.CheckAuthorizeRequest(r.Context(), req)
+	}
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	h.renderLogin(w, http.StatusOK, req, "", "")
+}
+
+// authorize logs the user in and sends the authorization code to the client,
+// or asks the user to consent first.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed form", http.StatusBadRequest)
+		return
+	}
+
+	req, err := authorizeRequest(r.PostForm)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+
+	authorization, err := h.oauth.Authorize(r.Context(), req, email, r.PostForm.Get("password"))
+	if err != nil {
+		if errors.Is(err, oauth.ErrLoginFailed) {
+			h.renderLogin(w, http.StatusUnauthorized, req, email, "Invalid email or password.")
+			return
+		}
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	h.authorized(w, r, req, authorization)
+}
+
+// consent records the answer of the user to the consent prompt and sends the
+// outcome to the client.
+func (h *handler) consent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed form", http.StatusBadRequest)
+		return
+	}
+
+	approve := r.PostForm.Get("action") == "approve"
+
+	req, code, err := h.oauth.Consent(r.Context(), r.PostForm.Get("challenge"), approve)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidConsent) {
+			renderError(w, http.StatusBadRequest, "The request expired or was already answered, please sign in again.")
+			return
+		}
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+}
+
+// authorized sends the authorization code to the client, or shows the consent
+// prompt when the user must consent first.
+func (h *handler) authorized(w http.ResponseWriter, r *http.Request, req oauth.AuthorizeRequest, authorization oauth.Authorization) {
+	if authorization.Consent != nil {
+		h.renderConsent(w, *authorization.Consent)
+		return
+	}
+
+	redirect(w, r, req.RedirectURI, url.Values{"code": {authorization.Code}, "state": {req.State}})
+}
+
+// authorizeError sends the error to the client when its redirect URI can be
+// trusted, and shows it to the user otherwise.
+func (h *handler) authorizeError(w http.ResponseWriter, r *http.Request, req oauth.AuthorizeRequest, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		h.log.Error("authorization failed", slog.Any("error", err))
+		renderError(w, http.StatusInternalServerError, "Something went wrong, please try again later.")
+		return
+	}
+
+	if !oauth.Redirectable(err) {
+		renderError(w, http.StatusBadRequest, oauthErr.Error())
+		return
+	}
+
+	params := url.Values{"error": {oauthErr.Code}, "state": {req.State}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	redirect(w, r, req.RedirectURI, params)
+}
+
+// federationStart sends the user to log in at an upstream provider instead,
+// after validating the authorization request it will resume.
+func (h *handler) federationStart(w http.ResponseWriter, r *http.Request) {
+	req, err := authorizeRequest(r.URL.Query())
+	if err == nil {
+		err = h.oauth.CheckAuthorizeRequest(r.Context(), req)
+	}
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	target, state, err := h.federation.Start(r.Context(), r.PathValue("provider"), authorizeQuery(req).Encode())
+	if err != nil {
+		h.federationError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/federation",
+		Secure:   strings.HasPrefix(h.oauth.Metadata().Issuer, "https://"),
+		HttpOnly: true,
+		// Lax lets the cookie through the top-level redirect back from the provider.
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// federationCallback finishes a login at an upstream provider and resumes the
+// authorization request it was started for.
+func (h *handler) federationCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(stateCookie)
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/federation", MaxAge: -1})
+	if err != nil || state == "" || cookie.Value != state {
+		renderError(w, http.StatusBadRequest, "The sign in expired or was started in another browser, please sign in again.")
+		return
+	}
+
+	if query.Get("error") != "" {
+		renderError(w, http.StatusForbidden, "The sign in at the identity provider was cancelled or failed.")
+		return
+	}
+
+	login, err := h.federation.Finish(r.Context(), state, query.Get("code"))
+	if err != nil {
+		h.federationError(w, err)
+		return
+	}
+
+	values, err := url.ParseQuery(login.Resume)
+	if err != nil {
+		h.federationError(w, err)
+		return
+	}
+	req, err := authorizeRequest(values)
+	if err != nil {
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	authorization, err := h.oauth.AuthorizeUser(r.Context(), req, login.User.ID, login.AMR)
+	if err != nil {
+		if errors.Is(err, oauth.ErrLoginFailed) {
+			renderError(w, http.StatusForbidden, "This account can't sign in.")
+			return
+		}
+		h.authorizeError(w, r, req, err)
+		return
+	}
+
+	h.authorized(w, r, req, authorization)
+}
+
+// federationError shows why a login at an upstream provider failed.
+func (h *handler) federationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, federation.ErrUnknownProvider):
+		renderError(w, http.StatusNotFound, "Unknown identity provider.")
+	case errors.Is(err, federation.ErrInvalidState):
+		renderError(w, http.StatusBadRequest, "The sign in expired, please sign in again.")
+	case errors.Is(err, federation.ErrUpstream):
+		renderError(w, http.StatusBadGateway, "The sign in at the identity provider failed, please try again later.")
+	case errors.Is(err, federation.ErrNoAccount):
+		renderError(w, http.StatusForbidden, "No account is linked to this sign in.")
+	default:
+		h.log.Error("federated login failed", slog.Any("error", err))
+		renderError(w, http.StatusInternalServerError, "Something went wrong, please try again later.")
+	}
+}
+
+func (h *handler) token(w http.ResponseWriter, r *http.Request) {
+	req, basic, err := tokenRequest(r)
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	var resp oauth.TokenResponse
+	switch req.GrantType {
+	case oauth.GrantTypeAuthorizationCode:
+		resp, err = h.oauth.Exchange(r.Context(), req)
+	case oauth.GrantTypeClientCredentials:
+		resp, err = h.oauth.ClientCredentials(r.Context(), req)
+	case oauth.GrantTypeDeviceCode:
+		resp, err = h.oauth.DeviceToken(r.Context(), req)
+	case oauth.GrantTypeTokenExchange:
+		resp, err = h.oauth.TokenExchange(r.Context(), req)
+	default:
+		err = oauth.ErrUnsupportedGrantType
+	}
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	body := map[string]any{
+		"access_token": resp.AccessToken,
+		"token_type":   resp.TokenType,
+		"expires_in":   int64(resp.ExpiresIn.Seconds()),
+	}
+	if len(resp.Scopes) > 0 {
+		body["scope"] = strings.Join(resp.Scopes, " ")
+	}
+	if resp.IssuedTokenType != "" {
+		body["issued_token_type"] = resp.IssuedTokenType
+	}
+	if resp.IDToken != "" {
+		body["id_token"] = resp.IDToken
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// introspect answers a token introspection request (RFC 7662, section 2).
+func (h *handler) introspect(w http.ResponseWriter, r *http.Request) {
+	req, basic, err := tokenRequest(r)
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	resp, err := h.oauth.Introspect(r.Context(), req)
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) deviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	req, basic, err := tokenRequest(r)
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	resp, err := h.oauth.AuthorizeDevice(r.Context(), req)
+	if err != nil {
+		h.writeTokenError(w, err, basic)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"device_code":               resp.DeviceCode,
+		"user_code":                 resp.UserCode,
+		"verification_uri":          resp.VerificationURI,
+		"verification_uri_complete": resp.VerificationURIComplete,
+		"expires_in":                int64(resp.ExpiresIn.Seconds()),
+		"interval":                  int64(resp.Interval.Seconds()),
+	})
+}
+
+// deviceForm asks the user to log in and approve the device showing the user code.
+func (h *handler) deviceForm(w http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		h.renderDevice(w, http.StatusOK, oauth.DeviceRequest{}, "", "")
+		return
+	}
+
+	device, err := h.oauth.LookupDevice(r.Context(), userCode)
+	if err != nil {
+		h.deviceError(w, oauth.DeviceRequest{UserCode: userCode}, "", err)
+		return
+	}
+
+	h.renderDevice(w, http.StatusOK, device, "", "")
+}
+
+func (h *handler) verifyDevice(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed form", http.StatusBadRequest)
+		return
+	}
+
+	userCode := r.PostForm.Get("user_code")
+	email := strings.TrimSpace(r.PostForm.Get("email"))
+	approve := r.PostForm.Get("action") == "approve"
+
+	err := h.oauth.VerifyDevice(r.Context(), userCode, email, r.PostForm.Get("password"), approve)
+	if err != nil {
+		h.deviceError(w, oauth.DeviceRequest{UserCode: userCode}, email, err)
+		return
+	}
+
+	message := "The device was denied access."
+	if approve {
+		message = "The device is signed in. You can close this page and return to it."
+	}
+	renderMessage(w, http.StatusOK, "Device sign in", message)
+}
+
+// deviceError shows the device form again with what went wrong.
+func (h *handler) deviceError(w http.ResponseWriter, device oauth.DeviceRequest, email string, err error) {
+	switch {
+	case errors.Is(err, oauth.ErrInvalidUserCode):
+		h.renderDevice(w, http.StatusBadRequest, device, email, "The code is invalid or has expired.")
+	case errors.Is(err, oauth.ErrLoginFailed):
+		h.renderDevice(w, http.StatusUnauthorized, device, email, "Invalid email or password.")
+	case errors.Is(err, oauth.ErrAccessDenied):
+		h.renderDevice(w, http.StatusForbidden, device, email, "Your account is not allowed to use this app.")
+	default:
+		h.log.Error("device verification failed", slog.Any("error", err))
+		renderError(w, http.StatusInternalServerError, "Something went wrong, please try again later.")
+	}
+}
+
+func (h *handler) userInfo(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		// No error code when the request has no credentials (RFC 6750, section 3.1).
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": oauth.ErrInvalidToken.Code})
+		return
+	}
+
+	claims, err := h.oauth.UserInfo(r.Context(), token, r.Header.Get("Origin"))
+	if err != nil {
+		var oauthErr *oauth.Error
+		if !errors.As(err, &oauthErr) {
+			h.log.Error("userinfo request failed", slog.Any("error", err))
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+
+		status := http.StatusUnauthorized
+		if oauthErr.Code == oauth.ErrInsufficientScope.Code {
+			status = http.StatusForbidden
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="userinfo", error=%q`, oauthErr.Code))
+		writeJSON(w, status, errorBody(oauthErr))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, claims)
+}
+
+// logout sends the user back to the client after it logged them out, or says
+// they are signed out. The request is a query or a form, as the client chooses.
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "malformed form", http.StatusBadRequest)
+		return
+	}
+
+	req := oauth.LogoutRequest{
+		IDTokenHint:           r.Form.Get("id_token_hint"),
+		PostLogoutRedirectURI: r.Form.Get("post_logout_redirect_uri"),
+	}
+	if clientId := r.Form.Get("client_id"); clientId != "" {
+		id, err := strconv.Atoi(clientId)
+		if err != nil {
+			renderMessage(w, http.StatusBadRequest, "Sign out error", "unknown client")
+			return
+		}
+		req.ClientID = id
+	}
+
+	target, err := h.oauth.Logout(r.Context(), req)
+	if err != nil {
+		var oauthErr *oauth.Error
+		if !errors.As(err, &oauthErr) {
+			h.log.Error("logout failed", slog.Any("error", err))
+			renderMessage(w, http.StatusInternalServerError, "Sign out error", "Something went wrong, please try again later.")
+			return
+		}
+		renderMessage(w, http.StatusBadRequest, "Sign out error", oauthErr.Error())
+		return
+	}
+
+	if target == "" {
+		renderMessage(w, http.StatusOK, "Signed out", "You are signed out. You can close this page.")
+		return
+	}
+
+	redirect(w, r, target, url.Values{"state": {r.Form.Get("state")}})
+}
+
+func (h *handler) jwks(w http.ResponseWriter, _ *http.Request) {
+	writePublicJSON(w, h.oauth.JWKS())
+}
+
+func (h *handler) discovery(w http.ResponseWriter, _ *http.Request) {
+	writePublicJSON(w, h.oauth.Metadata())
+}
+
+// tokenRequest reads a request to the token endpoint, or to another endpoint
+// authenticating the client the same way. basic tells whether the client used
+// HTTP Basic authentication.
+func tokenRequest(r *http.Request) (req oauth.TokenRequest, basic bool, err error) {
+	if err := r.ParseForm(); err != nil {
+		return oauth.TokenRequest{}, false, oauth.ErrInvalidRequest
+	}
+
+	form := r.PostForm
+	clientId, clientSecret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-encoded before being put in the header (RFC 6749, section 2.3.1).
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientId, clientSecret = form.Get("client_id"), form.Get("client_secret")
+	}
+
+	req = oauth.TokenRequest{
+		GrantType:           form.Get("grant_type"),
+		ClientSecret:        clientSecret,
+		ClientAssertionType: form.Get("client_assertion_type"),
+		ClientAssertion:     form.Get("client_assertion"),
+		Code:                form.Get("code"),
+		RedirectURI:         form.Get("redirect_uri"),
+		CodeVerifier:        form.Get("code_verifier"),
+		DeviceCode:          form.Get("device_code"),
+		SubjectToken:        form.Get("subject_token"),
+		SubjectTokenType:    form.Get("subject_token_type"),
+		ActorToken:          form.Get("actor_token"),
+		ActorTokenType:      form.Get("actor_token_type"),
+		Audience:            form.Get("audience"),
+		Scopes:              strings.Fields(form.Get("scope")),
+		Token:               form.Get("token"),
+		Origin:              r.Header.Get("Origin"),
+	}
+
+	// The client id can be left out with a client assertion, which names the client itself.
+	if clientId != "" || req.ClientAssertion == "" {
+		id, err := strconv.Atoi(clientId)
+		if err != nil {
+			return oauth.TokenRequest{}, basic, &oauth.Error{Code: oauth.ErrInvalidClient.Code, Description: "unknown client"}
+		}
+		req.ClientID = id
+	}
+
+	return req, basic, nil
+}
+
+func authorizeRequest(values url.Values) (oauth.AuthorizeRequest, error) {
+	req := oauth.AuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scopes:              strings.Fields(values.Get("scope")),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+
+	clientId, err := strconv.Atoi(values.Get("client_id"))
+	if err != nil {
+		return req, &oauth.Error{Code: oauth.ErrInvalidClient.Code, Description: "unknown client"}
+	}
+	req.ClientID = clientId
+
+	return req, nil
+}
+
+// authorizeQuery is the inverse of authorizeRequest.
+func authorizeQuery(req oauth.AuthorizeRequest) url.Values {
+	values := url.Values{"client_id": {strconv.Itoa(req.ClientID)}}
+	for key, value := range map[string]string{
+		"response_type":         req.ResponseType,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 strings.Join(req.Scopes, " "),
+		"state":                 req.State,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+		"nonce":                 req.Nonce,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	return values
+}
+
+// redirect sends the user agent to the redirect URI with the params added to its query.
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		renderError(w, http.StatusBadRequest, "invalid redirect uri")
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		query.Set(key, values[0])
+	}
+	target.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// writeTokenError writes the error as a JSON token error response (RFC 6749, section 5.2).
+func (h *handler) writeTokenError(w http.ResponseWriter, err error, basic bool) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		h.log.Error("token request failed", slog.Any("error", err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == oauth.ErrInvalidClient.Code {
+		status = http.StatusUnauthorized
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+	}
+
+	writeJSON(w, status, errorBody(oauthErr))
+}
+
+func errorBody(oauthErr *oauth.Error) map[string]string {
+	body := map[string]string{"error": oauthErr.Code}
+	if oauthErr.Description != "" {
+		body["error_description"] = oauthErr.Description
+	}
+
+	return body
+}
+
+// writePublicJSON writes a document that is the same for everyone and may be cached.
+func writePublicJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+  <input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+  <input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+  <input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+  <input type="hidden" name="scope" value="{{.Scope}}">
+  <input type="hidden" name="state" value="{{.Req.State}}">
+  <input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+  <input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+  <input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+  <label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label>
+  <label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+  <button type="submit">Sign in</button>
+</form>
+{{range .Providers}}<p><a href="{{.URL}}">Sign in with {{.DisplayName}}</a></p>
+{{end}}</body>
+</html>
+`))
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Allow access</title></head>
+<body>
+<h1>Allow access</h1>
+<p>{{.Prompt.AppName}} is asking for access to your account{{if .Prompt.Scopes}}: {{.Scope}}{{end}}.</p>
+<p>You can revoke it at any time.</p>
+<form method="post" action="/authorize/consent">
+  <input type="hidden" name="challenge" value="{{.Prompt.Challenge}}">
+  <button type="submit" name="action" value="approve">Allow</button>
+  <button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in error</title></head>
+<body>
+<h1>Sign in error</h1>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Sign in a device</title></head>
+<body>
+<h1>Sign in a device</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+{{if .Device.AppName}}<p>{{.Device.AppName}} is asking for access{{if .Device.Scopes}} to: {{.Scope}}{{end}}.</p>{{end}}
+<form method="post" action="/device">
+  <label>Code shown on the device <input type="text" name="user_code" value="{{.Device.UserCode}}" autocomplete="off" required></label>
+  <label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label>
+  <label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+  <button type="submit" name="action" value="approve">Approve</button>
+  <button type="submit" name="action" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+var messagePage = template.Must(template.New("message").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`))
+
+func (h *handler) renderLogin(w http.ResponseWriter, status int, req oauth.AuthorizeRequest, email string, message string) {
+	setPageHeaders(w)
+	w.WriteHeader(status)
+
+	type provider struct {
+		DisplayName string
+		URL         string
+	}
+	query := authorizeQuery(req).Encode()
+	var providers []provider
+	for _, p := range h.federation.Providers() {
+		path := strings.Replace(federation.StartPath, "{provider}", url.PathEscape(p.Name), 1)
+		providers = append(providers, provider{DisplayName: p.DisplayName, URL: path + "?" + query})
+	}
+
+	err := loginPage.Execute(w, struct {
+		Req       oauth.AuthorizeRequest
+		Scope     string
+		Email     string
+		Error     string
+		Providers []provider
+	}{req, strings.Join(req.Scopes, " "), email, message, providers})
+	if err != nil {
+		h.log.Error("failed to render login page", slog.Any("error", err))
+	}
+}
+
+func (h *handler) renderConsent(w http.ResponseWriter, prompt oauth.ConsentPrompt) {
+	setPageHeaders(w)
+	w.WriteHeader(http.StatusOK)
+
+	err := consentPage.Execute(w, struct {
+		Prompt oauth.ConsentPrompt
+		Scope  string
+	}{prompt, strings.Join(prompt.Scopes, " ")})
+	if err != nil {
+		h.log.Error("failed to render consent page", slog.Any("error", err))
+	}
+}
+
+func (h *handler) renderDevice(w http.ResponseWriter, status int, device oauth.DeviceRequest, email string, message string) {
+	setPageHeaders(w)
+	w.WriteHeader(status)
+
+	err := devicePage.Execute(w, struct {
+		Device oauth.DeviceRequest
+		Scope  string
+		Email  string
+		Error  string
+	}{device, strings.Join(device.Scopes, " "), email, message})
+	if err != nil {
+		h.log.Error("failed to render device page", slog.Any("error", err))
+	}
+}
+
+func renderMessage(w http.ResponseWriter, status int, title string, message string) {
+	setPageHeaders(w)
+	w.WriteHeader(status)
+	_ = messagePage.Execute(w, struct {
+		Title   string
+		Message string
+	}{title, message})
+}
+
+func renderError(w http.ResponseWriter, status int, message string) {
+	setPageHeaders(w)
+	w.WriteHeader(status)
+	_ = errorPage.Execute(w, message)
+}
+
+// setPageHeaders keeps the pages out of caches and frames, so the login form
+// can't be clickjacked.
+func setPageHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
@@ -0,0 +1,773 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve sends the request to the endpoints. The registration endpoints are
+// only added with a registration service.
+func serve(
+	oauthService OAuth,
+	federationService Federation,
+	registrationService Registration,
+	req *http.Request,
+) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	Register(mux, slog.Default(), oauthService, federationService, registrationService)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// formRequest returns a POST request with the form as its body.
+func formRequest(target string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	var body map[string]any
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&body))
+
+	return body
+}
+
+func TestHandler_authorize(t *testing.T) {
+	prefixName := "oauth handler"
+	authorizeReq := oauth.AuthorizeRequest{
+		ResponseType:        oauth.ResponseTypeCode,
+		ClientID:            3,
+		RedirectURI:         "https://app.example.com/callback",
+		Scopes:              []string{"openid"},
+		State:               "xyz",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+	}
+	query := authorizeQuery(authorizeReq)
+	type test struct {
+		name         string
+		req          func() *http.Request
+		prepare      func(m *MockOAuth)
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize form success test"),
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, oauth.AuthorizePath+"?"+query.Encode(), nil)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().CheckAuthorizeRequest(gomock.Any(), authorizeReq).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `name="code_challenge" value="challenge"`,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize form negative test: redirect uri mismatch"),
+			req: func() *http.Request {
+				mismatch := authorizeQuery(authorizeReq)
+				mismatch.Set("redirect_uri", "https://evil.example.com/callback")
+				return httptest.NewRequest(http.MethodGet, oauth.AuthorizePath+"?"+mismatch.Encode(), nil)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().CheckAuthorizeRequest(gomock.Any(), gomock.Any()).
+					Return(fmt.Errorf("oauth.CheckAuthorizeRequest: %w", oauth.ErrRedirectURIMismatch))
+			},
+			// Shown to the user: redirecting would make the server an open redirector.
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "redirect_uri is not registered for the client",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize form negative test: no code challenge"),
+			req: func() *http.Request {
+				withoutPKCE := authorizeQuery(authorizeReq)
+				withoutPKCE.Del("code_challenge")
+				withoutPKCE.Del("code_challenge_method")
+				return httptest.NewRequest(http.MethodGet, oauth.AuthorizePath+"?"+withoutPKCE.Encode(), nil)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().CheckAuthorizeRequest(gomock.Any(), gomock.Any()).Return(fmt.Errorf("oauth.CheckAuthorizeRequest: %w",
+					&oauth.Error{Code: oauth.ErrInvalidRequest.Code, Description: "code_challenge is required"}))
+			},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://app.example.com/callback?error=invalid_request&error_description=code_challenge+is+required&state=xyz",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize form negative test: malformed client id"),
+			req: func() *http.Request {
+				unknown := authorizeQuery(authorizeReq)
+				unknown.Set("client_id", "app")
+				return httptest.NewRequest(http.MethodGet, oauth.AuthorizePath+"?"+unknown.Encode(), nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "unknown client",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize success test"),
+			req: func() *http.Request {
+				form := authorizeQuery(authorizeReq)
+				form.Set("email", "user@mail.com")
+				form.Set("password", "password")
+				return formRequest(oauth.AuthorizePath, form)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Authorize(gomock.Any(), authorizeReq, "user@mail.com", "password").
+					Return(oauth.Authorization{Code: "code"}, nil)
+			},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://app.example.com/callback?code=code&state=xyz",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: wrong password"),
+			req: func() *http.Request {
+				form := authorizeQuery(authorizeReq)
+				form.Set("email", "user@mail.com")
+				form.Set("password", "wrong")
+				return formRequest(oauth.AuthorizePath, form)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Authorize(gomock.Any(), authorizeReq, "user@mail.com", "wrong").
+					Return(oauth.Authorization{}, fmt.Errorf("oauth.Authorize: %w", oauth.ErrLoginFailed))
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Invalid email or password.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+			federationService := NewMockFederation(ctrl)
+			federationService.EXPECT().Providers().AnyTimes().Return(nil)
+
+			rec := serve(service, federationService, nil, tt.req())
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestHandler_authorizationCode(t *testing.T) {
+	prefixName := "oauth handler"
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"3"},
+		"code":          {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"code_verifier": {"verifier"},
+	}
+	tokenReq := oauth.TokenRequest{
+		GrantType:    oauth.GrantTypeAuthorizationCode,
+		ClientID:     3,
+		Code:         "code",
+		RedirectURI:  "https://app.example.com/callback",
+		CodeVerifier: "verifier",
+		Scopes:       []string{},
+	}
+	type test struct {
+		name       string
+		form       url.Values
+		prepare    func(m *MockOAuth)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorization code success test"),
+			form: form,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Exchange(gomock.Any(), tokenReq).Return(oauth.TokenResponse{
+					AccessToken: "access-token",
+					TokenType:   "Bearer",
+					ExpiresIn:   time.Hour,
+					Scopes:      []string{"openid"},
+					IDToken:     "id-token",
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "access-token", body["access_token"])
+				assert.Equal(t, "id-token", body["id_token"])
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorization code negative test: code verifier mismatch"),
+			form: form,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Exchange(gomock.Any(), tokenReq).Return(oauth.TokenResponse{}, fmt.Errorf("oauth.Exchange: %w",
+					&oauth.Error{Code: oauth.ErrInvalidGrant.Code, Description: "code_verifier does not match"}))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_grant", body["error"])
+				assert.Equal(t, "code_verifier does not match", body["error_description"])
+				assert.NotContains(t, body, "access_token")
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "token negative test: unsupported grant type"),
+			form:       url.Values{"grant_type": {"password"}, "client_id": {"3"}},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "unsupported_grant_type", body["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(service, nil, nil, formRequest(oauth.TokenPath, tt.form))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			tt.check(t, decodeBody(t, rec))
+		})
+	}
+}
+
+func TestHandler_clientCredentials(t *testing.T) {
+	prefixName := "oauth handler"
+	type test struct {
+		name          string
+		form          url.Values
+		basic         []string
+		prepare       func(m *MockOAuth)
+		wantStatus    int
+		wantChallenge string
+		check         func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "client credentials with basic authentication success test"),
+			form:  url.Values{"grant_type": {"client_credentials"}, "scope": {"orders.read"}},
+			basic: []string{"3", "secret"},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().ClientCredentials(gomock.Any(), oauth.TokenRequest{
+					GrantType:    oauth.GrantTypeClientCredentials,
+					ClientID:     3,
+					ClientSecret: "secret",
+					Scopes:       []string{"orders.read"},
+				}).Return(oauth.TokenResponse{
+					AccessToken: "service-token",
+					TokenType:   "Bearer",
+					ExpiresIn:   time.Hour,
+					Scopes:      []string{"orders.read"},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "service-token", body["access_token"])
+				assert.Equal(t, float64(3600), body["expires_in"])
+				assert.Equal(t, "orders.read", body["scope"])
+				assert.NotContains(t, body, "id_token")
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials with a client assertion success test"),
+			form: url.Values{
+				"grant_type":            {"client_credentials"},
+				"client_assertion_type": {oauth.ClientAssertionTypeJWTBearer},
+				"client_assertion":      {"assertion"},
+			},
+			prepare: func(m *MockOAuth) {
+				// The assertion names the client, the handler leaves the id to the service.
+				m.EXPECT().ClientCredentials(gomock.Any(), oauth.TokenRequest{
+					GrantType:           oauth.GrantTypeClientCredentials,
+					ClientAssertionType: oauth.ClientAssertionTypeJWTBearer,
+					ClientAssertion:     "assertion",
+					Scopes:              []string{},
+				}).Return(oauth.TokenResponse{AccessToken: "service-token", TokenType: "Bearer", ExpiresIn: time.Hour}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.NotContains(t, body, "scope")
+			},
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: wrong secret"),
+			form:  url.Values{"grant_type": {"client_credentials"}},
+			basic: []string{"3", "wrong"},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().ClientCredentials(gomock.Any(), gomock.Any()).
+					Return(oauth.TokenResponse{}, fmt.Errorf("oauth.ClientCredentials: %w", oauth.ErrInvalidClient))
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Basic realm="token"`,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client", body["error"])
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: grant not enabled"),
+			form: url.Values{"grant_type": {"client_credentials"}, "client_id": {"3"}, "client_secret": {"secret"}},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().ClientCredentials(gomock.Any(), gomock.Any()).Return(oauth.TokenResponse{},
+					&oauth.Error{Code: oauth.ErrUnauthorizedClient.Code, Description: "the client credentials grant is not enabled for the client"})
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "unauthorized_client", body["error"])
+				assert.NotEmpty(t, body["error_description"])
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: malformed client id"),
+			form:       url.Values{"grant_type": {"client_credentials"}, "client_id": {"orders"}, "client_secret": {"secret"}},
+			wantStatus: http.StatusUnauthorized,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client", body["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			req := formRequest(oauth.TokenPath, tt.form)
+			if tt.basic != nil {
+				req.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+
+			rec := serve(service, nil, nil, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantChallenge, rec.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			tt.check(t, decodeBody(t, rec))
+		})
+	}
+}
+
+func TestHandler_deviceCode(t *testing.T) {
+	prefixName := "oauth handler"
+	pollForm := url.Values{
+		"grant_type":  {oauth.GrantTypeDeviceCode},
+		"client_id":   {"3"},
+		"device_code": {"device-code"},
+	}
+	pollReq := oauth.TokenRequest{
+		GrantType:  oauth.GrantTypeDeviceCode,
+		ClientID:   3,
+		DeviceCode: "device-code",
+		Scopes:     []string{},
+	}
+	type test struct {
+		name       string
+		target     string
+		form       url.Values
+		prepare    func(m *MockOAuth)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device authorization success test"),
+			target: oauth.DeviceAuthorizationPath,
+			form:   url.Values{"client_id": {"3"}, "scope": {"openid profile"}},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().AuthorizeDevice(gomock.Any(), oauth.TokenRequest{ClientID: 3, Scopes: []string{"openid", "profile"}}).
+					Return(oauth.DeviceAuthorization{
+						DeviceCode:              "device-code",
+						UserCode:                "BCDF-GHJK",
+						VerificationURI:         "https://sso.example.com/device",
+						VerificationURIComplete: "https://sso.example.com/device?user_code=BCDF-GHJK",
+						ExpiresIn:               10 * time.Minute,
+						Interval:                5 * time.Second,
+					}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "device-code", body["device_code"])
+				assert.Equal(t, "BCDF-GHJK", body["user_code"])
+				assert.Equal(t, "https://sso.example.com/device", body["verification_uri"])
+				assert.Equal(t, "https://sso.example.com/device?user_code=BCDF-GHJK", body["verification_uri_complete"])
+				assert.Equal(t, float64(600), body["expires_in"])
+				assert.Equal(t, float64(5), body["interval"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device authorization negative test: grant not enabled"),
+			target: oauth.DeviceAuthorizationPath,
+			form:   url.Values{"client_id": {"3"}},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().AuthorizeDevice(gomock.Any(), gomock.Any()).Return(oauth.DeviceAuthorization{},
+					&oauth.Error{Code: oauth.ErrUnauthorizedClient.Code, Description: "the device code grant is not enabled for the client"})
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "unauthorized_client", body["error"])
+				assert.NotContains(t, body, "device_code")
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device token success test"),
+			target: oauth.TokenPath,
+			form:   pollForm,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().DeviceToken(gomock.Any(), pollReq).Return(oauth.TokenResponse{
+					AccessToken: "access-token",
+					TokenType:   "Bearer",
+					ExpiresIn:   time.Hour,
+					Scopes:      []string{"openid", "profile"},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "access-token", body["access_token"])
+				assert.Equal(t, "openid profile", body["scope"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device token negative test: authorization pending"),
+			target: oauth.TokenPath,
+			form:   pollForm,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().DeviceToken(gomock.Any(), pollReq).
+					Return(oauth.TokenResponse{}, fmt.Errorf("oauth.DeviceToken: %w", oauth.ErrAuthorizationPending))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "authorization_pending", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device token negative test: slow down"),
+			target: oauth.TokenPath,
+			form:   pollForm,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().DeviceToken(gomock.Any(), pollReq).
+					Return(oauth.TokenResponse{}, fmt.Errorf("oauth.DeviceToken: %w", oauth.ErrSlowDown))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "slow_down", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "device token negative test: expired device code"),
+			target: oauth.TokenPath,
+			form:   pollForm,
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().DeviceToken(gomock.Any(), pollReq).
+					Return(oauth.TokenResponse{}, fmt.Errorf("oauth.DeviceToken: %w", oauth.ErrExpiredToken))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "expired_token", body["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(service, nil, nil, formRequest(tt.target, tt.form))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			tt.check(t, decodeBody(t, rec))
+		})
+	}
+}
+
+func TestHandler_deviceVerification(t *testing.T) {
+	prefixName := "oauth handler"
+	verifyForm := func(password string, action string) url.Values {
+		return url.Values{
+			"user_code": {"BCDF-GHJK"},
+			"email":     {"user@mail.com"},
+			"password":  {password},
+			"action":    {action},
+		}
+	}
+	type test struct {
+		name       string
+		req        func() *http.Request
+		prepare    func(m *MockOAuth)
+		wantStatus int
+		wantBody   string
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device form success test"),
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, oauth.DeviceVerificationPath+"?user_code=BCDF-GHJK", nil)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().LookupDevice(gomock.Any(), "BCDF-GHJK").Return(oauth.DeviceRequest{
+					UserCode: "BCDF-GHJK",
+					AppName:  "cli",
+					Scopes:   []string{"openid", "profile"},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "cli is asking for access to: openid profile.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device form success test: no user code"),
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, oauth.DeviceVerificationPath, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `name="user_code" value=""`,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device form negative test: invalid user code"),
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, oauth.DeviceVerificationPath+"?user_code=XXXX-XXXX", nil)
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().LookupDevice(gomock.Any(), "XXXX-XXXX").
+					Return(oauth.DeviceRequest{}, fmt.Errorf("oauth.LookupDevice: %w", oauth.ErrInvalidUserCode))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "The code is invalid or has expired.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device success test: approve"),
+			req: func() *http.Request {
+				return formRequest(oauth.DeviceVerificationPath, verifyForm("password", "approve"))
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().VerifyDevice(gomock.Any(), "BCDF-GHJK", "user@mail.com", "password", true).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "The device is signed in.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device success test: deny"),
+			req: func() *http.Request {
+				return formRequest(oauth.DeviceVerificationPath, verifyForm("password", "deny"))
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().VerifyDevice(gomock.Any(), "BCDF-GHJK", "user@mail.com", "password", false).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "The device was denied access.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: wrong password"),
+			req: func() *http.Request {
+				return formRequest(oauth.DeviceVerificationPath, verifyForm("wrong", "approve"))
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().VerifyDevice(gomock.Any(), "BCDF-GHJK", "user@mail.com", "wrong", true).
+					Return(fmt.Errorf("oauth.VerifyDevice: %w", oauth.ErrLoginFailed))
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Invalid email or password.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: access denied"),
+			req: func() *http.Request {
+				return formRequest(oauth.DeviceVerificationPath, verifyForm("password", "approve"))
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().VerifyDevice(gomock.Any(), "BCDF-GHJK", "user@mail.com", "password", true).
+					Return(fmt.Errorf("oauth.VerifyDevice: %w", oauth.ErrAccessDenied))
+			},
+			wantStatus: http.StatusForbidden,
+			wantBody:   "Your account is not allowed to use this app.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(service, nil, nil, tt.req())
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestHandler_logout(t *testing.T) {
+	prefixName := "oauth handler"
+	type test struct {
+		name         string
+		query        url.Values
+		prepare      func(m *MockOAuth)
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout success test: registered post logout redirect uri"),
+			query: url.Values{
+				"client_id":                {"3"},
+				"post_logout_redirect_uri": {"https://app.example.com/signed-out"},
+				"state":                    {"xyz"},
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Logout(gomock.Any(), oauth.LogoutRequest{
+					ClientID:              3,
+					PostLogoutRedirectURI: "https://app.example.com/signed-out",
+				}).Return("https://app.example.com/signed-out", nil)
+			},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://app.example.com/signed-out?state=xyz",
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "logout success test: no redirect"),
+			query: url.Values{"id_token_hint": {"id-token"}},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Logout(gomock.Any(), oauth.LogoutRequest{IDTokenHint: "id-token"}).Return("", nil)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "You are signed out.",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout negative test: unregistered post logout redirect uri"),
+			query: url.Values{
+				"client_id":                {"3"},
+				"post_logout_redirect_uri": {"https://evil.example.com"},
+			},
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Logout(gomock.Any(), gomock.Any()).Return("", fmt.Errorf("oauth.Logout: %w",
+					&oauth.Error{Code: oauth.ErrInvalidRequest.Code, Description: "post_logout_redirect_uri is not registered for the client"}))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "post_logout_redirect_uri is not registered for the client",
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "logout negative test: malformed client id"),
+			query:      url.Values{"client_id": {"calendar"}},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "unknown client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			rec := serve(service, nil, nil, httptest.NewRequest(http.MethodGet, oauth.LogoutPath+"?"+tt.query.Encode(), nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestHandler_introspect(t *testing.T) {
+	prefixName := "oauth handler"
+	type test struct {
+		name       string
+		prepare    func(m *MockOAuth)
+		wantStatus int
+		check      func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "introspect success test"),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Introspect(gomock.Any(), oauth.TokenRequest{
+					ClientID:     3,
+					ClientSecret: "secret",
+					Scopes:       []string{},
+					Token:        "access-token",
+				}).Return(map[string]any{"active": true, "client_id": "4", "scope": "orders:read"}, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, true, body["active"])
+				assert.Equal(t, "4", body["client_id"])
+				assert.Equal(t, "orders:read", body["scope"])
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "introspect negative test: client authentication failed"),
+			prepare: func(m *MockOAuth) {
+				m.EXPECT().Introspect(gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("oauth.Introspect: %w", oauth.ErrInvalidClient))
+			},
+			wantStatus: http.StatusUnauthorized,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client", body["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockOAuth(ctrl)
+			tt.prepare(service)
+
+			req := formRequest(oauth.IntrospectionPath, url.Values{"token": {"access-token"}})
+			req.SetBasicAuth("3", "secret")
+
+			rec := serve(service, nil, nil, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			tt.check(t, decodeBody(t, rec))
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+)
+
+// maxMetadataBytes bounds the body of a client registration request.
+const maxMetadataBytes = 64 << 10
+
+type Registration interface {
+	RegisterClient(ctx context.Context, initialAccessToken string, md apps.ClientMetadata) (apps.ClientInformation, error)
+	ReadClient(ctx context.Context, clientId int, token string) (apps.ClientInformation, error)
+	UpdateClient(ctx context.Context, clientId int, token string, md apps.ClientMetadata) (apps.ClientInformation, error)
+	DeleteClient(ctx context.Context, clientId int, token string) error
+}
+
+// clientMetadata is the JSON client metadata of RFC 7591, section 2. Fields
+// not listed are ignored, as the RFC requires.
+type clientMetadata struct {
+	ClientID                string   `json:"client_id,omitempty"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	Contacts                []string `json:"contacts,omitempty"`
+}
+
+// clientInformation is the JSON client information response of RFC 7591,
+// section 3.2.1, with the fields RFC 7592 adds.
+type clientInformation struct {
+	clientMetadata
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+func (h *handler) registerClient(w http.ResponseWriter, r *http.Request) {
+	md, err := readClientMetadata(w, r)
+	if err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	info, err := h.registration.RegisterClient(r.Context(), bearerToken(r), md)
+	if err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, clientInformationBody(info))
+}
+
+func (h *handler) readClient(w http.ResponseWriter, r *http.Request) {
+	clientId, err := strconv.Atoi(r.PathValue("client_id"))
+	if err != nil {
+		h.writeRegistrationError(w, apps.ErrInvalidRegistrationToken)
+		return
+	}
+
+	info, err := h.registration.ReadClient(r.Context(), clientId, bearerToken(r))
+	if err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, clientInformationBody(info))
+}
+
+func (h *handler) updateClient(w http.ResponseWriter, r *http.Request) {
+	clientId, err := strconv.Atoi(r.PathValue("client_id"))
+	if err != nil {
+		h.writeRegistrationError(w, apps.ErrInvalidRegistrationToken)
+		return
+	}
+
+	md, err := readClientMetadata(w, r)
+	if err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	info, err := h.registration.UpdateClient(r.Context(), clientId, bearerToken(r), md)
+	if err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, clientInformationBody(info))
+}
+
+func (h *handler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	clientId, err := strconv.Atoi(r.PathValue("client_id"))
+	if err != nil {
+		h.writeRegistrationError(w, apps.ErrInvalidRegistrationToken)
+		return
+	}
+
+	if err := h.registration.DeleteClient(r.Context(), clientId, bearerToken(r)); err != nil {
+		h.writeRegistrationError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readClientMetadata reads the client metadata of a registration or update
+// request. The client ID of an update must be the one in the URL.
+func readClientMetadata(w http.ResponseWriter, r *http.Request) (apps.ClientMetadata, error) {
+	var body clientMetadata
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMetadataBytes)).Decode(&body); err != nil {
+		return apps.ClientMetadata{}, fmt.Errorf("%w: malformed json", apps.ErrInvalidClientMetadata)
+	}
+
+	if body.ClientID != "" && body.ClientID != r.PathValue("client_id") {
+		return apps.ClientMetadata{}, fmt.Errorf("%w: client_id does not match", apps.ErrInvalidClientMetadata)
+	}
+	for _, responseType := range body.ResponseTypes {
+		if responseType != oauth.ResponseTypeCode {
+			return apps.ClientMetadata{}, fmt.Errorf("%w: only the code response type is supported",
+				apps.ErrInvalidClientMetadata)
+		}
+	}
+
+	return apps.ClientMetadata{
+		ClientName:              body.ClientName,
+		RedirectURIs:            body.RedirectURIs,
+		GrantTypes:              body.GrantTypes,
+		TokenEndpointAuthMethod: body.TokenEndpointAuthMethod,
+		Scopes:                  strings.Fields(body.Scope),
+		LogoURI:                 body.LogoURI,
+		Contacts:                body.Contacts,
+	}, nil
+}
+
+func clientInformationBody(info apps.ClientInformation) clientInformation {
+	body := clientInformation{
+		clientMetadata: clientMetadata{
+			ClientID:                strconv.Itoa(info.ClientID),
+			ClientName:              info.ClientName,
+			RedirectURIs:            info.RedirectURIs,
+			GrantTypes:              info.GrantTypes,
+			TokenEndpointAuthMethod: info.TokenEndpointAuthMethod,
+			Scope:                   strings.Join(info.Scopes, " "),
+			LogoURI:                 info.LogoURI,
+			Contacts:                info.Contacts,
+		},
+		ClientSecret:            info.ClientSecret,
+		ClientIDIssuedAt:        info.ClientIDIssuedAt.Unix(),
+		RegistrationAccessToken: info.RegistrationAccessToken,
+		RegistrationClientURI:   info.RegistrationClientURI,
+	}
+	if slices.Contains(info.GrantTypes, oauth.GrantTypeAuthorizationCode) {
+		body.ResponseTypes = []string{oauth.ResponseTypeCode}
+	}
+	if info.ClientSecret != "" {
+		// Secrets don't expire, they are rotated by an admin.
+		var never int64
+		body.ClientSecretExpiresAt = &never
+	}
+
+	return body
+}
+
+// writeRegistrationError writes the error as a client registration error
+// response (RFC 7591, section 3.2.2), or as a bearer token error when the
+// request is not authorized (RFC 7592, section 2).
+func (h *handler) writeRegistrationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, apps.ErrInvalidInitialAccessToken), errors.Is(err, apps.ErrInvalidRegistrationToken):
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="register", error=%q`, oauth.ErrInvalidToken.Code))
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": oauth.ErrInvalidToken.Code})
+	case errors.Is(err, apps.ErrInvalidURI):
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_redirect_uri",
+			"error_description": errorDescription(err, apps.ErrInvalidURI),
+		})
+	case errors.Is(err, apps.ErrInvalidClientMetadata):
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_client_metadata",
+			"error_description": errorDescription(err, apps.ErrInvalidClientMetadata),
+		})
+	default:
+		h.log.Error("client registration request failed", slog.Any("error", err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+	}
+}
+
+// errorDescription returns what the error says after the sentinel it wraps.
+func errorDescription(err error, sentinel error) string {
+	_, description, _ := strings.Cut(err.Error(), sentinel.Error()+": ")
+
+	return description
+}
+
+// bearerToken returns the bearer token the request is authorized with.
+func bearerToken(r *http.Request) string {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return token
+}
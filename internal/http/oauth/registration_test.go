@@ -0,0 +1,276 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/services/apps"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_registration(t *testing.T) {
+	prefixName := "oauth handler"
+	md := apps.ClientMetadata{
+		ClientName:   "calendar",
+		RedirectURIs: []string{"https://calendar.example.com/callback"},
+		GrantTypes:   []string{oauth.GrantTypeAuthorizationCode},
+		Scopes:       []string{"openid", "email"},
+	}
+	info := apps.ClientInformation{
+		ClientMetadata:          md,
+		ClientID:                7,
+		ClientIDIssuedAt:        time.Unix(1700000000, 0),
+		RegistrationAccessToken: "registration-token",
+		RegistrationClientURI:   "https://sso.example.com/register/7",
+	}
+	mdBody := `{"client_name": "calendar", "redirect_uris": ["https://calendar.example.com/callback"],
+		"grant_types": ["authorization_code"], "response_types": ["code"], "scope": "openid email"}`
+	type test struct {
+		name          string
+		method        string
+		target        string
+		bearer        string
+		body          string
+		prepare       func(m *MockRegistration)
+		wantStatus    int
+		wantChallenge string
+		check         func(t *testing.T, body map[string]any)
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "register client success test"),
+			method: http.MethodPost,
+			target: oauth.RegistrationPath,
+			bearer: "initial-token",
+			body:   mdBody,
+			prepare: func(m *MockRegistration) {
+				registered := info
+				registered.ClientSecret = "secret"
+				m.EXPECT().RegisterClient(gomock.Any(), "initial-token", md).Return(registered, nil)
+			},
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "7", body["client_id"])
+				assert.Equal(t, "secret", body["client_secret"])
+				assert.Equal(t, float64(0), body["client_secret_expires_at"])
+				assert.Equal(t, float64(1700000000), body["client_id_issued_at"])
+				assert.Equal(t, "openid email", body["scope"])
+				assert.Equal(t, []any{"code"}, body["response_types"])
+				assert.Equal(t, "registration-token", body["registration_access_token"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "register client negative test: invalid initial access token"),
+			method: http.MethodPost,
+			target: oauth.RegistrationPath,
+			bearer: "wrong",
+			body:   mdBody,
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().RegisterClient(gomock.Any(), "wrong", md).
+					Return(apps.ClientInformation{}, fmt.Errorf("apps.RegisterClient: %w", apps.ErrInvalidInitialAccessToken))
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="register", error="invalid_token"`,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_token", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "register client negative test: unregistrable redirect uri"),
+			method: http.MethodPost,
+			target: oauth.RegistrationPath,
+			bearer: "initial-token",
+			body:   `{"client_name": "calendar", "redirect_uris": ["http://calendar.example.com/callback"]}`,
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().RegisterClient(gomock.Any(), "initial-token", gomock.Any()).Return(apps.ClientInformation{},
+					fmt.Errorf("apps.RegisterClient: %w: http is only allowed for loopback addresses", apps.ErrInvalidURI))
+			},
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_redirect_uri", body["error"])
+				assert.Equal(t, "http is only allowed for loopback addresses", body["error_description"])
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "register client negative test: unsupported response type"),
+			method:     http.MethodPost,
+			target:     oauth.RegistrationPath,
+			bearer:     "initial-token",
+			body:       `{"client_name": "calendar", "response_types": ["token"]}`,
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client_metadata", body["error"])
+				assert.Equal(t, "only the code response type is supported", body["error_description"])
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "register client negative test: malformed json"),
+			method:     http.MethodPost,
+			target:     oauth.RegistrationPath,
+			bearer:     "initial-token",
+			body:       `{"client_name": `,
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client_metadata", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "read client success test"),
+			method: http.MethodGet,
+			target: oauth.RegistrationPath + "/7",
+			bearer: "registration-token",
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().ReadClient(gomock.Any(), 7, "registration-token").Return(info, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "calendar", body["client_name"])
+				assert.NotContains(t, body, "client_secret")
+				assert.NotContains(t, body, "client_secret_expires_at")
+			},
+		},
+		{
+			name:          fmt.Sprintf("%s: %s", prefixName, "read client negative test: malformed client id"),
+			method:        http.MethodGet,
+			target:        oauth.RegistrationPath + "/calendar",
+			bearer:        "registration-token",
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="register", error="invalid_token"`,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_token", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "update client success test"),
+			method: http.MethodPut,
+			target: oauth.RegistrationPath + "/7",
+			bearer: "registration-token",
+			body:   `{"client_id": "7", "client_name": "calendar", "redirect_uris": ["https://calendar.example.com/callback"], "grant_types": ["authorization_code"], "scope": "openid email"}`,
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().UpdateClient(gomock.Any(), 7, "registration-token", md).Return(info, nil)
+			},
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "7", body["client_id"])
+			},
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "update client negative test: client id mismatch"),
+			method:     http.MethodPut,
+			target:     oauth.RegistrationPath + "/7",
+			bearer:     "registration-token",
+			body:       `{"client_id": "8", "client_name": "calendar"}`,
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_client_metadata", body["error"])
+				assert.Equal(t, "client_id does not match", body["error_description"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "update client negative test: invalid registration access token"),
+			method: http.MethodPut,
+			target: oauth.RegistrationPath + "/7",
+			bearer: "wrong",
+			body:   mdBody,
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().UpdateClient(gomock.Any(), 7, "wrong", md).
+					Return(apps.ClientInformation{}, fmt.Errorf("apps.UpdateClient: %w", apps.ErrInvalidRegistrationToken))
+			},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="register", error="invalid_token"`,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "invalid_token", body["error"])
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "read client negative test: internal error"),
+			method: http.MethodGet,
+			target: oauth.RegistrationPath + "/7",
+			bearer: "registration-token",
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().ReadClient(gomock.Any(), 7, "registration-token").
+					Return(apps.ClientInformation{}, fmt.Errorf("apps.ReadClient: database is locked"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			check: func(t *testing.T, body map[string]any) {
+				assert.Equal(t, "server_error", body["error"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockRegistration(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.bearer)
+
+			rec := serve(nil, nil, service, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantChallenge, rec.Header().Get("WWW-Authenticate"))
+			tt.check(t, decodeBody(t, rec))
+		})
+	}
+}
+
+func TestHandler_deleteClient(t *testing.T) {
+	prefixName := "oauth handler"
+	type test struct {
+		name       string
+		target     string
+		prepare    func(m *MockRegistration)
+		wantStatus int
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "delete client success test"),
+			target: oauth.RegistrationPath + "/7",
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().DeleteClient(gomock.Any(), 7, "registration-token").Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "delete client negative test: invalid registration access token"),
+			target: oauth.RegistrationPath + "/7",
+			prepare: func(m *MockRegistration) {
+				m.EXPECT().DeleteClient(gomock.Any(), 7, "registration-token").
+					Return(fmt.Errorf("apps.DeleteClient: %w", apps.ErrInvalidRegistrationToken))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			service := NewMockRegistration(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(service)
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer registration-token")
+
+			rec := serve(nil, nil, service, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		})
+	}
+}
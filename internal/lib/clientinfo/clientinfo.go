@@ -0,0 +1,53 @@
+package clientinfo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+)
+
+const (
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 48
+)
+
+// ClientInfo describes the client that issued the current request.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying the given client info.
+func NewContext(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+// FromContext returns the client info stored in ctx, if any.
+func FromContext(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(ctxKey{}).(ClientInfo)
+	return info, ok
+}
+
+// IPPrefix returns the network the client address belongs to:
+// /24 for IPv4 and /48 for IPv6. Unparsable addresses are returned as is.
+func (c ClientInfo) IPPrefix() string {
+	ip := net.ParseIP(c.IP)
+	if ip == nil {
+		return c.IP
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(ipv4PrefixBits, 32)), Mask: net.CIDRMask(ipv4PrefixBits, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(ipv6PrefixBits, 128)), Mask: net.CIDRMask(ipv6PrefixBits, 128)}).String()
+}
+
+// Fingerprint identifies a device by its user agent and network prefix.
+func (c ClientInfo) Fingerprint() string {
+	sum := sha256.Sum256([]byte(c.UserAgent + "\n" + c.IPPrefix()))
+	return hex.EncodeToString(sum[:])
+}
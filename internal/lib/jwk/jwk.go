@@ -0,0 +1,173 @@
+// Package jwk holds the RSA key tokens are signed with and publishes its
+// public half as a JSON Web Key Set (RFC 7517). It also reads the RSA keys
+// other providers publish the same way.
+package jwk
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyBits = 2048
+
+// Key is an RSA signing key identified by the thumbprint of its public key.
+type Key struct {
+	ID      string
+	private *rsa.PrivateKey
+}
+
+// PublicKey is a public key in JWK form.
+type PublicKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// Set is a JSON Web Key Set.
+type Set struct {
+	Keys []PublicKey `json:"keys"`
+}
+
+// Generate returns a new random key.
+func Generate() (*Key, error) {
+	private, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(private)
+}
+
+// Parse reads a PEM encoded RSA private key, in PKCS #1 or PKCS #8 form.
+func Parse(pemKey []byte) (*Key, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if private, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return newKey(private)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+
+	return newKey(private)
+}
+
+// PEM returns the private key PEM encoded in PKCS #1 form, as Parse reads it.
+func (k *Key) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k.private)})
+}
+
+func newKey(private *rsa.PrivateKey) (*Key, error) {
+	if private.N.BitLen() < keyBits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", keyBits)
+	}
+
+	key := &Key{private: private}
+	key.ID = key.thumbprint()
+
+	return key, nil
+}
+
+// Sign returns the claims as a JWT signed with RS256, with the key id in the header.
+func (k *Key) Sign(claims map[string]any) (string, error) {
+	return k.SignType("", claims)
+}
+
+// SignType is Sign with the typ header set to the media type of the token, so
+// tokens of different kinds signed with the key can't be mistaken for one
+// another. An empty typ keeps the default, JWT.
+func (k *Key) SignType(typ string, claims map[string]any) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	token.Header["kid"] = k.ID
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+
+	return token.SignedString(k.private)
+}
+
+// Public returns the RSA public key.
+func (k *Key) Public() *rsa.PublicKey {
+	return &k.private.PublicKey
+}
+
+// JWK returns the public key in JWK form.
+func (k *Key) JWK() PublicKey {
+	return PublicKey{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		KeyID:     k.ID,
+		N:         encode(k.private.N),
+		E:         encode(big.NewInt(int64(k.private.E))),
+	}
+}
+
+// RSA returns the public key of an RSA JWK, as published by another provider.
+func (p PublicKey) RSA() (*rsa.PublicKey, error) {
+	if p.KeyType != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", p.KeyType)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(p.N)
+	if err != nil {
+		return nil, fmt.Errorf("decode modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(p.E)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	if key.N.BitLen() < keyBits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", keyBits)
+	}
+
+	return key, nil
+}
+
+// thumbprint is the RFC 7638 thumbprint of the public key.
+func (k *Key) thumbprint() string {
+	// The members are required in lexicographic order, without whitespace.
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{encode(big.NewInt(int64(k.private.E))), "RSA", encode(k.private.N)})
+
+	sum := sha256.Sum256(canonical)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encode(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
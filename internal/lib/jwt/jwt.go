@@ -1,23 +1,319 @@
 package jwt
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
 	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
 	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func NewToken(user entity.User, app entity.App, duration time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+var ErrInvalidToken = errors.New("invalid token")
+
+// AccessTokenType is the typ header of access tokens (RFC 9068, section 2.1).
+// ID tokens are signed with the same key, the header tells them apart.
+const AccessTokenType = "at+jwt"
+
+// Option adds extra claims to a token.
+type Option func(claims jwt.MapClaims)
+
+// WithActor adds an RFC 8693 "act" claim identifying the user acting on behalf of the subject.
+func WithActor(actor entity.User) Option {
+	return func(claims jwt.MapClaims) {
+		claims["act"] = map[string]any{
+			"sub":   strconv.FormatInt(actor.ID, 10),
+			"email": actor.Email,
+		}
+	}
+}
+
+// WithPriorActor keeps the "act" claim of a token being exchanged. It is nested
+// in the current actor, if any, to record the chain of delegation (RFC 8693, section 4.1).
+func WithPriorActor(act any) Option {
+	return func(claims jwt.MapClaims) {
+		if act == nil {
+			return
+		}
+
+		current, ok := claims["act"].(map[string]any)
+		if !ok {
+			claims["act"] = act
+			return
+		}
+		current["act"] = act
+	}
+}
+
+// WithAuthContext adds auth_time, amr and acr claims describing how the user authenticated.
+func WithAuthContext(authTime time.Time, amr []string) Option {
+	return func(claims jwt.MapClaims) {
+		claims["auth_time"] = authTime.Unix()
+		claims["amr"] = amr
+		claims["acr"] = entity.ACRForMethods(amr)
+	}
+}
+
+// WithScopes adds a space-separated "scope" claim. No claim is added for empty scopes.
+func WithScopes(scopes []string) Option {
+	return func(claims jwt.MapClaims) {
+		if len(scopes) > 0 {
+			claims["scope"] = strings.Join(scopes, " ")
+		}
+	}
+}
+
+// WithRoles adds a "roles" claim listing the names of the user's roles.
+func WithRoles(roles []entity.Role) Option {
+	return func(claims jwt.MapClaims) {
+		names := make([]string, 0, len(roles))
+		for _, role := range roles {
+			names = append(names, role.Name)
+		}
+		claims["roles"] = names
+	}
+}
+
+// WithConsent adds a "consent_id" claim naming the consent of the user a
+// third-party app's token is issued under, see entity.Consent.GrantID.
+func WithConsent(consent entity.Consent) Option {
+	return func(claims jwt.MapClaims) {
+		claims["consent_id"] = consent.GrantID
+	}
+}
+
+// WithOrg adds "org_id" and "org_role" claims for the organization the token is scoped to.
+func WithOrg(membership entity.Membership) Option {
+	return func(claims jwt.MapClaims) {
+		claims["org_id"] = membership.OrgID
+		claims["org_role"] = membership.Role
+	}
+}
+
+// WithPersonalAccessToken adds a "pat_id" claim naming the personal access token
+// the token was given in exchange for, see PersonalAccessTokenID.
+func WithPersonalAccessToken(tokenId int64) Option {
+	return func(claims jwt.MapClaims) {
+		claims["pat_id"] = tokenId
+	}
+}
+
+// WithExpiresAt sets the "exp" claim, overriding the lifetime the token was issued with.
+func WithExpiresAt(exp time.Time) Option {
+	return func(claims jwt.MapClaims) {
+		claims["exp"] = exp.Unix()
+	}
+}
+
+// NewToken issues an access token for the user of the app, signed with the key of the server.
+func NewToken(key *jwk.Key, user entity.User, app entity.App, duration time.Duration, opts ...Option) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
 		"uid":    user.ID,
 		"email":  user.Email,
-		"exp":    time.Now().Add(duration).Unix(),
+		"iat":    now.Unix(),
+		"exp":    now.Add(duration).Unix(),
 		"app_id": app.ID,
-	})
+	}
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return key.SignType(AccessTokenType, claims)
+}
+
+// NewClientToken issues a token for the app itself rather than for a user, as
+// with the OAuth client credentials grant. The subject is the client id.
+func NewClientToken(key *jwk.Key, app entity.App, duration time.Duration, opts ...Option) (string, error) {
+	clientId := strconv.Itoa(app.ID)
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       clientId,
+		"client_id": clientId,
+		"iat":       now.Unix(),
+		"exp":       now.Add(duration).Unix(),
+		"app_id":    app.ID,
+	}
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return key.SignType(AccessTokenType, claims)
+}
+
+// Reissue signs a copy of already verified claims with the options applied.
+// Every other claim, expiration included, is kept as is.
+func Reissue(key *jwk.Key, claims jwt.MapClaims, opts ...Option) (string, error) {
+	reissued := make(jwt.MapClaims, len(claims))
+	for k, v := range claims {
+		reissued[k] = v
+	}
+
+	for _, opt := range opts {
+		opt(reissued)
+	}
+
+	return key.SignType(AccessTokenType, reissued)
+}
+
+// Parse verifies an access token signed with the key of the server and returns
+// its claims. The token must not be expired and must name the app it was
+// issued for, see AppID.
+//
+// App secrets are client credentials only: a token signed with one is refused.
+func Parse(tokenString string, key *rsa.PublicKey) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != AccessTokenType {
+			return nil, errors.New("not an access token")
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	if _, ok := claims["app_id"].(float64); !ok {
+		return nil, fmt.Errorf("%w: app_id claim missing", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// AppID returns the id of the app the parsed access token was issued for.
+func AppID(claims jwt.MapClaims) int {
+	appId, _ := claims["app_id"].(float64)
+
+	return int(appId)
+}
+
+// IssuedAt returns when the parsed access token was issued, the zero time if it doesn't say.
+func IssuedAt(claims jwt.MapClaims) time.Time {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(iat), 0)
+}
+
+// PersonalAccessTokenID returns the id of the personal access token the parsed
+// access token was given in exchange for, if it was.
+func PersonalAccessTokenID(claims jwt.MapClaims) (int64, bool) {
+	id, ok := claims["pat_id"].(float64)
+	return int64(id), ok
+}
+
+// UnverifiedAppID extracts the app_id claim without checking the signature.
+// It must only be used to route a token that is then verified with Parse.
+func UnverifiedAppID(tokenString string) (int, error) {
+	claims := jwt.MapClaims{}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	appId, ok := claims["app_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%w: app_id claim missing", ErrInvalidToken)
+	}
+
+	return int(appId), nil
+}
+
+// UnverifiedIssuer extracts the iss claim without checking the signature.
+// It must only be used to pick the key the token is then verified with.
+func UnverifiedIssuer(tokenString string) (string, error) {
+	claims := jwt.RegisteredClaims{}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	if claims.Issuer == "" {
+		return "", fmt.Errorf("%w: iss claim missing", ErrInvalidToken)
+	}
 
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	return claims.Issuer, nil
+}
+
+// ParsePublicKey parses a PEM encoded RSA or ECDSA public key.
+func ParsePublicKey(pemKey string) (crypto.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pemKey)); err == nil {
+		return key, nil
+	}
+
+	key, err := jwt.ParseECPublicKeyFromPEM([]byte(pemKey))
+	if err != nil {
+		return nil, errors.New("not a PEM encoded RSA or ECDSA public key")
+	}
+
+	return key, nil
+}
+
+// ParseClientAssertion verifies a private key JWT client assertion (RFC 7523,
+// section 3) with the public key of the client. The assertion must be signed
+// with RS256 or ES256, name the client as issuer and subject, be addressed to
+// one of the audiences and have an id (jti) to detect replays.
+func ParseClientAssertion(assertion string, clientId string, publicKeyPEM string, audiences []string) (*jwt.RegisteredClaims, error) {
+	key, err := ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &jwt.RegisteredClaims{}
+
+	_, err = jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(clientId),
+		jwt.WithSubject(clientId),
+	)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(audiences, aud) }) {
+		return nil, fmt.Errorf("%w: assertion is not addressed to this server", ErrInvalidToken)
+	}
+
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: jti claim missing", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// ParseIDToken verifies an ID token this server issued and returns its claims.
+// Expired tokens are accepted: an ID token hint names who is logging out,
+// which is usually long after the token expired.
+func ParseIDToken(idToken string, key *rsa.PublicKey, issuer string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	// Claims validation is off for the expiry, which turns off the issuer check too.
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, fmt.Errorf("%w: token was issued by another server", ErrInvalidToken)
 	}
 
-	return tokenString, nil
+	return claims, nil
 }
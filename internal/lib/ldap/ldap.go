@@ -0,0 +1,161 @@
+// Package ldap checks passwords against an LDAP directory, like Active
+// Directory, by binding as the user. Nothing is cached: every login opens its
+// own connection, and the password is only sent in the bind.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	defaultUserFilter     = "(mail=%s)"
+	defaultGroupAttribute = "memberOf"
+	defaultTimeout        = 5 * time.Second
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid directory credentials")
+	ErrUnavailable        = errors.New("directory unavailable")
+)
+
+type Config struct {
+	// URL is the ldap:// or ldaps:// URL of the directory server.
+	URL string
+	// StartTLS upgrades an ldap:// connection before anything is sent.
+	StartTLS bool
+	// BindDN and BindPassword are the account users are searched with. Users
+	// are searched anonymously when BindDN is empty.
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched.
+	BaseDN string
+	// UserFilter finds a user by email, %s is replaced with the escaped email.
+	// (mail=%s) by default.
+	UserFilter string
+	// GroupAttribute lists the DNs of the groups of a user, memberOf by default.
+	GroupAttribute string
+	// Attributes are read from the user's entry.
+	Attributes []string
+	Timeout    time.Duration
+}
+
+type Directory struct {
+	cfg Config
+}
+
+func New(cfg Config) *Directory {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = defaultUserFilter
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = defaultGroupAttribute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &Directory{cfg: cfg}
+}
+
+// Authenticate finds the user with the email and checks the password by
+// binding as them. Returns the user's groups and configured attributes.
+//
+// A user that isn't found, or isn't the only one with the email, returns
+// ErrInvalidCredentials like a wrong password does.
+func (d *Directory) Authenticate(ctx context.Context, email string, password string) (entity.DirectoryUser, error) {
+	// An empty password would be an unauthenticated bind, which succeeds.
+	if email == "" || password == "" {
+		return entity.DirectoryUser{}, ErrInvalidCredentials
+	}
+
+	conn, err := d.dial()
+	if err != nil {
+		return entity.DirectoryUser{}, err
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return entity.DirectoryUser{}, fmt.Errorf("%w: service bind: %s", ErrUnavailable, err)
+		}
+	}
+
+	attributes := append([]string{d.cfg.GroupAttribute}, d.cfg.Attributes...)
+	result, err := conn.Search(goldap.NewSearchRequest(
+		d.cfg.BaseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		2,
+		int(d.cfg.Timeout.Seconds()),
+		false,
+		fmt.Sprintf(d.cfg.UserFilter, goldap.EscapeFilter(email)),
+		attributes,
+		nil,
+	))
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return entity.DirectoryUser{}, fmt.Errorf("%w: search: %s", ErrUnavailable, err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		return entity.DirectoryUser{}, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return entity.DirectoryUser{}, ErrInvalidCredentials
+		}
+		return entity.DirectoryUser{}, fmt.Errorf("%w: bind: %s", ErrUnavailable, err)
+	}
+
+	user := entity.DirectoryUser{
+		DN:         entry.DN,
+		Email:      email,
+		Attributes: make(map[string]string, len(d.cfg.Attributes)),
+		Groups:     entry.GetEqualFoldAttributeValues(d.cfg.GroupAttribute),
+	}
+	for _, name := range d.cfg.Attributes {
+		if value := entry.GetEqualFoldAttributeValue(name); value != "" {
+			user.Attributes[name] = value
+		}
+	}
+
+	return user, nil
+}
+
+func (d *Directory) dial() (*goldap.Conn, error) {
+	u, err := url.Parse(d.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid url: %s", ErrUnavailable, err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+
+	conn, err := goldap.DialURL(d.cfg.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout}),
+		goldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnavailable, err)
+	}
+	conn.SetTimeout(d.cfg.Timeout)
+
+	if d.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w: start tls: %s", ErrUnavailable, err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,149 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer delivers notification emails. When no SMTP host is configured
+// messages are only written to the log, which is handy for local runs.
+type Mailer struct {
+	log      *slog.Logger
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// New returns a new instance of the Mailer. Sending a message gives up after
+// the timeout, or earlier when the context of the send ends.
+func New(log *slog.Logger, host, port, username, password, from string, timeout time.Duration) *Mailer {
+	return &Mailer{
+		log:      log,
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		timeout:  timeout,
+	}
+}
+
+// Send sends a plain text email to the given recipient.
+//
+// The body is never logged: it can hold secrets like invitation codes.
+func (m *Mailer) Send(ctx context.Context, to, subject, body string) error {
+	const op = "mailer.Send"
+
+	subject = headerValue(subject)
+
+	log := m.log.With(
+		slog.String("op", op),
+		slog.String("to", to),
+		slog.String("subject", subject),
+	)
+
+	if m.host == "" {
+		log.Info("smtp is not configured, message dropped", slog.Int("body_bytes", len(body)))
+		return nil
+	}
+
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("UTF-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := m.send(ctx, to, []byte(msg)); err != nil {
+		log.Error("failed to send email", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email sent")
+
+	return nil
+}
+
+// send delivers the message like smtp.SendMail does, but within the deadline
+// of the context: smtp.SendMail has no way to stop a stalled server.
+func (m *Mailer) send(ctx context.Context, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.host, m.port))
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+	// Closing the connection unblocks the client when the context is canceled.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// headerValue makes the value safe to put in a header: line breaks would let
+// it add headers of its own, or start the body.
+func headerValue(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+}
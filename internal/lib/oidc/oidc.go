@@ -0,0 +1,339 @@
+// Package oidc logs users in with an upstream OpenID Connect provider, as a
+// relying party using the authorization code flow with PKCE. Only RS256 signed
+// ID tokens are accepted.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// keysRefreshInterval bounds how often the keys are fetched again for an
+	// unknown key id, so tokens with made up key ids can't flood the provider.
+	keysRefreshInterval = time.Minute
+	maxResponseSize     = 1 << 20
+)
+
+var (
+	ErrProvider       = errors.New("identity provider request failed")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Config is the registration of this service as a client of the provider.
+type Config struct {
+	// Issuer is the provider's issuer URL, its metadata is discovered from it.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURI is where the provider sends the user back with the code.
+	RedirectURI string
+	// Scopes are requested in addition to openid.
+	Scopes []string
+}
+
+// Claims are what the provider asserts about the user in the ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an upstream OpenID Connect provider. Its metadata and keys are
+// fetched when first needed.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &Provider{cfg: cfg, client: client}
+}
+
+// AuthCodeURL returns the URL of the provider's authorization endpoint to send
+// the user to. The verifier's S256 challenge is sent along, see NewVerifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid authorization endpoint: %s", ErrProvider, err)
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURI)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	query.Set("code_challenge_method", "S256")
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// Exchange redeems the authorization code at the provider's token endpoint and
+// returns the claims of the verified ID token. The nonce and verifier are
+// those the authorization URL was made with.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// Basic credentials are form-encoded first (RFC 6749, section 2.3.1).
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var resp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &resp)
+	if err != nil {
+		return Claims{}, err
+	}
+	if status != http.StatusOK {
+		return Claims{}, fmt.Errorf("%w: token endpoint returned %d: %s %s", ErrProvider, status, resp.Error, resp.ErrorDescription)
+	}
+	if resp.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: no id token in the token response", ErrProvider)
+	}
+
+	return p.verify(ctx, resp.IDToken, nonce)
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	return random(32)
+}
+
+// NewNonce returns a random nonce.
+func NewNonce() (string, error) {
+	return random(16)
+}
+
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// verify checks the ID token was signed by the provider for this client and
+// this login (OpenID Connect Core 1.0, section 3.1.3.7).
+func (p *Provider) verify(ctx context.Context, idToken string, nonce string) (Claims, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Nonce         string `json:"nonce"`
+		AuthorizedBy  string `json:"azp"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: sub claim missing", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.cfg.ClientID {
+		return Claims{}, fmt.Errorf("%w: issued to another party", ErrInvalidIDToken)
+	}
+
+	// Some providers send email_verified as a string.
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	return Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+discoveryPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+
+	var md metadata
+	status, err := p.do(req, &md)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: discovery returned %d", ErrProvider, status)
+	}
+
+	// The metadata must be about the configured issuer (OpenID Connect Discovery 1.0, section 4.3).
+	if strings.TrimSuffix(md.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: discovered issuer %q doesn't match", ErrProvider, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrProvider)
+	}
+
+	p.metadata = &md
+
+	return p.metadata, nil
+}
+
+// key returns the provider's key with the id, fetching the keys again if it is
+// unknown, as after a key rotation.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+
+	var set jwk.Set
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: jwks returned %d", ErrProvider, status)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of other types or too weak are skipped rather than failing the whole set.
+		if key, err := k.RSA(); err == nil {
+			keys[k.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// do sends the request and decodes the JSON response into v, whatever its status.
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrProvider, err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: malformed response: %s", ErrProvider, err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func random(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"path"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+// Wildcard matches any action.
+const Wildcard = "*"
+
+// Decision is the outcome of a permission check.
+type Decision struct {
+	Allowed bool
+	// Role and Permission tell which grant allowed the request. Both are empty on deny.
+	Role       string
+	Permission string
+}
+
+// Evaluate decides whether the roles allow the action on the resource.
+//
+// Permissions are named "<resource>:<action>". The resource part is a path.Match
+// pattern, so "docs/*:read" allows reading any document, and the action part may be
+// Wildcard. Permissions without a colon are plain labels and never match.
+// The global admin role allows everything. Nothing is allowed unless granted.
+func Evaluate(roles []entity.Role, resource string, action string) Decision {
+	for _, role := range roles {
+		if role.Name == entity.RoleAdmin && role.AppID == entity.GlobalAppID {
+			return Decision{Allowed: true, Role: role.Name}
+		}
+	}
+
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if Matches(permission, resource, action) {
+				return Decision{Allowed: true, Role: role.Name, Permission: permission}
+			}
+		}
+	}
+
+	return Decision{}
+}
+
+// Matches reports whether the permission covers the action on the resource.
+func Matches(permission string, resource string, action string) bool {
+	i := strings.LastIndex(permission, ":")
+	if i < 0 {
+		return false
+	}
+	resourcePattern, actionPattern := permission[:i], permission[i+1:]
+
+	if actionPattern != Wildcard && actionPattern != action {
+		return false
+	}
+
+	ok, err := path.Match(resourcePattern, resource)
+	return err == nil && ok
+}
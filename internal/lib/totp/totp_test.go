@@ -0,0 +1,80 @@
+package totp
+
+import (
+	"encoding/base32"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode(t *testing.T) {
+	prefixName := "totp"
+	// The SHA1 test vectors of RFC 6238, appendix B, cut to 6 digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s: code success test: %d", prefixName, tt.unix), func(t *testing.T) {
+			code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, code)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	prefixName := "totp"
+	secret, err := NewSecret()
+	assert.Nil(t, err)
+	now := time.Now()
+	code := func(at time.Time) string {
+		code, err := Code(secret, Step(at))
+		assert.Nil(t, err)
+		return code
+	}
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOk   bool
+	}{
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "validate success test: current code"),
+			code:     code(now),
+			wantStep: Step(now),
+			wantOk:   true,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "validate success test: previous code"),
+			code:     code(now.Add(-period * time.Second)),
+			wantStep: Step(now) - 1,
+			wantOk:   true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "validate negative test: expired code"),
+			code: code(now.Add(-3 * period * time.Second)),
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "validate negative test: malformed code"),
+			code: "12345",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, now)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantStep, step)
+		})
+	}
+}
@@ -0,0 +1,309 @@
+// Package userio reads and writes users in the bulk import and export formats:
+// CSV with a header row and JSON Lines.
+package userio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Columns of the CSV format. Only email and password_hash are required on import.
+const (
+	columnEmail         = "email"
+	columnPasswordHash  = "password_hash"
+	columnAdmin         = "admin"
+	columnEmailVerified = "email_verified"
+	columnStatus        = "status"
+	columnCreatedAt     = "created_at"
+)
+
+var columns = []string{columnEmail, columnPasswordHash, columnAdmin, columnEmailVerified, columnStatus, columnCreatedAt}
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	// ErrInvalidRecord is returned for a record that can't be parsed.
+	// Reading can go on with the next record.
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// record is a user in JSON Lines. Times are RFC 3339.
+type record struct {
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"password_hash"`
+	Admin         bool       `json:"admin"`
+	EmailVerified bool       `json:"email_verified"`
+	Status        string     `json:"status,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+}
+
+// FormatFromPath guesses the format from the file extension.
+func FormatFromPath(path string) (string, error) {
+	switch {
+	case strings.HasSuffix(path, ".csv"):
+		return FormatCSV, nil
+	case strings.HasSuffix(path, ".jsonl"), strings.HasSuffix(path, ".ndjson"):
+		return FormatJSONL, nil
+	}
+
+	return "", fmt.Errorf("%w: can't tell the format of %q", ErrUnknownFormat, path)
+}
+
+// Reader reads user records one at a time.
+type Reader interface {
+	// Read returns the next record or io.EOF when there are none left.
+	Read() (entity.UserRecord, error)
+	// Line is the line the last record read started at.
+	Line() int
+}
+
+// NewReader returns a reader of the format.
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return &csvReader{reader: reader}, nil
+	case FormatJSONL:
+		return &jsonlReader{scanner: bufio.NewScanner(r)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+type csvReader struct {
+	reader *csv.Reader
+	index  map[string]int
+	line   int
+}
+
+func (r *csvReader) Read() (entity.UserRecord, error) {
+	if r.index == nil {
+		if err := r.readHeader(); err != nil {
+			return entity.UserRecord{}, err
+		}
+	}
+
+	fields, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.line = parseErr.StartLine
+			return entity.UserRecord{}, fmt.Errorf("%w: %s", ErrInvalidRecord, parseErr.Err)
+		}
+		return entity.UserRecord{}, err
+	}
+	r.line, _ = r.reader.FieldPos(0)
+
+	field := func(name string) string {
+		i, ok := r.index[name]
+		if !ok || i >= len(fields) {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	var user entity.UserRecord
+	user.Email = field(columnEmail)
+	user.PassHash = []byte(field(columnPasswordHash))
+	user.Status = field(columnStatus)
+
+	if user.Admin, err = parseBool(field(columnAdmin)); err != nil {
+		return entity.UserRecord{}, fmt.Errorf("%w: %s: %s", ErrInvalidRecord, columnAdmin, err)
+	}
+	if user.EmailVerified, err = parseBool(field(columnEmailVerified)); err != nil {
+		return entity.UserRecord{}, fmt.Errorf("%w: %s: %s", ErrInvalidRecord, columnEmailVerified, err)
+	}
+	if createdAt := field(columnCreatedAt); createdAt != "" {
+		if user.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return entity.UserRecord{}, fmt.Errorf("%w: %s: %s", ErrInvalidRecord, columnCreatedAt, err)
+		}
+	}
+
+	return user, nil
+}
+
+func (r *csvReader) Line() int {
+	return r.line
+}
+
+func (r *csvReader) readHeader() error {
+	header, err := r.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return err
+		}
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	r.index = make(map[string]int, len(header))
+	for i, name := range header {
+		r.index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{columnEmail, columnPasswordHash} {
+		if _, ok := r.index[required]; !ok {
+			return fmt.Errorf("header has no %q column", required)
+		}
+	}
+
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *jsonlReader) Read() (entity.UserRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return entity.UserRecord{}, fmt.Errorf("%w: %s", ErrInvalidRecord, err)
+		}
+
+		user := entity.UserRecord{
+			User: entity.User{
+				Email:         strings.TrimSpace(rec.Email),
+				PassHash:      []byte(rec.PasswordHash),
+				Status:        rec.Status,
+				EmailVerified: rec.EmailVerified,
+			},
+			Admin: rec.Admin,
+		}
+		if rec.CreatedAt != nil {
+			user.CreatedAt = *rec.CreatedAt
+		}
+
+		return user, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return entity.UserRecord{}, err
+	}
+
+	return entity.UserRecord{}, io.EOF
+}
+
+func (r *jsonlReader) Line() int {
+	return r.line
+}
+
+// Writer writes user records. Flush must be called once everything is written.
+type Writer interface {
+	Write(user entity.UserRecord) error
+	Flush() error
+}
+
+// NewWriter returns a writer of the format.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(user entity.UserRecord) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	var createdAt string
+	if !user.CreatedAt.IsZero() {
+		createdAt = user.CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	return w.writer.Write([]string{
+		user.Email,
+		string(user.PassHash),
+		strconv.FormatBool(user.Admin),
+		strconv.FormatBool(user.EmailVerified),
+		user.Status,
+		createdAt,
+	})
+}
+
+// Flush writes the header even when there were no records, so an empty export
+// can still be imported.
+func (w *csvWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+
+	return w.writer.Write(columns)
+}
+
+type jsonlWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *jsonlWriter) Write(user entity.UserRecord) error {
+	rec := record{
+		Email:         user.Email,
+		PasswordHash:  string(user.PassHash),
+		Admin:         user.Admin,
+		EmailVerified: user.EmailVerified,
+		Status:        user.Status,
+	}
+	if !user.CreatedAt.IsZero() {
+		createdAt := user.CreatedAt.UTC()
+		rec.CreatedAt = &createdAt
+	}
+
+	return w.encoder.Encode(rec)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return w.buffered.Flush()
+}
@@ -0,0 +1,567 @@
+package apps
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_apps.go -package=apps . AppStorage,UserProvider,RegistrationStorage
+
+// secretBytes is the amount of randomness in an app secret. Secrets only
+// authenticate apps as OAuth clients, tokens are signed with the server's key.
+const secretBytes = 32
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidName      = errors.New("app name required")
+	ErrAppExists        = errors.New("app already exists")
+	ErrAppNotFound      = errors.New("app not found")
+	ErrInvalidSettings  = errors.New("invalid app settings")
+	ErrInvalidURI       = errors.New("invalid redirect uri")
+	ErrInvalidOrigin    = errors.New("invalid web origin")
+)
+
+type Apps struct {
+	log          *slog.Logger
+	appStorage   AppStorage
+	userProvider UserProvider
+}
+
+type AppStorage interface {
+	SaveApp(ctx context.Context, app entity.App) (int, error)
+	App(ctx context.Context, appId int) (entity.App, error)
+	Apps(ctx context.Context) ([]entity.App, error)
+	UpdateApp(ctx context.Context, app entity.App) error
+	UpdateAppSecret(ctx context.Context, appId int, secret string) error
+	DeleteApp(ctx context.Context, appId int) error
+	RedirectURIs(ctx context.Context, appId int) ([]string, error)
+	SetRedirectURIs(ctx context.Context, appId int, uris []string) error
+	PostLogoutRedirectURIs(ctx context.Context, appId int) ([]string, error)
+	SetPostLogoutRedirectURIs(ctx context.Context, appId int, uris []string) error
+	WebOrigins(ctx context.Context, appId int) ([]string, error)
+	SetWebOrigins(ctx context.Context, appId int, origins []string) error
+}
+
+type UserProvider interface {
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+}
+
+// New returns a new instance of the app registry service
+func New(
+	log *slog.Logger,
+	appStorage AppStorage,
+	userProvider UserProvider,
+) *Apps {
+	return &Apps{
+		log:          log,
+		appStorage:   appStorage,
+		userProvider: userProvider,
+	}
+}
+
+// CreateApp registers a new app with a freshly generated secret.
+//
+// The returned app is the only one carrying the secret: it is never returned
+// again and can only be replaced with RotateAppSecret.
+func (a *Apps) CreateApp(ctx context.Context, adminId int64, app entity.App) (entity.App, error) {
+	const op = "apps.CreateApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.Name = strings.TrimSpace(app.Name)
+	if app.Name == "" {
+		return entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	if err := validateSettings(app.Settings); err != nil {
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.Secret = secret
+
+	id, err := a.appStorage.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return entity.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+		log.Error("failed to save app", slog.Any("error", err))
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.ID = id
+
+	log.Info("app created", slog.Int("app_id", id), slog.String("name", app.Name))
+
+	return app, nil
+}
+
+// GetApp returns the app without its secret.
+func (a *Apps) GetApp(ctx context.Context, adminId int64, appId int) (entity.App, error) {
+	const op = "apps.GetApp"
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appStorage.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return entity.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.Secret = ""
+
+	return app, nil
+}
+
+// ListApps returns all apps without their secrets.
+func (a *Apps) ListApps(ctx context.Context, adminId int64) ([]entity.App, error) {
+	const op = "apps.ListApps"
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	apps, err := a.appStorage.Apps(ctx)
+	if err != nil {
+		a.log.Error("failed to list apps", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range apps {
+		apps[i].Secret = ""
+	}
+
+	return apps, nil
+}
+
+// UpdateApp updates the app name and settings. The secret can't be changed this way,
+// see RotateAppSecret.
+func (a *Apps) UpdateApp(ctx context.Context, adminId int64, app entity.App) error {
+	const op = "apps.UpdateApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", app.ID))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	app.Name = strings.TrimSpace(app.Name)
+	if app.Name == "" {
+		return fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	if err := validateSettings(app.Settings); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appStorage.UpdateApp(ctx, app); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAppNotFound):
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		case errors.Is(err, storage.ErrAppExists):
+			return fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+		log.Error("failed to update app", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app updated")
+
+	return nil
+}
+
+// DeleteApp deletes the app with its roles, consents and allowlists, and
+// removes it from the token exchange lists of other apps. Tokens issued for it
+// are no longer accepted.
+func (a *Apps) DeleteApp(ctx context.Context, adminId int64, appId int) error {
+	const op = "apps.DeleteApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", appId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appStorage.DeleteApp(ctx, appId); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to delete app", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app deleted")
+
+	return nil
+}
+
+// RotateAppSecret replaces the app secret with a new one and returns it.
+// The old secret stops authenticating the app immediately; tokens already
+// issued to the app stay valid.
+func (a *Apps) RotateAppSecret(ctx context.Context, adminId int64, appId int) (string, error) {
+	const op = "apps.RotateAppSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", appId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appStorage.UpdateAppSecret(ctx, appId, secret); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to rotate app secret", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("app secret rotated")
+
+	return secret, nil
+}
+
+// RedirectURIs returns the OAuth redirect URIs registered for the app.
+func (a *Apps) RedirectURIs(ctx context.Context, adminId int64, appId int) ([]string, error) {
+	const op = "apps.RedirectURIs"
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.appStorage.App(ctx, appId); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	uris, err := a.appStorage.RedirectURIs(ctx, appId)
+	if err != nil {
+		a.log.Error("failed to list redirect uris", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uris, nil
+}
+
+// SetRedirectURIs replaces the OAuth redirect URIs of the app. Authorization
+// codes are only ever sent to one of them, compared exactly, but for the port of
+// loopback URIs when the app settings allow any loopback port.
+//
+// URIs must be absolute and have no fragment. Plain http is only allowed for
+// loopback addresses; native apps may use a private-use scheme.
+func (a *Apps) SetRedirectURIs(ctx context.Context, adminId int64, appId int, uris []string) error {
+	const op = "apps.SetRedirectURIs"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", appId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, uri := range uris {
+		if err := validateRedirectURI(uri); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.appStorage.SetRedirectURIs(ctx, appId, uris); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to set redirect uris", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("redirect uris updated", slog.Int("count", len(uris)))
+
+	return nil
+}
+
+// PostLogoutRedirectURIs returns the URIs the app may send users to after logout.
+func (a *Apps) PostLogoutRedirectURIs(ctx context.Context, adminId int64, appId int) ([]string, error) {
+	const op = "apps.PostLogoutRedirectURIs"
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.appStorage.App(ctx, appId); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	uris, err := a.appStorage.PostLogoutRedirectURIs(ctx, appId)
+	if err != nil {
+		a.log.Error("failed to list post-logout redirect uris", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uris, nil
+}
+
+// SetPostLogoutRedirectURIs replaces the post-logout redirect URIs of the app.
+// They follow the rules of SetRedirectURIs: the logout endpoint only redirects
+// to one of them, compared exactly.
+func (a *Apps) SetPostLogoutRedirectURIs(ctx context.Context, adminId int64, appId int, uris []string) error {
+	const op = "apps.SetPostLogoutRedirectURIs"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", appId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, uri := range uris {
+		if err := validateRedirectURI(uri); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.appStorage.SetPostLogoutRedirectURIs(ctx, appId, uris); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to set post-logout redirect uris", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("post-logout redirect uris updated", slog.Int("count", len(uris)))
+
+	return nil
+}
+
+// WebOrigins returns the origins browser code of the app may call the endpoints from.
+func (a *Apps) WebOrigins(ctx context.Context, adminId int64, appId int) ([]string, error) {
+	const op = "apps.WebOrigins"
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := a.appStorage.App(ctx, appId); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	origins, err := a.appStorage.WebOrigins(ctx, appId)
+	if err != nil {
+		a.log.Error("failed to list web origins", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return origins, nil
+}
+
+// SetWebOrigins replaces the web origins of the app. Cross-origin requests to
+// the token and userinfo endpoints are only answered for these, compared exactly.
+//
+// An origin is a scheme, host and optional port with nothing after them, as
+// browsers send it. Plain http is only allowed for loopback addresses.
+func (a *Apps) SetWebOrigins(ctx context.Context, adminId int64, appId int, origins []string) error {
+	const op = "apps.SetWebOrigins"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int("app_id", appId))
+
+	if err := a.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, origin := range origins {
+		if err := validateOrigin(origin); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.appStorage.SetWebOrigins(ctx, appId, origins); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to set web origins", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("web origins updated", slog.Int("count", len(origins)))
+
+	return nil
+}
+
+func (a *Apps) requireAdmin(ctx context.Context, userId int64) error {
+	isAdmin, err := a.userProvider.IsAdmin(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+	if !isAdmin {
+		a.log.Warn("non-admin user tried to manage apps", slog.Int64("user_id", userId))
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func validateSettings(settings entity.AppSettings) error {
+	if settings.AccessTokenTTL < 0 {
+		return fmt.Errorf("%w: negative ttl", ErrInvalidSettings)
+	}
+
+	if settings.RequiredACR != "" && !entity.ValidACR(settings.RequiredACR) {
+		return fmt.Errorf("%w: unknown acr %q", ErrInvalidSettings, settings.RequiredACR)
+	}
+	// Requiring a class no login reaches would lock every user out of the app.
+	if settings.RequiredACR != "" && !entity.IssuableACR(settings.RequiredACR) {
+		return fmt.Errorf("%w: no login method of this server reaches acr %q", ErrInvalidSettings, settings.RequiredACR)
+	}
+
+	// Lists are stored space-separated.
+	for _, method := range settings.LoginMethods {
+		if method == "" || strings.ContainsAny(method, " \t\r\n") {
+			return fmt.Errorf("%w: invalid login method %q", ErrInvalidSettings, method)
+		}
+	}
+
+	for _, domain := range settings.AllowedEmailDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ \t\r\n") {
+			return fmt.Errorf("%w: invalid email domain %q", ErrInvalidSettings, domain)
+		}
+	}
+
+	for _, scope := range settings.ClientScopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n\"\\") {
+			return fmt.Errorf("%w: invalid client scope %q", ErrInvalidSettings, scope)
+		}
+	}
+
+	for _, scope := range settings.UserScopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n\"\\") {
+			return fmt.Errorf("%w: invalid user scope %q", ErrInvalidSettings, scope)
+		}
+	}
+
+	for _, grantType := range settings.GrantTypes {
+		if !slices.Contains(grantTypes, grantType) {
+			return fmt.Errorf("%w: unsupported grant type %q", ErrInvalidSettings, grantType)
+		}
+	}
+
+	switch settings.TokenAuthMethod {
+	case "", entity.TokenAuthNone, entity.TokenAuthClientSecretBasic, entity.TokenAuthClientSecretPost:
+	default:
+		return fmt.Errorf("%w: unknown token auth method %q", ErrInvalidSettings, settings.TokenAuthMethod)
+	}
+
+	for _, appId := range settings.TokenExchangeFrom {
+		if appId <= 0 {
+			return fmt.Errorf("%w: invalid token exchange app id %d", ErrInvalidSettings, appId)
+		}
+	}
+
+	if settings.ClientPublicKey != "" {
+		if _, err := jwt.ParsePublicKey(settings.ClientPublicKey); err != nil {
+			return fmt.Errorf("%w: client public key: %s", ErrInvalidSettings, err)
+		}
+	}
+
+	return nil
+}
+
+func validateRedirectURI(raw string) error {
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidURI, err)
+	}
+
+	switch {
+	case !uri.IsAbs():
+		return fmt.Errorf("%w: %q is not absolute", ErrInvalidURI, raw)
+	case uri.Fragment != "" || strings.HasSuffix(raw, "#"):
+		return fmt.Errorf("%w: %q has a fragment", ErrInvalidURI, raw)
+	case uri.Scheme == "https":
+		if uri.Host == "" {
+			return fmt.Errorf("%w: %q has no host", ErrInvalidURI, raw)
+		}
+	case uri.Scheme == "http":
+		if !isLoopback(uri.Hostname()) {
+			return fmt.Errorf("%w: plain http is only allowed for loopback addresses", ErrInvalidURI)
+		}
+	case uri.Scheme == "javascript" || uri.Scheme == "data" || uri.Scheme == "file":
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidURI, uri.Scheme)
+	}
+
+	return nil
+}
+
+// validateOrigin checks the origin is serialized the way browsers send it in
+// the Origin header, so that it can be compared exactly.
+func validateOrigin(raw string) error {
+	origin, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidOrigin, err)
+	}
+
+	switch {
+	case origin.Scheme != "https" && origin.Scheme != "http":
+		return fmt.Errorf("%w: %q is not an http or https origin", ErrInvalidOrigin, raw)
+	case origin.Host == "" || origin.User != nil:
+		return fmt.Errorf("%w: %q has no host", ErrInvalidOrigin, raw)
+	case origin.Scheme+"://"+origin.Host != raw:
+		return fmt.Errorf("%w: %q must not have a path, query or fragment", ErrInvalidOrigin, raw)
+	case origin.Host != strings.ToLower(origin.Host):
+		return fmt.Errorf("%w: %q must be lower case", ErrInvalidOrigin, raw)
+	case origin.Scheme == "http" && !isLoopback(origin.Hostname()):
+		return fmt.Errorf("%w: plain http is only allowed for loopback addresses", ErrInvalidOrigin)
+	}
+
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
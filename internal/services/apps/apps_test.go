@@ -0,0 +1,331 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApps_createApp(t *testing.T) {
+	prefixName := "apps service"
+	type fields struct {
+		appStorage   *MockAppStorage
+		userProvider *MockUserProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		app     entity.App
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app success test"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+				f.appStorage.EXPECT().SaveApp(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, app entity.App) (int, error) {
+						assert.Equal(t, "billing", app.Name)
+						assert.Len(t, app.Secret, 43)
+						return 2, nil
+					})
+			},
+			app: entity.App{Name: " billing "},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app success test: multi-factor acr"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+				f.appStorage.EXPECT().SaveApp(gomock.Any(), gomock.Any()).Return(2, nil)
+			},
+			app: entity.App{Name: "billing", Settings: entity.AppSettings{RequiredACR: entity.ACRMultiFactor}},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: caller is not admin"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(false, nil)
+			},
+			app:     entity.App{Name: "billing"},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: empty name"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: " "},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: unknown acr"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{RequiredACR: "mfa"}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: acr no login reaches"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{RequiredACR: entity.ACRHardwareKey}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: email instead of domain"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{AllowedEmailDomains: []string{"me@corp.com"}}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: user scope with a space"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{UserScopes: []string{"orders read"}}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: malformed client public key"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{ClientPublicKey: "not a key"}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: invalid token exchange app"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			},
+			app:     entity.App{Name: "billing", Settings: entity.AppSettings{TokenExchangeFrom: []int{0}}},
+			wantErr: ErrInvalidSettings,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create app negative test: name taken"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+				f.appStorage.EXPECT().SaveApp(gomock.Any(), gomock.Any()).Return(0, storage.ErrAppExists)
+			},
+			app:     entity.App{Name: "billing"},
+			wantErr: ErrAppExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				appStorage:   NewMockAppStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.appStorage, f.userProvider)
+			app, err := service.CreateApp(context.Background(), 1, tt.app)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, 2, app.ID)
+				assert.NotEmpty(t, app.Secret)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestApps_secretsAreNotReturned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	appStorage := NewMockAppStorage(ctrl)
+	userProvider := NewMockUserProvider(ctrl)
+
+	userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil).Times(2)
+	appStorage.EXPECT().App(gomock.Any(), 2).Return(entity.App{ID: 2, Name: "billing", Secret: "secret"}, nil)
+	appStorage.EXPECT().Apps(gomock.Any()).Return([]entity.App{{ID: 2, Name: "billing", Secret: "secret"}}, nil)
+
+	service := New(slog.Default(), appStorage, userProvider)
+
+	app, err := service.GetApp(context.Background(), 1, 2)
+	assert.Nil(t, err)
+	assert.Empty(t, app.Secret)
+
+	apps, err := service.ListApps(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, apps, 1)
+	assert.Empty(t, apps[0].Secret)
+}
+
+func TestApps_rotateAppSecret(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	appStorage := NewMockAppStorage(ctrl)
+	userProvider := NewMockUserProvider(ctrl)
+
+	userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil).Times(2)
+
+	var stored string
+	appStorage.EXPECT().UpdateAppSecret(gomock.Any(), 2, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ int, secret string) error {
+			stored = secret
+			return nil
+		})
+	appStorage.EXPECT().UpdateAppSecret(gomock.Any(), 3, gomock.Any()).Return(storage.ErrAppNotFound)
+
+	service := New(slog.Default(), appStorage, userProvider)
+
+	secret, err := service.RotateAppSecret(context.Background(), 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, stored, secret)
+
+	_, err = service.RotateAppSecret(context.Background(), 1, 3)
+	assert.True(t, errors.Is(err, ErrAppNotFound))
+}
+
+func TestApps_setRedirectURIs(t *testing.T) {
+	prefixName := "apps service"
+	type test struct {
+		name    string
+		uris    []string
+		stored  bool
+		wantErr error
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set redirect uris success test"),
+			uris:   []string{"https://shop.example.com/callback", "http://127.0.0.1:8080/cb", "com.example.app:/oauth"},
+			stored: true,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "set redirect uris success test: localhost"),
+			uris:   []string{"http://localhost/cb"},
+			stored: true,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set redirect uris negative test: relative"),
+			uris:    []string{"/callback"},
+			wantErr: ErrInvalidURI,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set redirect uris negative test: fragment"),
+			uris:    []string{"https://shop.example.com/callback#x"},
+			wantErr: ErrInvalidURI,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set redirect uris negative test: plain http"),
+			uris:    []string{"http://shop.example.com/callback"},
+			wantErr: ErrInvalidURI,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set redirect uris negative test: javascript"),
+			uris:    []string{"javascript:alert(1)"},
+			wantErr: ErrInvalidURI,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			appStorage := NewMockAppStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+
+			userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			if tt.stored {
+				appStorage.EXPECT().SetRedirectURIs(gomock.Any(), 2, tt.uris).Return(nil)
+			}
+
+			err := New(slog.Default(), appStorage, userProvider).SetRedirectURIs(context.Background(), 1, 2, tt.uris)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestApps_setWebOrigins(t *testing.T) {
+	prefixName := "apps service"
+	type test struct {
+		name    string
+		origins []string
+		stored  bool
+		wantErr error
+	}
+	tests := []test{
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins success test"),
+			origins: []string{"https://shop.example.com", "https://shop.example.com:8443", "http://localhost:3000"},
+			stored:  true,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: path"),
+			origins: []string{"https://shop.example.com/"},
+			wantErr: ErrInvalidOrigin,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: query"),
+			origins: []string{"https://shop.example.com?x=1"},
+			wantErr: ErrInvalidOrigin,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: upper case"),
+			origins: []string{"https://Shop.example.com"},
+			wantErr: ErrInvalidOrigin,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: plain http"),
+			origins: []string{"http://shop.example.com"},
+			wantErr: ErrInvalidOrigin,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "set web origins negative test: wildcard"),
+			origins: []string{"*"},
+			wantErr: ErrInvalidOrigin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			appStorage := NewMockAppStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+
+			userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+			if tt.stored {
+				appStorage.EXPECT().SetWebOrigins(gomock.Any(), 2, tt.origins).Return(nil)
+			}
+
+			err := New(slog.Default(), appStorage, userProvider).SetWebOrigins(context.Background(), 1, 2, tt.origins)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
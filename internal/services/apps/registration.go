@@ -0,0 +1,407 @@
+package apps
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/oauth"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+	// ErrInvalidInitialAccessToken means the registration request was not
+	// authorized with the initial access token.
+	ErrInvalidInitialAccessToken = errors.New("invalid initial access token")
+	// ErrInvalidRegistrationToken means the registration access token is wrong,
+	// or the client doesn't exist or was not registered dynamically.
+	ErrInvalidRegistrationToken = errors.New("invalid registration access token")
+)
+
+// grantTypes are the grant types an app may be restricted to.
+var grantTypes = []string{
+	oauth.GrantTypeAuthorizationCode,
+	oauth.GrantTypeClientCredentials,
+	oauth.GrantTypeDeviceCode,
+	oauth.GrantTypeTokenExchange,
+}
+
+type RegistrationStorage interface {
+	RegisterClient(
+		ctx context.Context,
+		app entity.App,
+		redirectURIs []string,
+		reg entity.ClientRegistration,
+	) (int, error)
+	ClientRegistration(ctx context.Context, appId int) (entity.ClientRegistration, error)
+	UpdateClientRegistration(
+		ctx context.Context,
+		app entity.App,
+		redirectURIs []string,
+		reg entity.ClientRegistration,
+	) error
+}
+
+// Registration lets app owners register their apps themselves (RFC 7591) and
+// manage them afterwards with the registration access token they get back
+// (RFC 7592).
+type Registration struct {
+	log                 *slog.Logger
+	appStorage          AppStorage
+	registrationStorage RegistrationStorage
+	initialAccessToken  string
+	endpoint            string
+	scopes              []string
+}
+
+// ClientMetadata is what the owner of an app tells about it (RFC 7591,
+// section 2). Scopes are the client scopes of the client credentials grant.
+type ClientMetadata struct {
+	ClientName              string
+	RedirectURIs            []string
+	GrantTypes              []string
+	TokenEndpointAuthMethod string
+	Scopes                  []string
+	LogoURI                 string
+	Contacts                []string
+}
+
+// ClientInformation is a registered client (RFC 7591, section 3.2.1). The
+// client secret is only set when the client is registered, and never for a
+// public client.
+type ClientInformation struct {
+	ClientMetadata
+	ClientID                int
+	ClientSecret            string
+	ClientIDIssuedAt        time.Time
+	RegistrationAccessToken string
+	RegistrationClientURI   string
+}
+
+// NewRegistration returns a new instance of the client registration service.
+// Clients are registered with the initial access token, and managed at the
+// registration endpoint URL followed by their ID. They may only ask for the
+// registrable client scopes; with none, no client can use client credentials
+// with a scope.
+func NewRegistration(
+	log *slog.Logger,
+	appStorage AppStorage,
+	registrationStorage RegistrationStorage,
+	initialAccessToken string,
+	endpoint string,
+	scopes []string,
+) *Registration {
+	return &Registration{
+		log:                 log,
+		appStorage:          appStorage,
+		registrationStorage: registrationStorage,
+		initialAccessToken:  initialAccessToken,
+		endpoint:            strings.TrimSuffix(endpoint, "/"),
+		scopes:              scopes,
+	}
+}
+
+// RegisterClient creates a third-party app from the metadata. Unset grant types
+// default to the authorization code grant, and the token endpoint auth method
+// to client_secret_basic.
+//
+// The returned client information is the only one carrying the client secret
+// and the registration access token.
+func (r *Registration) RegisterClient(ctx context.Context, initialAccessToken string, md ClientMetadata) (ClientInformation, error) {
+	const op = "apps.RegisterClient"
+
+	log := r.log.With(slog.String("op", op))
+
+	if r.initialAccessToken == "" ||
+		subtle.ConstantTimeCompare([]byte(initialAccessToken), []byte(r.initialAccessToken)) != 1 {
+		log.Warn("client registration with an invalid initial access token")
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, ErrInvalidInitialAccessToken)
+	}
+
+	md = withDefaults(md)
+	if err := r.validateMetadata(md); err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app := entity.App{
+		Name:   md.ClientName,
+		Secret: secret,
+		Settings: entity.AppSettings{
+			ThirdParty:      true,
+			ClientScopes:    md.Scopes,
+			GrantTypes:      md.GrantTypes,
+			TokenAuthMethod: md.TokenEndpointAuthMethod,
+		},
+	}
+	reg := entity.ClientRegistration{
+		AccessTokenHash: hashToken(token),
+		LogoURI:         md.LogoURI,
+		Contacts:        md.Contacts,
+	}
+
+	id, err := r.registrationStorage.RegisterClient(ctx, app, md.RedirectURIs, reg)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			return ClientInformation{}, fmt.Errorf("%s: %w", op, clientNameTaken(md.ClientName))
+		}
+		log.Error("failed to register client", slog.Any("error", err))
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client registered", slog.Int("app_id", id), slog.String("name", md.ClientName))
+
+	info := ClientInformation{
+		ClientMetadata:          md,
+		ClientID:                id,
+		ClientIDIssuedAt:        time.Now(),
+		RegistrationAccessToken: token,
+		RegistrationClientURI:   r.clientURI(id),
+	}
+	if md.TokenEndpointAuthMethod != entity.TokenAuthNone {
+		info.ClientSecret = secret
+	}
+
+	return info, nil
+}
+
+// ReadClient returns the registered client (RFC 7592, section 2.1).
+func (r *Registration) ReadClient(ctx context.Context, clientId int, token string) (ClientInformation, error) {
+	const op = "apps.ReadClient"
+
+	app, reg, err := r.registration(ctx, clientId, token)
+	if err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	uris, err := r.appStorage.RedirectURIs(ctx, app.ID)
+	if err != nil {
+		r.log.Error("failed to list redirect uris", slog.String("op", op), slog.Any("error", err))
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ClientInformation{
+		ClientMetadata: ClientMetadata{
+			ClientName:              app.Name,
+			RedirectURIs:            uris,
+			GrantTypes:              app.Settings.GrantTypes,
+			TokenEndpointAuthMethod: app.Settings.TokenAuthMethod,
+			Scopes:                  app.Settings.ClientScopes,
+			LogoURI:                 reg.LogoURI,
+			Contacts:                reg.Contacts,
+		},
+		ClientID:                app.ID,
+		ClientIDIssuedAt:        reg.CreatedAt,
+		RegistrationAccessToken: token,
+		RegistrationClientURI:   r.clientURI(app.ID),
+	}, nil
+}
+
+// UpdateClient replaces the metadata of the registered client (RFC 7592, section
+// 2.2). Unset fields are reset to their defaults. The settings an admin
+// manages, like token lifetimes, are kept, and the token endpoint auth method
+// can't change: a public client never got its secret.
+func (r *Registration) UpdateClient(ctx context.Context, clientId int, token string, md ClientMetadata) (ClientInformation, error) {
+	const op = "apps.UpdateClient"
+
+	log := r.log.With(slog.String("op", op), slog.Int("app_id", clientId))
+
+	app, reg, err := r.registration(ctx, clientId, token)
+	if err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	md = withDefaults(md)
+	if err := r.validateMetadata(md); err != nil {
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if md.TokenEndpointAuthMethod != app.Settings.TokenAuthMethod {
+		return ClientInformation{}, fmt.Errorf("%s: %w: token_endpoint_auth_method can't be changed",
+			op, ErrInvalidClientMetadata)
+	}
+
+	app.Name = md.ClientName
+	app.Settings.ClientScopes = md.Scopes
+	app.Settings.GrantTypes = md.GrantTypes
+	reg.LogoURI = md.LogoURI
+	reg.Contacts = md.Contacts
+
+	if err := r.registrationStorage.UpdateClientRegistration(ctx, app, md.RedirectURIs, reg); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrRegistrationNotFound):
+			return ClientInformation{}, fmt.Errorf("%s: %w", op, ErrInvalidRegistrationToken)
+		case errors.Is(err, storage.ErrAppExists):
+			return ClientInformation{}, fmt.Errorf("%s: %w", op, clientNameTaken(md.ClientName))
+		}
+		log.Error("failed to update client registration", slog.Any("error", err))
+		return ClientInformation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client registration updated")
+
+	return ClientInformation{
+		ClientMetadata:          md,
+		ClientID:                app.ID,
+		ClientIDIssuedAt:        reg.CreatedAt,
+		RegistrationAccessToken: token,
+		RegistrationClientURI:   r.clientURI(app.ID),
+	}, nil
+}
+
+// DeleteClient deletes the registered client (RFC 7592, section 2.3). Tokens issued
+// for it can no longer be verified.
+func (r *Registration) DeleteClient(ctx context.Context, clientId int, token string) error {
+	const op = "apps.DeleteClient"
+
+	log := r.log.With(slog.String("op", op), slog.Int("app_id", clientId))
+
+	if _, _, err := r.registration(ctx, clientId, token); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.appStorage.DeleteApp(ctx, clientId); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidRegistrationToken)
+		}
+		log.Error("failed to delete app", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client registration deleted")
+
+	return nil
+}
+
+// registration returns the app and the registration of the client if the
+// registration access token is the one issued for it.
+func (r *Registration) registration(
+	ctx context.Context,
+	clientId int,
+	token string,
+) (entity.App, entity.ClientRegistration, error) {
+	reg, err := r.registrationStorage.ClientRegistration(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrRegistrationNotFound) {
+			return entity.App{}, entity.ClientRegistration{}, ErrInvalidRegistrationToken
+		}
+		return entity.App{}, entity.ClientRegistration{}, err
+	}
+
+	if subtle.ConstantTimeCompare(hashToken(token), reg.AccessTokenHash) != 1 {
+		r.log.Warn("invalid registration access token", slog.Int("app_id", clientId))
+		return entity.App{}, entity.ClientRegistration{}, ErrInvalidRegistrationToken
+	}
+
+	app, err := r.appStorage.App(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return entity.App{}, entity.ClientRegistration{}, ErrInvalidRegistrationToken
+		}
+		return entity.App{}, entity.ClientRegistration{}, err
+	}
+
+	return app, reg, nil
+}
+
+func (r *Registration) clientURI(clientId int) string {
+	return r.endpoint + "/" + strconv.Itoa(clientId)
+}
+
+func withDefaults(md ClientMetadata) ClientMetadata {
+	md.ClientName = strings.TrimSpace(md.ClientName)
+	if len(md.GrantTypes) == 0 {
+		md.GrantTypes = []string{oauth.GrantTypeAuthorizationCode}
+	}
+	if md.TokenEndpointAuthMethod == "" {
+		md.TokenEndpointAuthMethod = entity.TokenAuthClientSecretBasic
+	}
+
+	return md
+}
+
+func (r *Registration) validateMetadata(md ClientMetadata) error {
+	if md.ClientName == "" {
+		return fmt.Errorf("%w: client_name is required", ErrInvalidClientMetadata)
+	}
+
+	settings := entity.AppSettings{
+		ClientScopes:    md.Scopes,
+		GrantTypes:      md.GrantTypes,
+		TokenAuthMethod: md.TokenEndpointAuthMethod,
+	}
+	if err := validateSettings(settings); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidClientMetadata, err)
+	}
+
+	// The client credentials and token exchange grants are for confidential clients only.
+	if md.TokenEndpointAuthMethod == entity.TokenAuthNone &&
+		(slices.Contains(md.GrantTypes, oauth.GrantTypeClientCredentials) ||
+			slices.Contains(md.GrantTypes, oauth.GrantTypeTokenExchange)) {
+		return fmt.Errorf("%w: a public client can only use the authorization code and device code grants",
+			ErrInvalidClientMetadata)
+	}
+
+	if slices.Contains(md.GrantTypes, oauth.GrantTypeAuthorizationCode) && len(md.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: redirect_uris are required by the authorization code grant", ErrInvalidURI)
+	}
+	for _, uri := range md.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return err
+		}
+	}
+
+	if len(md.Scopes) > 0 && !slices.Contains(md.GrantTypes, oauth.GrantTypeClientCredentials) {
+		return fmt.Errorf("%w: scope is only used by the client credentials grant", ErrInvalidClientMetadata)
+	}
+	// A client picks its own scopes, so only those an admin made registrable are allowed.
+	for _, scope := range md.Scopes {
+		if !slices.Contains(r.scopes, scope) {
+			return fmt.Errorf("%w: scope %q can't be registered", ErrInvalidClientMetadata, scope)
+		}
+	}
+
+	if md.LogoURI != "" {
+		logo, err := url.Parse(md.LogoURI)
+		if err != nil || logo.Scheme != "https" || logo.Host == "" {
+			return fmt.Errorf("%w: logo_uri must be an https url", ErrInvalidClientMetadata)
+		}
+	}
+
+	// Contacts are stored space-separated.
+	for _, contact := range md.Contacts {
+		if !strings.Contains(contact, "@") || strings.ContainsAny(contact, " \t\r\n") {
+			return fmt.Errorf("%w: invalid contact %q", ErrInvalidClientMetadata, contact)
+		}
+	}
+
+	return nil
+}
+
+func clientNameTaken(name string) error {
+	return fmt.Errorf("%w: client_name %q is already taken", ErrInvalidClientMetadata, name)
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+
+	return sum[:]
+}
@@ -0,0 +1,361 @@
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	initialAccessToken   = "initial-token"
+	registrationEndpoint = "https://sso.example.com/register"
+)
+
+func newRegistration(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) *Registration {
+	return NewRegistration(slog.Default(), appStorage, registrationStorage, initialAccessToken, registrationEndpoint,
+		[]string{"orders:read"})
+}
+
+func TestRegistration_registerClient(t *testing.T) {
+	prefixName := "registration service"
+	valid := ClientMetadata{
+		ClientName:   " Shop ",
+		RedirectURIs: []string{"https://shop.example.com/callback"},
+		LogoURI:      "https://shop.example.com/logo.png",
+		Contacts:     []string{"dev@shop.example.com"},
+	}
+	type test struct {
+		name       string
+		prepare    func(registrationStorage *MockRegistrationStorage)
+		token      string
+		md         func(md ClientMetadata) ClientMetadata
+		wantSecret bool
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "register client success test"),
+			prepare: func(registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().RegisterClient(gomock.Any(), gomock.Any(), valid.RedirectURIs, gomock.Any()).
+					DoAndReturn(func(_ context.Context, app entity.App, _ []string, reg entity.ClientRegistration) (int, error) {
+						assert.Equal(t, "Shop", app.Name)
+						assert.NotEmpty(t, app.Secret)
+						assert.True(t, app.Settings.ThirdParty)
+						assert.Equal(t, []string{"authorization_code"}, app.Settings.GrantTypes)
+						assert.Equal(t, entity.TokenAuthClientSecretBasic, app.Settings.TokenAuthMethod)
+						assert.Len(t, reg.AccessTokenHash, 32)
+						assert.Equal(t, valid.LogoURI, reg.LogoURI)
+						assert.Equal(t, valid.Contacts, reg.Contacts)
+						return 7, nil
+					})
+			},
+			token:      initialAccessToken,
+			wantSecret: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "register client success test: public client"),
+			prepare: func(registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().RegisterClient(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(7, nil)
+			},
+			token: initialAccessToken,
+			md: func(md ClientMetadata) ClientMetadata {
+				md.TokenEndpointAuthMethod = entity.TokenAuthNone
+				md.GrantTypes = []string{"authorization_code", "urn:ietf:params:oauth:grant-type:device_code"}
+				return md
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: wrong initial access token"),
+			token:   "guess",
+			wantErr: ErrInvalidInitialAccessToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: no name"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.ClientName = " "; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: no redirect uri"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.RedirectURIs = nil; return md },
+			wantErr: ErrInvalidURI,
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "register client negative test: plain http redirect uri"),
+			token: initialAccessToken,
+			md: func(md ClientMetadata) ClientMetadata {
+				md.RedirectURIs = []string{"http://shop.example.com/cb"}
+				return md
+			},
+			wantErr: ErrInvalidURI,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: unsupported grant type"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.GrantTypes = []string{"password"}; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "register client negative test: public client credentials"),
+			token: initialAccessToken,
+			md: func(md ClientMetadata) ClientMetadata {
+				md.TokenEndpointAuthMethod = entity.TokenAuthNone
+				md.GrantTypes = []string{"client_credentials"}
+				return md
+			},
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: unsupported auth method"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.TokenEndpointAuthMethod = "private_key_jwt"; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: scope without client credentials"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.Scopes = []string{"orders:read"}; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "register client success test: registrable scope"),
+			prepare: func(registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().RegisterClient(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, app entity.App, _ []string, _ entity.ClientRegistration) (int, error) {
+						assert.Equal(t, []string{"orders:read"}, app.Settings.ClientScopes)
+						return 7, nil
+					})
+			},
+			token: initialAccessToken,
+			md: func(md ClientMetadata) ClientMetadata {
+				md.GrantTypes = []string{"client_credentials"}
+				md.Scopes = []string{"orders:read"}
+				return md
+			},
+			wantSecret: true,
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "register client negative test: scope not registrable"),
+			token: initialAccessToken,
+			md: func(md ClientMetadata) ClientMetadata {
+				md.GrantTypes = []string{"client_credentials"}
+				md.Scopes = []string{"orders:read", "admin"}
+				return md
+			},
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: plain http logo"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.LogoURI = "http://shop.example.com/logo.png"; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "register client negative test: invalid contact"),
+			token:   initialAccessToken,
+			md:      func(md ClientMetadata) ClientMetadata { md.Contacts = []string{"dev team"}; return md },
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "register client negative test: name taken"),
+			prepare: func(registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().RegisterClient(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(0, storage.ErrAppExists)
+			},
+			token:   initialAccessToken,
+			wantErr: ErrInvalidClientMetadata,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			registrationStorage := NewMockRegistrationStorage(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(registrationStorage)
+			}
+
+			md := valid
+			if tt.md != nil {
+				md = tt.md(md)
+			}
+
+			info, err := newRegistration(NewMockAppStorage(ctrl), registrationStorage).
+				RegisterClient(context.Background(), tt.token, md)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, 7, info.ClientID)
+				assert.Equal(t, "Shop", info.ClientName)
+				assert.NotEmpty(t, info.RegistrationAccessToken)
+				assert.Equal(t, registrationEndpoint+"/7", info.RegistrationClientURI)
+				assert.Equal(t, tt.wantSecret, info.ClientSecret != "")
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestRegistration_manageClient(t *testing.T) {
+	prefixName := "registration service"
+	const token = "registration-token"
+	app := entity.App{ID: 7, Name: "Shop", Secret: "secret", Settings: entity.AppSettings{
+		ThirdParty:      true,
+		AccessTokenTTL:  time.Hour,
+		GrantTypes:      []string{"authorization_code"},
+		TokenAuthMethod: entity.TokenAuthClientSecretBasic,
+	}}
+	reg := entity.ClientRegistration{AppID: 7, AccessTokenHash: hashToken(token), LogoURI: "https://shop.example.com/logo.png"}
+	uris := []string{"https://shop.example.com/callback"}
+	type test struct {
+		name    string
+		prepare func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage)
+		call    func(r *Registration) error
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "read client success test"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+				appStorage.EXPECT().App(gomock.Any(), 7).Return(app, nil)
+				appStorage.EXPECT().RedirectURIs(gomock.Any(), 7).Return(uris, nil)
+			},
+			call: func(r *Registration) error {
+				info, err := r.ReadClient(context.Background(), 7, token)
+				assert.Equal(t, "Shop", info.ClientName)
+				assert.Equal(t, uris, info.RedirectURIs)
+				assert.Equal(t, reg.LogoURI, info.LogoURI)
+				assert.Equal(t, token, info.RegistrationAccessToken)
+				assert.Empty(t, info.ClientSecret)
+				return err
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "read client negative test: wrong token"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+			},
+			call: func(r *Registration) error {
+				_, err := r.ReadClient(context.Background(), 7, "guess")
+				return err
+			},
+			wantErr: ErrInvalidRegistrationToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "read client negative test: app created by an admin"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 2).
+					Return(entity.ClientRegistration{}, storage.ErrRegistrationNotFound)
+			},
+			call: func(r *Registration) error {
+				_, err := r.ReadClient(context.Background(), 2, token)
+				return err
+			},
+			wantErr: ErrInvalidRegistrationToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "update client success test"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+				appStorage.EXPECT().App(gomock.Any(), 7).Return(app, nil)
+				registrationStorage.EXPECT().UpdateClientRegistration(gomock.Any(), gomock.Any(), uris, gomock.Any()).
+					DoAndReturn(func(_ context.Context, updated entity.App, _ []string, updatedReg entity.ClientRegistration) error {
+						assert.Equal(t, "Shop 2", updated.Name)
+						assert.Equal(t, app.Settings.AccessTokenTTL, updated.Settings.AccessTokenTTL)
+						assert.True(t, updated.Settings.ThirdParty)
+						assert.Empty(t, updatedReg.LogoURI)
+						return nil
+					})
+			},
+			call: func(r *Registration) error {
+				_, err := r.UpdateClient(context.Background(), 7, token, ClientMetadata{ClientName: "Shop 2", RedirectURIs: uris})
+				return err
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "update client negative test: scope not registrable"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+				appStorage.EXPECT().App(gomock.Any(), 7).Return(app, nil)
+			},
+			call: func(r *Registration) error {
+				_, err := r.UpdateClient(context.Background(), 7, token, ClientMetadata{
+					ClientName: "Shop",
+					GrantTypes: []string{"client_credentials"},
+					Scopes:     []string{"admin"},
+				})
+				return err
+			},
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "update client negative test: auth method changed"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+				appStorage.EXPECT().App(gomock.Any(), 7).Return(app, nil)
+			},
+			call: func(r *Registration) error {
+				_, err := r.UpdateClient(context.Background(), 7, token, ClientMetadata{
+					ClientName:              "Shop",
+					RedirectURIs:            uris,
+					TokenEndpointAuthMethod: entity.TokenAuthNone,
+				})
+				return err
+			},
+			wantErr: ErrInvalidClientMetadata,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "delete client success test"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+				appStorage.EXPECT().App(gomock.Any(), 7).Return(app, nil)
+				appStorage.EXPECT().DeleteApp(gomock.Any(), 7).Return(nil)
+			},
+			call: func(r *Registration) error {
+				return r.DeleteClient(context.Background(), 7, token)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "delete client negative test: no token"),
+			prepare: func(appStorage *MockAppStorage, registrationStorage *MockRegistrationStorage) {
+				registrationStorage.EXPECT().ClientRegistration(gomock.Any(), 7).Return(reg, nil)
+			},
+			call: func(r *Registration) error {
+				return r.DeleteClient(context.Background(), 7, "")
+			},
+			wantErr: ErrInvalidRegistrationToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			appStorage := NewMockAppStorage(ctrl)
+			registrationStorage := NewMockRegistrationStorage(ctrl)
+			tt.prepare(appStorage, registrationStorage)
+
+			err := tt.call(newRegistration(appStorage, registrationStorage))
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
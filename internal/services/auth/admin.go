@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserDisabled     = errors.New("user is disabled")
+	ErrNotAdmin         = errors.New("user is not an admin")
+	ErrLastAdmin        = errors.New("can't revoke the last admin")
+	ErrInvalidPassword  = errors.New("password required")
+)
+
+// SetAdmin makes the user an admin. Only an admin can call it.
+//
+// Granting admin to a user who already is one is not an error.
+func (auth *Auth) SetAdmin(ctx context.Context, actorId int64, userId int64) error {
+	const op = "auth.SetAdmin"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("user_id", userId),
+	)
+	log.Info("granting admin")
+
+	if err := auth.requireAdmin(ctx, actorId); err != nil {
+		log.Warn("admin grant denied", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := auth.userStorage.SetAdmin(ctx, userId, actorId); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to grant admin", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("admin granted")
+
+	return nil
+}
+
+// RevokeAdmin takes admin away from the user. Only an admin can call it,
+// including on themselves, but the last remaining admin can't be revoked.
+func (auth *Auth) RevokeAdmin(ctx context.Context, actorId int64, userId int64) error {
+	const op = "auth.RevokeAdmin"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("user_id", userId),
+	)
+	log.Info("revoking admin")
+
+	if err := auth.requireAdmin(ctx, actorId); err != nil {
+		log.Warn("admin revoke denied", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := auth.userStorage.RevokeAdmin(ctx, userId, actorId); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrUserNotFound):
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		case errors.Is(err, storage.ErrNotAdmin):
+			return fmt.Errorf("%s: %w", op, ErrNotAdmin)
+		case errors.Is(err, storage.ErrLastAdmin):
+			log.Warn("attempt to revoke the last admin")
+			return fmt.Errorf("%s: %w", op, ErrLastAdmin)
+		}
+		log.Error("failed to revoke admin", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("admin revoked")
+
+	return nil
+}
+
+// ResetPassword sets a new password for the user. Only an admin can call it.
+func (auth *Auth) ResetPassword(ctx context.Context, actorId int64, userId int64, password string) error {
+	const op = "auth.ResetPassword"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("user_id", userId),
+	)
+
+	if err := auth.requireAdmin(ctx, actorId); err != nil {
+		log.Warn("password reset denied", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if password == "" {
+		return fmt.Errorf("%s: %w", op, ErrInvalidPassword)
+	}
+
+	if auth.directory != nil {
+		user, err := auth.userProvider.UserByID(ctx, userId)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+			}
+			log.Error("failed to get user", slog.Any("error", err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if auth.directory.serves(user.Email) {
+			return fmt.Errorf("%s: %w", op, ErrDirectoryUser)
+		}
+	}
+
+	passHash, err := auth.hasher.Hash(ctx, password)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := auth.userStorage.ResetPassword(ctx, userId, passHash, actorId); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to reset password", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset")
+
+	return nil
+}
+
+// RevokeSessions revokes the personal access tokens of the user and forgets
+// their devices. Only an admin can call it. Returns the number of tokens revoked.
+//
+// Access tokens issued to the user so far are refused from then on wherever this
+// server verifies them. Resource servers that only check the signature keep
+// accepting them until they expire.
+func (auth *Auth) RevokeSessions(ctx context.Context, actorId int64, userId int64) (int64, error) {
+	const op = "auth.RevokeSessions"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("user_id", userId),
+	)
+
+	if err := auth.requireAdmin(ctx, actorId); err != nil {
+		log.Warn("session revoke denied", slog.Any("error", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := auth.userStorage.RevokeSessions(ctx, userId, actorId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to revoke sessions", slog.Any("error", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("sessions revoked", slog.Int64("tokens", revoked))
+
+	return revoked, nil
+}
+
+// sessionUser returns the user a verified token was issued to, as long as the
+// token still holds: it isn't a client token, the user isn't disabled, their
+// sessions weren't revoked since the token was issued and the personal access
+// token it was given for, if any, is still active.
+func (auth *Auth) sessionUser(ctx context.Context, log *slog.Logger, claims map[string]any) (entity.User, error) {
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		log.Info("token has no user")
+		return entity.User{}, ErrInvalidToken
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, int64(uid))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return entity.User{}, ErrInvalidToken
+		}
+		log.Error("failed to get user", slog.Any("error", err))
+		return entity.User{}, err
+	}
+
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("user is disabled", slog.Int64("user_id", user.ID))
+		return entity.User{}, ErrInvalidToken
+	}
+
+	if user.TokenRevoked(jwt.IssuedAt(claims)) {
+		log.Info("token was issued before the sessions were revoked", slog.Int64("user_id", user.ID))
+		return entity.User{}, ErrInvalidToken
+	}
+
+	if tokenId, ok := jwt.PersonalAccessTokenID(claims); ok {
+		pat, err := auth.userProvider.PersonalAccessToken(ctx, tokenId)
+		if err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+			log.Error("failed to get personal access token", slog.Any("error", err))
+			return entity.User{}, err
+		}
+		if err != nil || pat.UserID != user.ID || !pat.Active(time.Now()) {
+			log.Info("personal access token was revoked or expired", slog.Int64("token_id", tokenId))
+			return entity.User{}, ErrInvalidToken
+		}
+	}
+
+	return user, nil
+}
+
+func (auth *Auth) requireAdmin(ctx context.Context, userId int64) error {
+	isAdmin, err := auth.userProvider.IsAdmin(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+	if !isAdmin {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
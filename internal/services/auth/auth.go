@@ -5,14 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
 	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
 	"github.com/KRYST4L614/auth_service/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 	"log/slog"
+	"sync"
 	"time"
 )
 
-//go:generate mockgen -destination=mock_auth.go -package=auth . UserStorage,UserProvider,AppProvider
+//go:generate mockgen -destination=mock_auth.go -package=auth . UserStorage,UserProvider,AppProvider,DeviceStorage,Mailer,Directory,DirectoryStorage
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
@@ -21,11 +22,17 @@ var (
 )
 
 type Auth struct {
-	log          *slog.Logger
-	userStorage  UserStorage
-	userProvider UserProvider
-	appProvider  AppProvider
-	tokenTTL     time.Duration
+	log           *slog.Logger
+	userStorage   UserStorage
+	userProvider  UserProvider
+	appProvider   AppProvider
+	deviceStorage DeviceStorage
+	mailer        Mailer
+	hasher        *PasswordHasher
+	directory     *DirectoryBackend
+	signingKey    *jwk.Key
+	tokenTTL      time.Duration
+	notifications sync.WaitGroup
 }
 
 type UserStorage interface {
@@ -34,31 +41,66 @@ type UserStorage interface {
 		email string,
 		passHash []byte,
 	) (uid int64, err error)
+	SaveTOTPFactor(ctx context.Context, userId int64, secret string) error
+	ConfirmTOTPFactor(ctx context.Context, userId int64, step int64) error
+	UseTOTPStep(ctx context.Context, userId int64, step int64) error
+	SetAdmin(ctx context.Context, userId int64, actorId int64) error
+	RevokeAdmin(ctx context.Context, userId int64, actorId int64) error
+	ResetPassword(ctx context.Context, userId int64, passHash []byte, actorId int64) error
+	RevokeSessions(ctx context.Context, userId int64, actorId int64) (int64, error)
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (entity.User, error)
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
 	IsAdmin(ctx context.Context, userId int64) (bool, error)
+	UserRoles(ctx context.Context, userId int64, appId int) ([]entity.Role, error)
+	Membership(ctx context.Context, orgId int64, userId int64) (entity.Membership, error)
+	ListUsers(ctx context.Context, query entity.UserQuery) ([]entity.User, error)
+	Consent(ctx context.Context, userId int64, appId int) (entity.Consent, error)
+	TOTPFactor(ctx context.Context, userId int64) (entity.TOTPFactor, error)
+	PersonalAccessToken(ctx context.Context, tokenId int64) (entity.PersonalAccessToken, error)
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appId int) (entity.App, error)
 }
 
-// New returns a new instance of the Auth service
+type DeviceStorage interface {
+	Devices(ctx context.Context, userId int64) ([]entity.Device, error)
+	SaveDevice(ctx context.Context, device entity.Device) (int64, error)
+	TouchDevice(ctx context.Context, deviceId int64) error
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// New returns a new instance of the Auth service. The directory may be nil.
+// Access tokens are signed and verified with the signing key.
 func New(
 	log *slog.Logger,
 	userStorage UserStorage,
 	userProvider UserProvider,
 	appProvider AppProvider,
+	deviceStorage DeviceStorage,
+	mailer Mailer,
+	hasher *PasswordHasher,
+	directory *DirectoryBackend,
+	signingKey *jwk.Key,
 	tokenTTL time.Duration,
 ) *Auth {
 	return &Auth{
-		log:          log,
-		userStorage:  userStorage,
-		userProvider: userProvider,
-		appProvider:  appProvider,
-		tokenTTL:     tokenTTL,
+		log:           log,
+		userStorage:   userStorage,
+		userProvider:  userProvider,
+		appProvider:   appProvider,
+		deviceStorage: deviceStorage,
+		mailer:        mailer,
+		hasher:        hasher,
+		directory:     directory,
+		signingKey:    signingKey,
+		tokenTTL:      tokenTTL,
 	}
 }
 
@@ -66,14 +108,22 @@ func New(
 //
 // If user exists, but password is incorrect, returns error.
 // If user doesn't exist, returns error.
+// If the requested acr can't be reached with a password, and a one-time code
+// if one is given, returns ErrStepUpRequired.
 func (auth *Auth) Login(
 	ctx context.Context,
 	email string,
 	password string,
 	appId int,
+	opts ...LoginOption,
 ) (string, error) {
 	const op = "auth.Login"
 
+	var options loginOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	log := auth.log.With(
 		slog.String("operation", op),
 		slog.String("email", email),
@@ -81,37 +131,42 @@ func (auth *Auth) Login(
 	)
 	log.Info("attempt to login")
 
-	user, err := auth.userProvider.User(ctx, email)
+	user, app, amr, err := auth.authenticate(ctx, log, email, password, appId, options)
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Warn("user not found", slog.Any("error", err))
-
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
-		}
-
-		log.Info("failed to login", slog.Any("error", err))
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		log.Info("invalid credentials", slog.Any("error", err))
+	roles, err := auth.userProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to get user roles", slog.Any("error", err))
 
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	app, err := auth.appProvider.App(ctx, appId)
-	if err != nil {
-		if errors.Is(err, storage.ErrAppNotFound) {
-			log.Warn("app not found", slog.Any("error", err))
+	tokenOpts := []jwt.Option{jwt.WithAuthContext(time.Now(), amr), jwt.WithRoles(roles)}
 
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+	if options.orgId != 0 {
+		membership, err := auth.membership(ctx, options.orgId, user.ID)
+		if err != nil {
+			log.Info("login into organization denied", slog.Int64("org_id", options.orgId), slog.Any("error", err))
+
+			return "", fmt.Errorf("%s: %w", op, err)
 		}
-		return "", fmt.Errorf("%s: %w", op, err)
+		tokenOpts = append(tokenOpts, jwt.WithOrg(membership))
 	}
 
 	log.Info("user logged is successfully")
 
-	token, err := jwt.NewToken(user, app, auth.tokenTTL)
+	auth.trackDevice(ctx, log, user)
+
+	// A password login always authenticates the user anew, so max age only
+	// caps the token lifetime: the token can't outlive the requested freshness.
+	tokenTTL := auth.appTokenTTL(app)
+	if options.maxAge > 0 && options.maxAge < tokenTTL {
+		tokenTTL = options.maxAge
+	}
+
+	token, err := jwt.NewToken(auth.signingKey, user, app, tokenTTL, tokenOpts...)
 	if err != nil {
 		log.Error("failed to generate token", slog.Any("error", err))
 
@@ -123,20 +178,40 @@ func (auth *Auth) Login(
 
 // Register registers new user in the system and returns user ID
 // If user with given username already exists, returns error.
+// If registered through an app that doesn't allow it, returns error. Without
+// an app no app policy applies.
 func (auth *Auth) Register(
 	ctx context.Context,
 	email string,
 	password string,
+	opts ...RegisterOption,
 ) (int64, error) {
 	const op = "auth.RegisterNewUser"
 
+	var options registerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	log := auth.log.With(
 		slog.String("op", op),
 	)
 
 	log.Info("registering user")
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if auth.directory.serves(email) {
+		log.Info("email is managed by the directory")
+		return -1, fmt.Errorf("%s: %w", op, ErrDirectoryUser)
+	}
+
+	if options.appId != 0 {
+		if err := auth.checkRegistration(ctx, options.appId, email); err != nil {
+			log.Info("registration denied by app", slog.Int("app_id", options.appId), slog.Any("error", err))
+			return -1, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	passHash, err := auth.hasher.Hash(ctx, password)
 	if err != nil {
 		log.Error("failed to generate password hash", slog.Any("error", err))
 		return -1, fmt.Errorf("%s:%w", op, err)
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_loginAppPolicy(t *testing.T) {
+	prefixName := "auth service"
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	user := entity.User{ID: 1, Email: "test@corp.com", PassHash: passHash}
+	type test struct {
+		name     string
+		settings entity.AppSettings
+		wantTTL  time.Duration
+		wantErr  error
+	}
+	tests := []test{
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "login uses app access token ttl"),
+			settings: entity.AppSettings{AccessTokenTTL: 5 * time.Minute, AllowedEmailDomains: []string{"CORP.com"}},
+			wantTTL:  5 * time.Minute,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "login uses global ttl by default"),
+			settings: entity.AppSettings{},
+			wantTTL:  time.Hour,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "login negative test: email domain not allowed"),
+			settings: entity.AppSettings{AllowedEmailDomains: []string{"partner.com"}},
+			wantErr:  ErrEmailDomainNotAllowed,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "login negative test: password login not allowed"),
+			settings: entity.AppSettings{LoginMethods: []string{entity.AMRHardwareKey}},
+			wantErr:  ErrLoginMethodNotAllowed,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "login negative test: app requires mfa"),
+			settings: entity.AppSettings{RequiredACR: entity.ACRMultiFactor},
+			wantErr:  ErrStepUpRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			app := entity.App{ID: 1, Secret: "secret", Settings: tt.settings}
+
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().User(gomock.Any(), user.Email).Return(user, nil)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil)
+			if tt.wantErr == nil {
+				userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, app.ID).Return(nil, nil)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, err := auth.Login(context.Background(), user.Email, "password", app.ID)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				exp, _ := claims.GetExpirationTime()
+				assert.InDelta(t, tt.wantTTL.Seconds(), time.Until(exp.Time).Seconds(), 5)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestAuth_registerAppPolicy(t *testing.T) {
+	prefixName := "auth service"
+	type test struct {
+		name     string
+		email    string
+		settings entity.AppSettings
+		opts     []RegisterOption
+		wantErr  error
+	}
+	tests := []test{
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "register through app success test"),
+			email:    "new@corp.com",
+			settings: entity.AppSettings{AllowRegistration: true, AllowedEmailDomains: []string{"corp.com"}},
+			opts:     []RegisterOption{WithApp(1)},
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "register without app success test"),
+			email: "new@gmail.com",
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "register through app negative test: registration disabled"),
+			email:    "new@corp.com",
+			settings: entity.AppSettings{AllowRegistration: false},
+			opts:     []RegisterOption{WithApp(1)},
+			wantErr:  ErrRegistrationDisabled,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "register through app negative test: email domain not allowed"),
+			email:    "new@gmail.com",
+			settings: entity.AppSettings{AllowRegistration: true, AllowedEmailDomains: []string{"corp.com"}},
+			opts:     []RegisterOption{WithApp(1)},
+			wantErr:  ErrEmailDomainNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userStorage := NewMockUserStorage(ctrl)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Settings: tt.settings}, nil).AnyTimes()
+			if tt.wantErr == nil {
+				userStorage.EXPECT().SaveUser(gomock.Any(), tt.email, gomock.Any()).Return(int64(1), nil)
+			}
+
+			auth := New(slog.Default(), userStorage, NewMockUserProvider(ctrl), appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			_, err := auth.Register(context.Background(), tt.email, "password", tt.opts...)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_authenticateToken(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	otherApp := entity.App{ID: 2, Secret: "other-secret"}
+	user := entity.User{ID: 10, Email: "test@mail.com", Status: entity.UserStatusActive}
+	admin := entity.User{ID: 20, Email: "admin@mail.com", Status: entity.UserStatusActive}
+
+	signedToken := func(key *jwk.Key, user entity.User, app entity.App, opts ...jwt.Option) string {
+		token, err := jwt.NewToken(key, user, app, time.Hour, opts...)
+		assert.Nil(t, err)
+		return token
+	}
+	clientToken, err := jwt.NewClientToken(signingKey, app, time.Hour)
+	assert.Nil(t, err)
+
+	type test struct {
+		name    string
+		token   string
+		stored  entity.User
+		wantErr error
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "authenticate token success test"),
+			token:  signedToken(signingKey, user, app),
+			stored: user,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: token of another app"),
+			token:   signedToken(signingKey, user, otherApp),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: forged token"),
+			token:   signedToken(otherKey, user, app),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: impersonation token"),
+			token:   signedToken(signingKey, user, app, jwt.WithActor(admin)),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: token given for a personal access token"),
+			token: signedToken(signingKey, user, app,
+				jwt.WithAuthContext(time.Now(), []string{entity.AMRPersonalAccessToken})),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: client token"),
+			token:   clientToken,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: deleted user"),
+			token:   signedToken(signingKey, user, app),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: disabled user"),
+			token:   signedToken(signingKey, user, app),
+			stored:  entity.User{ID: user.ID, Email: user.Email, Status: entity.UserStatusDisabled},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "authenticate token negative test: sessions revoked"),
+			token: signedToken(signingKey, user, app),
+			stored: entity.User{ID: user.ID, Email: user.Email, Status: entity.UserStatusActive,
+				SessionsRevokedAt: time.Now()},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().UserByID(gomock.Any(), user.ID).AnyTimes().
+				DoAndReturn(func(context.Context, int64) (entity.User, error) {
+					if tt.stored.ID == 0 {
+						return entity.User{}, storage.ErrUserNotFound
+					}
+					return tt.stored, nil
+				})
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, NewMockAppProvider(ctrl),
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			authenticated, err := auth.AuthenticateToken(context.Background(), tt.token, app.ID)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, user.ID, authenticated.ID)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestAuth_authenticateClient(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	deleted := entity.App{ID: 2, Secret: "deleted-secret"}
+	user := entity.User{ID: 10, Email: "test@mail.com", Status: entity.UserStatusActive}
+
+	clientToken := func(key *jwk.Key, app entity.App) string {
+		token, err := jwt.NewClientToken(key, app, time.Hour)
+		assert.Nil(t, err)
+		return token
+	}
+	userToken, err := jwt.NewToken(signingKey, user, app, time.Hour)
+	assert.Nil(t, err)
+
+	type test struct {
+		name    string
+		token   string
+		wantErr error
+	}
+	tests := []test{
+		{
+			name:  fmt.Sprintf("%s: %s", prefixName, "authenticate client success test"),
+			token: clientToken(signingKey, app),
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate client negative test: user token"),
+			token:   userToken,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate client negative test: forged token"),
+			token:   clientToken(otherKey, app),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "authenticate client negative test: deleted app"),
+			token:   clientToken(signingKey, deleted),
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).AnyTimes().Return(app, nil)
+			appProvider.EXPECT().App(gomock.Any(), deleted.ID).AnyTimes().Return(entity.App{}, storage.ErrAppNotFound)
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), NewMockUserProvider(ctrl), appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			authenticated, err := auth.AuthenticateClient(context.Background(), tt.token)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, app.ID, authenticated.ID)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/ldap"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	serviceDN       = "cn=sso,dc=corp,dc=com"
+	servicePassword = "service-secret"
+	adminsGroup     = "cn=admins,ou=groups,dc=corp,dc=com"
+)
+
+// fakeDirectoryEntry is a user of the fake directory.
+type fakeDirectoryEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// newFakeDirectory starts an in-process LDAP server answering simple binds and
+// searches with an equality filter on mail, and returns its URL.
+func newFakeDirectory(t *testing.T, entries ...fakeDirectoryEntry) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeDirectory(conn, entries)
+		}
+	}()
+
+	return "ldap://" + lis.Addr().String()
+}
+
+func serveFakeDirectory(conn net.Conn, entries []fakeDirectoryEntry) {
+	defer func() { _ = conn.Close() }()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := int64(goldap.LDAPResultInvalidCredentials)
+			if dn == serviceDN && password == servicePassword {
+				code = goldap.LDAPResultSuccess
+			}
+			for _, entry := range entries {
+				if dn == entry.dn && password == entry.password {
+					code = goldap.LDAPResultSuccess
+				}
+			}
+			writeFakeResponse(conn, id, fakeResult(goldap.ApplicationBindResponse, code))
+		case goldap.ApplicationSearchRequest:
+			filter, _ := goldap.DecompileFilter(op.Children[6])
+			for _, entry := range entries {
+				for _, mail := range entry.attributes["mail"] {
+					if filter == "(mail="+goldap.EscapeFilter(mail)+")" {
+						writeFakeResponse(conn, id, fakeEntry(entry, op.Children[7].Children))
+					}
+				}
+			}
+			writeFakeResponse(conn, id, fakeResult(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func fakeResult(tag ber.Tag, code int64) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched dn"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "message"))
+	return result
+}
+
+func fakeEntry(entry fakeDirectoryEntry, requested []*ber.Packet) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "dn"))
+
+	attributes := ber.NewSequence("attributes")
+	for _, name := range requested {
+		values, ok := entry.attributes[name.Data.String()]
+		if !ok {
+			continue
+		}
+		attribute := ber.NewSequence("attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name.Data.String(), "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+
+	return result
+}
+
+func writeFakeResponse(conn net.Conn, id any, op *ber.Packet) {
+	packet := ber.NewSequence("message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+	packet.AppendChild(op)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func TestAuth_directoryLogin(t *testing.T) {
+	prefixName := "auth service"
+
+	url := newFakeDirectory(t,
+		fakeDirectoryEntry{
+			dn:       "cn=test,ou=people,dc=corp,dc=com",
+			password: "directory-password",
+			attributes: map[string][]string{
+				"mail":        {"test@corp.com"},
+				"displayName": {"Test User"},
+				"memberOf":    {"CN=Admins,OU=Groups,DC=corp,DC=com", "cn=staff,ou=groups,dc=corp,dc=com"},
+			},
+		},
+		fakeDirectoryEntry{
+			dn:         "cn=mixed,ou=people,dc=corp,dc=com",
+			password:   "directory-password",
+			attributes: map[string][]string{"mail": {"Mixed@corp.com"}},
+		},
+		fakeDirectoryEntry{
+			dn:         "cn=twin1,ou=people,dc=corp,dc=com",
+			password:   "directory-password",
+			attributes: map[string][]string{"mail": {"twin@corp.com"}},
+		},
+		fakeDirectoryEntry{
+			dn:         "cn=twin2,ou=people,dc=corp,dc=com",
+			password:   "directory-password",
+			attributes: map[string][]string{"mail": {"twin@corp.com"}},
+		},
+	)
+	app := entity.App{ID: 1, Secret: "secret"}
+	user := entity.User{ID: 10, Email: "test@corp.com", Status: entity.UserStatusActive}
+	admin := entity.RoleRef{Name: entity.RoleAdmin, AppID: entity.GlobalAppID}
+	support := entity.RoleRef{Name: "support", AppID: app.ID}
+
+	type test struct {
+		name         string
+		email        string
+		password     string
+		url          string
+		bindPassword string
+		prepare      func(userProvider *MockUserProvider, directoryStorage *MockDirectoryStorage)
+		wantErr      error
+	}
+	tests := []test{
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login success test"),
+			email:    "test@corp.com",
+			password: "directory-password",
+			prepare: func(userProvider *MockUserProvider, directoryStorage *MockDirectoryStorage) {
+				directoryStorage.EXPECT().SyncDirectoryUser(gomock.Any(), entity.DirectoryUser{
+					DN:         "cn=test,ou=people,dc=corp,dc=com",
+					Email:      "test@corp.com",
+					Attributes: map[string]string{"displayName": "Test User"},
+					Groups:     []string{"CN=Admins,OU=Groups,DC=corp,DC=com", "cn=staff,ou=groups,dc=corp,dc=com"},
+				}, []entity.RoleRef{support}).Return(user.ID, nil)
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, app.ID).Return(nil, nil)
+			},
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login success test: email in another case"),
+			email:    "Mixed@corp.com",
+			password: "directory-password",
+			prepare: func(userProvider *MockUserProvider, directoryStorage *MockDirectoryStorage) {
+				directoryStorage.EXPECT().SyncDirectoryUser(gomock.Any(), entity.DirectoryUser{
+					DN:         "cn=mixed,ou=people,dc=corp,dc=com",
+					Email:      "mixed@corp.com",
+					Attributes: map[string]string{},
+					Groups:     []string{},
+				}, nil).Return(user.ID, nil)
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, app.ID).Return(nil, nil)
+			},
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: other domains use local passwords"),
+			email:    "test@mail.com",
+			password: "directory-password",
+			prepare: func(userProvider *MockUserProvider, _ *MockDirectoryStorage) {
+				userProvider.EXPECT().User(gomock.Any(), "test@mail.com").Return(entity.User{}, storage.ErrUserNotFound)
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: wrong password"),
+			email:    "test@corp.com",
+			password: "password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "directory login negative test: empty password"),
+			email:   "test@corp.com",
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: unknown user"),
+			email:    "unknown@corp.com",
+			password: "directory-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: ambiguous email"),
+			email:    "twin@corp.com",
+			password: "directory-password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: disabled locally"),
+			email:    "test@corp.com",
+			password: "directory-password",
+			prepare: func(userProvider *MockUserProvider, directoryStorage *MockDirectoryStorage) {
+				directoryStorage.EXPECT().SyncDirectoryUser(gomock.Any(), gomock.Any(), gomock.Any()).Return(user.ID, nil)
+				disabled := user
+				disabled.Status = entity.UserStatusDisabled
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(disabled, nil)
+			},
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "directory login negative test: service account rejected"),
+			email:        "test@corp.com",
+			password:     "directory-password",
+			bindPassword: "wrong",
+			wantErr:      ErrDirectoryUnavailable,
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "directory login negative test: directory down"),
+			email:    "test@corp.com",
+			password: "directory-password",
+			url:      "ldap://127.0.0.1:1",
+			wantErr:  ErrDirectoryUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cfg := ldap.Config{
+				URL:          url,
+				BindDN:       serviceDN,
+				BindPassword: servicePassword,
+				BaseDN:       "dc=corp,dc=com",
+				Attributes:   []string{"displayName", "department"},
+				Timeout:      time.Second,
+			}
+			if tt.url != "" {
+				cfg.URL = tt.url
+			}
+			if tt.bindPassword != "" {
+				cfg.BindPassword = tt.bindPassword
+			}
+
+			userProvider := NewMockUserProvider(ctrl)
+			directoryStorage := NewMockDirectoryStorage(ctrl)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil).AnyTimes()
+			if tt.prepare != nil {
+				tt.prepare(userProvider, directoryStorage)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), &DirectoryBackend{
+					Directory:  ldap.New(cfg),
+					Storage:    directoryStorage,
+					Domains:    []string{"CORP.com"},
+					GroupRoles: map[string][]entity.RoleRef{adminsGroup: {admin, support}},
+				}, signingKey, time.Hour)
+			token, err := auth.Login(context.Background(), tt.email, tt.password, app.ID)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, token)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestAuth_directoryUserManagement(t *testing.T) {
+	prefixName := "auth service"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userProvider := NewMockUserProvider(ctrl)
+	auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, NewMockAppProvider(ctrl),
+		NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), &DirectoryBackend{
+			Directory: NewMockDirectory(ctrl),
+			Storage:   NewMockDirectoryStorage(ctrl),
+			Domains:   []string{"corp.com"},
+		}, signingKey, time.Hour)
+
+	t.Run(fmt.Sprintf("%s: %s", prefixName, "register negative test: directory user"), func(t *testing.T) {
+		_, err := auth.Register(context.Background(), "new@corp.com", "password")
+		assert.True(t, errors.Is(err, ErrDirectoryUser), err)
+	})
+
+	t.Run(fmt.Sprintf("%s: %s", prefixName, "reset password negative test: directory user"), func(t *testing.T) {
+		userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+		userProvider.EXPECT().UserByID(gomock.Any(), int64(10)).Return(entity.User{ID: 10, Email: "test@corp.com"}, nil)
+
+		err := auth.ResetPassword(context.Background(), 1, 10, "password")
+		assert.True(t, errors.Is(err, ErrDirectoryUser), err)
+	})
+}
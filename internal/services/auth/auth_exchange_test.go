@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_exchangeToken(t *testing.T) {
+	prefixName := "auth service"
+	source := entity.App{ID: 1, Secret: "source-secret"}
+	target := entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{TokenExchangeFrom: []int{1}}}
+	user := entity.User{ID: 10, Email: "test@mail.com", Status: entity.UserStatusActive}
+	admin := entity.User{ID: 20, Email: "admin@mail.com", Status: entity.UserStatusActive}
+	disabled := entity.User{ID: 30, Email: "disabled@mail.com", Status: entity.UserStatusDisabled}
+	revoked := entity.User{ID: 40, Email: "revoked@mail.com", Status: entity.UserStatusActive, SessionsRevokedAt: time.Now().Add(time.Minute)}
+	authTime := time.Now().Add(-time.Minute)
+	amr := []string{entity.AMRPassword}
+
+	signedToken := func(key *jwk.Key, user entity.User, app entity.App, opts ...jwt.Option) string {
+		token, err := jwt.NewToken(key, user, app, 30*time.Minute, append([]jwt.Option{jwt.WithAuthContext(authTime, amr)}, opts...)...)
+		assert.Nil(t, err)
+		return token
+	}
+	newToken := func(user entity.User, app entity.App, opts ...jwt.Option) string {
+		return signedToken(signingKey, user, app, opts...)
+	}
+	clientToken, err := jwt.NewClientToken(signingKey, source, time.Hour)
+	assert.Nil(t, err)
+	thirdPartySource := entity.App{ID: 4, Secret: "shop-secret", Settings: entity.AppSettings{ThirdParty: true}}
+	thirdPartyTarget := entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+		TokenExchangeFrom: []int{1},
+		ThirdParty:        true,
+	}}
+	consent := entity.Consent{UserID: user.ID, GrantID: "grant-1"}
+	pats := map[int64]entity.PersonalAccessToken{
+		9:  {ID: 9, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		10: {ID: 10, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: time.Now()},
+	}
+
+	type test struct {
+		name         string
+		target       entity.App
+		subjectToken string
+		actorToken   string
+		scopes       []string
+		consents     map[int]entity.Consent
+		check        func(t *testing.T, claims map[string]any)
+		wantErr      error
+	}
+	tests := []test{
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token success test"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithScopes([]string{"read", "write"})),
+			check: func(t *testing.T, claims map[string]any) {
+				assert.Equal(t, float64(user.ID), claims["uid"])
+				assert.Equal(t, float64(target.ID), claims["app_id"])
+				assert.Equal(t, "read write", claims["scope"])
+				assert.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+				assert.LessOrEqual(t, claims["exp"], float64(time.Now().Add(30*time.Minute).Unix()))
+				assert.Nil(t, claims["act"])
+			},
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token success test: personal access token"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithPersonalAccessToken(9)),
+			check: func(t *testing.T, claims map[string]any) {
+				tokenId, ok := jwt.PersonalAccessTokenID(claims)
+				assert.True(t, ok)
+				assert.Equal(t, int64(9), tokenId)
+			},
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: personal access token revoked"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithPersonalAccessToken(10)),
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token success test: narrower scopes"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithScopes([]string{"read", "write"})),
+			scopes:       []string{"read"},
+			check: func(t *testing.T, claims map[string]any) {
+				assert.Equal(t, "read", claims["scope"])
+			},
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token success test: delegation"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithActor(disabled)),
+			actorToken:   newToken(admin, target),
+			check: func(t *testing.T, claims map[string]any) {
+				act, ok := claims["act"].(map[string]any)
+				assert.True(t, ok)
+				assert.Equal(t, "20", act["sub"])
+				prior, ok := act["act"].(map[string]any)
+				assert.True(t, ok)
+				assert.Equal(t, "30", prior["sub"])
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token success test: third-party subject token"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom: []int{thirdPartySource.ID},
+			}},
+			subjectToken: newToken(user, thirdPartySource, jwt.WithConsent(consent)),
+			consents:     map[int]entity.Consent{thirdPartySource.ID: consent},
+			check: func(t *testing.T, claims map[string]any) {
+				assert.Nil(t, claims["consent_id"])
+			},
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token success test: third-party audience"),
+			target:       thirdPartyTarget,
+			subjectToken: newToken(user, source),
+			consents:     map[int]entity.Consent{thirdPartyTarget.ID: consent},
+			check: func(t *testing.T, claims map[string]any) {
+				assert.Equal(t, "grant-1", claims["consent_id"])
+			},
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: third-party audience without consent"),
+			target:       thirdPartyTarget,
+			subjectToken: newToken(user, source),
+			wantErr:      ErrConsentRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: consent to the subject token's app revoked"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom: []int{thirdPartySource.ID},
+			}},
+			subjectToken: newToken(user, thirdPartySource, jwt.WithConsent(consent)),
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: consent to the subject token's app given again"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom: []int{thirdPartySource.ID},
+			}},
+			subjectToken: newToken(user, thirdPartySource, jwt.WithConsent(consent)),
+			consents:     map[int]entity.Consent{thirdPartySource.ID: {UserID: user.ID, GrantID: "grant-2"}},
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: one login method not allowed"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom: []int{1},
+				LoginMethods:      []string{entity.AMRPassword},
+			}},
+			subjectToken: newToken(user, source, jwt.WithAuthContext(authTime, []string{entity.AMRPassword, entity.AMROTP})),
+			wantErr:      ErrLoginMethodNotAllowed,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: no login methods"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithAuthContext(authTime, nil)),
+			wantErr:      ErrLoginMethodNotAllowed,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: app not trusted"),
+			target:       entity.App{ID: 2, Secret: "target-secret"},
+			subjectToken: newToken(user, source),
+			wantErr:      ErrExchangeNotAllowed,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: wider scopes"),
+			target:       target,
+			subjectToken: newToken(user, source, jwt.WithScopes([]string{"read"})),
+			scopes:       []string{"read", "write"},
+			wantErr:      ErrScopeNotGranted,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: forged token"),
+			target:       target,
+			subjectToken: signedToken(otherKey, user, source),
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: client token"),
+			target:       target,
+			subjectToken: clientToken,
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: disabled user"),
+			target:       target,
+			subjectToken: newToken(disabled, source),
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: sessions revoked"),
+			target:       target,
+			subjectToken: newToken(revoked, source),
+			wantErr:      ErrInvalidToken,
+		},
+		{
+			name:         fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: untrusted actor token"),
+			target:       target,
+			subjectToken: newToken(user, source),
+			actorToken:   newToken(admin, entity.App{ID: 3, Secret: "third-secret"}),
+			wantErr:      ErrExchangeNotAllowed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: stronger acr required"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom: []int{1},
+				RequiredACR:       entity.ACRMultiFactor,
+			}},
+			subjectToken: newToken(user, source),
+			wantErr:      ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange token negative test: email domain not allowed"),
+			target: entity.App{ID: 2, Secret: "target-secret", Settings: entity.AppSettings{
+				TokenExchangeFrom:   []int{1},
+				AllowedEmailDomains: []string{"corp.com"},
+			}},
+			subjectToken: newToken(user, source),
+			wantErr:      ErrEmailDomainNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			apps := map[int]entity.App{source.ID: source, thirdPartySource.ID: thirdPartySource, tt.target.ID: tt.target}
+			users := map[int64]entity.User{user.ID: user, admin.ID: admin, disabled.ID: disabled, revoked.ID: revoked}
+
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(_ context.Context, appId int) (entity.App, error) {
+					app, ok := apps[appId]
+					if !ok {
+						return entity.App{}, storage.ErrAppNotFound
+					}
+					return app, nil
+				})
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().UserByID(gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(_ context.Context, userId int64) (entity.User, error) {
+					return users[userId], nil
+				})
+			userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, tt.target.ID).AnyTimes().Return(nil, nil)
+			userProvider.EXPECT().PersonalAccessToken(gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(_ context.Context, tokenId int64) (entity.PersonalAccessToken, error) {
+					pat, ok := pats[tokenId]
+					if !ok {
+						return entity.PersonalAccessToken{}, storage.ErrTokenNotFound
+					}
+					return pat, nil
+				})
+			userProvider.EXPECT().Consent(gomock.Any(), user.ID, gomock.Any()).AnyTimes().
+				DoAndReturn(func(_ context.Context, _ int64, appId int) (entity.Consent, error) {
+					consent, ok := tt.consents[appId]
+					if !ok {
+						return entity.Consent{}, storage.ErrConsentNotFound
+					}
+					return consent, nil
+				})
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, expiresIn, err := auth.ExchangeToken(context.Background(), tt.subjectToken, tt.actorToken,
+				tt.target.ID, tt.scopes)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.LessOrEqual(t, expiresIn, 30*time.Minute)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				tt.check(t, claims)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
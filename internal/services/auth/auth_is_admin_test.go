@@ -14,9 +14,11 @@ import (
 func TestAuth_isAdmin(t *testing.T) {
 	prefixName := "auth service"
 	type fields struct {
-		userStorage  *MockUserStorage
-		userProvider *MockUserProvider
-		appProvider  *MockAppProvider
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
 	}
 	type args struct {
 		userId  int
@@ -72,16 +74,18 @@ func TestAuth_isAdmin(t *testing.T) {
 			defer ctrl.Finish()
 
 			f := &fields{
-				userStorage:  NewMockUserStorage(ctrl),
-				userProvider: NewMockUserProvider(ctrl),
-				appProvider:  NewMockAppProvider(ctrl),
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
 			}
 
 			if tt.prepare != nil {
 				tt.prepare(f, tt.args)
 			}
 
-			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, time.Duration(10000))
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
 			isAdmin, err := auth.IsAdmin(context.Background(), tt.args.userId)
 
 			if !tt.wantErr {
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_issueToken(t *testing.T) {
+	prefixName := "auth service"
+	user := entity.User{ID: 5, Email: "test@mail.com"}
+	firstParty := entity.App{ID: 1}
+	thirdParty := entity.App{ID: 2, Settings: entity.AppSettings{ThirdParty: true}}
+	type fields struct {
+		userProvider *MockUserProvider
+		appProvider  *MockAppProvider
+	}
+	type test struct {
+		name          string
+		user          entity.User
+		app           entity.App
+		prepare       func(f *fields)
+		wantConsentID any
+		wantTTL       time.Duration
+		wantErr       error
+	}
+	tests := []test{
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "issue token success test: first-party app"),
+			app:     firstParty,
+			wantTTL: time.Hour,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "issue token success test: third-party app"),
+			app:  thirdParty,
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().Consent(gomock.Any(), user.ID, thirdParty.ID).
+					Return(entity.Consent{UserID: user.ID, AppID: thirdParty.ID, GrantID: "grant-1"}, nil)
+			},
+			wantConsentID: "grant-1",
+			wantTTL:       maxThirdPartyTokenTTL,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "issue token negative test: consent revoked"),
+			app:  thirdParty,
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().Consent(gomock.Any(), user.ID, thirdParty.ID).
+					Return(entity.Consent{}, storage.ErrConsentNotFound)
+			},
+			wantErr: ErrConsentRequired,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "issue token negative test: user disabled"),
+			user:    entity.User{ID: user.ID, Email: user.Email, Status: entity.UserStatusDisabled},
+			app:     firstParty,
+			wantErr: ErrUserDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userProvider: NewMockUserProvider(ctrl),
+				appProvider:  NewMockAppProvider(ctrl),
+			}
+			if tt.user.ID == 0 {
+				tt.user = user
+			}
+			f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(tt.user, nil)
+			f.appProvider.EXPECT().App(gomock.Any(), tt.app.ID).Return(tt.app, nil).AnyTimes()
+			f.userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, tt.app.ID).Return(nil, nil).AnyTimes()
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), f.userProvider, f.appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, expiresIn, err := auth.IssueToken(context.Background(), user.ID, tt.app.ID, time.Now(),
+				[]string{entity.AMRPassword}, []string{"openid"})
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantConsentID, claims["consent_id"])
+				assert.Equal(t, tt.wantTTL, expiresIn)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth_listUsers(t *testing.T) {
+	prefixName := "auth service"
+	users := []entity.User{
+		{ID: 1, Email: "a@mail.com", PassHash: []byte("hash")},
+		{ID: 2, Email: "b@mail.com", PassHash: []byte("hash")},
+		{ID: 3, Email: "c@mail.com", PassHash: []byte("hash")},
+	}
+	type args struct {
+		query entity.UserQuery
+		token string
+	}
+	type test struct {
+		name      string
+		prepare   func(userProvider *MockUserProvider, arg args)
+		args      args
+		wantUsers int
+		wantNext  bool
+		wantErr   error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "list users success test: first page"),
+			prepare: func(userProvider *MockUserProvider, arg args) {
+				userProvider.EXPECT().ListUsers(gomock.Any(), entity.UserQuery{SortBy: entity.UserSortEmail, Limit: 3}).
+					Return(users, nil)
+			},
+			args:      args{query: entity.UserQuery{SortBy: entity.UserSortEmail, Limit: 2}},
+			wantUsers: 2,
+			wantNext:  true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "list users success test: last page"),
+			prepare: func(userProvider *MockUserProvider, arg args) {
+				userProvider.EXPECT().ListUsers(gomock.Any(), entity.UserQuery{
+					SortBy: entity.UserSortEmail,
+					After:  &entity.User{ID: 2, Email: "b@mail.com"},
+					Limit:  3,
+				}).Return(users[2:], nil)
+			},
+			args: args{
+				query: entity.UserQuery{SortBy: entity.UserSortEmail, Limit: 2},
+				token: encodePageToken(users[1], entity.UserQuery{SortBy: entity.UserSortEmail}),
+			},
+			wantUsers: 1,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "list users negative test: unknown sort field"),
+			args:    args{query: entity.UserQuery{SortBy: "pass_hash"}},
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "list users negative test: page size too large"),
+			args:    args{query: entity.UserQuery{Limit: maxPageSize + 1}},
+			wantErr: ErrInvalidQuery,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "list users negative test: token issued for another sorting"),
+			args: args{
+				query: entity.UserQuery{SortBy: entity.UserSortCreatedAt},
+				token: encodePageToken(users[1], entity.UserQuery{SortBy: entity.UserSortEmail}),
+			},
+			wantErr: ErrInvalidPageToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "list users negative test: malformed token"),
+			args:    args{token: "not a token"},
+			wantErr: ErrInvalidPageToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(userProvider, tt.args)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, NewMockAppProvider(ctrl),
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			page, next, err := auth.ListUsers(context.Background(), 1, tt.args.query, tt.args.token)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Len(t, page, tt.wantUsers)
+				assert.Equal(t, tt.wantNext, next != "")
+				for _, user := range page {
+					assert.Nil(t, user.PassHash)
+				}
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestAuth_listUsersNotAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userProvider := NewMockUserProvider(ctrl)
+	userProvider.EXPECT().IsAdmin(gomock.Any(), int64(2)).Return(false, nil)
+
+	auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, NewMockAppProvider(ctrl),
+		NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+	_, _, err := auth.ListUsers(context.Background(), 2, entity.UserQuery{}, "")
+
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
 	"github.com/KRYST4L614/auth_service/internal/storage"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -14,12 +15,24 @@ import (
 	"time"
 )
 
+var signingKey, otherKey = generateKey(), generateKey()
+
+func generateKey() *jwk.Key {
+	key, err := jwk.Generate()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
 func TestAuth_login(t *testing.T) {
 	prefixName := "auth service"
 	type fields struct {
-		userStorage  *MockUserStorage
-		userProvider *MockUserProvider
-		appProvider  *MockAppProvider
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
 	}
 	type args struct {
 		email    string
@@ -40,6 +53,9 @@ func TestAuth_login(t *testing.T) {
 					ID:     arg.appId,
 					Secret: "secret",
 				}, nil)
+				f.userProvider.EXPECT().UserRoles(gomock.Any(), int64(1), arg.appId).Return([]entity.Role{
+					{ID: 1, Name: entity.RoleAdmin},
+				}, nil)
 				passHash, err := bcrypt.GenerateFromPassword([]byte(arg.password), bcrypt.DefaultCost)
 				assert.Nil(t, err)
 				f.userProvider.EXPECT().User(gomock.Any(), gomock.Any()).Return(entity.User{
@@ -73,6 +89,25 @@ func TestAuth_login(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login negative test: user disabled"),
+			prepare: func(f *fields, arg args) {
+				passHash, err := bcrypt.GenerateFromPassword([]byte(arg.password), bcrypt.DefaultCost)
+				assert.Nil(t, err)
+				f.userProvider.EXPECT().User(gomock.Any(), gomock.Any()).Return(entity.User{
+					ID:       1,
+					Email:    arg.email,
+					PassHash: passHash,
+					Status:   entity.UserStatusDisabled,
+				}, nil)
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+			wantErr: true,
+		},
 		{
 			name: fmt.Sprintf("%s: %s", prefixName,
 				"login negative test: userProvider returns error ErrUserNotFound"),
@@ -133,6 +168,29 @@ func TestAuth_login(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login negative test: userProvider.UserRoles returns error"),
+			prepare: func(f *fields, arg args) {
+				f.appProvider.EXPECT().App(gomock.Any(), gomock.Any()).Return(entity.App{
+					ID:     arg.appId,
+					Secret: "secret",
+				}, nil)
+				passHash, err := bcrypt.GenerateFromPassword([]byte(arg.password), bcrypt.DefaultCost)
+				assert.Nil(t, err)
+				f.userProvider.EXPECT().User(gomock.Any(), gomock.Any()).Return(entity.User{
+					ID:       1,
+					Email:    arg.email,
+					PassHash: passHash,
+				}, nil)
+				f.userProvider.EXPECT().UserRoles(gomock.Any(), int64(1), arg.appId).Return(nil, errors.New("testError"))
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+			wantErr: true,
+		},
 		{
 			name: fmt.Sprintf("%s: %s", prefixName, "login negative test: appProvider returns error"),
 			prepare: func(f *fields, arg args) {
@@ -163,16 +221,18 @@ func TestAuth_login(t *testing.T) {
 			defer ctrl.Finish()
 
 			f := &fields{
-				userStorage:  NewMockUserStorage(ctrl),
-				userProvider: NewMockUserProvider(ctrl),
-				appProvider:  NewMockAppProvider(ctrl),
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
 			}
 
 			if tt.prepare != nil {
 				tt.prepare(f, tt.args)
 			}
 
-			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, time.Duration(10000))
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
 			token, err := auth.Login(context.Background(), tt.args.email, tt.args.password, tt.args.appId)
 
 			if !tt.wantErr {
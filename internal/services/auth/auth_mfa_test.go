@@ -0,0 +1,383 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/lib/totp"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_enrollTOTP(t *testing.T) {
+	prefixName := "auth service"
+	user := entity.User{ID: 1, Email: "test@mail.com"}
+	type test struct {
+		name    string
+		saveErr error
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "enroll authenticator app success test"),
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "enroll authenticator app negative test: already confirmed"),
+			saveErr: storage.ErrFactorExists,
+			wantErr: ErrMFAEnrolled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var saved string
+			userStorage := NewMockUserStorage(ctrl)
+			userStorage.EXPECT().SaveTOTPFactor(gomock.Any(), user.ID, gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ int64, secret string) error {
+					saved = secret
+					return tt.saveErr
+				})
+
+			auth := New(slog.Default(), userStorage, NewMockUserProvider(ctrl), NewMockAppProvider(ctrl),
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			secret, uri, err := auth.EnrollTOTP(context.Background(), user, "sso.example.com")
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, saved, secret)
+			assert.Equal(t, totp.URI("sso.example.com", user.Email, secret), uri)
+		})
+	}
+}
+
+func TestAuth_confirmTOTP(t *testing.T) {
+	prefixName := "auth service"
+	secret, err := totp.NewSecret()
+	assert.Nil(t, err)
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	assert.Nil(t, err)
+	type test struct {
+		name    string
+		prepare func(userStorage *MockUserStorage, userProvider *MockUserProvider)
+		code    string
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app success test"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), int64(1)).
+					Return(entity.TOTPFactor{UserID: 1, Secret: secret}, nil)
+				userStorage.EXPECT().ConfirmTOTPFactor(gomock.Any(), int64(1), gomock.Any()).Return(nil)
+			},
+			code: code,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app negative test: wrong code"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), int64(1)).
+					Return(entity.TOTPFactor{UserID: 1, Secret: secret}, nil)
+			},
+			code:    "000000x",
+			wantErr: ErrInvalidOTP,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app negative test: not enrolled"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), int64(1)).
+					Return(entity.TOTPFactor{}, storage.ErrFactorNotFound)
+			},
+			code:    code,
+			wantErr: ErrMFANotEnrolled,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "confirm authenticator app negative test: already confirmed"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), int64(1)).
+					Return(entity.TOTPFactor{UserID: 1, Secret: secret, ConfirmedAt: time.Now()}, nil)
+			},
+			code:    code,
+			wantErr: ErrMFAEnrolled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userStorage := NewMockUserStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+			tt.prepare(userStorage, userProvider)
+
+			auth := New(slog.Default(), userStorage, userProvider, NewMockAppProvider(ctrl),
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			err := auth.ConfirmTOTP(context.Background(), 1, tt.code)
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestAuth_loginOTP(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret", Settings: entity.AppSettings{RequiredACR: entity.ACRMultiFactor}}
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	user := entity.User{ID: 1, Email: "test@mail.com", PassHash: passHash}
+	secret, err := totp.NewSecret()
+	assert.Nil(t, err)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	assert.Nil(t, err)
+	factor := entity.TOTPFactor{UserID: user.ID, Secret: secret, ConfirmedAt: time.Now(), LastStep: step - 10}
+	type test struct {
+		name    string
+		prepare func(userStorage *MockUserStorage, userProvider *MockUserProvider)
+		code    string
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login with one-time code success test"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).Return(factor, nil)
+				userStorage.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+				userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, app.ID).Return(nil, nil)
+			},
+			code: code,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login with one-time code negative test: code already used"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				used := factor
+				used.LastStep = step
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).Return(used, nil)
+			},
+			code:    code,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login with one-time code negative test: concurrent use"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).Return(factor, nil)
+				userStorage.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(storage.ErrOTPReplayed)
+			},
+			code:    code,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login with one-time code negative test: unconfirmed app"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).
+					Return(entity.TOTPFactor{UserID: user.ID, Secret: secret}, nil)
+			},
+			code:    code,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: app requires a second factor"),
+			wantErr: ErrStepUpRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userStorage := NewMockUserStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().User(gomock.Any(), user.Email).Return(user, nil)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil)
+			if tt.prepare != nil {
+				tt.prepare(userStorage, userProvider)
+			}
+
+			var opts []LoginOption
+			if tt.code != "" {
+				opts = append(opts, WithOTP(tt.code))
+			}
+
+			auth := New(slog.Default(), userStorage, userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, err := auth.Login(context.Background(), user.Email, "password", app.ID, opts...)
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				return
+			}
+			assert.Nil(t, err)
+			claims, err := jwt.Parse(token, signingKey.Public())
+			assert.Nil(t, err)
+			assert.Equal(t, []any{entity.AMRPassword, entity.AMROTP}, claims["amr"])
+			assert.Equal(t, entity.ACRMultiFactor, claims["acr"])
+		})
+	}
+}
+
+func TestAuth_verifyMFA(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	passwordOnly := entity.App{ID: 1, Secret: "secret", Settings: entity.AppSettings{
+		LoginMethods: []string{entity.AMRPassword},
+	}}
+	user := entity.User{ID: 1, Email: "test@mail.com"}
+	admin := entity.User{ID: 2, Email: "admin@mail.com"}
+	authTime := time.Now().Add(-time.Hour)
+	newToken := func(amr []string, opts ...jwt.Option) string {
+		token, err := jwt.NewToken(signingKey, user, app, 30*time.Minute,
+			append([]jwt.Option{jwt.WithAuthContext(authTime, amr)}, opts...)...)
+		assert.Nil(t, err)
+		return token
+	}
+	original := newToken([]string{entity.AMRPassword}, jwt.WithRoles([]entity.Role{{Name: "editor"}}))
+	secret, err := totp.NewSecret()
+	assert.Nil(t, err)
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	assert.Nil(t, err)
+	factor := entity.TOTPFactor{UserID: user.ID, Secret: secret, ConfirmedAt: time.Now(), LastStep: step - 10}
+	verified := func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+		userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+		userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).Return(factor, nil)
+		userStorage.EXPECT().UseTOTPStep(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+	}
+	type test struct {
+		name    string
+		app     entity.App
+		prepare func(userStorage *MockUserStorage, userProvider *MockUserProvider)
+		token   string
+		code    string
+		opts    []LoginOption
+		check   func(t *testing.T, claims map[string]any)
+		wantErr error
+	}
+	tests := []test{
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor success test"),
+			prepare: verified,
+			token:   original,
+			code:    code,
+			opts:    []LoginOption{WithACR(entity.ACRMultiFactor)},
+			check: func(t *testing.T, claims map[string]any) {
+				originalClaims, err := jwt.Parse(original, signingKey.Public())
+				assert.Nil(t, err)
+				assert.Equal(t, []any{entity.AMRPassword, entity.AMROTP}, claims["amr"])
+				assert.Equal(t, entity.ACRMultiFactor, claims["acr"])
+				assert.Greater(t, claims["auth_time"], float64(authTime.Unix()))
+				assert.Equal(t, originalClaims["exp"], claims["exp"])
+				assert.Equal(t, originalClaims["roles"], claims["roles"])
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor success test: max age caps the lifetime"),
+			prepare: verified,
+			token:   original,
+			code:    code,
+			opts:    []LoginOption{WithMaxAge(5 * time.Minute)},
+			check: func(t *testing.T, claims map[string]any) {
+				assert.LessOrEqual(t, claims["exp"], float64(time.Now().Add(5*time.Minute).Unix()))
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: hardware key acr"),
+			prepare: verified,
+			token:   original,
+			code:    code,
+			opts:    []LoginOption{WithACR(entity.ACRHardwareKey)},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: app doesn't allow otp"),
+			app:     passwordOnly,
+			prepare: verified,
+			token:   original,
+			code:    code,
+			wantErr: ErrLoginMethodNotAllowed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: wrong code"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).Return(factor, nil)
+			},
+			token:   original,
+			code:    "abcdef",
+			wantErr: ErrInvalidOTP,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: not enrolled"),
+			prepare: func(userStorage *MockUserStorage, userProvider *MockUserProvider) {
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().TOTPFactor(gomock.Any(), user.ID).
+					Return(entity.TOTPFactor{}, storage.ErrFactorNotFound)
+			},
+			token:   original,
+			code:    code,
+			wantErr: ErrMFANotEnrolled,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: impersonation token"),
+			token:   newToken([]string{entity.AMRPassword}, jwt.WithActor(admin)),
+			code:    code,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "verify second factor negative test: personal access token"),
+			token:   newToken([]string{entity.AMRPersonalAccessToken}),
+			code:    code,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			if tt.app.ID == 0 {
+				tt.app = app
+			}
+			userStorage := NewMockUserStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(tt.app, nil).AnyTimes()
+			if tt.prepare != nil {
+				tt.prepare(userStorage, userProvider)
+			}
+
+			auth := New(slog.Default(), userStorage, userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, err := auth.VerifyMFA(context.Background(), tt.token, app.ID, tt.code, tt.opts...)
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				return
+			}
+			assert.Nil(t, err)
+			claims, err := jwt.Parse(token, signingKey.Public())
+			assert.Nil(t, err)
+			tt.check(t, claims)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/clientinfo"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_loginNewDevice(t *testing.T) {
+	prefixName := "auth service"
+	client := clientinfo.ClientInfo{UserAgent: "grpc-go/1.71.1", IP: "192.168.10.42"}
+	type fields struct {
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
+	}
+	type args struct {
+		email    string
+		password string
+		appId    int
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr bool
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "first device is saved without notification"),
+			prepare: func(f *fields, arg args) {
+				f.deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return(nil, nil)
+				f.deviceStorage.EXPECT().SaveDevice(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, device entity.Device) (int64, error) {
+						assert.Equal(t, client.Fingerprint(), device.Fingerprint)
+						assert.Equal(t, "192.168.10.0/24", device.IPPrefix)
+						return 1, nil
+					})
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "known device is touched"),
+			prepare: func(f *fields, arg args) {
+				f.deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return([]entity.Device{
+					{ID: 7, UserID: 1, Fingerprint: client.Fingerprint()},
+				}, nil)
+				f.deviceStorage.EXPECT().TouchDevice(gomock.Any(), int64(7)).Return(nil)
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "new device triggers notification"),
+			prepare: func(f *fields, arg args) {
+				f.deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return([]entity.Device{
+					{ID: 7, UserID: 1, Fingerprint: "other"},
+				}, nil)
+				f.deviceStorage.EXPECT().SaveDevice(gomock.Any(), gomock.Any()).Return(int64(8), nil)
+				f.mailer.EXPECT().Send(gomock.Any(), arg.email, newDeviceSubject, gomock.Any()).Return(nil)
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device storage error does not fail login"),
+			prepare: func(f *fields, arg args) {
+				f.deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return(nil, errors.New("testError"))
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "mailer error does not fail login"),
+			prepare: func(f *fields, arg args) {
+				f.deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return([]entity.Device{
+					{ID: 7, UserID: 1, Fingerprint: "other"},
+				}, nil)
+				f.deviceStorage.EXPECT().SaveDevice(gomock.Any(), gomock.Any()).Return(int64(8), nil)
+				f.mailer.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(errors.New("testError"))
+			},
+			args: args{
+				email:    "test@mail.com",
+				password: "password",
+				appId:    1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
+			}
+
+			passHash, err := bcrypt.GenerateFromPassword([]byte(tt.args.password), bcrypt.MinCost)
+			assert.Nil(t, err)
+			f.userProvider.EXPECT().User(gomock.Any(), tt.args.email).Return(entity.User{
+				ID:       1,
+				Email:    tt.args.email,
+				PassHash: passHash,
+			}, nil)
+			f.appProvider.EXPECT().App(gomock.Any(), tt.args.appId).Return(entity.App{
+				ID:     tt.args.appId,
+				Secret: "secret",
+			}, nil)
+			f.userProvider.EXPECT().UserRoles(gomock.Any(), int64(1), tt.args.appId).Return(nil, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			ctx := clientinfo.NewContext(context.Background(), client)
+
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
+			token, err := auth.Login(ctx, tt.args.email, tt.args.password, tt.args.appId)
+			auth.Stop()
+
+			if !tt.wantErr {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, token)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestAuth_loginNewDeviceMailInBackground(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userProvider := NewMockUserProvider(ctrl)
+	appProvider := NewMockAppProvider(ctrl)
+	deviceStorage := NewMockDeviceStorage(ctrl)
+	mailer := NewMockMailer(ctrl)
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	userProvider.EXPECT().User(gomock.Any(), "test@mail.com").Return(entity.User{
+		ID:       1,
+		Email:    "test@mail.com",
+		PassHash: passHash,
+	}, nil)
+	appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Secret: "secret"}, nil)
+	userProvider.EXPECT().UserRoles(gomock.Any(), int64(1), 1).Return(nil, nil)
+	deviceStorage.EXPECT().Devices(gomock.Any(), int64(1)).Return([]entity.Device{
+		{ID: 7, UserID: 1, Fingerprint: "other"},
+	}, nil)
+	deviceStorage.EXPECT().SaveDevice(gomock.Any(), gomock.Any()).Return(int64(8), nil)
+
+	release := make(chan struct{})
+	mailer.EXPECT().Send(gomock.Any(), "test@mail.com", newDeviceSubject, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _, _, _ string) error {
+			<-release
+			// The mail outlives the login request, but not its own timeout.
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			assert.Nil(t, ctx.Err())
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(clientinfo.NewContext(context.Background(),
+		clientinfo.ClientInfo{UserAgent: "grpc-go/1.71.1", IP: "192.168.10.42"}))
+
+	auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider, deviceStorage, mailer,
+		newTestHasher(t), nil, signingKey, time.Duration(10000))
+	token, err := auth.Login(ctx, "test@mail.com", "password", 1)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+
+	// The login is over while the mail is still being sent.
+	cancel()
+	close(release)
+	auth.Stop()
+}
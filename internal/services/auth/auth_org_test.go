@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_loginOrg(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	user := entity.User{ID: 1, Email: "test@mail.com", PassHash: passHash}
+	type fields struct {
+		userProvider *MockUserProvider
+		appProvider  *MockAppProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login into organization success test"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().Membership(gomock.Any(), int64(7), user.ID).
+					Return(entity.Membership{OrgID: 7, UserID: user.ID, Role: entity.OrgRoleAdmin}, nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login into organization negative test: not a member"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().Membership(gomock.Any(), int64(7), user.ID).
+					Return(entity.Membership{}, storage.ErrMemberNotFound)
+			},
+			wantErr: ErrNotOrgMember,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userProvider: NewMockUserProvider(ctrl),
+				appProvider:  NewMockAppProvider(ctrl),
+			}
+			f.userProvider.EXPECT().User(gomock.Any(), user.Email).Return(user, nil)
+			f.appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil)
+			f.userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, app.ID).Return(nil, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), f.userProvider, f.appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, err := auth.Login(context.Background(), user.Email, "password", app.ID, WithOrg(7))
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				assert.Equal(t, float64(7), claims["org_id"])
+				assert.Equal(t, entity.OrgRoleAdmin, claims["org_role"])
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestAuth_switchOrg(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	user := entity.User{ID: 1, Email: "test@mail.com"}
+	authTime := time.Now().Add(-time.Minute)
+	original, err := jwt.NewToken(signingKey, user, app, time.Hour,
+		jwt.WithAuthContext(authTime, []string{entity.AMRPassword}),
+		jwt.WithOrg(entity.Membership{OrgID: 7, Role: entity.OrgRoleOwner}),
+	)
+	assert.Nil(t, err)
+	forged, err := jwt.NewToken(otherKey, user, app, time.Hour,
+		jwt.WithAuthContext(authTime, []string{entity.AMRPassword}),
+	)
+	assert.Nil(t, err)
+	type test struct {
+		name    string
+		prepare func(userProvider *MockUserProvider)
+		token   string
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "switch organization success test"),
+			prepare: func(userProvider *MockUserProvider) {
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().Membership(gomock.Any(), int64(8), user.ID).
+					Return(entity.Membership{OrgID: 8, UserID: user.ID, Role: entity.OrgRoleMember}, nil)
+			},
+			token: original,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: not a member"),
+			prepare: func(userProvider *MockUserProvider) {
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				userProvider.EXPECT().Membership(gomock.Any(), int64(8), user.ID).
+					Return(entity.Membership{}, storage.ErrMemberNotFound)
+			},
+			token:   original,
+			wantErr: ErrNotOrgMember,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: sessions revoked"),
+			prepare: func(userProvider *MockUserProvider) {
+				revoked := user
+				revoked.SessionsRevokedAt = time.Now()
+				userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(revoked, nil)
+			},
+			token:   original,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "switch organization negative test: forged token"),
+			token:   forged,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userProvider := NewMockUserProvider(ctrl)
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil).AnyTimes()
+
+			if tt.prepare != nil {
+				tt.prepare(userProvider)
+			}
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Hour)
+			token, err := auth.SwitchOrg(context.Background(), tt.token, app.ID, 8)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				originalClaims, err := jwt.Parse(original, signingKey.Public())
+				assert.Nil(t, err)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				assert.Equal(t, float64(8), claims["org_id"])
+				assert.Equal(t, entity.OrgRoleMember, claims["org_role"])
+				assert.Equal(t, originalClaims["exp"], claims["exp"])
+				assert.Equal(t, originalClaims["auth_time"], claims["auth_time"])
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
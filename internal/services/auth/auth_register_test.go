@@ -16,9 +16,11 @@ import (
 func TestRegister_login(t *testing.T) {
 	prefixName := "auth service"
 	type fields struct {
-		userStorage  *MockUserStorage
-		userProvider *MockUserProvider
-		appProvider  *MockAppProvider
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
 	}
 	type args struct {
 		email    string
@@ -76,16 +78,18 @@ func TestRegister_login(t *testing.T) {
 			defer ctrl.Finish()
 
 			f := &fields{
-				userStorage:  NewMockUserStorage(ctrl),
-				userProvider: NewMockUserProvider(ctrl),
-				appProvider:  NewMockAppProvider(ctrl),
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
 			}
 
 			if tt.prepare != nil {
 				tt.prepare(f, tt.args)
 			}
 
-			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, time.Duration(10000))
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
 			userId, err := auth.Register(context.Background(), tt.args.email, tt.args.password)
 
 			if !tt.wantErr {
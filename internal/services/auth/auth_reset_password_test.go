@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestAuth_resetPassword(t *testing.T) {
+	prefixName := "auth service"
+	type fields struct {
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
+	}
+	type args struct {
+		actorId  int64
+		userId   int64
+		password string
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "resetPassword success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().ResetPassword(gomock.Any(), arg.userId, gomock.Any(), arg.actorId).
+					DoAndReturn(func(_ context.Context, _ int64, passHash []byte, _ int64) error {
+						assert.Nil(t, bcrypt.CompareHashAndPassword(passHash, []byte(arg.password)))
+						return nil
+					})
+			},
+			args: args{actorId: 1, userId: 2, password: "new password"},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "resetPassword negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, nil)
+			},
+			args:    args{actorId: 1, userId: 2, password: "new password"},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "resetPassword negative test: empty password"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrInvalidPassword,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "resetPassword negative test: user not found"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().ResetPassword(gomock.Any(), arg.userId, gomock.Any(), arg.actorId).
+					Return(storage.ErrUserNotFound)
+			},
+			args:    args{actorId: 1, userId: 2, password: "new password"},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
+			err := auth.ResetPassword(context.Background(), tt.args.actorId, tt.args.userId, tt.args.password)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestAuth_revokeSessions(t *testing.T) {
+	prefixName := "auth service"
+	type fields struct {
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
+	}
+	type args struct {
+		actorId int64
+		userId  int64
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		want    int64
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeSessions success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeSessions(gomock.Any(), arg.userId, arg.actorId).Return(int64(3), nil)
+			},
+			args: args{actorId: 1, userId: 2},
+			want: 3,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeSessions negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, nil)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeSessions negative test: user not found"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeSessions(gomock.Any(), arg.userId, arg.actorId).
+					Return(int64(0), storage.ErrUserNotFound)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
+			revoked, err := auth.RevokeSessions(context.Background(), tt.args.actorId, tt.args.userId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, revoked)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
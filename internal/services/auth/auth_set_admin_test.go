@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestAuth_setAdmin(t *testing.T) {
+	prefixName := "auth service"
+	type fields struct {
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
+	}
+	type args struct {
+		actorId int64
+		userId  int64
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "setAdmin success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().SetAdmin(gomock.Any(), arg.userId, arg.actorId).Return(nil)
+			},
+			args: args{actorId: 1, userId: 2},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "setAdmin negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, nil)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "setAdmin negative test: caller not found"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, storage.ErrUserNotFound)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "setAdmin negative test: user not found"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().SetAdmin(gomock.Any(), arg.userId, arg.actorId).Return(storage.ErrUserNotFound)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
+			err := auth.SetAdmin(context.Background(), tt.args.actorId, tt.args.userId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestAuth_revokeAdmin(t *testing.T) {
+	prefixName := "auth service"
+	type fields struct {
+		userStorage   *MockUserStorage
+		userProvider  *MockUserProvider
+		appProvider   *MockAppProvider
+		deviceStorage *MockDeviceStorage
+		mailer        *MockMailer
+	}
+	type args struct {
+		actorId int64
+		userId  int64
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeAdmin success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeAdmin(gomock.Any(), arg.userId, arg.actorId).Return(nil)
+			},
+			args: args{actorId: 1, userId: 2},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeAdmin negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, nil)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeAdmin negative test: last admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeAdmin(gomock.Any(), arg.userId, arg.actorId).Return(storage.ErrLastAdmin)
+			},
+			args:    args{actorId: 1, userId: 1},
+			wantErr: ErrLastAdmin,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeAdmin negative test: user is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeAdmin(gomock.Any(), arg.userId, arg.actorId).Return(storage.ErrNotAdmin)
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: ErrNotAdmin,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revokeAdmin negative test: userStorage returns error"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.userStorage.EXPECT().RevokeAdmin(gomock.Any(), arg.userId, arg.actorId).Return(errors.New("testError"))
+			},
+			args:    args{actorId: 1, userId: 2},
+			wantErr: errors.New("testError"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userStorage:   NewMockUserStorage(ctrl),
+				userProvider:  NewMockUserProvider(ctrl),
+				appProvider:   NewMockAppProvider(ctrl),
+				deviceStorage: NewMockDeviceStorage(ctrl),
+				mailer:        NewMockMailer(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			auth := New(slog.Default(), f.userStorage, f.userProvider, f.appProvider, f.deviceStorage, f.mailer, newTestHasher(t), nil, signingKey, time.Duration(10000))
+			err := auth.RevokeAdmin(context.Background(), tt.args.actorId, tt.args.userId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+				if !errors.Is(err, tt.wantErr) {
+					assert.ErrorContains(t, err, tt.wantErr.Error())
+				}
+			}
+		})
+	}
+}
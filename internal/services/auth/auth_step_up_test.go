@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth_loginACR(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userProvider := NewMockUserProvider(ctrl)
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	userProvider.EXPECT().User(gomock.Any(), gomock.Any()).Return(entity.User{
+		ID:       1,
+		Email:    "test@mail.com",
+		PassHash: passHash,
+	}, nil)
+	appProvider := NewMockAppProvider(ctrl)
+	appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Secret: "secret"}, nil)
+
+	auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+		NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Duration(10000))
+	_, err = auth.Login(context.Background(), "test@mail.com", "password", 1, WithACR(entity.ACRMultiFactor))
+
+	assert.True(t, errors.Is(err, ErrStepUpRequired))
+}
+
+func TestAuth_checkAuthContext(t *testing.T) {
+	prefixName := "auth service"
+	app := entity.App{ID: 1, Secret: "secret"}
+	user := entity.User{ID: 1, Email: "test@mail.com"}
+	type args struct {
+		token  string
+		appId  int
+		acr    string
+		maxAge time.Duration
+	}
+	type test struct {
+		name      string
+		args      args
+		revokedAt time.Time
+		pat       entity.PersonalAccessToken
+		wantErr   error
+	}
+	newToken := func(authTime time.Time, amr ...string) string {
+		opts := []jwt.Option{jwt.WithAuthContext(authTime, amr)}
+		if slices.Contains(amr, entity.AMRPersonalAccessToken) {
+			opts = append(opts, jwt.WithPersonalAccessToken(9))
+		}
+		token, err := jwt.NewToken(signingKey, user, app, time.Hour, opts...)
+		assert.Nil(t, err)
+		return token
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "fresh password token satisfies single factor"),
+			args: args{
+				token:  newToken(time.Now(), entity.AMRPassword),
+				appId:  app.ID,
+				acr:    entity.ACRSingleFactor,
+				maxAge: time.Minute,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "multi factor token satisfies multi factor"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword, entity.AMROTP),
+				appId: app.ID,
+				acr:   entity.ACRMultiFactor,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "password token requires step-up"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword),
+				appId: app.ID,
+				acr:   entity.ACRMultiFactor,
+			},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "two methods of one factor class require step-up"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword, "pin"),
+				appId: app.ID,
+				acr:   entity.ACRMultiFactor,
+			},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "multi factor token doesn't satisfy hardware key"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword, entity.AMROTP),
+				appId: app.ID,
+				acr:   entity.ACRHardwareKey,
+			},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "password and hardware key satisfy hardware key"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword, entity.AMRHardwareKey),
+				appId: app.ID,
+				acr:   entity.ACRHardwareKey,
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "hardware key alone is a single factor"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRHardwareKey),
+				appId: app.ID,
+				acr:   entity.ACRMultiFactor,
+			},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "unknown acr is never satisfied"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRHardwareKey),
+				appId: app.ID,
+				acr:   "10",
+			},
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "old token requires reauthentication"),
+			args: args{
+				token:  newToken(time.Now().Add(-10*time.Minute), entity.AMRPassword),
+				appId:  app.ID,
+				maxAge: 5 * time.Minute,
+			},
+			wantErr: ErrReauthenticationRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token issued before the sessions were revoked is rejected"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword),
+				appId: app.ID,
+			},
+			revokedAt: time.Now(),
+			wantErr:   ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token issued after the sessions were revoked is accepted"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword),
+				appId: app.ID,
+			},
+			revokedAt: time.Now().Add(-time.Hour),
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token of an active personal access token is accepted"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPersonalAccessToken),
+				appId: app.ID,
+			},
+			pat: entity.PersonalAccessToken{ID: 9, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token of a revoked personal access token is rejected"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPersonalAccessToken),
+				appId: app.ID,
+			},
+			pat:     entity.PersonalAccessToken{ID: 9, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: time.Now()},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token of an expired personal access token is rejected"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPersonalAccessToken),
+				appId: app.ID,
+			},
+			pat:     entity.PersonalAccessToken{ID: 9, UserID: user.ID, ExpiresAt: time.Now().Add(-time.Minute)},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token for another app is rejected"),
+			args: args{
+				token: newToken(time.Now(), entity.AMRPassword),
+				appId: 2,
+			},
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			appProvider := NewMockAppProvider(ctrl)
+			appProvider.EXPECT().App(gomock.Any(), app.ID).Return(app, nil).AnyTimes()
+			userProvider := NewMockUserProvider(ctrl)
+			userProvider.EXPECT().UserByID(gomock.Any(), user.ID).
+				Return(entity.User{ID: user.ID, Email: user.Email, SessionsRevokedAt: tt.revokedAt}, nil).AnyTimes()
+			userProvider.EXPECT().PersonalAccessToken(gomock.Any(), int64(9)).Return(tt.pat, nil).AnyTimes()
+
+			auth := New(slog.Default(), NewMockUserStorage(ctrl), userProvider, appProvider,
+				NewMockDeviceStorage(ctrl), NewMockMailer(ctrl), newTestHasher(t), nil, signingKey, time.Duration(10000))
+			err := auth.CheckAuthContext(context.Background(), tt.args.token, tt.args.appId, tt.args.acr, tt.args.maxAge)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// Authenticate checks the credentials of the user and that the app lets them
+// log in with a password. Unlike Login it issues no token: it is meant for flows
+// that hand out tokens later, like the OAuth authorization code grant.
+//
+// Returns the user and the authentication methods used.
+func (auth *Auth) Authenticate(ctx context.Context, email string, password string, appId int) (entity.User, []string, error) {
+	const op = "auth.Authenticate"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.Int("app_id", appId),
+	)
+
+	user, _, amr, err := auth.authenticate(ctx, log, email, password, appId, loginOptions{})
+	if err != nil {
+		return entity.User{}, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auth.trackDevice(ctx, log, user)
+
+	return user, amr, nil
+}
+
+// AuthenticateUser checks that the app lets in a user who authenticated
+// elsewhere with the amr methods, like at an upstream identity provider.
+func (auth *Auth) AuthenticateUser(ctx context.Context, userId int64, appId int, amr []string) (entity.User, error) {
+	const op = "auth.AuthenticateUser"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+		slog.Int("app_id", appId),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return entity.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get user", slog.Any("error", err))
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("user is disabled")
+		return entity.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return entity.User{}, fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkLoginPolicy(log, user, app, amr, ""); err != nil {
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	auth.trackDevice(ctx, log, user)
+
+	return user, nil
+}
+
+// IssueToken issues an access token for a user who authenticated earlier, at
+// authTime with the amr methods. Returns the token and how long it is valid.
+//
+// A token of a third-party app is issued under the consent of the user, and
+// is refused once the consent is revoked. Without consent, returns
+// ErrConsentRequired. The user may have been disabled since they
+// authenticated, then returns ErrUserDisabled.
+func (auth *Auth) IssueToken(
+	ctx context.Context,
+	userId int64,
+	appId int,
+	authTime time.Time,
+	amr []string,
+	scopes []string,
+) (string, time.Duration, error) {
+	const op = "auth.IssueToken"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+		slog.Int("app_id", appId),
+	)
+
+	user, err := auth.userProvider.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", 0, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get user", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("user is disabled")
+		return "", 0, fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := auth.userProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to get user roles", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	opts := []jwt.Option{jwt.WithAuthContext(authTime, amr), jwt.WithRoles(roles), jwt.WithScopes(scopes)}
+
+	if app.Settings.ThirdParty {
+		consent, err := auth.consent(ctx, user.ID, app.ID)
+		if err != nil {
+			log.Info("no consent to the third-party app", slog.Any("error", err))
+			return "", 0, fmt.Errorf("%s: %w", op, err)
+		}
+		opts = append(opts, jwt.WithConsent(consent))
+	}
+
+	tokenTTL := auth.appTokenTTL(app)
+
+	token, err := jwt.NewToken(auth.signingKey, user, app, tokenTTL, opts...)
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token issued")
+
+	return token, tokenTTL, nil
+}
+
+// IssueClientToken issues an access token for the app itself, with no user
+// behind it. The caller must have authenticated the app as a client.
+func (auth *Auth) IssueClientToken(ctx context.Context, appId int, scopes []string) (string, time.Duration, error) {
+	const op = "auth.IssueClientToken"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokenTTL := auth.appTokenTTL(app)
+
+	token, err := jwt.NewClientToken(auth.signingKey, app, tokenTTL, jwt.WithScopes(scopes))
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client token issued")
+
+	return token, tokenTTL, nil
+}
+
+// authenticate checks the password of the user, with the directory for the
+// email domains it serves, the one-time code of the options if any, and the
+// login policy of the app for the acr of the options.
+// The returned errors are not wrapped with an op, the caller does that.
+func (auth *Auth) authenticate(
+	ctx context.Context,
+	log *slog.Logger,
+	email string,
+	password string,
+	appId int,
+	options loginOptions,
+) (entity.User, entity.App, []string, error) {
+	var user entity.User
+	var err error
+	if auth.directory.serves(email) {
+		user, err = auth.directoryUser(ctx, log, email, password)
+	} else {
+		user, err = auth.localUser(ctx, log, email, password)
+	}
+	if err != nil {
+		return entity.User{}, entity.App{}, nil, err
+	}
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", slog.Any("error", err))
+
+			return entity.User{}, entity.App{}, nil, ErrInvalidAppId
+		}
+		return entity.User{}, entity.App{}, nil, err
+	}
+
+	amr := []string{entity.AMRPassword}
+	if options.otp != "" {
+		if err := auth.verifyOTP(ctx, log, user.ID, options.otp); err != nil {
+			if errors.Is(err, ErrInvalidOTP) || errors.Is(err, ErrMFANotEnrolled) {
+				// A wrong code fails the login like a wrong password does.
+				return entity.User{}, entity.App{}, nil, ErrInvalidCredentials
+			}
+			return entity.User{}, entity.App{}, nil, err
+		}
+		amr = append(amr, entity.AMROTP)
+	}
+
+	if err := checkLoginPolicy(log, user, app, amr, options.acr); err != nil {
+		return entity.User{}, entity.App{}, nil, err
+	}
+
+	return user, app, amr, nil
+}
+
+// localUser checks the password against the user's local password hash.
+func (auth *Auth) localUser(ctx context.Context, log *slog.Logger, email string, password string) (entity.User, error) {
+	user, err := auth.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", slog.Any("error", err))
+
+			return entity.User{}, ErrInvalidCredentials
+		}
+
+		log.Info("failed to login", slog.Any("error", err))
+		return entity.User{}, err
+	}
+
+	if err := auth.hasher.Compare(ctx, user.PassHash, password); err != nil {
+		if errors.Is(err, ErrHasherOverloaded) || errors.Is(err, ctx.Err()) {
+			log.Warn("failed to compare password", slog.Any("error", err))
+
+			return entity.User{}, err
+		}
+		log.Info("invalid credentials", slog.Any("error", err))
+
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	// Checked after the password, so it doesn't tell whether an account is disabled.
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("user is disabled")
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// checkLoginPolicy verifies the app lets the user in after authenticating with
+// the amr methods, reaching at least the acr.
+func checkLoginPolicy(log *slog.Logger, user entity.User, app entity.App, amr []string, acr string) error {
+	if !app.Settings.AllowsEmail(user.Email) {
+		log.Info("email domain is not allowed by app")
+
+		return ErrEmailDomainNotAllowed
+	}
+
+	for _, method := range amr {
+		if !app.Settings.AllowsMethod(method) {
+			log.Info("login method is not allowed by app", slog.String("amr", method))
+
+			return ErrLoginMethodNotAllowed
+		}
+	}
+
+	achieved := entity.ACRForMethods(amr)
+	if !entity.ACRSatisfies(achieved, acr) || !entity.ACRSatisfies(achieved, app.Settings.RequiredACR) {
+		log.Info("required acr can't be reached with the login methods",
+			slog.Any("amr", amr),
+			slog.String("acr", acr),
+			slog.String("app_acr", app.Settings.RequiredACR),
+		)
+
+		return ErrStepUpRequired
+	}
+
+	return nil
+}
+
+// consent returns the current consent of the user to the third-party app.
+func (auth *Auth) consent(ctx context.Context, userId int64, appId int) (entity.Consent, error) {
+	consent, err := auth.userProvider.Consent(ctx, userId, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			return entity.Consent{}, ErrConsentRequired
+		}
+		return entity.Consent{}, err
+	}
+
+	return consent, nil
+}
+
+// maxThirdPartyTokenTTL caps the lifetime of access tokens of third-party
+// apps. Resource servers that don't introspect them keep accepting them after
+// the user revokes the consent, until they expire.
+const maxThirdPartyTokenTTL = 15 * time.Minute
+
+// appTokenTTL is the lifetime of access tokens issued for the app.
+func (auth *Auth) appTokenTTL(app entity.App) time.Duration {
+	tokenTTL := auth.tokenTTL
+	if app.Settings.AccessTokenTTL > 0 {
+		tokenTTL = app.Settings.AccessTokenTTL
+	}
+
+	if app.Settings.ThirdParty {
+		return min(tokenTTL, maxThirdPartyTokenTTL)
+	}
+
+	return tokenTTL
+}
+
+// AuthenticateToken returns the user an access token of the app was issued to.
+//
+// Tokens issued on behalf of the user by someone else, like impersonation
+// tokens, are refused: they let the actor use the app as the user, not manage
+// the account. So are the tokens given for a personal access token, which
+// could otherwise create new personal access tokens outliving its revocation.
+func (auth *Auth) AuthenticateToken(ctx context.Context, token string, appId int) (entity.User, error) {
+	const op = "auth.AuthenticateToken"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	claims, err := jwt.Parse(token, auth.signingKey.Public())
+	if err != nil || jwt.AppID(claims) != appId {
+		log.Info("invalid token", slog.Any("error", err))
+		return entity.User{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if _, ok := claims["act"]; ok {
+		log.Info("token was issued to an actor")
+		return entity.User{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	if slices.Contains(stringsClaim(claims["amr"]), entity.AMRPersonalAccessToken) {
+		log.Info("token was given for a personal access token")
+		return entity.User{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	user, err := auth.sessionUser(ctx, log, claims)
+	if err != nil {
+		return entity.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// AuthenticateClient returns the app a client token was issued to, as with the
+// OAuth client credentials grant. Tokens issued to users are refused, and so are
+// the tokens of deleted apps.
+func (auth *Auth) AuthenticateClient(ctx context.Context, token string) (entity.App, error) {
+	const op = "auth.AuthenticateClient"
+
+	log := auth.log.With(slog.String("op", op))
+
+	claims, err := jwt.Parse(token, auth.signingKey.Public())
+	if err != nil {
+		log.Info("invalid token", slog.Any("error", err))
+		return entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	appId := jwt.AppID(claims)
+	if _, ok := claims["uid"]; ok || claims["client_id"] != strconv.Itoa(appId) {
+		log.Info("not a client token")
+		return entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Info("token of a deleted app", slog.Int("app_id", appId))
+			return entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to get app", slog.Any("error", err))
+		return entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/clientinfo"
+)
+
+const newDeviceSubject = "New sign-in to your account"
+
+// newDeviceMailTimeout bounds the delivery of a new device notification, which
+// no longer has the deadline of the login it was sent for.
+const newDeviceMailTimeout = 30 * time.Second
+
+// trackDevice records the device the user has just logged in from and
+// notifies the user when the device has never been seen before.
+//
+// Failures are only logged: device tracking must never block a login, so the
+// notification is sent in the background. The very first device of a user is
+// recorded silently.
+func (auth *Auth) trackDevice(ctx context.Context, log *slog.Logger, user entity.User) {
+	client, ok := clientinfo.FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	fingerprint := client.Fingerprint()
+
+	devices, err := auth.deviceStorage.Devices(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get user devices", slog.Any("error", err))
+		return
+	}
+
+	for _, device := range devices {
+		if device.Fingerprint == fingerprint {
+			if err := auth.deviceStorage.TouchDevice(ctx, device.ID); err != nil {
+				log.Error("failed to update device last seen time", slog.Any("error", err))
+			}
+			return
+		}
+	}
+
+	device := entity.Device{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   client.UserAgent,
+		IPPrefix:    client.IPPrefix(),
+	}
+
+	if _, err := auth.deviceStorage.SaveDevice(ctx, device); err != nil {
+		log.Error("failed to save device", slog.Any("error", err))
+		return
+	}
+
+	if len(devices) == 0 {
+		return
+	}
+
+	log.Warn("login from new device", slog.String("ip_prefix", device.IPPrefix))
+
+	body := fmt.Sprintf(
+		"Your account was just used to sign in from a new device.\n\n"+
+			"Device: %s\nNetwork: %s\nTime: %s\n\n"+
+			"If this was you, no action is needed. Otherwise change your password immediately.",
+		device.UserAgent, device.IPPrefix, time.Now().UTC().Format(time.RFC1123),
+	)
+
+	auth.notifications.Add(1)
+	go func() {
+		defer auth.notifications.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), newDeviceMailTimeout)
+		defer cancel()
+
+		if err := auth.mailer.Send(ctx, user.Email, newDeviceSubject, body); err != nil {
+			log.Error("failed to send new device notification", slog.Any("error", err))
+		}
+	}()
+}
+
+// Stop waits for the notifications being sent.
+func (auth *Auth) Stop() {
+	auth.notifications.Wait()
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/ldap"
+)
+
+var (
+	ErrDirectoryUser        = errors.New("the user is managed by the directory")
+	ErrDirectoryUnavailable = errors.New("directory unavailable")
+)
+
+type Directory interface {
+	Authenticate(ctx context.Context, email string, password string) (entity.DirectoryUser, error)
+}
+
+type DirectoryStorage interface {
+	SyncDirectoryUser(ctx context.Context, user entity.DirectoryUser, roles []entity.RoleRef) (int64, error)
+}
+
+// DirectoryBackend checks the passwords of the users of some email domains
+// with a directory instead of the local password hashes.
+type DirectoryBackend struct {
+	Directory Directory
+	Storage   DirectoryStorage
+	// Domains are the email domains whose users are in the directory.
+	Domains []string
+	// GroupRoles are the roles the members of a group get, by group DN. The
+	// admin role is skipped.
+	GroupRoles map[string][]entity.RoleRef
+}
+
+// serves reports whether the user with the email is in the directory.
+func (d *DirectoryBackend) serves(email string) bool {
+	if d == nil {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+
+	return slices.ContainsFunc(d.Domains, func(domain string) bool {
+		return strings.EqualFold(domain, email[at+1:])
+	})
+}
+
+// roles are the roles granted by the groups. The admin role is never among
+// them: it is only granted and revoked through SetAdmin and RevokeAdmin,
+// which keep the last admin and record who did it.
+func (d *DirectoryBackend) roles(groups []string) []entity.RoleRef {
+	var roles []entity.RoleRef
+	for dn, granted := range d.GroupRoles {
+		if slices.ContainsFunc(groups, func(group string) bool { return strings.EqualFold(group, dn) }) {
+			for _, role := range granted {
+				if !role.Admin() {
+					roles = append(roles, role)
+				}
+			}
+		}
+	}
+
+	return roles
+}
+
+// directoryUser checks the password with the directory and syncs the user's
+// attributes and roles. The user is created at their first login.
+func (auth *Auth) directoryUser(ctx context.Context, log *slog.Logger, email string, password string) (entity.User, error) {
+	dirUser, err := auth.directory.Directory.Authenticate(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			log.Info("invalid directory credentials")
+			return entity.User{}, ErrInvalidCredentials
+		}
+		log.Error("failed to authenticate with the directory", slog.Any("error", err))
+		return entity.User{}, fmt.Errorf("%w: %w", ErrDirectoryUnavailable, err)
+	}
+
+	// Directories compare emails case-insensitively, so the user is kept under one spelling.
+	dirUser.Email = strings.ToLower(dirUser.Email)
+
+	userId, err := auth.directory.Storage.SyncDirectoryUser(ctx, dirUser, auth.directory.roles(dirUser.Groups))
+	if err != nil {
+		log.Error("failed to sync directory user", slog.Any("error", err))
+		return entity.User{}, err
+	}
+
+	user, err := auth.userProvider.UserByID(ctx, userId)
+	if err != nil {
+		log.Error("failed to get user", slog.Any("error", err))
+		return entity.User{}, err
+	}
+
+	// The account can still be disabled here, whatever the directory says.
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("user is disabled")
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
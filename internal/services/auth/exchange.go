@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrExchangeNotAllowed = errors.New("token exchange is not allowed between these apps")
+	ErrScopeNotGranted    = errors.New("scope is not granted by the subject token")
+)
+
+// ExchangeToken issues a token for the app in exchange for a user token of
+// another app (RFC 8693), so the user doesn't have to log in again. The app
+// must list the subject token's app in its TokenExchangeFrom setting, and its
+// login policy must accept the user and every method they authenticated with.
+// A third-party app also needs the user's consent, as for IssueToken.
+//
+// The new token keeps the auth_time and amr of the subject token and never
+// outlives it. Scopes can only narrow those of the subject token, and default
+// to them. With an actor token the new token carries an "act" claim naming the
+// actor, which acts on behalf of the subject; an "act" claim of the subject
+// token is kept nested in it.
+//
+// Returns the token and how long it is valid.
+func (auth *Auth) ExchangeToken(
+	ctx context.Context,
+	subjectToken string,
+	actorToken string,
+	appId int,
+	scopes []string,
+) (string, time.Duration, error) {
+	const op = "auth.ExchangeToken"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", 0, fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claims, user, err := auth.tokenUser(ctx, log, subjectToken, app)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	authTime, _ := claims["auth_time"].(float64)
+	amr := stringsClaim(claims["amr"])
+	if len(amr) == 0 {
+		log.Info("token has no login methods")
+		return "", 0, fmt.Errorf("%s: %w", op, ErrLoginMethodNotAllowed)
+	}
+
+	if err := checkLoginPolicy(log, user, app, amr, ""); err != nil {
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A token without a scope claim isn't restricted, so any scope narrows it.
+	if granted, ok := claims["scope"].(string); ok {
+		if len(scopes) == 0 {
+			scopes = strings.Fields(granted)
+		}
+		for _, scope := range scopes {
+			if !slices.Contains(strings.Fields(granted), scope) {
+				log.Info("scope is not granted", slog.String("scope", scope))
+				return "", 0, fmt.Errorf("%s: %w", op, ErrScopeNotGranted)
+			}
+		}
+	}
+
+	opts := []jwt.Option{jwt.WithAuthContext(time.Unix(int64(authTime), 0), amr), jwt.WithScopes(scopes)}
+
+	if app.Settings.ThirdParty {
+		consent, err := auth.consent(ctx, user.ID, app.ID)
+		if err != nil {
+			log.Info("no consent to the third-party app", slog.Any("error", err))
+			return "", 0, fmt.Errorf("%s: %w", op, err)
+		}
+		opts = append(opts, jwt.WithConsent(consent))
+	}
+
+	if actorToken != "" {
+		_, actor, err := auth.tokenUser(ctx, log, actorToken, app)
+		if err != nil {
+			log.Info("invalid actor token", slog.Any("error", err))
+			return "", 0, fmt.Errorf("%s: %w", op, err)
+		}
+		opts = append(opts, jwt.WithActor(actor))
+	}
+	opts = append(opts, jwt.WithPriorActor(claims["act"]))
+	// The exchanged token falls with the personal access token the subject token was given for.
+	if tokenId, ok := jwt.PersonalAccessTokenID(claims); ok {
+		opts = append(opts, jwt.WithPersonalAccessToken(tokenId))
+	}
+
+	roles, err := auth.userProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to get user roles", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+	opts = append(opts, jwt.WithRoles(roles))
+
+	tokenTTL := auth.appTokenTTL(app)
+	// jwt.Parse requires exp, so the subject token always has one.
+	exp, _ := claims["exp"].(float64)
+	tokenTTL = min(tokenTTL, time.Until(time.Unix(int64(exp), 0)))
+
+	token, err := jwt.NewToken(auth.signingKey, user, app, tokenTTL, opts...)
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("token exchanged", slog.Bool("delegated", actorToken != ""))
+
+	return token, tokenTTL, nil
+}
+
+// tokenUser verifies a user token issued for an app whose tokens the target
+// app accepts, and returns its claims and the active user it was issued to.
+// A token of a third-party app must still be covered by the user's consent.
+// The returned errors are not wrapped with an op, the caller does that.
+func (auth *Auth) tokenUser(
+	ctx context.Context,
+	log *slog.Logger,
+	token string,
+	target entity.App,
+) (map[string]any, entity.User, error) {
+	claims, err := jwt.Parse(token, auth.signingKey.Public())
+	if err != nil {
+		log.Info("invalid token", slog.Any("error", err))
+		return nil, entity.User{}, ErrInvalidToken
+	}
+
+	tokenAppId := jwt.AppID(claims)
+	if !target.AcceptsTokensOf(tokenAppId) {
+		log.Info("app doesn't accept tokens of the token's app", slog.Int("token_app_id", tokenAppId))
+		return nil, entity.User{}, ErrExchangeNotAllowed
+	}
+
+	// Tokens of a deleted app are no longer accepted.
+	tokenApp, err := auth.appProvider.App(ctx, tokenAppId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, entity.User{}, ErrInvalidToken
+		}
+		return nil, entity.User{}, err
+	}
+
+	// Client tokens have no user and can't be exchanged.
+	user, err := auth.sessionUser(ctx, log, claims)
+	if err != nil {
+		return nil, entity.User{}, err
+	}
+
+	// A token of a third-party app holds only under the consent it was issued with.
+	if tokenApp.Settings.ThirdParty {
+		consent, err := auth.consent(ctx, user.ID, tokenApp.ID)
+		if err != nil && !errors.Is(err, ErrConsentRequired) {
+			log.Error("failed to get consent", slog.Any("error", err))
+			return nil, entity.User{}, err
+		}
+		if grantId, _ := claims["consent_id"].(string); err != nil || grantId == "" || consent.GrantID != grantId {
+			log.Info("consent the token was issued under is revoked", slog.Int64("user_id", user.ID))
+			return nil, entity.User{}, ErrInvalidToken
+		}
+	}
+
+	return claims, user, nil
+}
+
+// stringsClaim converts a parsed JSON array claim to strings, skipping other values.
+func stringsClaim(claim any) []string {
+	values, _ := claim.([]any)
+
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+
+	return strs
+}
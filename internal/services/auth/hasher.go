@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrHasherOverloaded = errors.New("password hasher is overloaded")
+
+// PasswordHasher runs bcrypt on a fixed number of workers with a bounded queue,
+// so bursts of logins can't occupy every core and starve other requests.
+//
+// Requests that don't fit into the queue are rejected right away with
+// ErrHasherOverloaded. Requests whose context is done while waiting in the
+// queue are dropped without hashing.
+type PasswordHasher struct {
+	cost int
+	jobs chan hashJob
+	wg   sync.WaitGroup
+
+	metrics   *expvar.Map
+	processed *expvar.Int
+	rejected  *expvar.Int
+	expired   *expvar.Int
+	waitTotal *expvar.Int
+}
+
+type hashJob struct {
+	ctx      context.Context
+	enqueued time.Time
+	run      func() ([]byte, error)
+	result   chan hashResult
+}
+
+type hashResult struct {
+	hash []byte
+	err  error
+}
+
+// NewPasswordHasher starts a hasher with the given number of workers and queue size.
+func NewPasswordHasher(workers int, queueSize int, cost int) *PasswordHasher {
+	h := &PasswordHasher{
+		cost:      cost,
+		jobs:      make(chan hashJob, queueSize),
+		metrics:   new(expvar.Map).Init(),
+		processed: new(expvar.Int),
+		rejected:  new(expvar.Int),
+		expired:   new(expvar.Int),
+		waitTotal: new(expvar.Int),
+	}
+
+	h.metrics.Set("queue_depth", expvar.Func(func() any { return len(h.jobs) }))
+	h.metrics.Set("queue_capacity", expvar.Func(func() any { return cap(h.jobs) }))
+	h.metrics.Set("workers", expvar.Func(func() any { return workers }))
+	h.metrics.Set("processed_total", h.processed)
+	h.metrics.Set("rejected_total", h.rejected)
+	h.metrics.Set("expired_total", h.expired)
+	h.metrics.Set("wait_time_ns_total", h.waitTotal)
+
+	h.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go h.work()
+	}
+
+	return h
+}
+
+// Hash returns the bcrypt hash of the password.
+func (h *PasswordHasher) Hash(ctx context.Context, password string) ([]byte, error) {
+	return h.submit(ctx, func() ([]byte, error) {
+		return bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	})
+}
+
+// Compare checks the password against the bcrypt hash.
+func (h *PasswordHasher) Compare(ctx context.Context, hash []byte, password string) error {
+	_, err := h.submit(ctx, func() ([]byte, error) {
+		return nil, bcrypt.CompareHashAndPassword(hash, []byte(password))
+	})
+	return err
+}
+
+// Metrics returns queue depth, wait time and throughput counters of the hasher.
+func (h *PasswordHasher) Metrics() expvar.Var {
+	return h.metrics
+}
+
+// Stop stops the workers once the queued jobs are done. The hasher must not be used afterwards.
+func (h *PasswordHasher) Stop() {
+	close(h.jobs)
+	h.wg.Wait()
+}
+
+func (h *PasswordHasher) submit(ctx context.Context, run func() ([]byte, error)) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	job := hashJob{
+		ctx:      ctx,
+		enqueued: time.Now(),
+		run:      run,
+		result:   make(chan hashResult, 1),
+	}
+
+	select {
+	case h.jobs <- job:
+	default:
+		h.rejected.Add(1)
+		return nil, ErrHasherOverloaded
+	}
+
+	select {
+	case res := <-job.result:
+		return res.hash, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *PasswordHasher) work() {
+	defer h.wg.Done()
+
+	for job := range h.jobs {
+		h.waitTotal.Add(int64(time.Since(job.enqueued)))
+
+		if err := job.ctx.Err(); err != nil {
+			h.expired.Add(1)
+			job.result <- hashResult{err: err}
+			continue
+		}
+
+		hash, err := job.run()
+		h.processed.Add(1)
+		job.result <- hashResult{hash: hash, err: err}
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestHasher(t *testing.T) *PasswordHasher {
+	t.Helper()
+
+	hasher := NewPasswordHasher(2, 8, bcrypt.MinCost)
+	t.Cleanup(hasher.Stop)
+
+	return hasher
+}
+
+func TestPasswordHasher_hashAndCompare(t *testing.T) {
+	hasher := newTestHasher(t)
+
+	hash, err := hasher.Hash(context.Background(), "password")
+	assert.Nil(t, err)
+
+	assert.Nil(t, hasher.Compare(context.Background(), hash, "password"))
+	assert.True(t, errors.Is(hasher.Compare(context.Background(), hash, "bad"), bcrypt.ErrMismatchedHashAndPassword))
+}
+
+func TestPasswordHasher_overloaded(t *testing.T) {
+	hasher := NewPasswordHasher(1, 1, bcrypt.MinCost)
+	defer hasher.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+
+	// Occupy the only worker, then fill the only queue slot.
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = hasher.submit(context.Background(), func() ([]byte, error) {
+			close(blocked)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-blocked
+	go func() {
+		defer wg.Done()
+		_, _ = hasher.Hash(context.Background(), "queued")
+	}()
+	assert.Eventually(t, func() bool { return len(hasher.jobs) == 1 }, time.Second, time.Millisecond)
+
+	_, err := hasher.Hash(context.Background(), "password")
+	assert.True(t, errors.Is(err, ErrHasherOverloaded))
+	assert.Equal(t, int64(1), hasher.rejected.Value())
+
+	close(release)
+}
+
+func TestPasswordHasher_deadline(t *testing.T) {
+	hasher := NewPasswordHasher(1, 4, bcrypt.MinCost)
+	defer hasher.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = hasher.submit(context.Background(), func() ([]byte, error) {
+			close(blocked)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-blocked
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := hasher.Hash(ctx, "password")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	close(release)
+	assert.Eventually(t, func() bool { return hasher.expired.Value() == 1 }, time.Second, time.Millisecond)
+}
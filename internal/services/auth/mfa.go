@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/lib/totp"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrInvalidOTP     = errors.New("invalid one-time code")
+	ErrMFANotEnrolled = errors.New("user has no second factor")
+	ErrMFAEnrolled    = errors.New("user already has a second factor")
+)
+
+// WithOTP proves a second factor at login with a code of the user's
+// authenticator app, adding otp to the amr of the token. A wrong code fails
+// the login with ErrInvalidCredentials.
+func WithOTP(code string) LoginOption {
+	return func(opts *loginOptions) {
+		opts.otp = code
+	}
+}
+
+// EnrollTOTP creates a new authenticator app secret for the user and returns
+// it with the otpauth URI to scan it from. The issuer names this server in the
+// app. The secret is only used once confirmed, see ConfirmTOTP; until then
+// enrolling again replaces it. A confirmed one returns ErrMFAEnrolled.
+func (auth *Auth) EnrollTOTP(ctx context.Context, user entity.User, issuer string) (string, string, error) {
+	const op = "auth.EnrollTOTP"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+	)
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		log.Error("failed to generate secret", slog.Any("error", err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := auth.userStorage.SaveTOTPFactor(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, storage.ErrFactorExists) {
+			return "", "", fmt.Errorf("%s: %w", op, ErrMFAEnrolled)
+		}
+		log.Error("failed to save authenticator app", slog.Any("error", err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authenticator app enrollment started")
+
+	return secret, totp.URI(issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP completes the enrollment of the authenticator app with a code
+// it shows, proving the user set it up. From then on the user can log in with
+// a second factor.
+func (auth *Auth) ConfirmTOTP(ctx context.Context, userId int64, code string) error {
+	const op = "auth.ConfirmTOTP"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+	)
+
+	factor, err := auth.userProvider.TOTPFactor(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrFactorNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrMFANotEnrolled)
+		}
+		log.Error("failed to get authenticator app", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if factor.Confirmed() {
+		return fmt.Errorf("%s: %w", op, ErrMFAEnrolled)
+	}
+
+	step, ok := totp.Validate(factor.Secret, code, time.Now())
+	if !ok {
+		log.Info("invalid one-time code")
+		return fmt.Errorf("%s: %w", op, ErrInvalidOTP)
+	}
+
+	if err := auth.userStorage.ConfirmTOTPFactor(ctx, userId, step); err != nil {
+		if errors.Is(err, storage.ErrFactorNotFound) {
+			// Confirmed concurrently.
+			return fmt.Errorf("%s: %w", op, ErrMFAEnrolled)
+		}
+		log.Error("failed to confirm authenticator app", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authenticator app confirmed")
+
+	return nil
+}
+
+// VerifyMFA steps up the authentication of a token of the app with a code of
+// the user's authenticator app. The token is reissued with otp added to its
+// amr, the acr that follows, and auth_time set to now.
+//
+// The acr and max age options are checked as at login: if the methods still
+// don't reach the acr, or the app doesn't allow them, returns
+// ErrStepUpRequired or ErrLoginMethodNotAllowed. The new token never outlives
+// the original one, and a max age caps it further.
+//
+// Impersonation tokens and tokens given for personal access tokens can't be
+// stepped up, they return ErrInvalidToken: whoever holds them isn't
+// necessarily the user the code proves.
+func (auth *Auth) VerifyMFA(ctx context.Context, token string, appId int, code string, opts ...LoginOption) (string, error) {
+	const op = "auth.VerifyMFA"
+
+	var options loginOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	claims, err := jwt.Parse(token, auth.signingKey.Public())
+	if err != nil || jwt.AppID(claims) != appId {
+		log.Info("invalid token", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+	if _, ok := claims["act"]; ok {
+		log.Info("token was issued to an actor")
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+	if slices.Contains(stringsClaim(claims["amr"]), entity.AMRPersonalAccessToken) {
+		log.Info("token was given for a personal access token")
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := auth.sessionUser(ctx, log, claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := auth.verifyOTP(ctx, log, user.ID, code); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	amr := stringsClaim(claims["amr"])
+	if !slices.Contains(amr, entity.AMROTP) {
+		amr = append(amr, entity.AMROTP)
+	}
+	if err := checkLoginPolicy(log, user, app, amr, options.acr); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	tokenOpts := []jwt.Option{jwt.WithAuthContext(now, amr)}
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if options.maxAge > 0 && now.Add(options.maxAge).Before(exp.Time) {
+		tokenOpts = append(tokenOpts, jwt.WithExpiresAt(now.Add(options.maxAge)))
+	}
+
+	stepped, err := jwt.Reissue(auth.signingKey, claims, tokenOpts...)
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authentication stepped up", slog.Int64("user_id", user.ID))
+
+	return stepped, nil
+}
+
+// verifyOTP checks a code of the confirmed authenticator app of the user. A
+// code is accepted once: a later code, or a replay of the same one, of an
+// earlier time step is refused.
+func (auth *Auth) verifyOTP(ctx context.Context, log *slog.Logger, userId int64, code string) error {
+	factor, err := auth.userProvider.TOTPFactor(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrFactorNotFound) {
+			log.Info("user has no authenticator app")
+			return ErrMFANotEnrolled
+		}
+		log.Error("failed to get authenticator app", slog.Any("error", err))
+		return err
+	}
+	if !factor.Confirmed() {
+		log.Info("authenticator app is not confirmed")
+		return ErrMFANotEnrolled
+	}
+
+	step, ok := totp.Validate(factor.Secret, code, time.Now())
+	if !ok || step <= factor.LastStep {
+		log.Info("invalid one-time code")
+		return ErrInvalidOTP
+	}
+
+	if err := auth.userStorage.UseTOTPStep(ctx, userId, step); err != nil {
+		if errors.Is(err, storage.ErrOTPReplayed) {
+			log.Info("one-time code already used")
+			return ErrInvalidOTP
+		}
+		log.Error("failed to use one-time code", slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrRegistrationDisabled  = errors.New("registration is disabled for this app")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed for this app")
+	ErrLoginMethodNotAllowed = errors.New("login method is not allowed for this app")
+)
+
+type registerOptions struct {
+	appId int
+}
+
+// RegisterOption tunes a single registration.
+type RegisterOption func(opts *registerOptions)
+
+// WithApp registers the user through the app, so the app's registration policy applies:
+// self-registration must be allowed and the email domain must be accepted by the app.
+func WithApp(appId int) RegisterOption {
+	return func(opts *registerOptions) {
+		opts.appId = appId
+	}
+}
+
+// checkRegistration verifies the registration is allowed by the app settings.
+func (auth *Auth) checkRegistration(ctx context.Context, appId int, email string) error {
+	app, err := auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return ErrInvalidAppId
+		}
+		return fmt.Errorf("failed to get app: %w", err)
+	}
+
+	if !app.Settings.AllowRegistration {
+		return ErrRegistrationDisabled
+	}
+
+	if !app.Settings.AllowsEmail(email) {
+		return ErrEmailDomainNotAllowed
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	ErrStepUpRequired           = errors.New("stronger authentication required")
+	ErrReauthenticationRequired = errors.New("reauthentication required")
+	ErrInvalidToken             = errors.New("invalid token")
+	ErrConsentRequired          = errors.New("user has not consented to the app")
+)
+
+type loginOptions struct {
+	acr    string
+	maxAge time.Duration
+	orgId  int64
+	otp    string
+}
+
+// LoginOption tunes the authentication requirements of a single login.
+type LoginOption func(opts *loginOptions)
+
+// WithACR requires the login to reach at least the given authentication context class.
+func WithACR(acr string) LoginOption {
+	return func(opts *loginOptions) {
+		opts.acr = acr
+	}
+}
+
+// WithMaxAge requires the user to have authenticated no longer than maxAge ago.
+// The issued token expires once it no longer proves fresh enough authentication.
+func WithMaxAge(maxAge time.Duration) LoginOption {
+	return func(opts *loginOptions) {
+		opts.maxAge = maxAge
+	}
+}
+
+// CheckAuthContext verifies the token and reports whether it proves recent enough
+// and strong enough authentication for a sensitive operation.
+//
+// If the token is older than maxAge, returns ErrReauthenticationRequired.
+// If the token's acr is weaker than the required one, returns ErrStepUpRequired.
+// A zero maxAge and an empty acr disable the corresponding check.
+func (auth *Auth) CheckAuthContext(
+	ctx context.Context,
+	token string,
+	appId int,
+	acr string,
+	maxAge time.Duration,
+) error {
+	const op = "auth.CheckAuthContext"
+
+	log := auth.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	claims, err := jwt.Parse(token, auth.signingKey.Public())
+	if err != nil || jwt.AppID(claims) != appId {
+		log.Info("invalid token", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	_, err = auth.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := auth.sessionUser(ctx, log, claims); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if maxAge > 0 {
+		authTime, ok := claims["auth_time"].(float64)
+		if !ok || time.Since(time.Unix(int64(authTime), 0)) > maxAge {
+			log.Info("authentication is too old")
+			return fmt.Errorf("%s: %w", op, ErrReauthenticationRequired)
+		}
+	}
+
+	tokenACR, _ := claims["acr"].(string)
+	if !entity.ACRSatisfies(tokenACR, acr) {
+		log.Info("authentication is too weak", slog.String("acr", tokenACR), slog.String("required_acr", acr))
+		return fmt.Errorf("%s: %w", op, ErrStepUpRequired)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var (
+	ErrInvalidQuery     = errors.New("invalid user query")
+	ErrInvalidPageToken = errors.New("invalid page token")
+)
+
+// pageToken is the opaque cursor handed out to continue a user listing.
+type pageToken struct {
+	SortBy    string    `json:"s"`
+	Desc      bool      `json:"d"`
+	ID        int64     `json:"i"`
+	Email     string    `json:"e,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+}
+
+// ListUsers returns a page of the user directory and the token of the next page,
+// which is empty on the last page. Only admins can list users.
+//
+// Password hashes are never returned. A page token is only valid with the
+// sorting it was issued for.
+func (auth *Auth) ListUsers(
+	ctx context.Context,
+	actorId int64,
+	query entity.UserQuery,
+	token string,
+) ([]entity.User, string, error) {
+	const op = "auth.ListUsers"
+
+	log := auth.log.With(slog.String("op", op), slog.Int64("actor_id", actorId))
+
+	if err := auth.requireAdmin(ctx, actorId); err != nil {
+		log.Warn("user listing denied", slog.Any("error", err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if query.SortBy == "" {
+		query.SortBy = entity.UserSortID
+	}
+	if query.SortBy != entity.UserSortID && query.SortBy != entity.UserSortEmail && query.SortBy != entity.UserSortCreatedAt {
+		return nil, "", fmt.Errorf("%s: %w: unknown sort field %q", op, ErrInvalidQuery, query.SortBy)
+	}
+	if query.Filter.Status != "" && !entity.ValidUserStatus(query.Filter.Status) {
+		return nil, "", fmt.Errorf("%s: %w: unknown status %q", op, ErrInvalidQuery, query.Filter.Status)
+	}
+	if query.Limit < 0 || query.Limit > maxPageSize {
+		return nil, "", fmt.Errorf("%s: %w: page size must be at most %d", op, ErrInvalidQuery, maxPageSize)
+	}
+
+	pageSize := query.Limit
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	query.After = nil
+	if token != "" {
+		after, err := decodePageToken(token, query)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", op, err)
+		}
+		query.After = &after
+	}
+
+	// One extra user tells whether there is a next page.
+	query.Limit = pageSize + 1
+
+	users, err := auth.userProvider.ListUsers(ctx, query)
+	if err != nil {
+		log.Error("failed to list users", slog.Any("error", err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	var next string
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		next = encodePageToken(users[pageSize-1], query)
+	}
+
+	for i := range users {
+		users[i].PassHash = nil
+	}
+
+	return users, next, nil
+}
+
+func encodePageToken(last entity.User, query entity.UserQuery) string {
+	raw, _ := json.Marshal(pageToken{
+		SortBy:    query.SortBy,
+		Desc:      query.Desc,
+		ID:        last.ID,
+		Email:     last.Email,
+		CreatedAt: last.CreatedAt,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(token string, query entity.UserQuery) (entity.User, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return entity.User{}, ErrInvalidPageToken
+	}
+
+	var page pageToken
+	if err := json.Unmarshal(raw, &page); err != nil {
+		return entity.User{}, ErrInvalidPageToken
+	}
+
+	if page.SortBy != query.SortBy || page.Desc != query.Desc {
+		return entity.User{}, ErrInvalidPageToken
+	}
+
+	return entity.User{ID: page.ID, Email: page.Email, CreatedAt: page.CreatedAt}, nil
+}
@@ -0,0 +1,230 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/userio"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:generate mockgen -destination=mock_bulk.go -package=bulk . UserStorage
+
+const DefaultBatchSize = 500
+
+var (
+	ErrInvalidEmail        = errors.New("invalid email")
+	ErrInvalidPasswordHash = errors.New("password hash is not a bcrypt hash")
+	ErrInvalidStatus       = errors.New("invalid status")
+	ErrDuplicateEmail      = errors.New("email appears more than once in the input")
+	ErrUserExists          = errors.New("user already exists")
+)
+
+type Bulk struct {
+	log         *slog.Logger
+	userStorage UserStorage
+	batchSize   int
+}
+
+type UserStorage interface {
+	ImportUsers(ctx context.Context, records []entity.UserRecord, dryRun bool) ([]error, error)
+	UserRecords(ctx context.Context, afterId int64, limit int) ([]entity.UserRecord, error)
+}
+
+// Report sums up an import.
+type Report struct {
+	DryRun bool
+	// Processed counts the records read, Imported the users created (or that
+	// would be created on a dry run) and Failed the records rejected.
+	Processed int
+	Imported  int
+	Failed    int
+	Errors    []RowError
+}
+
+// RowError tells why a record of the input was rejected.
+type RowError struct {
+	Line  int
+	Email string
+	Err   error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Email, e.Err)
+}
+
+// New returns a new instance of the bulk user service
+func New(log *slog.Logger, userStorage UserStorage, batchSize int) *Bulk {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &Bulk{
+		log:         log,
+		userStorage: userStorage,
+		batchSize:   batchSize,
+	}
+}
+
+// Import creates the users read from the reader, a batch per transaction.
+//
+// Invalid records are reported and skipped. Password hashes are stored as is and
+// must be bcrypt hashes. When an error other than an invalid record stops the
+// import, the batches before it stay imported and the report tells how far it got.
+func (b *Bulk) Import(ctx context.Context, reader userio.Reader, dryRun bool) (Report, error) {
+	const op = "bulk.Import"
+
+	log := b.log.With(slog.String("op", op), slog.Bool("dry_run", dryRun))
+
+	report := Report{DryRun: dryRun}
+	seen := make(map[string]struct{})
+
+	batch := make([]entity.UserRecord, 0, b.batchSize)
+	lines := make([]int, 0, b.batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		errs, err := b.userStorage.ImportUsers(ctx, batch, dryRun)
+		if err != nil {
+			return err
+		}
+
+		for i, err := range errs {
+			if err == nil {
+				report.Imported++
+				continue
+			}
+			if errors.Is(err, storage.ErrUserExists) {
+				err = ErrUserExists
+			}
+			report.fail(lines[i], batch[i].Email, err)
+		}
+
+		log.Debug("batch imported", slog.Int("size", len(batch)))
+
+		batch, lines = batch[:0], lines[:0]
+
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, userio.ErrInvalidRecord) {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+
+		report.Processed++
+
+		if err == nil {
+			err = validate(record)
+		}
+		if err == nil {
+			key := strings.ToLower(record.Email)
+			if _, ok := seen[key]; ok {
+				err = ErrDuplicateEmail
+			}
+			seen[key] = struct{}{}
+		}
+		if err != nil {
+			report.fail(reader.Line(), record.Email, err)
+			continue
+		}
+
+		batch = append(batch, record)
+		lines = append(lines, reader.Line())
+
+		if len(batch) == b.batchSize {
+			if err := flush(); err != nil {
+				log.Error("failed to import batch", slog.Any("error", err))
+				return report, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.Error("failed to import batch", slog.Any("error", err))
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("users imported",
+		slog.Int("processed", report.Processed),
+		slog.Int("imported", report.Imported),
+		slog.Int("failed", report.Failed),
+	)
+
+	return report, nil
+}
+
+func (r *Report) fail(line int, email string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, RowError{Line: line, Email: email, Err: err})
+}
+
+func validate(record entity.UserRecord) error {
+	if !strings.Contains(record.Email, "@") {
+		return ErrInvalidEmail
+	}
+
+	if _, err := bcrypt.Cost(record.PassHash); err != nil {
+		return ErrInvalidPasswordHash
+	}
+
+	if record.Status != "" && !entity.ValidUserStatus(record.Status) {
+		return ErrInvalidStatus
+	}
+
+	return nil
+}
+
+// Export writes every user, with password hashes, to the writer in id order.
+// Returns the number of users written.
+func (b *Bulk) Export(ctx context.Context, writer userio.Writer) (int, error) {
+	const op = "bulk.Export"
+
+	log := b.log.With(slog.String("op", op))
+
+	var (
+		afterId int64
+		count   int
+	)
+
+	for {
+		records, err := b.userStorage.UserRecords(ctx, afterId, b.batchSize)
+		if err != nil {
+			log.Error("failed to read users", slog.Any("error", err))
+			return count, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, record := range records {
+			if err := writer.Write(record); err != nil {
+				return count, fmt.Errorf("%s: %w", op, err)
+			}
+			count++
+		}
+
+		if len(records) < b.batchSize {
+			break
+		}
+		afterId = records[len(records)-1].ID
+	}
+
+	if err := writer.Flush(); err != nil {
+		return count, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("users exported", slog.Int("count", count))
+
+	return count, nil
+}
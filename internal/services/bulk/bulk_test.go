@@ -0,0 +1,170 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/userio"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBulk_import(t *testing.T) {
+	prefixName := "bulk service"
+	passHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	hash := string(passHash)
+
+	type test struct {
+		name       string
+		format     string
+		input      string
+		dryRun     bool
+		prepare    func(storage *MockUserStorage)
+		wantReport Report
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "import success test: batches"),
+			format: userio.FormatCSV,
+			input: "email,password_hash,admin,email_verified\n" +
+				"a@mail.com," + hash + ",true,true\n" +
+				"b@mail.com," + hash + ",,\n" +
+				"c@mail.com," + hash + ",false,true\n",
+			prepare: func(s *MockUserStorage) {
+				first := s.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), false).
+					DoAndReturn(func(_ context.Context, records []entity.UserRecord, _ bool) ([]error, error) {
+						assert.Len(t, records, 2)
+						assert.Equal(t, "a@mail.com", records[0].Email)
+						assert.True(t, records[0].Admin)
+						assert.True(t, records[0].EmailVerified)
+						assert.Equal(t, passHash, records[0].PassHash)
+						assert.False(t, records[1].Admin)
+						return make([]error, len(records)), nil
+					})
+				s.EXPECT().ImportUsers(gomock.Any(), gomock.Len(1), false).Return([]error{nil}, nil).After(first)
+			},
+			wantReport: Report{Processed: 3, Imported: 3},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "import test: invalid records are reported"),
+			format: userio.FormatJSONL,
+			input: `{"email":"a@mail.com","password_hash":"` + hash + `"}` + "\n" +
+				`{"email":"no-at","password_hash":"` + hash + `"}` + "\n" +
+				`{"email":"b@mail.com","password_hash":"plain"}` + "\n" +
+				"not json\n" +
+				`{"email":"A@mail.com","password_hash":"` + hash + `"}` + "\n" +
+				`{"email":"c@mail.com","password_hash":"` + hash + `","status":"gone"}` + "\n",
+			prepare: func(s *MockUserStorage) {
+				s.EXPECT().ImportUsers(gomock.Any(), gomock.Len(1), false).Return([]error{nil}, nil)
+			},
+			wantReport: Report{Processed: 6, Imported: 1, Failed: 5, Errors: []RowError{
+				{Line: 2, Email: "no-at", Err: ErrInvalidEmail},
+				{Line: 3, Email: "b@mail.com", Err: ErrInvalidPasswordHash},
+				{Line: 4, Err: userio.ErrInvalidRecord},
+				{Line: 5, Email: "A@mail.com", Err: ErrDuplicateEmail},
+				{Line: 6, Email: "c@mail.com", Err: ErrInvalidStatus},
+			}},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "import test: existing users on a dry run"),
+			format: userio.FormatCSV,
+			input:  "password_hash,email\n" + hash + ",a@mail.com\n" + hash + ",b@mail.com\n",
+			dryRun: true,
+			prepare: func(s *MockUserStorage) {
+				s.EXPECT().ImportUsers(gomock.Any(), gomock.Len(2), true).
+					Return([]error{nil, fmt.Errorf("storage: %w", storage.ErrUserExists)}, nil)
+			},
+			wantReport: Report{DryRun: true, Processed: 2, Imported: 1, Failed: 1, Errors: []RowError{
+				{Line: 3, Email: "b@mail.com", Err: ErrUserExists},
+			}},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "import negative test: storage failure"),
+			format: userio.FormatCSV,
+			input:  "email,password_hash\na@mail.com," + hash + "\n",
+			prepare: func(s *MockUserStorage) {
+				s.EXPECT().ImportUsers(gomock.Any(), gomock.Any(), false).Return(nil, errors.New("disk full"))
+			},
+			wantReport: Report{Processed: 1},
+			wantErr:    errors.New("disk full"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userStorage := NewMockUserStorage(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(userStorage)
+			}
+
+			reader, err := userio.NewReader(strings.NewReader(tt.input), tt.format)
+			assert.Nil(t, err)
+
+			service := New(slog.Default(), userStorage, 2)
+			report, err := service.Import(context.Background(), reader, tt.dryRun)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr.Error())
+			}
+
+			assert.Equal(t, tt.wantReport.DryRun, report.DryRun)
+			assert.Equal(t, tt.wantReport.Processed, report.Processed)
+			assert.Equal(t, tt.wantReport.Imported, report.Imported)
+			assert.Equal(t, tt.wantReport.Failed, report.Failed)
+			if assert.Len(t, report.Errors, len(tt.wantReport.Errors)) {
+				for i, want := range tt.wantReport.Errors {
+					assert.Equal(t, want.Line, report.Errors[i].Line)
+					assert.Equal(t, want.Email, report.Errors[i].Email)
+					assert.True(t, errors.Is(report.Errors[i].Err, want.Err), report.Errors[i].Err)
+				}
+			}
+		})
+	}
+}
+
+func TestBulk_export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userStorage := NewMockUserStorage(ctrl)
+	gomock.InOrder(
+		userStorage.EXPECT().UserRecords(gomock.Any(), int64(0), 2).Return([]entity.UserRecord{
+			{User: entity.User{ID: 1, Email: "a@mail.com", PassHash: []byte("h1"), Status: entity.UserStatusActive}, Admin: true},
+			{User: entity.User{ID: 4, Email: "b@mail.com", PassHash: []byte("h2"), EmailVerified: true}},
+		}, nil),
+		userStorage.EXPECT().UserRecords(gomock.Any(), int64(4), 2).Return(nil, nil),
+	)
+
+	var out bytes.Buffer
+	writer, err := userio.NewWriter(&out, userio.FormatCSV)
+	assert.Nil(t, err)
+
+	count, err := New(slog.Default(), userStorage, 2).Export(context.Background(), writer)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "email,password_hash,admin,email_verified,status,created_at\n"+
+		"a@mail.com,h1,true,false,active,\n"+
+		"b@mail.com,h2,false,true,,\n", out.String())
+
+	reader, err := userio.NewReader(&out, userio.FormatCSV)
+	assert.Nil(t, err)
+	record, err := reader.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, "a@mail.com", record.Email)
+	assert.True(t, record.Admin)
+}
@@ -0,0 +1,341 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/oidc"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_federation.go -package=federation . StateStorage,IdentityStorage,UserProvider
+
+const (
+	// StartPath starts a login at the provider named by the path.
+	StartPath = "/federation/login/{provider}"
+	// CallbackPath is where every provider sends the user back.
+	CallbackPath = "/federation/callback"
+
+	stateBytes = 32
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidState    = errors.New("invalid or expired login")
+	ErrUpstream        = errors.New("identity provider login failed")
+	ErrNoAccount       = errors.New("no account is linked to the identity")
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+type Federation struct {
+	log             *slog.Logger
+	stateStorage    StateStorage
+	identityStorage IdentityStorage
+	userProvider    UserProvider
+	providers       map[string]*provider
+	names           []string
+	stateTTL        time.Duration
+}
+
+type StateStorage interface {
+	SaveFederationState(ctx context.Context, state entity.FederationState) error
+	UseFederationState(ctx context.Context, hash []byte) (entity.FederationState, error)
+}
+
+type IdentityStorage interface {
+	FederatedIdentity(ctx context.Context, provider string, subject string) (entity.FederatedIdentity, error)
+	SaveFederatedIdentity(ctx context.Context, identity entity.FederatedIdentity) (int64, error)
+	SaveFederatedUser(ctx context.Context, identity entity.FederatedIdentity, emailVerified bool) (int64, error)
+}
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (entity.User, error)
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+}
+
+// ProviderConfig configures an upstream OpenID Connect provider.
+type ProviderConfig struct {
+	// Name identifies the provider in URLs and linked identities. It must not
+	// change once users have logged in with the provider.
+	Name        string
+	DisplayName string
+	OIDC        oidc.Config
+	// CreateUsers creates a local user at the first login of an identity that
+	// isn't linked yet and can't be linked by email.
+	CreateUsers bool
+	// LinkByEmail links an identity to the local user with the same email, if
+	// the provider verified the email. Only enable it for providers trusted to
+	// verify emails, or an account could be taken over.
+	LinkByEmail bool
+}
+
+// Provider describes a provider users can log in with.
+type Provider struct {
+	Name        string
+	DisplayName string
+}
+
+type provider struct {
+	cfg  ProviderConfig
+	oidc *oidc.Provider
+}
+
+// Login is a successful login at a provider, linked to a local user.
+type Login struct {
+	User entity.User
+	// AMR are the authentication methods of the login.
+	AMR []string
+	// Resume is what Start was given.
+	Resume string
+}
+
+// New returns a new instance of the federation service. Requests to the
+// providers are sent with the client.
+func New(
+	log *slog.Logger,
+	stateStorage StateStorage,
+	identityStorage IdentityStorage,
+	userProvider UserProvider,
+	providers []ProviderConfig,
+	client *http.Client,
+	stateTTL time.Duration,
+) (*Federation, error) {
+	f := &Federation{
+		log:             log,
+		stateStorage:    stateStorage,
+		identityStorage: identityStorage,
+		userProvider:    userProvider,
+		providers:       make(map[string]*provider, len(providers)),
+		stateTTL:        stateTTL,
+	}
+
+	for _, cfg := range providers {
+		if !providerName.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("invalid identity provider name %q", cfg.Name)
+		}
+		if _, ok := f.providers[cfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate identity provider %q", cfg.Name)
+		}
+		if cfg.OIDC.Issuer == "" || cfg.OIDC.ClientID == "" {
+			return nil, fmt.Errorf("identity provider %q needs an issuer and a client id", cfg.Name)
+		}
+		if cfg.DisplayName == "" {
+			cfg.DisplayName = cfg.Name
+		}
+
+		f.providers[cfg.Name] = &provider{cfg: cfg, oidc: oidc.NewProvider(cfg.OIDC, client)}
+		f.names = append(f.names, cfg.Name)
+	}
+
+	return f, nil
+}
+
+// Providers lists the configured providers in configuration order.
+func (f *Federation) Providers() []Provider {
+	providers := make([]Provider, 0, len(f.names))
+	for _, name := range f.names {
+		p := f.providers[name]
+		providers = append(providers, Provider{Name: p.cfg.Name, DisplayName: p.cfg.DisplayName})
+	}
+
+	return providers
+}
+
+// Start begins a login at the provider and returns the URL to send the user to,
+// and the state the provider will send back. The caller should tie the state
+// to the user agent, so a login can't be finished in another browser.
+//
+// resume is returned by Finish once the user is back, so what the login was
+// started for can go on.
+func (f *Federation) Start(ctx context.Context, providerName string, resume string) (string, string, error) {
+	const op = "federation.Start"
+
+	log := f.log.With(slog.String("op", op), slog.String("provider", providerName))
+
+	p, ok := f.providers[providerName]
+	if !ok {
+		return "", "", fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	state, err := random(stateBytes)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	target, err := p.oidc.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Error("failed to build authorization url", slog.Any("error", err))
+		return "", "", fmt.Errorf("%s: %w: %w", op, ErrUpstream, err)
+	}
+
+	err = f.stateStorage.SaveFederationState(ctx, entity.FederationState{
+		StateHash:    hash(state),
+		Provider:     p.cfg.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Resume:       resume,
+		ExpiresAt:    time.Now().Add(f.stateTTL),
+	})
+	if err != nil {
+		log.Error("failed to save state", slog.Any("error", err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("upstream login started")
+
+	return target, state, nil
+}
+
+// Finish completes the login the provider sent the user back from with the
+// state and code, and returns the local user linked to the identity.
+//
+// An identity seen for the first time is linked to the local user with the
+// same verified email if the provider allows it, or else to a new user if the
+// provider allows it. Otherwise ErrNoAccount is returned.
+func (f *Federation) Finish(ctx context.Context, state string, code string) (Login, error) {
+	const op = "federation.Finish"
+
+	log := f.log.With(slog.String("op", op))
+
+	saved, err := f.stateStorage.UseFederationState(ctx, hash(state))
+	if err != nil {
+		if errors.Is(err, storage.ErrFederationStateNotFound) {
+			return Login{}, fmt.Errorf("%s: %w", op, ErrInvalidState)
+		}
+		log.Error("failed to get state", slog.Any("error", err))
+		return Login{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if saved.Expired(time.Now()) {
+		return Login{}, fmt.Errorf("%s: %w", op, ErrInvalidState)
+	}
+
+	log = log.With(slog.String("provider", saved.Provider))
+
+	p, ok := f.providers[saved.Provider]
+	if !ok {
+		// The provider was removed from the configuration during the login.
+		return Login{}, fmt.Errorf("%s: %w", op, ErrUnknownProvider)
+	}
+
+	claims, err := p.oidc.Exchange(ctx, code, saved.CodeVerifier, saved.Nonce)
+	if err != nil {
+		log.Warn("upstream login failed", slog.Any("error", err))
+		return Login{}, fmt.Errorf("%s: %w: %w", op, ErrUpstream, err)
+	}
+
+	log = log.With(slog.String("subject", claims.Subject))
+
+	user, err := f.linkedUser(ctx, log, p.cfg, claims)
+	if err != nil {
+		return Login{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("upstream login succeeded", slog.Int64("user_id", user.ID))
+
+	return Login{User: user, AMR: []string{entity.AMRFederated}, Resume: saved.Resume}, nil
+}
+
+// linkedUser returns the local user of the identity, linking it first if needed.
+func (f *Federation) linkedUser(ctx context.Context, log *slog.Logger, cfg ProviderConfig, claims oidc.Claims) (entity.User, error) {
+	user, err := f.identityUser(ctx, cfg.Name, claims.Subject)
+	if !errors.Is(err, storage.ErrIdentityNotFound) {
+		if err != nil {
+			log.Error("failed to get the user of the identity", slog.Any("error", err))
+		}
+		return user, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	identity := entity.FederatedIdentity{Provider: cfg.Name, Subject: claims.Subject, Email: email}
+
+	if cfg.LinkByEmail && claims.EmailVerified && email != "" {
+		user, err := f.userProvider.User(ctx, email)
+		switch {
+		case err == nil:
+			identity.UserID = user.ID
+			_, err := f.identityStorage.SaveFederatedIdentity(ctx, identity)
+			if err == nil {
+				log.Info("identity linked by email", slog.Int64("user_id", user.ID))
+				return user, nil
+			}
+			return f.linkFailed(ctx, log, identity, err)
+		case !errors.Is(err, storage.ErrUserNotFound):
+			log.Error("failed to get user", slog.Any("error", err))
+			return entity.User{}, err
+		}
+	}
+
+	if !cfg.CreateUsers || email == "" {
+		log.Info("no account for the identity")
+		return entity.User{}, ErrNoAccount
+	}
+
+	userId, err := f.identityStorage.SaveFederatedUser(ctx, identity, claims.EmailVerified)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			// The email belongs to a user the identity may not be linked to.
+			log.Info("email of the identity is taken")
+			return entity.User{}, ErrNoAccount
+		}
+		return f.linkFailed(ctx, log, identity, err)
+	}
+
+	log.Info("user created for the identity", slog.Int64("user_id", userId))
+
+	return f.userProvider.UserByID(ctx, userId)
+}
+
+// linkFailed handles a failure to link the identity. If a concurrent login
+// linked it meanwhile, the user of that link is returned.
+func (f *Federation) linkFailed(ctx context.Context, log *slog.Logger, identity entity.FederatedIdentity, err error) (entity.User, error) {
+	if errors.Is(err, storage.ErrIdentityExists) {
+		return f.identityUser(ctx, identity.Provider, identity.Subject)
+	}
+
+	log.Error("failed to link identity", slog.Any("error", err))
+	return entity.User{}, err
+}
+
+// identityUser returns the user the identity is linked to, or
+// storage.ErrIdentityNotFound if it isn't linked.
+func (f *Federation) identityUser(ctx context.Context, provider string, subject string) (entity.User, error) {
+	identity, err := f.identityStorage.FederatedIdentity(ctx, provider, subject)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	return f.userProvider.UserByID(ctx, identity.UserID)
+}
+
+func random(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hash(value string) []byte {
+	sum := sha256.Sum256([]byte(value))
+	return sum[:]
+}
@@ -0,0 +1,407 @@
+package federation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/oidc"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	clientID     = "sso"
+	clientSecret = "secret"
+	redirectURI  = "https://sso.example.com/federation/callback"
+	upstreamCode = "upstream-code"
+)
+
+// fakeIdP is an in-process upstream OpenID Connect provider. It issues an ID
+// token for the login last started at it, with claims merged over the defaults,
+// signed by signer rather than its published key if set.
+type fakeIdP struct {
+	*httptest.Server
+	key    *jwk.Key
+	signer *jwk.Key
+
+	claims    map[string]any
+	nonce     string
+	challenge string
+}
+
+func newFakeIdP(t *testing.T, key *jwk.Key) *fakeIdP {
+	idp := &fakeIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwk.Set{Keys: []jwk.PublicKey{idp.key.JWK()}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// authorize plays the user logging in at the authorization URL, and returns
+// the code the provider sends back.
+func (idp *fakeIdP) authorize(t *testing.T, target string, state string) string {
+	u, err := url.Parse(target)
+	assert.Nil(t, err)
+
+	query := u.Query()
+	assert.Equal(t, idp.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, clientID, query.Get("client_id"))
+	assert.Equal(t, redirectURI, query.Get("redirect_uri"))
+	assert.Equal(t, state, query.Get("state"))
+	assert.Equal(t, "openid email", query.Get("scope"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+
+	idp.nonce = query.Get("nonce")
+	idp.challenge = query.Get("code_challenge")
+
+	return upstreamCode
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if id != clientID || secret != clientSecret || r.PostFormValue("code") != upstreamCode ||
+		r.PostFormValue("redirect_uri") != redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            idp.URL,
+		"aud":            clientID,
+		"sub":            "upstream-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          idp.nonce,
+		"email":          "test@mail.com",
+		"email_verified": true,
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+
+	signer := idp.key
+	if idp.signer != nil {
+		signer = idp.signer
+	}
+	idToken, err := signer.Sign(claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+type fields struct {
+	stateStorage    *MockStateStorage
+	identityStorage *MockIdentityStorage
+	userProvider    *MockUserProvider
+}
+
+func TestFederation_login(t *testing.T) {
+	prefixName := "federation service"
+
+	key, err := jwk.Generate()
+	assert.Nil(t, err)
+	otherKey, err := jwk.Generate()
+	assert.Nil(t, err)
+
+	user := entity.User{ID: 10, Email: "test@mail.com", Status: entity.UserStatusActive}
+	identity := entity.FederatedIdentity{ID: 1, Provider: "idp", Subject: "upstream-1", UserID: user.ID}
+
+	type test struct {
+		name        string
+		createUsers bool
+		linkByEmail bool
+		claims      map[string]any
+		signingKey  *jwk.Key
+		useState    func(saved entity.FederationState) (entity.FederationState, error)
+		prepare     func(f *fields)
+		wantErr     error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "login success test: linked identity"),
+			prepare: func(f *fields) {
+				f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").Return(identity, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+			},
+		},
+		{
+			name:        fmt.Sprintf("%s: %s", prefixName, "login success test: linked by verified email"),
+			linkByEmail: true,
+			prepare: func(f *fields) {
+				f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+					Return(entity.FederatedIdentity{}, storage.ErrIdentityNotFound)
+				f.userProvider.EXPECT().User(gomock.Any(), "test@mail.com").Return(user, nil)
+				f.identityStorage.EXPECT().SaveFederatedIdentity(gomock.Any(), entity.FederatedIdentity{
+					Provider: "idp",
+					Subject:  "upstream-1",
+					UserID:   user.ID,
+					Email:    "test@mail.com",
+				}).Return(int64(1), nil)
+			},
+		},
+		{
+			name:        fmt.Sprintf("%s: %s", prefixName, "login success test: linked by a concurrent login"),
+			linkByEmail: true,
+			prepare: func(f *fields) {
+				gomock.InOrder(
+					f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+						Return(entity.FederatedIdentity{}, storage.ErrIdentityNotFound),
+					f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+						Return(identity, nil),
+				)
+				f.userProvider.EXPECT().User(gomock.Any(), "test@mail.com").Return(user, nil)
+				f.identityStorage.EXPECT().SaveFederatedIdentity(gomock.Any(), gomock.Any()).
+					Return(int64(0), storage.ErrIdentityExists)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+			},
+		},
+		{
+			name:        fmt.Sprintf("%s: %s", prefixName, "login success test: user created"),
+			createUsers: true,
+			linkByEmail: true,
+			prepare: func(f *fields) {
+				f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+					Return(entity.FederatedIdentity{}, storage.ErrIdentityNotFound)
+				f.userProvider.EXPECT().User(gomock.Any(), "test@mail.com").Return(entity.User{}, storage.ErrUserNotFound)
+				f.identityStorage.EXPECT().SaveFederatedUser(gomock.Any(), entity.FederatedIdentity{
+					Provider: "idp",
+					Subject:  "upstream-1",
+					Email:    "test@mail.com",
+				}, true).Return(user.ID, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+			},
+		},
+		{
+			name:        fmt.Sprintf("%s: %s", prefixName, "login negative test: unverified email isn't linked"),
+			linkByEmail: true,
+			claims:      map[string]any{"email_verified": false},
+			prepare: func(f *fields) {
+				f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+					Return(entity.FederatedIdentity{}, storage.ErrIdentityNotFound)
+			},
+			wantErr: ErrNoAccount,
+		},
+		{
+			name:        fmt.Sprintf("%s: %s", prefixName, "login negative test: email of another user"),
+			createUsers: true,
+			claims:      map[string]any{"email_verified": false},
+			prepare: func(f *fields) {
+				f.identityStorage.EXPECT().FederatedIdentity(gomock.Any(), "idp", "upstream-1").
+					Return(entity.FederatedIdentity{}, storage.ErrIdentityNotFound)
+				f.identityStorage.EXPECT().SaveFederatedUser(gomock.Any(), gomock.Any(), false).
+					Return(int64(0), storage.ErrUserExists)
+			},
+			wantErr: ErrNoAccount,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: replayed state"),
+			wantErr: ErrInvalidState,
+			useState: func(entity.FederationState) (entity.FederationState, error) {
+				return entity.FederationState{}, storage.ErrFederationStateNotFound
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: expired state"),
+			wantErr: ErrInvalidState,
+			useState: func(saved entity.FederationState) (entity.FederationState, error) {
+				saved.ExpiresAt = time.Now().Add(-time.Second)
+				return saved, nil
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: nonce mismatch"),
+			claims:  map[string]any{"nonce": "replayed"},
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: token for another client"),
+			claims:  map[string]any{"aud": "other"},
+			wantErr: oidc.ErrInvalidIDToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "login negative test: token from another issuer"),
+			claims:  map[string]any{"iss": "https://evil.example.com"},
+			wantErr: ErrUpstream,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "login negative test: forged signature"),
+			signingKey: otherKey,
+			wantErr:    ErrUpstream,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			idp := newFakeIdP(t, key)
+			idp.claims = tt.claims
+			if tt.signingKey != nil {
+				// The forged key has the kid of the published one.
+				forged := *tt.signingKey
+				forged.ID = key.ID
+				idp.signer = &forged
+			}
+
+			f := &fields{
+				stateStorage:    NewMockStateStorage(ctrl),
+				identityStorage: NewMockIdentityStorage(ctrl),
+				userProvider:    NewMockUserProvider(ctrl),
+			}
+			federation, err := New(slog.Default(), f.stateStorage, f.identityStorage, f.userProvider, []ProviderConfig{{
+				Name: "idp",
+				OIDC: oidc.Config{
+					Issuer:       idp.URL,
+					ClientID:     clientID,
+					ClientSecret: clientSecret,
+					RedirectURI:  redirectURI,
+					Scopes:       []string{"email"},
+				},
+				CreateUsers: tt.createUsers,
+				LinkByEmail: tt.linkByEmail,
+			}}, idp.Client(), 10*time.Minute)
+			assert.Nil(t, err)
+
+			var saved entity.FederationState
+			f.stateStorage.EXPECT().SaveFederationState(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, state entity.FederationState) error {
+					saved = state
+					return nil
+				})
+
+			target, state, err := federation.Start(context.Background(), "idp", "resume")
+			assert.Nil(t, err)
+			assert.Equal(t, hash(state), saved.StateHash)
+
+			code := idp.authorize(t, target, state)
+
+			f.stateStorage.EXPECT().UseFederationState(gomock.Any(), hash(state)).
+				DoAndReturn(func(context.Context, []byte) (entity.FederationState, error) {
+					if tt.useState != nil {
+						return tt.useState(saved)
+					}
+					return saved, nil
+				})
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			login, err := federation.Finish(context.Background(), state, code)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, user, login.User)
+				assert.Equal(t, []string{entity.AMRFederated}, login.AMR)
+				assert.Equal(t, "resume", login.Resume)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestFederation_start(t *testing.T) {
+	prefixName := "federation service"
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	idp := newFakeIdP(t, nil)
+	federation, err := New(slog.Default(), NewMockStateStorage(ctrl), NewMockIdentityStorage(ctrl),
+		NewMockUserProvider(ctrl), []ProviderConfig{{
+			Name: "idp",
+			OIDC: oidc.Config{Issuer: idp.URL + "/other", ClientID: clientID, RedirectURI: redirectURI},
+		}}, idp.Client(), 10*time.Minute)
+	assert.Nil(t, err)
+
+	t.Run(fmt.Sprintf("%s: %s", prefixName, "start negative test: unknown provider"), func(t *testing.T) {
+		_, _, err := federation.Start(context.Background(), "other", "")
+		assert.True(t, errors.Is(err, ErrUnknownProvider), err)
+	})
+	t.Run(fmt.Sprintf("%s: %s", prefixName, "start negative test: provider discovery fails"), func(t *testing.T) {
+		_, _, err := federation.Start(context.Background(), "idp", "")
+		assert.True(t, errors.Is(err, ErrUpstream), err)
+	})
+}
+
+func TestFederation_new(t *testing.T) {
+	prefixName := "federation service"
+
+	valid := ProviderConfig{Name: "idp", OIDC: oidc.Config{Issuer: "https://idp.example.com", ClientID: clientID}}
+
+	type test struct {
+		name      string
+		providers []ProviderConfig
+		wantErr   bool
+	}
+	tests := []test{
+		{
+			name:      fmt.Sprintf("%s: %s", prefixName, "new success test"),
+			providers: []ProviderConfig{valid},
+		},
+		{
+			name:      fmt.Sprintf("%s: %s", prefixName, "new negative test: invalid name"),
+			providers: []ProviderConfig{{Name: "Idp/1", OIDC: valid.OIDC}},
+			wantErr:   true,
+		},
+		{
+			name:      fmt.Sprintf("%s: %s", prefixName, "new negative test: duplicate name"),
+			providers: []ProviderConfig{valid, valid},
+			wantErr:   true,
+		},
+		{
+			name:      fmt.Sprintf("%s: %s", prefixName, "new negative test: no issuer"),
+			providers: []ProviderConfig{{Name: "idp", OIDC: oidc.Config{ClientID: clientID}}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			federation, err := New(slog.Default(), nil, nil, nil, tt.providers, http.DefaultClient, time.Minute)
+
+			if tt.wantErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, []Provider{{Name: "idp", DisplayName: "idp"}}, federation.Providers())
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_impersonation.go -package=impersonation . UserProvider,AppProvider,AuditStorage
+
+var (
+	ErrDisabled         = errors.New("impersonation is disabled")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrReasonRequired   = errors.New("impersonation reason required")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserDisabled     = errors.New("user is disabled")
+	ErrInvalidAppId     = errors.New("invalid app id")
+)
+
+type Impersonation struct {
+	log          *slog.Logger
+	userProvider UserProvider
+	appProvider  AppProvider
+	auditStorage AuditStorage
+	signingKey   *jwk.Key
+	enabled      bool
+	tokenTTL     time.Duration
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+	UserRoles(ctx context.Context, userId int64, appId int) ([]entity.Role, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appId int) (entity.App, error)
+}
+
+type AuditStorage interface {
+	SaveAuditEvent(ctx context.Context, event entity.AuditEvent) (int64, error)
+}
+
+// New returns a new instance of the Impersonation service. Tokens are signed with the signing key.
+func New(
+	log *slog.Logger,
+	userProvider UserProvider,
+	appProvider AppProvider,
+	auditStorage AuditStorage,
+	signingKey *jwk.Key,
+	enabled bool,
+	tokenTTL time.Duration,
+) *Impersonation {
+	return &Impersonation{
+		log:          log,
+		userProvider: userProvider,
+		appProvider:  appProvider,
+		auditStorage: auditStorage,
+		signingKey:   signingKey,
+		enabled:      enabled,
+		tokenTTL:     tokenTTL,
+	}
+}
+
+// Impersonate issues a short-lived token for the target user on behalf of an admin.
+//
+// The token carries an "act" claim identifying the admin. Every issued token is
+// recorded in the audit trail together with the reason given by the admin.
+// Admins can't impersonate themselves, other admins or disabled users, and
+// disabled admins can't impersonate anyone.
+func (i *Impersonation) Impersonate(
+	ctx context.Context,
+	adminId int64,
+	targetUserId int64,
+	appId int,
+	reason string,
+) (string, error) {
+	const op = "impersonation.Impersonate"
+
+	log := i.log.With(
+		slog.String("op", op),
+		slog.Int64("admin_id", adminId),
+		slog.Int64("target_user_id", targetUserId),
+		slog.Int("app_id", appId),
+	)
+	log.Info("attempt to impersonate user")
+
+	if !i.enabled {
+		log.Warn("impersonation is disabled")
+		return "", fmt.Errorf("%s: %w", op, ErrDisabled)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return "", fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+
+	if adminId == targetUserId {
+		log.Warn("admin tried to impersonate themselves")
+		return "", fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	isAdmin, err := i.userProvider.IsAdmin(ctx, adminId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+		}
+		log.Error("failed to check if user is admin", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if !isAdmin {
+		log.Warn("non-admin user tried to impersonate")
+		return "", fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	admin, err := i.userProvider.UserByID(ctx, adminId)
+	if err != nil {
+		log.Error("failed to get admin", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if admin.Status == entity.UserStatusDisabled {
+		log.Warn("disabled admin tried to impersonate")
+		return "", fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	target, err := i.userProvider.UserByID(ctx, targetUserId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get target user", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if target.Status == entity.UserStatusDisabled {
+		log.Warn("admin tried to impersonate a disabled user")
+		return "", fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	targetIsAdmin, err := i.userProvider.IsAdmin(ctx, targetUserId)
+	if err != nil {
+		log.Error("failed to check if target user is admin", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if targetIsAdmin {
+		log.Warn("admin tried to impersonate another admin")
+		return "", fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	app, err := i.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return "", fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := i.userProvider.UserRoles(ctx, targetUserId, appId)
+	if err != nil {
+		log.Error("failed to get target user roles", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = i.auditStorage.SaveAuditEvent(ctx, entity.AuditEvent{
+		ActorID:      adminId,
+		Action:       entity.AuditActionImpersonate,
+		TargetUserID: targetUserId,
+		AppID:        appId,
+		Details:      reason,
+	})
+	if err != nil {
+		log.Error("failed to record audit event", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwt.NewToken(i.signingKey, target, app, i.tokenTTL, jwt.WithActor(admin), jwt.WithRoles(roles))
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("impersonation token issued")
+
+	return token, nil
+}
@@ -0,0 +1,185 @@
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var signingKey = func() *jwk.Key {
+	key, err := jwk.Generate()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func TestImpersonation_impersonate(t *testing.T) {
+	prefixName := "impersonation service"
+	admin := entity.User{ID: 1, Email: "admin@mail.com"}
+	target := entity.User{ID: 2, Email: "user@mail.com"}
+	type fields struct {
+		userProvider *MockUserProvider
+		appProvider  *MockAppProvider
+		auditStorage *MockAuditStorage
+	}
+	type args struct {
+		adminId      int64
+		targetUserId int64
+		appId        int
+		reason       string
+	}
+	type test struct {
+		name     string
+		prepare  func(f *fields, arg args)
+		args     args
+		disabled bool
+		wantErr  error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), target.ID).Return(false, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).Return(admin, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), target.ID).Return(target, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), arg.appId).Return(entity.App{
+					ID:     arg.appId,
+					Secret: "secret",
+				}, nil)
+				f.userProvider.EXPECT().UserRoles(gomock.Any(), target.ID, arg.appId).Return(nil, nil)
+				f.auditStorage.EXPECT().SaveAuditEvent(gomock.Any(), entity.AuditEvent{
+					ActorID:      admin.ID,
+					Action:       entity.AuditActionImpersonate,
+					TargetUserID: target.ID,
+					AppID:        arg.appId,
+					Details:      arg.reason,
+				}).Return(int64(1), nil)
+			},
+			args: args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+		},
+		{
+			name:     fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: disabled"),
+			args:     args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			disabled: true,
+			wantErr:  ErrDisabled,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: empty reason"),
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "  "},
+			wantErr: ErrReasonRequired,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.adminId).Return(false, nil)
+			},
+			args:    args{adminId: 3, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: target is admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).Return(admin, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), target.ID).Return(target, nil)
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), target.ID).Return(true, nil)
+			},
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: admin disabled"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).
+					Return(entity.User{ID: admin.ID, Email: admin.Email, Status: entity.UserStatusDisabled}, nil)
+			},
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: target disabled"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).Return(admin, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), target.ID).
+					Return(entity.User{ID: target.ID, Email: target.Email, Status: entity.UserStatusDisabled}, nil)
+			},
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: ErrUserDisabled,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: target not found"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).Return(admin, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), target.ID).Return(entity.User{}, storage.ErrUserNotFound)
+			},
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "impersonate negative test: audit storage returns error"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), admin.ID).Return(true, nil)
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), target.ID).Return(false, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), admin.ID).Return(admin, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), target.ID).Return(target, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), arg.appId).Return(entity.App{ID: arg.appId}, nil)
+				f.userProvider.EXPECT().UserRoles(gomock.Any(), target.ID, arg.appId).Return(nil, nil)
+				f.auditStorage.EXPECT().SaveAuditEvent(gomock.Any(), gomock.Any()).Return(int64(0), errors.New("testError"))
+			},
+			args:    args{adminId: admin.ID, targetUserId: target.ID, appId: 1, reason: "ticket #42"},
+			wantErr: errors.New("testError"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				userProvider: NewMockUserProvider(ctrl),
+				appProvider:  NewMockAppProvider(ctrl),
+				auditStorage: NewMockAuditStorage(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			service := New(slog.Default(), f.userProvider, f.appProvider, f.auditStorage, signingKey, !tt.disabled, time.Minute)
+			token, err := service.Impersonate(context.Background(), tt.args.adminId, tt.args.targetUserId, tt.args.appId, tt.args.reason)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+
+				claims := jwtlib.MapClaims{}
+				_, err := jwtlib.ParseWithClaims(token, claims, func(token *jwtlib.Token) (interface{}, error) {
+					return signingKey.Public(), nil
+				}, jwtlib.WithValidMethods([]string{"RS256"}))
+				assert.Nil(t, err)
+				assert.Equal(t, float64(target.ID), claims["uid"])
+				assert.Equal(t, map[string]any{"sub": "1", "email": admin.Email}, claims["act"])
+			} else {
+				assert.NotNil(t, err)
+				if !errors.Is(err, tt.wantErr) {
+					assert.ErrorContains(t, err, tt.wantErr.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package invitations
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_invitations.go -package=invitations . InvitationStorage,UserProvider,RoleProvider,OrgProvider,PasswordHasher,Mailer
+
+const tokenBytes = 32
+
+var (
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrInvalidEmail      = errors.New("invalid email")
+	ErrInvalidPassword   = errors.New("password required")
+	ErrInvalidTTL        = errors.New("invalid invitation ttl")
+	ErrUserExists        = errors.New("user already exists")
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrAdminRole         = errors.New("the admin role can't be granted by invitation")
+	ErrOrgNotFound       = errors.New("organization not found")
+	ErrInvalidOrgRole    = errors.New("invalid organization role")
+	ErrInvalidInvitation = errors.New("invalid invitation")
+	ErrNotFound          = errors.New("invitation not found")
+)
+
+type Invitations struct {
+	log               *slog.Logger
+	invitationStorage InvitationStorage
+	userProvider      UserProvider
+	roleProvider      RoleProvider
+	orgProvider       OrgProvider
+	hasher            PasswordHasher
+	mailer            Mailer
+	defaultTTL        time.Duration
+}
+
+type InvitationStorage interface {
+	SaveInvitation(ctx context.Context, invitation entity.Invitation) (int64, error)
+	Invitations(ctx context.Context) ([]entity.Invitation, error)
+	InvitationByHash(ctx context.Context, hash []byte) (entity.Invitation, error)
+	RevokeInvitation(ctx context.Context, invitationId int64) error
+	AcceptInvitation(ctx context.Context, invitation entity.Invitation, passHash []byte) (int64, error)
+}
+
+type UserProvider interface {
+	User(ctx context.Context, email string) (entity.User, error)
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+}
+
+type RoleProvider interface {
+	Role(ctx context.Context, roleId int64) (entity.Role, error)
+}
+
+type OrgProvider interface {
+	Organization(ctx context.Context, orgId int64) (entity.Organization, error)
+}
+
+type PasswordHasher interface {
+	Hash(ctx context.Context, password string) ([]byte, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// New returns a new instance of the invitations service
+func New(
+	log *slog.Logger,
+	invitationStorage InvitationStorage,
+	userProvider UserProvider,
+	roleProvider RoleProvider,
+	orgProvider OrgProvider,
+	hasher PasswordHasher,
+	mailer Mailer,
+	defaultTTL time.Duration,
+) *Invitations {
+	return &Invitations{
+		log:               log,
+		invitationStorage: invitationStorage,
+		userProvider:      userProvider,
+		roleProvider:      roleProvider,
+		orgProvider:       orgProvider,
+		hasher:            hasher,
+		mailer:            mailer,
+		defaultTTL:        defaultTTL,
+	}
+}
+
+// CreateInvitation invites a person to sign up and emails them the invitation token.
+//
+// The invitation may grant roles and an organization membership once accepted,
+// but never the admin role: admins are made with GrantAdmin only. The grants are
+// recorded in the audit trail on behalf of the inviting admin when the invitation
+// is accepted. A zero ttl means the configured default. Only admins can invite.
+func (i *Invitations) CreateInvitation(
+	ctx context.Context,
+	adminId int64,
+	invitation entity.Invitation,
+	ttl time.Duration,
+) (entity.Invitation, error) {
+	const op = "invitations.CreateInvitation"
+
+	log := i.log.With(slog.String("op", op), slog.Int64("admin_id", adminId))
+
+	if err := i.requireAdmin(ctx, adminId); err != nil {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invitation.Email = strings.TrimSpace(invitation.Email)
+	if !strings.Contains(invitation.Email, "@") {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrInvalidEmail)
+	}
+
+	if ttl == 0 {
+		ttl = i.defaultTTL
+	}
+	if ttl < 0 {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrInvalidTTL)
+	}
+
+	if _, err := i.userProvider.User(ctx, invitation.Email); err == nil {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrUserExists)
+	} else if !errors.Is(err, storage.ErrUserNotFound) {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, roleId := range invitation.RoleIDs {
+		role, err := i.roleProvider.Role(ctx, roleId)
+		if err != nil {
+			if errors.Is(err, storage.ErrRoleNotFound) {
+				return entity.Invitation{}, fmt.Errorf("%s: %w: %d", op, ErrRoleNotFound, roleId)
+			}
+			return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if role.Admin() {
+			log.Warn("admin tried to invite with the admin role")
+			return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrAdminRole)
+		}
+	}
+
+	if invitation.OrgID != 0 {
+		if invitation.OrgRole == "" {
+			invitation.OrgRole = entity.OrgRoleMember
+		}
+		if !entity.ValidOrgRole(invitation.OrgRole) {
+			return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrInvalidOrgRole)
+		}
+		if _, err := i.orgProvider.Organization(ctx, invitation.OrgID); err != nil {
+			if errors.Is(err, storage.ErrOrgNotFound) {
+				return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrOrgNotFound)
+			}
+			return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		invitation.OrgRole = ""
+	}
+
+	secret := make([]byte, tokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	invitation.TokenHash = hash(token)
+	invitation.InvitedBy = adminId
+	invitation.ExpiresAt = time.Now().Add(ttl).UTC()
+
+	id, err := i.invitationStorage.SaveInvitation(ctx, invitation)
+	if err != nil {
+		log.Error("failed to save invitation", slog.Any("error", err))
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	invitation.ID = id
+
+	body := fmt.Sprintf("You have been invited to create an account.\n\nInvitation code: %s\n\nThe code expires at %s.",
+		token, invitation.ExpiresAt.Format(time.RFC1123))
+
+	if err := i.mailer.Send(ctx, invitation.Email, "You are invited", body); err != nil {
+		log.Error("failed to send invitation", slog.Any("error", err))
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation sent", slog.Int64("invitation_id", id))
+
+	invitation.TokenHash = nil
+
+	return invitation, nil
+}
+
+// AcceptInvitation registers the invited user with the given password and applies
+// the roles and organization membership of the invitation. Returns the new user id.
+//
+// Invitations to join an organization sent by org.Invite are accepted here too
+// when the invited person has no account yet.
+func (i *Invitations) AcceptInvitation(ctx context.Context, token string, password string) (int64, error) {
+	const op = "invitations.AcceptInvitation"
+
+	log := i.log.With(slog.String("op", op))
+
+	if password == "" {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidPassword)
+	}
+
+	invitation, err := i.invitationStorage.InvitationByHash(ctx, hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !invitation.Pending(time.Now()) {
+		log.Info("invitation is no longer pending", slog.Int64("invitation_id", invitation.ID))
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+	}
+
+	passHash, err := i.hasher.Hash(ctx, password)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("error", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	userId, err := i.invitationStorage.AcceptInvitation(ctx, invitation, passHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvitationNotFound):
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+		case errors.Is(err, storage.ErrUserExists):
+			return 0, fmt.Errorf("%s: %w", op, ErrUserExists)
+		}
+		log.Error("failed to accept invitation", slog.Any("error", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation accepted", slog.Int64("invitation_id", invitation.ID), slog.Int64("user_id", userId))
+
+	return userId, nil
+}
+
+// ListInvitations returns all invitations, including accepted, revoked and expired ones.
+func (i *Invitations) ListInvitations(ctx context.Context, adminId int64) ([]entity.Invitation, error) {
+	const op = "invitations.ListInvitations"
+
+	if err := i.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	invitations, err := i.invitationStorage.Invitations(ctx)
+	if err != nil {
+		i.log.Error("failed to list invitations", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for j := range invitations {
+		invitations[j].TokenHash = nil
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation revokes a pending invitation so it can no longer be accepted.
+func (i *Invitations) RevokeInvitation(ctx context.Context, adminId int64, invitationId int64) error {
+	const op = "invitations.RevokeInvitation"
+
+	log := i.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int64("invitation_id", invitationId))
+
+	if err := i.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := i.invitationStorage.RevokeInvitation(ctx, invitationId); err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotFound)
+		}
+		log.Error("failed to revoke invitation", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation revoked")
+
+	return nil
+}
+
+func (i *Invitations) requireAdmin(ctx context.Context, userId int64) error {
+	isAdmin, err := i.userProvider.IsAdmin(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+	if !isAdmin {
+		i.log.Warn("non-admin user tried to manage invitations", slog.Int64("user_id", userId))
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
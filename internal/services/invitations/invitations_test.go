@@ -0,0 +1,257 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type fields struct {
+	invitationStorage *MockInvitationStorage
+	userProvider      *MockUserProvider
+	roleProvider      *MockRoleProvider
+	orgProvider       *MockOrgProvider
+	hasher            *MockPasswordHasher
+	mailer            *MockMailer
+}
+
+func newFields(ctrl *gomock.Controller) *fields {
+	return &fields{
+		invitationStorage: NewMockInvitationStorage(ctrl),
+		userProvider:      NewMockUserProvider(ctrl),
+		roleProvider:      NewMockRoleProvider(ctrl),
+		orgProvider:       NewMockOrgProvider(ctrl),
+		hasher:            NewMockPasswordHasher(ctrl),
+		mailer:            NewMockMailer(ctrl),
+	}
+}
+
+func (f *fields) service() *Invitations {
+	return New(slog.Default(), f.invitationStorage, f.userProvider, f.roleProvider, f.orgProvider, f.hasher, f.mailer, time.Hour)
+}
+
+func TestInvitations_createInvitation(t *testing.T) {
+	prefixName := "invitations service"
+	const adminId = int64(1)
+	type test struct {
+		name       string
+		prepare    func(f *fields, invitation entity.Invitation)
+		invitation entity.Invitation
+		ttl        time.Duration
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create success test"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+				f.userProvider.EXPECT().User(gomock.Any(), invitation.Email).Return(entity.User{}, storage.ErrUserNotFound)
+				f.roleProvider.EXPECT().Role(gomock.Any(), int64(4)).Return(entity.Role{ID: 4}, nil)
+				f.orgProvider.EXPECT().Organization(gomock.Any(), int64(2)).Return(entity.Organization{ID: 2}, nil)
+
+				var tokenHash []byte
+				f.invitationStorage.EXPECT().SaveInvitation(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, saved entity.Invitation) (int64, error) {
+						assert.Len(t, saved.TokenHash, 32)
+						assert.Equal(t, adminId, saved.InvitedBy)
+						assert.Equal(t, entity.OrgRoleMember, saved.OrgRole)
+						assert.WithinDuration(t, time.Now().Add(time.Hour), saved.ExpiresAt, time.Minute)
+						tokenHash = saved.TokenHash
+						return 7, nil
+					})
+				f.mailer.EXPECT().Send(gomock.Any(), invitation.Email, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, _ string, body string) error {
+						token := regexp.MustCompile(`Invitation code: (\S+)`).FindStringSubmatch(body)
+						if assert.Len(t, token, 2) {
+							assert.Equal(t, tokenHash, hash(token[1]))
+						}
+						return nil
+					})
+			},
+			invitation: entity.Invitation{Email: "new@mail.com", RoleIDs: []int64{4}, OrgID: 2},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: not an admin"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(false, nil)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com"},
+			wantErr:    ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: invalid email"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+			},
+			invitation: entity.Invitation{Email: "new"},
+			wantErr:    ErrInvalidEmail,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: user exists"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+				f.userProvider.EXPECT().User(gomock.Any(), invitation.Email).Return(entity.User{ID: 3}, nil)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com"},
+			wantErr:    ErrUserExists,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: unknown role"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+				f.userProvider.EXPECT().User(gomock.Any(), invitation.Email).Return(entity.User{}, storage.ErrUserNotFound)
+				f.roleProvider.EXPECT().Role(gomock.Any(), int64(4)).Return(entity.Role{}, storage.ErrRoleNotFound)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com", RoleIDs: []int64{4}},
+			wantErr:    ErrRoleNotFound,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: admin role"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+				f.userProvider.EXPECT().User(gomock.Any(), invitation.Email).Return(entity.User{}, storage.ErrUserNotFound)
+				f.roleProvider.EXPECT().Role(gomock.Any(), int64(1)).
+					Return(entity.Role{ID: 1, Name: entity.RoleAdmin, AppID: entity.GlobalAppID}, nil)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com", RoleIDs: []int64{1}},
+			wantErr:    ErrAdminRole,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: invalid org role"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+				f.userProvider.EXPECT().User(gomock.Any(), invitation.Email).Return(entity.User{}, storage.ErrUserNotFound)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com", OrgID: 2, OrgRole: "superuser"},
+			wantErr:    ErrInvalidOrgRole,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: negative ttl"),
+			prepare: func(f *fields, invitation entity.Invitation) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), adminId).Return(true, nil)
+			},
+			invitation: entity.Invitation{Email: "new@mail.com"},
+			ttl:        -time.Hour,
+			wantErr:    ErrInvalidTTL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f, tt.invitation)
+			}
+
+			invitation, err := f.service().CreateInvitation(context.Background(), adminId, tt.invitation, tt.ttl)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(7), invitation.ID)
+				assert.Nil(t, invitation.TokenHash)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestInvitations_acceptInvitation(t *testing.T) {
+	prefixName := "invitations service"
+	const token = "token"
+	pending := entity.Invitation{ID: 7, Email: "new@mail.com", ExpiresAt: time.Now().Add(time.Hour)}
+	type test struct {
+		name     string
+		prepare  func(f *fields)
+		password string
+		wantErr  error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept success test"),
+			prepare: func(f *fields) {
+				f.invitationStorage.EXPECT().InvitationByHash(gomock.Any(), hash(token)).Return(pending, nil)
+				f.hasher.EXPECT().Hash(gomock.Any(), "password").Return([]byte("hash"), nil)
+				f.invitationStorage.EXPECT().AcceptInvitation(gomock.Any(), pending, []byte("hash")).Return(int64(5), nil)
+			},
+			password: "password",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "accept negative test: empty password"),
+			wantErr: ErrInvalidPassword,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept negative test: unknown token"),
+			prepare: func(f *fields) {
+				f.invitationStorage.EXPECT().InvitationByHash(gomock.Any(), hash(token)).
+					Return(entity.Invitation{}, storage.ErrInvitationNotFound)
+			},
+			password: "password",
+			wantErr:  ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept negative test: expired"),
+			prepare: func(f *fields) {
+				expired := pending
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				f.invitationStorage.EXPECT().InvitationByHash(gomock.Any(), hash(token)).Return(expired, nil)
+			},
+			password: "password",
+			wantErr:  ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept negative test: revoked"),
+			prepare: func(f *fields) {
+				revoked := pending
+				revoked.RevokedAt = time.Now()
+				f.invitationStorage.EXPECT().InvitationByHash(gomock.Any(), hash(token)).Return(revoked, nil)
+			},
+			password: "password",
+			wantErr:  ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept negative test: email registered meanwhile"),
+			prepare: func(f *fields) {
+				f.invitationStorage.EXPECT().InvitationByHash(gomock.Any(), hash(token)).Return(pending, nil)
+				f.hasher.EXPECT().Hash(gomock.Any(), "password").Return([]byte("hash"), nil)
+				f.invitationStorage.EXPECT().AcceptInvitation(gomock.Any(), pending, []byte("hash")).
+					Return(int64(0), storage.ErrUserExists)
+			},
+			password: "password",
+			wantErr:  ErrUserExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			userId, err := f.service().AcceptInvitation(context.Background(), token, tt.password)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(5), userId)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
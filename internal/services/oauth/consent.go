@@ -0,0 +1,267 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+var (
+	// ErrInvalidConsent means the consent request answered is unknown, already
+	// answered or expired.
+	ErrInvalidConsent  = errors.New("invalid or expired consent request")
+	ErrConsentNotFound = errors.New("consent not found")
+)
+
+type ConsentStorage interface {
+	Consent(ctx context.Context, userId int64, appId int) (entity.Consent, error)
+	Consents(ctx context.Context, userId int64) ([]entity.Consent, error)
+	SaveConsent(ctx context.Context, consent entity.Consent) error
+	RevokeConsent(ctx context.Context, userId int64, appId int) error
+	SaveConsentRequest(ctx context.Context, req entity.ConsentRequest) (int64, error)
+	UseConsentRequest(ctx context.Context, hash []byte) (entity.ConsentRequest, error)
+}
+
+// Authorization is the outcome of a login at the authorization endpoint: the
+// code to send to the client, or the consent to ask the user for first.
+type Authorization struct {
+	Code    string
+	Consent *ConsentPrompt
+}
+
+// ConsentPrompt asks the user to let a third-party app access their data. The
+// answer is sent to Consent along with the challenge.
+type ConsentPrompt struct {
+	Challenge string
+	AppName   string
+	Scopes    []string
+}
+
+// Consent answers the consent prompt with the challenge. When the user
+// approves, the consent is recorded and the authorization code is returned.
+//
+// The authorization request the consent was asked for is returned in any case
+// but ErrInvalidConsent, so the client can be told the outcome. A user who
+// doesn't approve returns ErrAccessDenied.
+func (o *OAuth) Consent(ctx context.Context, challenge string, approve bool) (AuthorizeRequest, string, error) {
+	const op = "oauth.Consent"
+
+	log := o.log.With(slog.String("op", op))
+
+	consentReq, err := o.consentStorage.UseConsentRequest(ctx, hash(challenge))
+	if err != nil {
+		if errors.Is(err, storage.ErrConsentRequestNotFound) {
+			return AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, ErrInvalidConsent)
+		}
+		log.Error("failed to use consent request", slog.Any("error", err))
+		return AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, err)
+	}
+	if consentReq.Expired(time.Now()) {
+		return AuthorizeRequest{}, "", fmt.Errorf("%s: %w", op, ErrInvalidConsent)
+	}
+
+	log = log.With(slog.Int("client_id", consentReq.AppID), slog.Int64("user_id", consentReq.UserID))
+
+	req := AuthorizeRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            consentReq.AppID,
+		RedirectURI:         consentReq.RedirectURI,
+		Scopes:              consentReq.Scopes,
+		State:               consentReq.State,
+		CodeChallenge:       consentReq.CodeChallenge,
+		CodeChallengeMethod: consentReq.CodeChallengeMethod,
+		Nonce:               consentReq.Nonce,
+	}
+
+	if !approve {
+		log.Info("consent denied")
+		return req, "", fmt.Errorf("%s: %w", op, errorf(ErrAccessDenied, "the user denied the request"))
+	}
+
+	if err := o.grantConsent(ctx, consentReq.UserID, consentReq.AppID, consentReq.Scopes); err != nil {
+		log.Error("failed to save consent", slog.Any("error", err))
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("consent given", slog.Any("scopes", consentReq.Scopes))
+
+	code, err := o.issueCode(ctx, log, req, consentReq.UserID, consentReq.AuthTime, consentReq.AMR)
+	if err != nil {
+		return req, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return req, code, nil
+}
+
+// ListConsents returns the consents the user gave to third-party apps.
+func (o *OAuth) ListConsents(ctx context.Context, userId int64) ([]entity.Consent, error) {
+	const op = "oauth.ListConsents"
+
+	consents, err := o.consentStorage.Consents(ctx, userId)
+	if err != nil {
+		o.log.Error("failed to list consents", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return consents, nil
+}
+
+// RevokeConsent withdraws the consent of the user to the app. The codes the
+// app has not exchanged yet are revoked with it, and the access tokens it was
+// issued are no longer accepted at userinfo and token exchange, and are
+// inactive at introspection. The app must ask for consent again.
+//
+// Access tokens are not stored: resource servers verifying them on their own
+// accept them until they expire, which third-party app tokens do quickly.
+func (o *OAuth) RevokeConsent(ctx context.Context, userId int64, appId int) error {
+	const op = "oauth.RevokeConsent"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+		slog.Int("app_id", appId),
+	)
+
+	if err := o.consentStorage.RevokeConsent(ctx, userId, appId); err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrConsentNotFound)
+		}
+		log.Error("failed to revoke consent", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("consent revoked")
+
+	return nil
+}
+
+// authorize completes an authorization request for a user who just logged in
+// with the amr methods. A third-party app gets a code only for scopes the user
+// consented to, otherwise the user is asked first.
+func (o *OAuth) authorize(
+	ctx context.Context,
+	log *slog.Logger,
+	req AuthorizeRequest,
+	userId int64,
+	amr []string,
+) (Authorization, error) {
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	authTime := time.Now()
+
+	if app.Settings.ThirdParty {
+		consent, err := o.consentStorage.Consent(ctx, userId, app.ID)
+		if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+			log.Error("failed to get consent", slog.Any("error", err))
+			return Authorization{}, err
+		}
+
+		if err != nil || !consent.Covers(req.Scopes) {
+			prompt, err := o.askConsent(ctx, log, app, req, userId, authTime, amr)
+			if err != nil {
+				return Authorization{}, err
+			}
+			return Authorization{Consent: prompt}, nil
+		}
+	}
+
+	code, err := o.issueCode(ctx, log, req, userId, authTime, amr)
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	return Authorization{Code: code}, nil
+}
+
+// askConsent stores the authorization request until the user answers the
+// consent prompt returned.
+func (o *OAuth) askConsent(
+	ctx context.Context,
+	log *slog.Logger,
+	app entity.App,
+	req AuthorizeRequest,
+	userId int64,
+	authTime time.Time,
+	amr []string,
+) (*ConsentPrompt, error) {
+	challenge, err := newCode()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = o.consentStorage.SaveConsentRequest(ctx, entity.ConsentRequest{
+		ChallengeHash:       hash(challenge),
+		AppID:               app.ID,
+		UserID:              userId,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              req.Scopes,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            authTime,
+		AMR:                 amr,
+		ExpiresAt:           authTime.Add(o.cfg.ConsentTTL),
+	})
+	if err != nil {
+		log.Error("failed to save consent request", slog.Any("error", err))
+		return nil, err
+	}
+
+	log.Info("consent required", slog.Int64("user_id", userId))
+
+	return &ConsentPrompt{
+		Challenge: challenge,
+		AppName:   app.Name,
+		Scopes:    req.Scopes,
+	}, nil
+}
+
+// grantConsent adds the scopes to the consent of the user to the app, creating
+// it if needed.
+func (o *OAuth) grantConsent(ctx context.Context, userId int64, appId int, scopes []string) error {
+	consent, err := o.consentStorage.Consent(ctx, userId, appId)
+	if err != nil && !errors.Is(err, storage.ErrConsentNotFound) {
+		return err
+	}
+
+	if err != nil {
+		grantId, err := newCode()
+		if err != nil {
+			return err
+		}
+		consent = entity.Consent{UserID: userId, AppID: appId, GrantID: grantId}
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+
+	return o.consentStorage.SaveConsent(ctx, consent)
+}
+
+// consentCurrent reports whether the user still consents to the third-party
+// app under the grant a token was issued with. A consent given again after a
+// revoke is a new grant: it doesn't cover the tokens issued under the old one.
+func (o *OAuth) consentCurrent(ctx context.Context, userId int64, appId int, grantId string) (bool, error) {
+	consent, err := o.consentStorage.Consent(ctx, userId, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrConsentNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return grantId != "" && consent.GrantID == grantId, nil
+}
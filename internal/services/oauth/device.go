@@ -0,0 +1,328 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const (
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// userCodeAlphabet has no vowels, so user codes don't spell words, and no
+	// easily confused characters (RFC 8628, section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// userCodeAttempts is how many user codes are tried before giving up on collisions.
+	userCodeAttempts = 5
+	// slowDownStep is added to the poll interval of a device polling too often.
+	slowDownStep = 5 * time.Second
+)
+
+// ErrInvalidUserCode means the user code entered is unknown, already used or expired.
+var ErrInvalidUserCode = errors.New("invalid or expired user code")
+
+type DeviceStorage interface {
+	SaveDeviceCode(ctx context.Context, code entity.DeviceCode) (int64, error)
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (entity.DeviceCode, error)
+	DecideDeviceCode(
+		ctx context.Context,
+		userCode string,
+		status string,
+		userId int64,
+		authTime time.Time,
+		amr []string,
+	) error
+	PollDeviceCode(ctx context.Context, hash []byte) (entity.DeviceCode, error)
+	SetDevicePollInterval(ctx context.Context, id int64, interval time.Duration) error
+}
+
+// DeviceAuthorization is the response of the device authorization endpoint.
+// The device shows the user code and verification URI to the user and polls
+// the token endpoint with the device code.
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// DeviceRequest is a pending device authorization as shown to the user asked to approve it.
+type DeviceRequest struct {
+	UserCode string
+	AppName  string
+	Scopes   []string
+}
+
+// AuthorizeDevice starts a device authorization (RFC 8628, section 3.1). Only
+// the client authentication fields and Scopes of the request are used. The
+// scopes must be OpenID Connect scopes or user scopes of the app.
+func (o *OAuth) AuthorizeDevice(ctx context.Context, req TokenRequest) (DeviceAuthorization, error) {
+	const op = "oauth.AuthorizeDevice"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	app, err := o.authenticateClient(ctx, req, false)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkGrant(app, GrantTypeDeviceCode); err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkUserScopes(app, req.Scopes); err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deviceCode, err := newCode()
+	if err != nil {
+		return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code := entity.DeviceCode{
+		DeviceCodeHash: hash(deviceCode),
+		AppID:          app.ID,
+		Scopes:         req.Scopes,
+		PollInterval:   o.cfg.DevicePollInterval,
+		ExpiresAt:      time.Now().Add(o.cfg.DeviceCodeTTL),
+	}
+
+	for attempt := 1; ; attempt++ {
+		if code.UserCode, err = newUserCode(); err != nil {
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		_, err = o.deviceStorage.SaveDeviceCode(ctx, code)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, storage.ErrUserCodeExists) || attempt == userCodeAttempts {
+			log.Error("failed to save device code", slog.Any("error", err))
+			return DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("device authorization started")
+
+	userCode := formatUserCode(code.UserCode)
+	verificationURI := o.issuer + DeviceVerificationPath
+
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               o.cfg.DeviceCodeTTL,
+		Interval:                o.cfg.DevicePollInterval,
+	}, nil
+}
+
+// LookupDevice returns the pending device authorization with the user code,
+// for the user to check what they are about to approve.
+func (o *OAuth) LookupDevice(ctx context.Context, userCode string) (DeviceRequest, error) {
+	const op = "oauth.LookupDevice"
+
+	code, err := o.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return DeviceRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := o.appProvider.App(ctx, code.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return DeviceRequest{}, fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+		}
+		return DeviceRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return DeviceRequest{
+		UserCode: formatUserCode(code.UserCode),
+		AppName:  app.Name,
+		Scopes:   code.Scopes,
+	}, nil
+}
+
+// VerifyDevice logs the user in and records whether they approve the device
+// with the user code. Wrong credentials return ErrLoginFailed, a user the app
+// doesn't let in ErrAccessDenied.
+func (o *OAuth) VerifyDevice(ctx context.Context, userCode string, email string, password string, approve bool) error {
+	const op = "oauth.VerifyDevice"
+
+	log := o.log.With(slog.String("op", op))
+
+	code, err := o.pendingDeviceCode(ctx, userCode)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int("client_id", code.AppID))
+
+	user, amr, err := o.login(ctx, log, email, password, code.AppID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	status := entity.DeviceCodeDenied
+	if approve {
+		status = entity.DeviceCodeApproved
+
+		// Approving the device of a third-party app is consenting to it.
+		app, err := o.appProvider.App(ctx, code.AppID)
+		if err != nil {
+			if errors.Is(err, storage.ErrAppNotFound) {
+				return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if app.Settings.ThirdParty {
+			if err := o.grantConsent(ctx, user.ID, app.ID, code.Scopes); err != nil {
+				log.Error("failed to save consent", slog.Any("error", err))
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	if err := o.deviceStorage.DecideDeviceCode(ctx, code.UserCode, status, user.ID, time.Now(), amr); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrInvalidUserCode)
+		}
+		log.Error("failed to save device decision", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("device authorization decided", slog.Int64("user_id", user.ID), slog.String("status", status))
+
+	return nil
+}
+
+// DeviceToken answers a poll of the device (RFC 8628, section 3.4). Until the
+// user decides it fails with ErrAuthorizationPending, or ErrSlowDown if the
+// device polls faster than its interval, which then grows.
+func (o *OAuth) DeviceToken(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	const op = "oauth.DeviceToken"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if req.GrantType != GrantTypeDeviceCode {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+
+	app, err := o.authenticateClient(ctx, req, false)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkGrant(app, GrantTypeDeviceCode); err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if req.DeviceCode == "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "device_code is required"))
+	}
+
+	code, err := o.deviceStorage.PollDeviceCode(ctx, hash(req.DeviceCode))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "invalid device code"))
+		}
+		log.Error("failed to poll device code", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	switch {
+	case code.AppID != app.ID:
+		log.Warn("device code presented by another client", slog.Int("code_client_id", code.AppID))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "invalid device code"))
+	case code.Expired(now):
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrExpiredToken)
+	case code.Status == entity.DeviceCodeDenied:
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrAccessDenied, "the user denied the request"))
+	case code.Status == entity.DeviceCodePending:
+		if !code.LastPolledAt.IsZero() && now.Sub(code.LastPolledAt) < code.PollInterval {
+			if err := o.deviceStorage.SetDevicePollInterval(ctx, code.ID, code.PollInterval+slowDownStep); err != nil {
+				log.Error("failed to slow down device", slog.Any("error", err))
+			}
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrSlowDown)
+		}
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrAuthorizationPending)
+	}
+
+	resp, err := o.issueUserTokens(ctx, log, grant{
+		userId:   code.UserID,
+		appId:    code.AppID,
+		authTime: code.AuthTime,
+		amr:      code.AMR,
+		scopes:   code.Scopes,
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("device authorized", slog.Int64("user_id", code.UserID))
+
+	return resp, nil
+}
+
+// pendingDeviceCode returns the device code with the user code if it still
+// waits for the decision of a user.
+func (o *OAuth) pendingDeviceCode(ctx context.Context, userCode string) (entity.DeviceCode, error) {
+	code, err := o.deviceStorage.DeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			return entity.DeviceCode{}, ErrInvalidUserCode
+		}
+		return entity.DeviceCode{}, err
+	}
+
+	if code.Status != entity.DeviceCodePending || code.Expired(time.Now()) {
+		return entity.DeviceCode{}, ErrInvalidUserCode
+	}
+
+	return code, nil
+}
+
+func newUserCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// formatUserCode splits the user code in two halves to make it easier to type.
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode undoes formatUserCode and forgives the case and spacing
+// the user typed the code with.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
@@ -0,0 +1,63 @@
+package oauth
+
+import "fmt"
+
+// Error is an OAuth 2.0 error response (RFC 6749, sections 4.1.2.1 and 5.2).
+// Errors match each other by code, so errors.Is(err, ErrInvalidGrant) holds
+// whatever the description.
+type Error struct {
+	Code        string
+	Description string
+	// unsafeRedirect marks errors about the redirect URI, see Redirectable.
+	unsafeRedirect bool
+}
+
+var (
+	ErrInvalidRequest          = &Error{Code: "invalid_request"}
+	ErrInvalidClient           = &Error{Code: "invalid_client"}
+	ErrInvalidGrant            = &Error{Code: "invalid_grant"}
+	ErrUnauthorizedClient      = &Error{Code: "unauthorized_client"}
+	ErrUnsupportedGrantType    = &Error{Code: "unsupported_grant_type"}
+	ErrUnsupportedResponseType = &Error{Code: "unsupported_response_type"}
+	ErrInvalidScope            = &Error{Code: "invalid_scope"}
+	ErrAccessDenied            = &Error{Code: "access_denied"}
+
+	// Errors of the device authorization grant (RFC 8628, section 3.5).
+	ErrAuthorizationPending = &Error{Code: "authorization_pending"}
+	ErrSlowDown             = &Error{Code: "slow_down"}
+	ErrExpiredToken         = &Error{Code: "expired_token"}
+
+	// ErrInvalidTarget is the token exchange error about the audience (RFC 8693, section 2.2.2).
+	ErrInvalidTarget = &Error{Code: "invalid_target"}
+
+	// ErrRedirectURIMismatch is the error about a redirect URI not registered for
+	// the client. It is shown to the user, never sent to the redirect URI.
+	ErrRedirectURIMismatch = &Error{
+		Code:           "invalid_request",
+		Description:    "redirect_uri is not registered for the client",
+		unsafeRedirect: true,
+	}
+
+	// Errors of resource endpoints like userinfo (RFC 6750, section 3.1).
+	ErrInvalidToken      = &Error{Code: "invalid_token"}
+	ErrInsufficientScope = &Error{Code: "insufficient_scope"}
+)
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+
+	return ok && t.Code == e.Code
+}
+
+// errorf returns a copy of the error with the description set.
+func errorf(base *Error, format string, args ...any) *Error {
+	return &Error{Code: base.Code, Description: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,117 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+)
+
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// Token types of the token exchange grant (RFC 8693, section 3). Access
+	// tokens are JWTs, so both are accepted for subject and actor tokens.
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchange exchanges a user token of one app for a token of the app named
+// by Audience, or of the client when empty (RFC 8693). The client must be
+// either of the two apps; the target app's trust policy decides the rest, see
+// auth.ExchangeToken.
+func (o *OAuth) TokenExchange(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	const op = "oauth.TokenExchange"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if req.GrantType != GrantTypeTokenExchange {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+
+	app, err := o.authenticateClient(ctx, req, true)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkGrant(app, GrantTypeTokenExchange); err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if req.SubjectToken == "" || !validTokenType(req.SubjectTokenType) {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op,
+			errorf(ErrInvalidRequest, "subject_token with an access_token or jwt subject_token_type is required"))
+	}
+	if req.ActorToken != "" && !validTokenType(req.ActorTokenType) {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op,
+			errorf(ErrInvalidRequest, "actor_token_type must be access_token or jwt"))
+	}
+	if req.ActorToken == "" && req.ActorTokenType != "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "actor_token_type without actor_token"))
+	}
+
+	targetId := app.ID
+	if req.Audience != "" {
+		if targetId, err = strconv.Atoi(req.Audience); err != nil {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidTarget, "unknown audience"))
+		}
+	}
+
+	// The app id is only compared here; the token is verified by the authenticator.
+	sourceId, err := jwt.UnverifiedAppID(req.SubjectToken)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "invalid subject token"))
+	}
+	if app.ID != sourceId && app.ID != targetId {
+		log.Warn("client is not a party of the exchange", slog.Int("source_id", sourceId), slog.Int("target_id", targetId))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op,
+			errorf(ErrUnauthorizedClient, "the client must be the subject token's app or the audience"))
+	}
+
+	token, expiresIn, err := o.authenticator.ExchangeToken(ctx, req.SubjectToken, req.ActorToken, targetId, req.Scopes)
+	if err != nil {
+		log.Info("token exchange failed", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, exchangeError(err))
+	}
+
+	log.Info("token exchanged", slog.Int("source_id", sourceId), slog.Int("target_id", targetId))
+
+	return TokenResponse{
+		AccessToken:     token,
+		TokenType:       TokenTypeBearer,
+		IssuedTokenType: TokenTypeAccessToken,
+		ExpiresIn:       expiresIn,
+		Scopes:          req.Scopes,
+	}, nil
+}
+
+func validTokenType(tokenType string) bool {
+	return tokenType == TokenTypeAccessToken || tokenType == TokenTypeJWT
+}
+
+// exchangeError converts an error of the authenticator to the token exchange error response.
+func exchangeError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken):
+		return errorf(ErrInvalidGrant, "invalid subject or actor token")
+	case errors.Is(err, auth.ErrInvalidAppId):
+		return errorf(ErrInvalidTarget, "unknown audience")
+	case errors.Is(err, auth.ErrExchangeNotAllowed):
+		return errorf(ErrInvalidTarget, "the audience doesn't accept tokens of this app")
+	case errors.Is(err, auth.ErrScopeNotGranted):
+		return errorf(ErrInvalidScope, "the scope exceeds the subject token's")
+	case errors.Is(err, auth.ErrEmailDomainNotAllowed),
+		errors.Is(err, auth.ErrLoginMethodNotAllowed),
+		errors.Is(err, auth.ErrStepUpRequired):
+		return errorf(ErrInvalidGrant, "the user may not use the audience with this token")
+	case errors.Is(err, auth.ErrConsentRequired):
+		return errorf(ErrInvalidGrant, "the user has not consented to the audience")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// Introspect tells a resource server whether the access token of the request
+// is active, and returns its claims if it is (RFC 7662, section 2.2). Unlike
+// checking the signature on its own, it catches tokens revoked before they
+// expire: those of disabled users, of revoked sessions, of revoked personal
+// access tokens, and of third-party apps the user withdrew the consent to.
+//
+// The caller must authenticate as a confidential first-party client: the
+// claims of a token are not for third-party apps to see.
+func (o *OAuth) Introspect(ctx context.Context, req TokenRequest) (map[string]any, error) {
+	const op = "oauth.Introspect"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	caller, err := o.authenticateClient(ctx, req, true)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if caller.Settings.ThirdParty {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrUnauthorizedClient, "third-party clients may not introspect tokens"))
+	}
+
+	claims, active, err := o.activeToken(ctx, req.Token)
+	if err != nil {
+		log.Error("failed to check token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !active {
+		return map[string]any{"active": false}, nil
+	}
+
+	resp := make(map[string]any, len(claims)+4)
+	for name, value := range claims {
+		resp[name] = value
+	}
+	resp["active"] = true
+	resp["token_type"] = "Bearer"
+	resp["client_id"] = strconv.Itoa(jwt.AppID(claims))
+	resp["iss"] = o.issuer
+
+	return resp, nil
+}
+
+// activeToken returns the claims of an access token and whether it is still
+// accepted. Only storage failures are returned as errors.
+func (o *OAuth) activeToken(ctx context.Context, token string) (map[string]any, bool, error) {
+	claims, err := jwt.Parse(token, o.signingKey.Public())
+	if err != nil {
+		return nil, false, nil
+	}
+
+	app, err := o.appProvider.App(ctx, jwt.AppID(claims))
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	// A client credentials token has no user behind it.
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return claims, true, nil
+	}
+
+	user, err := o.userProvider.UserByID(ctx, int64(uid))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if user.Status == entity.UserStatusDisabled || user.TokenRevoked(jwt.IssuedAt(claims)) {
+		return nil, false, nil
+	}
+	if active, err := o.personalAccessTokenActive(ctx, claims, user.ID); err != nil || !active {
+		return nil, false, err
+	}
+
+	if app.Settings.ThirdParty {
+		grantId, _ := claims["consent_id"].(string)
+		consented, err := o.consentCurrent(ctx, user.ID, app.ID, grantId)
+		if err != nil || !consented {
+			return nil, false, err
+		}
+	}
+
+	return claims, true, nil
+}
+
+// personalAccessTokenActive reports whether the personal access token a user
+// token was given in exchange for is still active. Other tokens are.
+func (o *OAuth) personalAccessTokenActive(ctx context.Context, claims map[string]any, userId int64) (bool, error) {
+	tokenId, ok := jwt.PersonalAccessTokenID(claims)
+	if !ok {
+		return true, nil
+	}
+
+	token, err := o.userProvider.PersonalAccessToken(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return token.UserID == userId && token.Active(time.Now()), nil
+}
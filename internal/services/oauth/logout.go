@@ -0,0 +1,76 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+)
+
+// LogoutRequest is a request to the logout endpoint (OpenID Connect
+// RP-Initiated Logout 1.0, section 2). Every field is optional, but a post-logout
+// redirect URI needs the client to be named by the ID token hint or its id.
+type LogoutRequest struct {
+	IDTokenHint           string
+	ClientID              int
+	PostLogoutRedirectURI string
+}
+
+// Logout checks where to send the user after the client logged them out, and
+// returns the URI, or an empty string to show that they are signed out.
+//
+// The server keeps no browser session, users log in again at every
+// authorization, so there is nothing to end here. The endpoint only exists to
+// bring the user back to a registered post-logout redirect URI. Errors must be
+// shown to the user rather than sent to the URI.
+func (o *OAuth) Logout(ctx context.Context, req LogoutRequest) (string, error) {
+	const op = "oauth.Logout"
+
+	log := o.log.With(slog.String("op", op))
+
+	clientId := req.ClientID
+	if req.IDTokenHint != "" {
+		claims, err := jwt.ParseIDToken(req.IDTokenHint, o.signingKey.Public(), o.issuer)
+		if err != nil {
+			log.Info("invalid id token hint", slog.Any("error", err))
+			return "", fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "invalid id_token_hint"))
+		}
+
+		aud, _ := claims["aud"].(string)
+		hinted, err := strconv.Atoi(aud)
+		if err != nil || clientId != 0 && hinted != clientId {
+			return "", fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "id_token_hint was not issued to the client"))
+		}
+		clientId = hinted
+	}
+
+	if req.PostLogoutRedirectURI == "" {
+		return "", nil
+	}
+	if clientId == 0 {
+		return "", fmt.Errorf("%s: %w", op,
+			errorf(ErrInvalidRequest, "post_logout_redirect_uri requires id_token_hint or client_id"))
+	}
+
+	app, err := o.client(ctx, clientId)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	uris, err := o.appProvider.PostLogoutRedirectURIs(ctx, app.ID)
+	if err != nil {
+		log.Error("failed to get post-logout redirect uris", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !redirectURIAllowed(uris, req.PostLogoutRedirectURI, app.Settings.LoopbackAnyPort) {
+		return "", fmt.Errorf("%s: %w", op,
+			errorf(ErrInvalidRequest, "post_logout_redirect_uri is not registered for the client"))
+	}
+
+	log.Info("user logged out", slog.Int("client_id", app.ID))
+
+	return req.PostLogoutRedirectURI, nil
+}
@@ -0,0 +1,809 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_oauth.go -package=oauth . Authenticator,AppProvider,UserProvider,CodeStorage,AssertionStorage,DeviceStorage,ConsentStorage
+
+const (
+	ResponseTypeCode           = "code"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+	TokenTypeBearer            = "Bearer"
+
+	// ClientAssertionTypeJWTBearer is the client_assertion_type of private key
+	// JWT client authentication (RFC 7523).
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	codeBytes = 32
+	// maxAssertionLifetime bounds how far in the future a client assertion may
+	// expire, and so how long its jti has to be remembered.
+	maxAssertionLifetime = 10 * time.Minute
+)
+
+// ErrLoginFailed means the user entered wrong credentials. The login form is
+// shown again instead of sending an error to the client.
+var ErrLoginFailed = errors.New("invalid email or password")
+
+type OAuth struct {
+	log              *slog.Logger
+	authenticator    Authenticator
+	appProvider      AppProvider
+	userProvider     UserProvider
+	codeStorage      CodeStorage
+	assertionStorage AssertionStorage
+	deviceStorage    DeviceStorage
+	consentStorage   ConsentStorage
+	signingKey       *jwk.Key
+	issuer           string
+	audiences        []string
+	cfg              Config
+}
+
+// Config holds the settings of the authorization server.
+type Config struct {
+	// Issuer is the base URL of the server. Client assertions must be addressed
+	// to it or to its token endpoint.
+	Issuer string
+	// CodeTTL is how long an authorization code can be exchanged.
+	CodeTTL time.Duration
+	// DeviceCodeTTL is how long the user has to approve a device.
+	DeviceCodeTTL time.Duration
+	// DevicePollInterval is the minimal time between two polls of a device.
+	DevicePollInterval time.Duration
+	// ConsentTTL is how long the user has to consent to a third-party app after logging in.
+	ConsentTTL time.Duration
+	// Registration advertises the dynamic client registration endpoint in discovery.
+	Registration bool
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, email string, password string, appId int) (entity.User, []string, error)
+	AuthenticateUser(ctx context.Context, userId int64, appId int, amr []string) (entity.User, error)
+	IssueToken(
+		ctx context.Context,
+		userId int64,
+		appId int,
+		authTime time.Time,
+		amr []string,
+		scopes []string,
+	) (string, time.Duration, error)
+	IssueClientToken(ctx context.Context, appId int, scopes []string) (string, time.Duration, error)
+	ExchangeToken(
+		ctx context.Context,
+		subjectToken string,
+		actorToken string,
+		appId int,
+		scopes []string,
+	) (string, time.Duration, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appId int) (entity.App, error)
+	RedirectURIs(ctx context.Context, appId int) ([]string, error)
+	PostLogoutRedirectURIs(ctx context.Context, appId int) ([]string, error)
+	WebOrigins(ctx context.Context, appId int) ([]string, error)
+	OriginAllowed(ctx context.Context, origin string) (bool, error)
+}
+
+type CodeStorage interface {
+	SaveAuthorizationCode(ctx context.Context, code entity.AuthorizationCode) (int64, error)
+	UseAuthorizationCode(ctx context.Context, hash []byte) (entity.AuthorizationCode, error)
+}
+
+type AssertionStorage interface {
+	SaveClientAssertion(ctx context.Context, appId int, jti string, expiresAt time.Time) error
+}
+
+// AuthorizeRequest is a request to the authorization endpoint.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            int
+	RedirectURI         string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// TokenRequest is a request to the token endpoint. Clients authenticate with
+// ClientSecret or with a private key JWT in ClientAssertion, in which case
+// ClientID may be left zero. Public clients send neither and are
+// authenticated by PKCE alone.
+type TokenRequest struct {
+	GrantType           string
+	ClientID            int
+	ClientSecret        string
+	ClientAssertionType string
+	ClientAssertion     string
+	Code                string
+	RedirectURI         string
+	CodeVerifier        string
+	DeviceCode          string
+	SubjectToken        string
+	SubjectTokenType    string
+	ActorToken          string
+	ActorTokenType      string
+	Audience            string
+	Scopes              []string
+	// Token is the token to introspect, see Introspect.
+	Token string
+	// Origin is the Origin header of a request made by browser code. It is
+	// empty for requests from servers and native apps.
+	Origin string
+}
+
+// TokenResponse is a successful token response. IDToken is only set when the
+// openid scope was granted, and IssuedTokenType only by the token exchange grant.
+type TokenResponse struct {
+	AccessToken     string
+	TokenType       string
+	IssuedTokenType string
+	ExpiresIn       time.Duration
+	Scopes          []string
+	IDToken         string
+}
+
+// New returns a new instance of the OAuth authorization server and OpenID
+// provider. ID tokens are signed with the signing key, which must be the one
+// the authenticator signs access tokens with: userinfo verifies them with it.
+func New(
+	log *slog.Logger,
+	authenticator Authenticator,
+	appProvider AppProvider,
+	userProvider UserProvider,
+	codeStorage CodeStorage,
+	assertionStorage AssertionStorage,
+	deviceStorage DeviceStorage,
+	consentStorage ConsentStorage,
+	signingKey *jwk.Key,
+	cfg Config,
+) *OAuth {
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &OAuth{
+		log:              log,
+		authenticator:    authenticator,
+		appProvider:      appProvider,
+		userProvider:     userProvider,
+		codeStorage:      codeStorage,
+		assertionStorage: assertionStorage,
+		deviceStorage:    deviceStorage,
+		consentStorage:   consentStorage,
+		signingKey:       signingKey,
+		issuer:           issuer,
+		audiences:        []string{issuer, issuer + TokenPath},
+		cfg:              cfg,
+	}
+}
+
+// CheckAuthorizeRequest validates a request to the authorization endpoint.
+// The requested scopes must be OpenID Connect scopes or user scopes of the app.
+//
+// Errors about the client or its redirect URI must be shown to the user rather
+// than sent to the redirect URI, see Redirectable.
+func (o *OAuth) CheckAuthorizeRequest(ctx context.Context, req AuthorizeRequest) error {
+	const op = "oauth.CheckAuthorizeRequest"
+
+	app, err := o.checkClientRedirect(ctx, req.ClientID, req.RedirectURI)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return fmt.Errorf("%s: %w", op, errorf(ErrUnsupportedResponseType, "only the code response type is supported"))
+	}
+
+	if err := checkGrant(app, GrantTypeAuthorizationCode); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkUserScopes(app, req.Scopes); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// PKCE is mandatory, and only with S256: "plain" would send the verifier
+	// through the front channel.
+	if req.CodeChallenge == "" {
+		return fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "code_challenge is required"))
+	}
+	if req.CodeChallengeMethod != entity.CodeChallengeS256 {
+		return fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "code_challenge_method must be S256"))
+	}
+	if len(req.CodeChallenge) != base64.RawURLEncoding.EncodedLen(sha256.Size) {
+		return fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "malformed code_challenge"))
+	}
+
+	return nil
+}
+
+// Authorize logs the user in on behalf of the client and returns an
+// authorization code for it. The code is single-use and expires quickly.
+// A third-party client gets no code until the user consents, see Consent.
+//
+// Wrong credentials return ErrLoginFailed. A user the app doesn't let in
+// returns ErrAccessDenied.
+func (o *OAuth) Authorize(ctx context.Context, req AuthorizeRequest, email string, password string) (Authorization, error) {
+	const op = "oauth.Authorize"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if err := o.CheckAuthorizeRequest(ctx, req); err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, amr, err := o.login(ctx, log, email, password, req.ClientID)
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	authorization, err := o.authorize(ctx, log, req, user.ID, amr)
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authorization, nil
+}
+
+// AuthorizeUser returns an authorization code for a user who logged in
+// elsewhere with the amr methods, like at an upstream identity provider.
+// A third-party client gets no code until the user consents, see Consent.
+//
+// A user the app doesn't let in returns ErrAccessDenied.
+func (o *OAuth) AuthorizeUser(ctx context.Context, req AuthorizeRequest, userId int64, amr []string) (Authorization, error) {
+	const op = "oauth.AuthorizeUser"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if err := o.CheckAuthorizeRequest(ctx, req); err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := o.authenticator.AuthenticateUser(ctx, userId, req.ClientID, amr); err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, loginError(log, err))
+	}
+
+	authorization, err := o.authorize(ctx, log, req, userId, amr)
+	if err != nil {
+		return Authorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authorization, nil
+}
+
+// issueCode stores and returns an authorization code for the request, issued
+// to the user who logged in at authTime with the amr methods.
+func (o *OAuth) issueCode(
+	ctx context.Context,
+	log *slog.Logger,
+	req AuthorizeRequest,
+	userId int64,
+	authTime time.Time,
+	amr []string,
+) (string, error) {
+	code, err := newCode()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = o.codeStorage.SaveAuthorizationCode(ctx, entity.AuthorizationCode{
+		CodeHash:            hash(code),
+		AppID:               req.ClientID,
+		UserID:              userId,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              req.Scopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            authTime,
+		AMR:                 amr,
+		ExpiresAt:           now.Add(o.cfg.CodeTTL),
+	})
+	if err != nil {
+		log.Error("failed to save authorization code", slog.Any("error", err))
+		return "", err
+	}
+
+	log.Info("authorization code issued", slog.Int64("user_id", userId))
+
+	return code, nil
+}
+
+// Exchange redeems an authorization code for an access token.
+//
+// The code must be presented by the client it was issued to, with the same
+// redirect URI and the PKCE verifier of its challenge. A code is accepted once:
+// a second attempt fails even if the first one did too.
+func (o *OAuth) Exchange(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	const op = "oauth.Exchange"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if req.GrantType != GrantTypeAuthorizationCode {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+
+	app, err := o.authenticateClient(ctx, req, false)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkGrant(app, GrantTypeAuthorizationCode); err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if req.Code == "" || req.CodeVerifier == "" {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidRequest, "code and code_verifier are required"))
+	}
+
+	code, err := o.codeStorage.UseAuthorizationCode(ctx, hash(req.Code))
+	if err != nil {
+		if errors.Is(err, storage.ErrCodeNotFound) {
+			log.Warn("unknown or reused authorization code")
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "invalid authorization code"))
+		}
+		log.Error("failed to use authorization code", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case code.Expired(time.Now()):
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "authorization code expired"))
+	case code.AppID != app.ID:
+		log.Warn("authorization code presented by another client", slog.Int("code_client_id", code.AppID))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "invalid authorization code"))
+	case code.RedirectURI != req.RedirectURI:
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "redirect_uri does not match"))
+	case !verifyChallenge(code.CodeChallenge, req.CodeVerifier):
+		log.Warn("pkce verification failed")
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidGrant, "code_verifier does not match"))
+	}
+
+	resp, err := o.issueUserTokens(ctx, log, grant{
+		userId:   code.UserID,
+		appId:    code.AppID,
+		authTime: code.AuthTime,
+		amr:      code.AMR,
+		scopes:   code.Scopes,
+		nonce:    code.Nonce,
+	})
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code exchanged", slog.Int64("user_id", code.UserID))
+
+	return resp, nil
+}
+
+// ClientCredentials issues an access token to a client for itself (RFC 6749,
+// section 4.4). Only confidential clients can use it: the client must
+// authenticate with its secret or a private key JWT assertion.
+//
+// The requested scopes must be among the client scopes of the app. All of them
+// are granted when none are requested.
+func (o *OAuth) ClientCredentials(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	const op = "oauth.ClientCredentials"
+
+	log := o.log.With(slog.String("op", op), slog.Int("client_id", req.ClientID))
+
+	if req.GrantType != GrantTypeClientCredentials {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, ErrUnsupportedGrantType)
+	}
+
+	app, err := o.authenticateClient(ctx, req, true)
+	if err != nil {
+		log.Info("client authentication failed", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkGrant(app, GrantTypeClientCredentials); err != nil {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	allowed := app.Settings.ClientScopes
+	if len(allowed) == 0 {
+		return TokenResponse{}, fmt.Errorf("%s: %w", op,
+			errorf(ErrUnauthorizedClient, "the client credentials grant is not enabled for the client"))
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return TokenResponse{}, fmt.Errorf("%s: %w", op, errorf(ErrInvalidScope, "scope %q is not allowed for the client", scope))
+		}
+	}
+
+	token, expiresIn, err := o.authenticator.IssueClientToken(ctx, app.ID, scopes)
+	if err != nil {
+		log.Error("failed to issue token", slog.Any("error", err))
+		return TokenResponse{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("client token issued", slog.Int("app_id", app.ID))
+
+	return TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   expiresIn,
+		Scopes:      scopes,
+	}, nil
+}
+
+// grant is what a user let a client do: the tokens issued for it carry these claims.
+type grant struct {
+	userId   int64
+	appId    int
+	authTime time.Time
+	amr      []string
+	scopes   []string
+	nonce    string
+}
+
+// issueUserTokens issues the access token of the grant, and its ID token when
+// the openid scope was granted.
+func (o *OAuth) issueUserTokens(ctx context.Context, log *slog.Logger, g grant) (TokenResponse, error) {
+	token, expiresIn, err := o.authenticator.IssueToken(ctx, g.userId, g.appId, g.authTime, g.amr, g.scopes)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return TokenResponse{}, errorf(ErrInvalidGrant, "the user no longer exists")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return TokenResponse{}, errorf(ErrInvalidGrant, "the user is disabled")
+		}
+		if errors.Is(err, auth.ErrConsentRequired) {
+			return TokenResponse{}, errorf(ErrInvalidGrant, "the user revoked the consent to the client")
+		}
+		log.Error("failed to issue token", slog.Any("error", err))
+		return TokenResponse{}, err
+	}
+
+	resp := TokenResponse{
+		AccessToken: token,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   expiresIn,
+		Scopes:      g.scopes,
+	}
+
+	if slices.Contains(g.scopes, ScopeOpenID) {
+		user, err := o.userProvider.UserByID(ctx, g.userId)
+		if err != nil {
+			log.Error("failed to get user", slog.Any("error", err))
+			return TokenResponse{}, err
+		}
+
+		if resp.IDToken, err = o.idToken(user, g, expiresIn); err != nil {
+			log.Error("failed to sign id token", slog.Any("error", err))
+			return TokenResponse{}, err
+		}
+	}
+
+	return resp, nil
+}
+
+// login authenticates the user for the app. Wrong credentials return
+// ErrLoginFailed and a user the app doesn't let in ErrAccessDenied.
+func (o *OAuth) login(ctx context.Context, log *slog.Logger, email string, password string, appId int) (entity.User, []string, error) {
+	user, amr, err := o.authenticator.Authenticate(ctx, email, password, appId)
+	if err != nil {
+		return entity.User{}, nil, loginError(log, err)
+	}
+
+	return user, amr, nil
+}
+
+// loginError converts an authentication error to ErrLoginFailed or ErrAccessDenied.
+func loginError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return ErrLoginFailed
+	case errors.Is(err, auth.ErrEmailDomainNotAllowed),
+		errors.Is(err, auth.ErrLoginMethodNotAllowed),
+		errors.Is(err, auth.ErrStepUpRequired):
+		log.Info("user denied by app policy", slog.Any("error", err))
+		return errorf(ErrAccessDenied, "the user is not allowed to use this app")
+	case errors.Is(err, auth.ErrUserNotFound):
+		return errorf(ErrAccessDenied, "the user no longer exists")
+	}
+	log.Error("failed to authenticate", slog.Any("error", err))
+	return err
+}
+
+// Redirectable reports whether the authorization error may be sent to the
+// client's redirect URI. Errors about the client or the redirect URI itself
+// must not, or the authorization server would be an open redirector.
+func Redirectable(err error) bool {
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) {
+		return false
+	}
+
+	return !oauthErr.unsafeRedirect && oauthErr.Code != ErrInvalidClient.Code
+}
+
+// checkClientRedirect returns the app of the client if the redirect URI is
+// registered for it.
+func (o *OAuth) checkClientRedirect(ctx context.Context, clientId int, redirectURI string) (entity.App, error) {
+	app, err := o.client(ctx, clientId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	uris, err := o.appProvider.RedirectURIs(ctx, clientId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	if redirectURI == "" || !redirectURIAllowed(uris, redirectURI, app.Settings.LoopbackAnyPort) {
+		return entity.App{}, ErrRedirectURIMismatch
+	}
+
+	return app, nil
+}
+
+// redirectURIAllowed reports whether the URI is one of the registered ones.
+// URIs are compared exactly, except that with loopbackAnyPort the port of an
+// http loopback URI is ignored (RFC 8252, section 7.3).
+func redirectURIAllowed(registered []string, uri string, loopbackAnyPort bool) bool {
+	if slices.Contains(registered, uri) {
+		return true
+	}
+	if !loopbackAnyPort {
+		return false
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || !isLoopbackHTTP(u) {
+		return false
+	}
+
+	return slices.ContainsFunc(registered, func(r string) bool {
+		ru, err := url.Parse(r)
+		if err != nil || !isLoopbackHTTP(ru) || ru.Hostname() != u.Hostname() {
+			return false
+		}
+		ru.Host = u.Host
+		return ru.String() == uri
+	})
+}
+
+func isLoopbackHTTP(u *url.URL) bool {
+	return u.Scheme == "http" && isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkOrigin fails with ErrUnauthorizedClient unless browser code of the app
+// may call the endpoints from the origin. Requests without an origin pass.
+func (o *OAuth) checkOrigin(ctx context.Context, app entity.App, origin string) error {
+	if origin == "" {
+		return nil
+	}
+
+	origins, err := o.appProvider.WebOrigins(ctx, app.ID)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(origins, origin) {
+		return errorf(ErrUnauthorizedClient, "requests from %s are not allowed for the client", origin)
+	}
+
+	return nil
+}
+
+// OriginAllowed reports whether the origin is a web origin of any app, which
+// is all a CORS preflight request can be checked against. The endpoints then
+// check the origin against the app of the request.
+func (o *OAuth) OriginAllowed(ctx context.Context, origin string) (bool, error) {
+	const op = "oauth.OriginAllowed"
+
+	allowed, err := o.appProvider.OriginAllowed(ctx, origin)
+	if err != nil {
+		o.log.Error("failed to check origin", slog.String("op", op), slog.Any("error", err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed, nil
+}
+
+// checkGrant fails with ErrUnauthorizedClient unless the app may use the grant type.
+func checkGrant(app entity.App, grantType string) error {
+	if !app.Settings.AllowsGrant(grantType) {
+		return errorf(ErrUnauthorizedClient, "the client may not use the %s grant", grantType)
+	}
+
+	return nil
+}
+
+// checkUserScopes fails with ErrInvalidScope unless the app may request every
+// scope on behalf of a user: the OpenID Connect scopes or its user scopes.
+func checkUserScopes(app entity.App, scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(oidcScopes, scope) && !slices.Contains(app.Settings.UserScopes, scope) {
+			return errorf(ErrInvalidScope, "scope %q is not allowed for the client", scope)
+		}
+	}
+
+	return nil
+}
+
+// authenticateClient authenticates the client of a token request with its
+// secret or its client assertion and returns its app. A request made by
+// browser code must come from one of the web origins of the app.
+func (o *OAuth) authenticateClient(ctx context.Context, req TokenRequest, confidential bool) (entity.App, error) {
+	var (
+		app entity.App
+		err error
+	)
+	if req.ClientAssertionType != "" || req.ClientAssertion != "" {
+		if req.ClientSecret != "" {
+			return entity.App{}, errorf(ErrInvalidRequest, "only one client authentication method may be used")
+		}
+		app, err = o.verifyClientAssertion(ctx, req)
+	} else {
+		app, err = o.verifyClientSecret(ctx, req, confidential)
+	}
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	if err := o.checkOrigin(ctx, app, req.Origin); err != nil {
+		return entity.App{}, err
+	}
+
+	return app, nil
+}
+
+// verifyClientSecret authenticates the client with its secret. Without one the
+// client is only identified, which is enough for public clients relying on
+// PKCE, unless confidential is set or the app requires a client secret. A
+// public app must not send one.
+func (o *OAuth) verifyClientSecret(ctx context.Context, req TokenRequest, confidential bool) (entity.App, error) {
+	app, err := o.client(ctx, req.ClientID)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	switch {
+	case req.ClientSecret != "":
+		if app.Settings.TokenAuthMethod == entity.TokenAuthNone {
+			return entity.App{}, errorf(ErrInvalidClient, "the client is public and has no secret")
+		}
+		if subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(app.Secret)) != 1 {
+			return entity.App{}, errorf(ErrInvalidClient, "client authentication failed")
+		}
+	case confidential, app.Settings.TokenAuthMethod == entity.TokenAuthClientSecretBasic,
+		app.Settings.TokenAuthMethod == entity.TokenAuthClientSecretPost:
+		return entity.App{}, errorf(ErrInvalidClient, "client authentication required")
+	}
+
+	return app, nil
+}
+
+// verifyClientAssertion authenticates the client with a private key JWT
+// (RFC 7523). An assertion is accepted once.
+func (o *OAuth) verifyClientAssertion(ctx context.Context, req TokenRequest) (entity.App, error) {
+	if req.ClientAssertionType != ClientAssertionTypeJWTBearer {
+		return entity.App{}, errorf(ErrInvalidClient, "unsupported client_assertion_type")
+	}
+
+	clientId := req.ClientID
+	if clientId == 0 {
+		issuer, err := jwt.UnverifiedIssuer(req.ClientAssertion)
+		if err != nil {
+			return entity.App{}, errorf(ErrInvalidClient, "malformed client assertion")
+		}
+		if clientId, err = strconv.Atoi(issuer); err != nil {
+			return entity.App{}, errorf(ErrInvalidClient, "unknown client")
+		}
+	}
+
+	app, err := o.client(ctx, clientId)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	if app.Settings.ClientPublicKey == "" {
+		return entity.App{}, errorf(ErrInvalidClient, "the client has no public key registered")
+	}
+
+	claims, err := jwt.ParseClientAssertion(req.ClientAssertion, strconv.Itoa(app.ID), app.Settings.ClientPublicKey, o.audiences)
+	if err != nil {
+		o.log.Info("invalid client assertion", slog.Int("client_id", app.ID), slog.Any("error", err))
+		return entity.App{}, errorf(ErrInvalidClient, "invalid client assertion")
+	}
+
+	if time.Until(claims.ExpiresAt.Time) > maxAssertionLifetime {
+		return entity.App{}, errorf(ErrInvalidClient, "client assertion expires too late")
+	}
+
+	if err := o.assertionStorage.SaveClientAssertion(ctx, app.ID, claims.ID, claims.ExpiresAt.Time); err != nil {
+		if errors.Is(err, storage.ErrAssertionReplayed) {
+			o.log.Warn("client assertion replayed", slog.Int("client_id", app.ID))
+			return entity.App{}, errorf(ErrInvalidClient, "client assertion already used")
+		}
+		return entity.App{}, err
+	}
+
+	return app, nil
+}
+
+func (o *OAuth) client(ctx context.Context, clientId int) (entity.App, error) {
+	app, err := o.appProvider.App(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return entity.App{}, errorf(ErrInvalidClient, "unknown client")
+		}
+		return entity.App{}, err
+	}
+
+	return app, nil
+}
+
+// verifyChallenge checks the PKCE verifier against the S256 challenge (RFC 7636).
+func verifyChallenge(challenge string, verifier string) bool {
+	// 43 to 128 characters of the unreserved set.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	if strings.IndexFunc(verifier, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r))
+	}) >= 0 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// newCode returns a random single-use code to hand out to a client.
+func newCode() (string, error) {
+	secret := make([]byte, codeBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hash(code string) []byte {
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
@@ -0,0 +1,229 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signAssertion(t *testing.T, key *rsa.PrivateKey, claims jwt.RegisteredClaims) string {
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return assertion
+}
+
+func TestOAuth_clientCredentials(t *testing.T) {
+	prefixName := "oauth service"
+
+	key, publicKey := newClientKey(t)
+	otherKey, _ := newClientKey(t)
+
+	client := entity.App{ID: clientId, Secret: "secret", Settings: entity.AppSettings{
+		ClientScopes:    []string{"orders:read", "orders:write"},
+		ClientPublicKey: publicKey,
+	}}
+	claims := jwt.RegisteredClaims{
+		Issuer:    strconv.Itoa(clientId),
+		Subject:   strconv.Itoa(clientId),
+		Audience:  jwt.ClaimStrings{issuer + "/token"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		ID:        "assertion-1",
+	}
+	withAssertion := func(claims jwt.RegisteredClaims, key *rsa.PrivateKey) func(req TokenRequest) TokenRequest {
+		return func(req TokenRequest) TokenRequest {
+			req.ClientID = 0
+			req.ClientSecret = ""
+			req.ClientAssertionType = ClientAssertionTypeJWTBearer
+			req.ClientAssertion = signAssertion(t, key, claims)
+			return req
+		}
+	}
+
+	valid := TokenRequest{
+		GrantType:    GrantTypeClientCredentials,
+		ClientID:     clientId,
+		ClientSecret: "secret",
+	}
+	type test struct {
+		name       string
+		prepare    func(f *fields)
+		req        func(req TokenRequest) TokenRequest
+		wantScopes []string
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials success test: secret, all scopes"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil)
+				f.authenticator.EXPECT().IssueClientToken(gomock.Any(), clientId, client.Settings.ClientScopes).
+					Return("token", time.Hour, nil)
+			},
+			wantScopes: []string{"orders:read", "orders:write"},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials success test: requested scope"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil)
+				f.authenticator.EXPECT().IssueClientToken(gomock.Any(), clientId, []string{"orders:read"}).
+					Return("token", time.Hour, nil)
+			},
+			req:        func(req TokenRequest) TokenRequest { req.Scopes = []string{"orders:read"}; return req },
+			wantScopes: []string{"orders:read"},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials success test: private key jwt"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil)
+				f.assertionStorage.EXPECT().SaveClientAssertion(gomock.Any(), clientId, "assertion-1", gomock.Any()).Return(nil)
+				f.authenticator.EXPECT().IssueClientToken(gomock.Any(), clientId, gomock.Any()).Return("token", time.Hour, nil)
+			},
+			req:        withAssertion(claims, key),
+			wantScopes: []string{"orders:read", "orders:write"},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: no credentials"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req:     func(req TokenRequest) TokenRequest { req.ClientSecret = ""; return req },
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: wrong secret"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req:     func(req TokenRequest) TokenRequest { req.ClientSecret = "wrong"; return req },
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: unknown client"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(entity.App{}, storage.ErrAppNotFound)
+			},
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: grant not enabled"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(entity.App{ID: clientId, Secret: "secret"}, nil)
+			},
+			wantErr: ErrUnauthorizedClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: grant type not allowed"),
+			prepare: func(f *fields) {
+				restricted := client
+				restricted.Settings.GrantTypes = []string{GrantTypeAuthorizationCode}
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(restricted, nil)
+			},
+			wantErr: ErrUnauthorizedClient,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: scope not allowed"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req:     func(req TokenRequest) TokenRequest { req.Scopes = []string{"orders:read", "admin"}; return req },
+			wantErr: ErrInvalidScope,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: assertion signed with another key"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req:     withAssertion(claims, otherKey),
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: assertion for another audience"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req: func() func(req TokenRequest) TokenRequest {
+				other := claims
+				other.Audience = jwt.ClaimStrings{"https://elsewhere.example.com/token"}
+				return withAssertion(other, key)
+			}(),
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: long-lived assertion"),
+			prepare: func(f *fields) { f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil) },
+			req: func() func(req TokenRequest) TokenRequest {
+				other := claims
+				other.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+				return withAssertion(other, key)
+			}(),
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: replayed assertion"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(client, nil)
+				f.assertionStorage.EXPECT().SaveClientAssertion(gomock.Any(), clientId, "assertion-1", gomock.Any()).
+					Return(storage.ErrAssertionReplayed)
+			},
+			req:     withAssertion(claims, key),
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "client credentials negative test: secret and assertion"),
+			req: func(req TokenRequest) TokenRequest {
+				req = withAssertion(claims, key)(req)
+				req.ClientSecret = "secret"
+				return req
+			},
+			wantErr: ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			req := valid
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			resp, err := f.service().ClientCredentials(context.Background(), req)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, "token", resp.AccessToken)
+				assert.Equal(t, TokenTypeBearer, resp.TokenType)
+				assert.Equal(t, tt.wantScopes, resp.Scopes)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func (f *fields) thirdPartyClient() {
+	f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(entity.App{
+		ID:       clientId,
+		Name:     "Shop",
+		Secret:   "secret",
+		Settings: entity.AppSettings{ThirdParty: true},
+	}, nil).AnyTimes()
+	f.appProvider.EXPECT().RedirectURIs(gomock.Any(), clientId).Return([]string{redirectURI}, nil).AnyTimes()
+}
+
+func TestOAuth_authorizeThirdParty(t *testing.T) {
+	prefixName := "oauth service"
+	req := AuthorizeRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            clientId,
+		RedirectURI:         redirectURI,
+		Scopes:              []string{"openid", "email"},
+		State:               "xyz",
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: entity.CodeChallengeS256,
+		Nonce:               "n-0S6",
+	}
+	type test struct {
+		name        string
+		prepare     func(f *fields)
+		wantConsent bool
+		wantErr     error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize third-party success test: consent required"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{}, storage.ErrConsentNotFound)
+				f.consentStorage.EXPECT().SaveConsentRequest(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, consentReq entity.ConsentRequest) (int64, error) {
+						assert.Equal(t, int64(5), consentReq.UserID)
+						assert.Equal(t, clientId, consentReq.AppID)
+						assert.Equal(t, redirectURI, consentReq.RedirectURI)
+						assert.Equal(t, req.Scopes, consentReq.Scopes)
+						assert.Equal(t, "xyz", consentReq.State)
+						assert.Equal(t, req.CodeChallenge, consentReq.CodeChallenge)
+						assert.Equal(t, "n-0S6", consentReq.Nonce)
+						assert.Equal(t, []string{entity.AMRPassword}, consentReq.AMR)
+						assert.WithinDuration(t, time.Now().Add(10*time.Minute), consentReq.ExpiresAt, time.Second)
+						assert.Len(t, consentReq.ChallengeHash, sha256.Size)
+						return 1, nil
+					})
+			},
+			wantConsent: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize third-party success test: new scope requested"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, Scopes: []string{"openid"}}, nil)
+				f.consentStorage.EXPECT().SaveConsentRequest(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+			},
+			wantConsent: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize third-party success test: already consented"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, Scopes: []string{"email", "openid", "profile"}}, nil)
+				f.codeStorage.EXPECT().SaveAuthorizationCode(gomock.Any(), gomock.Any()).Return(int64(1), nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize third-party negative test: storage failure"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{}, errors.New("disk I/O error"))
+			},
+			wantErr: errors.New("disk I/O error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			f.thirdPartyClient()
+			f.authenticator.EXPECT().Authenticate(gomock.Any(), "a@mail.com", "password", clientId).
+				Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+			tt.prepare(f)
+
+			authorization, err := f.service().Authorize(context.Background(), req, "a@mail.com", "password")
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorContains(t, err, tt.wantErr.Error())
+			case tt.wantConsent:
+				assert.Nil(t, err)
+				assert.Empty(t, authorization.Code)
+				if assert.NotNil(t, authorization.Consent) {
+					assert.NotEmpty(t, authorization.Consent.Challenge)
+					assert.Equal(t, "Shop", authorization.Consent.AppName)
+					assert.Equal(t, req.Scopes, authorization.Consent.Scopes)
+				}
+			default:
+				assert.Nil(t, err)
+				assert.NotEmpty(t, authorization.Code)
+				assert.Nil(t, authorization.Consent)
+			}
+		})
+	}
+}
+
+func TestOAuth_consent(t *testing.T) {
+	prefixName := "oauth service"
+	const consentChallenge = "challenge"
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	pending := entity.ConsentRequest{
+		ID:                  1,
+		ChallengeHash:       hash(consentChallenge),
+		AppID:               clientId,
+		UserID:              5,
+		RedirectURI:         redirectURI,
+		Scopes:              []string{"openid", "email"},
+		State:               "xyz",
+		CodeChallenge:       "code-challenge",
+		CodeChallengeMethod: entity.CodeChallengeS256,
+		Nonce:               "n-0S6",
+		AuthTime:            authTime,
+		AMR:                 []string{entity.AMRPassword},
+		ExpiresAt:           time.Now().Add(time.Minute),
+	}
+	type test struct {
+		name         string
+		prepare      func(f *fields)
+		approve      bool
+		wantErr      error
+		redirectable bool
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "consent success test: approve"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().UseConsentRequest(gomock.Any(), hash(consentChallenge)).Return(pending, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, GrantID: "grant-1",
+						Scopes: []string{"openid", "profile"}}, nil)
+				f.consentStorage.EXPECT().SaveConsent(gomock.Any(), entity.Consent{
+					UserID:  5,
+					AppID:   clientId,
+					GrantID: "grant-1",
+					Scopes:  []string{"openid", "profile", "email"},
+				}).Return(nil)
+				f.codeStorage.EXPECT().SaveAuthorizationCode(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, code entity.AuthorizationCode) (int64, error) {
+						assert.Equal(t, int64(5), code.UserID)
+						assert.Equal(t, clientId, code.AppID)
+						assert.Equal(t, pending.Scopes, code.Scopes)
+						assert.Equal(t, "n-0S6", code.Nonce)
+						assert.Equal(t, authTime, code.AuthTime)
+						assert.Equal(t, pending.AMR, code.AMR)
+						return 1, nil
+					})
+			},
+			approve: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "consent negative test: deny"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().UseConsentRequest(gomock.Any(), hash(consentChallenge)).Return(pending, nil)
+			},
+			wantErr:      ErrAccessDenied,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "consent negative test: unknown or answered"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().UseConsentRequest(gomock.Any(), hash(consentChallenge)).
+					Return(entity.ConsentRequest{}, storage.ErrConsentRequestNotFound)
+			},
+			approve: true,
+			wantErr: ErrInvalidConsent,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "consent negative test: expired"),
+			prepare: func(f *fields) {
+				expired := pending
+				expired.ExpiresAt = time.Now().Add(-time.Second)
+				f.consentStorage.EXPECT().UseConsentRequest(gomock.Any(), hash(consentChallenge)).Return(expired, nil)
+			},
+			approve: true,
+			wantErr: ErrInvalidConsent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			tt.prepare(f)
+
+			req, code, err := f.service().Consent(context.Background(), consentChallenge, tt.approve)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, code)
+				assert.Equal(t, redirectURI, req.RedirectURI)
+				assert.Equal(t, "xyz", req.State)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				assert.Equal(t, tt.redirectable, Redirectable(err))
+				assert.Empty(t, code)
+			}
+		})
+	}
+}
+
+func TestOAuth_revokeConsent(t *testing.T) {
+	prefixName := "oauth service"
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revoke consent success test"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().RevokeConsent(gomock.Any(), int64(5), clientId).Return(nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "revoke consent negative test: not found"),
+			prepare: func(f *fields) {
+				f.consentStorage.EXPECT().RevokeConsent(gomock.Any(), int64(5), clientId).
+					Return(fmt.Errorf("storage.sqlite.RevokeConsent : %w", storage.ErrConsentNotFound))
+			},
+			wantErr: ErrConsentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			tt.prepare(f)
+
+			err := f.service().RevokeConsent(context.Background(), 5, clientId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestOAuth_listConsents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	consents := []entity.Consent{{UserID: 5, AppID: clientId, AppName: "Shop", Scopes: []string{"openid"}}}
+
+	f := newFields(ctrl)
+	f.consentStorage.EXPECT().Consents(gomock.Any(), int64(5)).Return(consents, nil)
+
+	got, err := f.service().ListConsents(context.Background(), 5)
+
+	assert.Nil(t, err)
+	assert.Equal(t, consents, got)
+}
@@ -0,0 +1,323 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth_authorizeDevice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := newFields(ctrl)
+	f.registeredClient()
+
+	var saved entity.DeviceCode
+	gomock.InOrder(
+		f.deviceStorage.EXPECT().SaveDeviceCode(gomock.Any(), gomock.Any()).Return(int64(0), storage.ErrUserCodeExists),
+		f.deviceStorage.EXPECT().SaveDeviceCode(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, code entity.DeviceCode) (int64, error) {
+				saved = code
+				return 1, nil
+			}),
+	)
+
+	resp, err := f.service().AuthorizeDevice(context.Background(), TokenRequest{
+		ClientID: clientId,
+		Scopes:   []string{ScopeOpenID},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, hash(resp.DeviceCode), saved.DeviceCodeHash)
+	assert.Equal(t, clientId, saved.AppID)
+	assert.Equal(t, []string{ScopeOpenID}, saved.Scopes)
+	assert.Equal(t, 5*time.Second, saved.PollInterval)
+	assert.Regexp(t, "^[B-Z]{4}-[B-Z]{4}$", resp.UserCode)
+	assert.Equal(t, saved.UserCode, strings.ReplaceAll(resp.UserCode, "-", ""))
+	assert.Equal(t, issuer+"/device", resp.VerificationURI)
+	assert.Equal(t, issuer+"/device?user_code="+resp.UserCode, resp.VerificationURIComplete)
+	assert.Equal(t, 10*time.Minute, resp.ExpiresIn)
+}
+
+func TestOAuth_authorizeDeviceScopeNotAllowed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := newFields(ctrl)
+	f.registeredClient()
+
+	_, err := f.service().AuthorizeDevice(context.Background(), TokenRequest{
+		ClientID: clientId,
+		Scopes:   []string{ScopeOpenID, "orders:read"},
+	})
+	assert.True(t, errors.Is(err, ErrInvalidScope), err)
+}
+
+func TestOAuth_verifyDevice(t *testing.T) {
+	prefixName := "oauth service"
+	pending := entity.DeviceCode{
+		ID:        1,
+		UserCode:  "BCDFGHJK",
+		AppID:     clientId,
+		Status:    entity.DeviceCodePending,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	withScopes := pending
+	withScopes.Scopes = []string{"profile"}
+	type test struct {
+		name     string
+		prepare  func(f *fields)
+		userCode string
+		approve  bool
+		wantErr  error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device success test: approve"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(pending, nil)
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "user@corp.com", "password", clientId).
+					Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+				f.deviceStorage.EXPECT().DecideDeviceCode(gomock.Any(), "BCDFGHJK", entity.DeviceCodeApproved, int64(5),
+					gomock.Any(), []string{entity.AMRPassword}).Return(nil)
+			},
+			userCode: " bcdf-ghjk ",
+			approve:  true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device success test: approve third-party app"),
+			prepare: func(f *fields) {
+				third := entity.App{ID: clientId, Name: "Shop", Settings: entity.AppSettings{ThirdParty: true}}
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(third, nil)
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(withScopes, nil)
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "user@corp.com", "password", clientId).
+					Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{}, storage.ErrConsentNotFound)
+				f.consentStorage.EXPECT().SaveConsent(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, consent entity.Consent) error {
+						assert.Equal(t, int64(5), consent.UserID)
+						assert.Equal(t, clientId, consent.AppID)
+						assert.Equal(t, []string{"profile"}, consent.Scopes)
+						assert.NotEmpty(t, consent.GrantID)
+						return nil
+					})
+				f.deviceStorage.EXPECT().DecideDeviceCode(gomock.Any(), "BCDFGHJK", entity.DeviceCodeApproved, int64(5),
+					gomock.Any(), []string{entity.AMRPassword}).Return(nil)
+			},
+			userCode: "BCDF-GHJK",
+			approve:  true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device success test: deny"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(pending, nil)
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "user@corp.com", "password", clientId).
+					Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+				f.deviceStorage.EXPECT().DecideDeviceCode(gomock.Any(), "BCDFGHJK", entity.DeviceCodeDenied, int64(5),
+					gomock.Any(), gomock.Any()).Return(nil)
+			},
+			userCode: "BCDF-GHJK",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: unknown code"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").
+					Return(entity.DeviceCode{}, storage.ErrDeviceCodeNotFound)
+			},
+			userCode: "BCDF-GHJK",
+			wantErr:  ErrInvalidUserCode,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: already decided"),
+			prepare: func(f *fields) {
+				decided := pending
+				decided.Status = entity.DeviceCodeApproved
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(decided, nil)
+			},
+			userCode: "BCDF-GHJK",
+			approve:  true,
+			wantErr:  ErrInvalidUserCode,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: expired"),
+			prepare: func(f *fields) {
+				expired := pending
+				expired.ExpiresAt = time.Now().Add(-time.Second)
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(expired, nil)
+			},
+			userCode: "BCDF-GHJK",
+			approve:  true,
+			wantErr:  ErrInvalidUserCode,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "verify device negative test: wrong password"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().DeviceCodeByUserCode(gomock.Any(), "BCDFGHJK").Return(pending, nil)
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "user@corp.com", "password", clientId).
+					Return(entity.User{}, nil, auth.ErrInvalidCredentials)
+			},
+			userCode: "BCDF-GHJK",
+			approve:  true,
+			wantErr:  ErrLoginFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			err := f.service().VerifyDevice(context.Background(), tt.userCode, "user@corp.com", "password", tt.approve)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestOAuth_deviceToken(t *testing.T) {
+	prefixName := "oauth service"
+	deviceCode := "device-code"
+	approved := entity.DeviceCode{
+		ID:           1,
+		AppID:        clientId,
+		Scopes:       []string{"profile"},
+		Status:       entity.DeviceCodeApproved,
+		UserID:       5,
+		AuthTime:     time.Now(),
+		AMR:          []string{entity.AMRPassword},
+		PollInterval: 5 * time.Second,
+		LastPolledAt: time.Now().Add(-time.Second),
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+	with := func(change func(code *entity.DeviceCode)) entity.DeviceCode {
+		code := approved
+		change(&code)
+		return code
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token success test"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).Return(approved, nil)
+				f.authenticator.EXPECT().IssueToken(gomock.Any(), int64(5), clientId, approved.AuthTime, approved.AMR, approved.Scopes).
+					Return("token", time.Hour, nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: pending"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) {
+						code.Status = entity.DeviceCodePending
+						code.LastPolledAt = time.Now().Add(-6 * time.Second)
+					}), nil)
+			},
+			wantErr: ErrAuthorizationPending,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: first poll"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) {
+						code.Status = entity.DeviceCodePending
+						code.LastPolledAt = time.Time{}
+					}), nil)
+			},
+			wantErr: ErrAuthorizationPending,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: polling too fast"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) { code.Status = entity.DeviceCodePending }), nil)
+				f.deviceStorage.EXPECT().SetDevicePollInterval(gomock.Any(), int64(1), 10*time.Second).Return(nil)
+			},
+			wantErr: ErrSlowDown,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: denied"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) { code.Status = entity.DeviceCodeDenied }), nil)
+			},
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: expired"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) { code.ExpiresAt = time.Now().Add(-time.Second) }), nil)
+			},
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: code of another client"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(with(func(code *entity.DeviceCode) { code.AppID = 3 }), nil)
+			},
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "device token negative test: unknown or used code"),
+			prepare: func(f *fields) {
+				f.deviceStorage.EXPECT().PollDeviceCode(gomock.Any(), hash(deviceCode)).
+					Return(entity.DeviceCode{}, storage.ErrDeviceCodeNotFound)
+			},
+			wantErr: ErrInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			f.registeredClient()
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			resp, err := f.service().DeviceToken(context.Background(), TokenRequest{
+				GrantType:  GrantTypeDeviceCode,
+				ClientID:   clientId,
+				DeviceCode: deviceCode,
+			})
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, "token", resp.AccessToken)
+				assert.Equal(t, []string{"profile"}, resp.Scopes)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth_introspect(t *testing.T) {
+	prefixName := "oauth service"
+	resourceServer := entity.App{ID: clientId, Secret: "secret"}
+	shop := entity.App{ID: 3, Secret: "shop-secret", Settings: entity.AppSettings{ThirdParty: true}}
+	user := entity.User{ID: 5, Email: "user@corp.com", Status: entity.UserStatusActive}
+	disabled := user
+	disabled.Status = entity.UserStatusDisabled
+	revoked := user
+	revoked.SessionsRevokedAt = time.Now().Add(time.Minute)
+
+	signedToken := func(key *jwk.Key, claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["iat"] = time.Now().Unix()
+		token, err := key.SignType("at+jwt", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	shopToken := signedToken(signingKey, jwt.MapClaims{
+		"uid": 5, "app_id": shop.ID, "scope": "openid orders:read", "consent_id": "grant-1",
+	})
+	userToken := signedToken(signingKey, jwt.MapClaims{"uid": 5, "app_id": resourceServer.ID})
+	clientToken := signedToken(signingKey, jwt.MapClaims{"sub": "2", "app_id": resourceServer.ID})
+	patToken := signedToken(signingKey, jwt.MapClaims{"uid": 5, "app_id": resourceServer.ID, "pat_id": 9})
+
+	type test struct {
+		name       string
+		caller     entity.App
+		prepare    func(f *fields)
+		token      string
+		secret     string
+		wantActive bool
+		wantClaims map[string]any
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: third-party token with consent"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), shop.ID).Return(shop, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), shop.ID).
+					Return(entity.Consent{UserID: 5, AppID: shop.ID, GrantID: "grant-1"}, nil)
+			},
+			token:      shopToken,
+			wantActive: true,
+			wantClaims: map[string]any{
+				"client_id":  "3",
+				"scope":      "openid orders:read",
+				"token_type": "Bearer",
+				"iss":        issuer,
+				"consent_id": "grant-1",
+			},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: client token"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), resourceServer.ID).Return(resourceServer, nil)
+			},
+			token:      clientToken,
+			wantActive: true,
+			wantClaims: map[string]any{"client_id": "2", "sub": "2"},
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: consent revoked"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), shop.ID).Return(shop, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), shop.ID).
+					Return(entity.Consent{}, storage.ErrConsentNotFound)
+			},
+			token: shopToken,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: consent given again"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), shop.ID).Return(shop, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), shop.ID).
+					Return(entity.Consent{UserID: 5, AppID: shop.ID, GrantID: "grant-2"}, nil)
+			},
+			token: shopToken,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: disabled user"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), resourceServer.ID).Return(resourceServer, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(disabled, nil)
+			},
+			token: userToken,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: sessions revoked"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), resourceServer.ID).Return(resourceServer, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(revoked, nil)
+			},
+			token: userToken,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: personal access token"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), resourceServer.ID).Return(resourceServer, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+				f.userProvider.EXPECT().PersonalAccessToken(gomock.Any(), int64(9)).
+					Return(entity.PersonalAccessToken{ID: 9, UserID: 5, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+			},
+			token:      patToken,
+			wantActive: true,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: personal access token revoked"),
+			caller: resourceServer,
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), resourceServer.ID).Return(resourceServer, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+				f.userProvider.EXPECT().PersonalAccessToken(gomock.Any(), int64(9)).Return(entity.PersonalAccessToken{
+					ID: 9, UserID: 5, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: time.Now(),
+				}, nil)
+			},
+			token: patToken,
+		},
+		{
+			name:   fmt.Sprintf("%s: %s", prefixName, "introspect success test: forged token"),
+			caller: resourceServer,
+			token:  signedToken(otherKey, jwt.MapClaims{"uid": 5, "app_id": resourceServer.ID}),
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "introspect negative test: wrong secret"),
+			caller:  resourceServer,
+			token:   userToken,
+			secret:  "wrong",
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "introspect negative test: third-party caller"),
+			caller:  shop,
+			token:   shopToken,
+			wantErr: ErrUnauthorizedClient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			f.appProvider.EXPECT().App(gomock.Any(), tt.caller.ID).Return(tt.caller, nil)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			secret := tt.caller.Secret
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+
+			resp, err := f.service().Introspect(context.Background(), TokenRequest{
+				ClientID:     tt.caller.ID,
+				ClientSecret: secret,
+				Token:        tt.token,
+			})
+
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantActive, resp["active"])
+			if !tt.wantActive {
+				assert.Len(t, resp, 1)
+			}
+			for name, value := range tt.wantClaims {
+				assert.Equal(t, value, resp[name], name)
+			}
+		})
+	}
+}
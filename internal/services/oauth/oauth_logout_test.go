@@ -0,0 +1,134 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth_logout(t *testing.T) {
+	prefixName := "oauth service"
+	const postLogoutURI = "https://shop.example.com/signed-out"
+
+	idToken := func(key *jwk.Key, claims map[string]any) string {
+		token, err := key.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	otherKey, err := jwk.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hints usually come long after the ID token expired.
+	expired := map[string]any{"iss": issuer, "aud": "2", "sub": "5", "exp": time.Now().Add(-time.Hour).Unix()}
+
+	postLogoutURIs := func(f *fields) {
+		f.registeredClient()
+		f.appProvider.EXPECT().PostLogoutRedirectURIs(gomock.Any(), clientId).Return([]string{postLogoutURI}, nil)
+	}
+
+	type test struct {
+		name       string
+		prepare    func(f *fields)
+		req        LogoutRequest
+		wantTarget string
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "logout success test: id token hint"),
+			prepare: postLogoutURIs,
+			req: LogoutRequest{
+				IDTokenHint:           idToken(signingKey, expired),
+				PostLogoutRedirectURI: postLogoutURI,
+			},
+			wantTarget: postLogoutURI,
+		},
+		{
+			name:       fmt.Sprintf("%s: %s", prefixName, "logout success test: client id"),
+			prepare:    postLogoutURIs,
+			req:        LogoutRequest{ClientID: clientId, PostLogoutRedirectURI: postLogoutURI},
+			wantTarget: postLogoutURI,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout success test: any loopback port"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{LoopbackAnyPort: true})
+				f.appProvider.EXPECT().PostLogoutRedirectURIs(gomock.Any(), clientId).
+					Return([]string{"http://127.0.0.1/signed-out"}, nil)
+			},
+			req:        LogoutRequest{ClientID: clientId, PostLogoutRedirectURI: "http://127.0.0.1:51004/signed-out"},
+			wantTarget: "http://127.0.0.1:51004/signed-out",
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout success test: no redirect"),
+			req:  LogoutRequest{IDTokenHint: idToken(signingKey, expired)},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "logout negative test: unregistered redirect uri"),
+			prepare: postLogoutURIs,
+			req:     LogoutRequest{ClientID: clientId, PostLogoutRedirectURI: "https://evil.example.com/"},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "logout negative test: no client"),
+			req:     LogoutRequest{PostLogoutRedirectURI: postLogoutURI},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout negative test: hint signed by another key"),
+			req: LogoutRequest{
+				IDTokenHint:           idToken(otherKey, expired),
+				PostLogoutRedirectURI: postLogoutURI,
+			},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout negative test: hint from another issuer"),
+			req: LogoutRequest{
+				IDTokenHint: idToken(signingKey, map[string]any{"iss": "https://other.example.com", "aud": "2"}),
+			},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "logout negative test: hint issued to another client"),
+			req: LogoutRequest{
+				IDTokenHint:           idToken(signingKey, expired),
+				ClientID:              3,
+				PostLogoutRedirectURI: postLogoutURI,
+			},
+			wantErr: ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			target, err := f.service().Logout(context.Background(), tt.req)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantTarget, target)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				assert.Empty(t, target)
+			}
+		})
+	}
+}
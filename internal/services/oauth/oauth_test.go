@@ -0,0 +1,566 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	issuer      = "https://sso.example.com"
+	clientId    = 2
+	redirectURI = "https://shop.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type fields struct {
+	authenticator    *MockAuthenticator
+	appProvider      *MockAppProvider
+	userProvider     *MockUserProvider
+	codeStorage      *MockCodeStorage
+	assertionStorage *MockAssertionStorage
+	deviceStorage    *MockDeviceStorage
+	consentStorage   *MockConsentStorage
+}
+
+func newFields(ctrl *gomock.Controller) *fields {
+	return &fields{
+		authenticator:    NewMockAuthenticator(ctrl),
+		appProvider:      NewMockAppProvider(ctrl),
+		userProvider:     NewMockUserProvider(ctrl),
+		codeStorage:      NewMockCodeStorage(ctrl),
+		assertionStorage: NewMockAssertionStorage(ctrl),
+		deviceStorage:    NewMockDeviceStorage(ctrl),
+		consentStorage:   NewMockConsentStorage(ctrl),
+	}
+}
+
+func (f *fields) service() *OAuth {
+	return New(slog.Default(), f.authenticator, f.appProvider, f.userProvider, f.codeStorage, f.assertionStorage,
+		f.deviceStorage, f.consentStorage, signingKey, Config{
+			Issuer:             issuer,
+			CodeTTL:            time.Minute,
+			DeviceCodeTTL:      10 * time.Minute,
+			DevicePollInterval: 5 * time.Second,
+			ConsentTTL:         10 * time.Minute,
+		})
+}
+
+func (f *fields) registeredClient() {
+	f.clientWith(entity.AppSettings{})
+}
+
+func (f *fields) clientWith(settings entity.AppSettings) {
+	f.appProvider.EXPECT().App(gomock.Any(), clientId).
+		Return(entity.App{ID: clientId, Secret: "secret", Settings: settings}, nil).AnyTimes()
+	f.appProvider.EXPECT().RedirectURIs(gomock.Any(), clientId).Return([]string{redirectURI}, nil).AnyTimes()
+}
+
+func TestOAuth_authorize(t *testing.T) {
+	prefixName := "oauth service"
+	valid := AuthorizeRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            clientId,
+		RedirectURI:         redirectURI,
+		Scopes:              []string{"profile"},
+		State:               "xyz",
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: entity.CodeChallengeS256,
+	}
+	type test struct {
+		name         string
+		prepare      func(f *fields)
+		req          func(req AuthorizeRequest) AuthorizeRequest
+		wantErr      error
+		redirectable bool
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize success test"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "a@mail.com", "password", clientId).
+					Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+				f.codeStorage.EXPECT().SaveAuthorizationCode(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, code entity.AuthorizationCode) (int64, error) {
+						assert.Equal(t, int64(5), code.UserID)
+						assert.Equal(t, clientId, code.AppID)
+						assert.Equal(t, redirectURI, code.RedirectURI)
+						assert.Equal(t, []string{"profile"}, code.Scopes)
+						assert.Equal(t, challenge(verifier), code.CodeChallenge)
+						assert.Equal(t, []string{entity.AMRPassword}, code.AMR)
+						assert.WithinDuration(t, time.Now().Add(time.Minute), code.ExpiresAt, time.Second)
+						assert.Len(t, code.CodeHash, sha256.Size)
+						return 1, nil
+					})
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: unknown client"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(entity.App{}, storage.ErrAppNotFound)
+			},
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: unregistered redirect uri"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.RedirectURI = "https://evil.example.com/callback"
+				return req
+			},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: no pkce"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.CodeChallenge, req.CodeChallengeMethod = "", ""
+				return req
+			},
+			wantErr:      ErrInvalidRequest,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: plain pkce"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.CodeChallenge, req.CodeChallengeMethod = verifier, "plain"
+				return req
+			},
+			wantErr:      ErrInvalidRequest,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: token response type"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.ResponseType = "token"
+				return req
+			},
+			wantErr:      ErrUnsupportedResponseType,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: grant type not allowed"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{GrantTypes: []string{GrantTypeClientCredentials}})
+			},
+			wantErr:      ErrUnauthorizedClient,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize success test: user scope"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{UserScopes: []string{"orders:read"}})
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "a@mail.com", "password", clientId).
+					Return(entity.User{ID: 5}, []string{entity.AMRPassword}, nil)
+				f.codeStorage.EXPECT().SaveAuthorizationCode(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, code entity.AuthorizationCode) (int64, error) {
+						assert.Equal(t, []string{ScopeOpenID, "orders:read"}, code.Scopes)
+						return 1, nil
+					})
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.Scopes = []string{ScopeOpenID, "orders:read"}
+				return req
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: scope not allowed"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{UserScopes: []string{"orders:read"}})
+			},
+			req: func(req AuthorizeRequest) AuthorizeRequest {
+				req.Scopes = []string{ScopeOpenID, "orders:write"}
+				return req
+			},
+			wantErr:      ErrInvalidScope,
+			redirectable: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: wrong password"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "a@mail.com", "password", clientId).
+					Return(entity.User{}, nil, fmt.Errorf("auth.Authenticate: %w", auth.ErrInvalidCredentials))
+			},
+			wantErr: ErrLoginFailed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize negative test: denied by app policy"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.authenticator.EXPECT().Authenticate(gomock.Any(), "a@mail.com", "password", clientId).
+					Return(entity.User{}, nil, fmt.Errorf("auth.Authenticate: %w", auth.ErrEmailDomainNotAllowed))
+			},
+			wantErr:      ErrAccessDenied,
+			redirectable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			req := valid
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			authorization, err := f.service().Authorize(context.Background(), req, "a@mail.com", "password")
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, authorization.Code)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+				assert.Equal(t, tt.redirectable, Redirectable(err))
+			}
+		})
+	}
+}
+
+func TestOAuth_authorizeUser(t *testing.T) {
+	prefixName := "oauth service"
+	req := AuthorizeRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            clientId,
+		RedirectURI:         redirectURI,
+		State:               "xyz",
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: entity.CodeChallengeS256,
+	}
+	amr := []string{entity.AMRFederated}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize user success test"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().AuthenticateUser(gomock.Any(), int64(5), clientId, amr).
+					Return(entity.User{ID: 5}, nil)
+				f.codeStorage.EXPECT().SaveAuthorizationCode(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, code entity.AuthorizationCode) (int64, error) {
+						assert.Equal(t, int64(5), code.UserID)
+						assert.Equal(t, amr, code.AMR)
+						return 1, nil
+					})
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize user negative test: disabled user"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().AuthenticateUser(gomock.Any(), int64(5), clientId, amr).
+					Return(entity.User{}, fmt.Errorf("auth.AuthenticateUser: %w", auth.ErrInvalidCredentials))
+			},
+			wantErr: ErrLoginFailed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "authorize user negative test: method not allowed by app"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().AuthenticateUser(gomock.Any(), int64(5), clientId, amr).
+					Return(entity.User{}, fmt.Errorf("auth.AuthenticateUser: %w", auth.ErrLoginMethodNotAllowed))
+			},
+			wantErr: ErrAccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			f.registeredClient()
+			tt.prepare(f)
+
+			authorization, err := f.service().AuthorizeUser(context.Background(), req, 5, amr)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, authorization.Code)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestOAuth_exchange(t *testing.T) {
+	prefixName := "oauth service"
+	const code = "code"
+	issued := entity.AuthorizationCode{
+		AppID:               clientId,
+		UserID:              5,
+		RedirectURI:         redirectURI,
+		Scopes:              []string{"profile"},
+		CodeChallenge:       challenge(verifier),
+		CodeChallengeMethod: entity.CodeChallengeS256,
+		AuthTime:            time.Now(),
+		AMR:                 []string{entity.AMRPassword},
+		ExpiresAt:           time.Now().Add(time.Minute),
+	}
+	valid := TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     clientId,
+		Code:         code,
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		req     func(req TokenRequest) TokenRequest
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange success test: public client"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+				f.authenticator.EXPECT().IssueToken(gomock.Any(), int64(5), clientId, issued.AuthTime, issued.AMR, issued.Scopes).
+					Return("token", time.Hour, nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange success test: confidential client"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+				f.authenticator.EXPECT().IssueToken(gomock.Any(), int64(5), clientId, gomock.Any(), gomock.Any(), gomock.Any()).
+					Return("token", time.Hour, nil)
+			},
+			req: func(req TokenRequest) TokenRequest {
+				req.ClientSecret = "secret"
+				return req
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "exchange negative test: unsupported grant type"),
+			req:     func(req TokenRequest) TokenRequest { req.GrantType = "password"; return req },
+			wantErr: ErrUnsupportedGrantType,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: wrong client secret"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+			},
+			req:     func(req TokenRequest) TokenRequest { req.ClientSecret = "wrong"; return req },
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: secret of a public client"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{TokenAuthMethod: entity.TokenAuthNone})
+			},
+			req:     func(req TokenRequest) TokenRequest { req.ClientSecret = "secret"; return req },
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: no secret of a confidential client"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{TokenAuthMethod: entity.TokenAuthClientSecretBasic})
+			},
+			wantErr: ErrInvalidClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: grant type not allowed"),
+			prepare: func(f *fields) {
+				f.clientWith(entity.AppSettings{GrantTypes: []string{GrantTypeDeviceCode}})
+			},
+			wantErr: ErrUnauthorizedClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: used code"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).
+					Return(entity.AuthorizationCode{}, storage.ErrCodeNotFound)
+			},
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: expired code"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				expired := issued
+				expired.ExpiresAt = time.Now().Add(-time.Second)
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(expired, nil)
+			},
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: code of another client"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), 3).Return(entity.App{ID: 3}, nil)
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+			},
+			req:     func(req TokenRequest) TokenRequest { req.ClientID = 3; return req },
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: redirect uri mismatch"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+			},
+			req:     func(req TokenRequest) TokenRequest { req.RedirectURI = "https://shop.example.com/other"; return req },
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange success test: allowed web origin"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.appProvider.EXPECT().WebOrigins(gomock.Any(), clientId).Return([]string{"https://shop.example.com"}, nil)
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+				f.authenticator.EXPECT().IssueToken(gomock.Any(), int64(5), clientId, issued.AuthTime, issued.AMR, issued.Scopes).
+					Return("token", time.Hour, nil)
+			},
+			req: func(req TokenRequest) TokenRequest { req.Origin = "https://shop.example.com"; return req },
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: web origin not allowed"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.appProvider.EXPECT().WebOrigins(gomock.Any(), clientId).Return([]string{"https://shop.example.com"}, nil)
+			},
+			req:     func(req TokenRequest) TokenRequest { req.Origin = "https://evil.example.com"; return req },
+			wantErr: ErrUnauthorizedClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: wrong verifier"),
+			prepare: func(f *fields) {
+				f.registeredClient()
+				f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(issued, nil)
+			},
+			req: func(req TokenRequest) TokenRequest {
+				req.CodeVerifier = "Z" + verifier[1:]
+				return req
+			},
+			wantErr: ErrInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			req := valid
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			resp, err := f.service().Exchange(context.Background(), req)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, "token", resp.AccessToken)
+				assert.Equal(t, TokenTypeBearer, resp.TokenType)
+				assert.Equal(t, time.Hour, resp.ExpiresIn)
+				assert.Equal(t, []string{"profile"}, resp.Scopes)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestOAuth_redirectURIAllowed(t *testing.T) {
+	prefixName := "oauth service"
+	registered := []string{redirectURI, "http://127.0.0.1/callback", "http://[::1]:8080/callback"}
+	type test struct {
+		name            string
+		uri             string
+		loopbackAnyPort bool
+		want            bool
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "redirect uri success test: exact match"),
+			uri:  redirectURI,
+			want: true,
+		},
+		{
+			name:            fmt.Sprintf("%s: %s", prefixName, "redirect uri success test: any loopback port"),
+			uri:             "http://127.0.0.1:51004/callback",
+			loopbackAnyPort: true,
+			want:            true,
+		},
+		{
+			name:            fmt.Sprintf("%s: %s", prefixName, "redirect uri success test: any ipv6 loopback port"),
+			uri:             "http://[::1]:51004/callback",
+			loopbackAnyPort: true,
+			want:            true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "redirect uri negative test: loopback port without the setting"),
+			uri:  "http://127.0.0.1:51004/callback",
+		},
+		{
+			name:            fmt.Sprintf("%s: %s", prefixName, "redirect uri negative test: loopback path differs"),
+			uri:             "http://127.0.0.1:51004/other",
+			loopbackAnyPort: true,
+		},
+		{
+			name:            fmt.Sprintf("%s: %s", prefixName, "redirect uri negative test: loopback host differs"),
+			uri:             "http://localhost:51004/callback",
+			loopbackAnyPort: true,
+		},
+		{
+			name:            fmt.Sprintf("%s: %s", prefixName, "redirect uri negative test: https port"),
+			uri:             "https://shop.example.com:8443/callback",
+			loopbackAnyPort: true,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "redirect uri negative test: prefix"),
+			uri:  redirectURI + "/more",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redirectURIAllowed(registered, tt.uri, tt.loopbackAnyPort))
+		})
+	}
+}
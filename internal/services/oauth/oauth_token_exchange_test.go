@@ -0,0 +1,166 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/services/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth_tokenExchange(t *testing.T) {
+	prefixName := "oauth service"
+
+	const sourceId = 1
+	client := entity.App{ID: clientId, Secret: "secret"}
+	subjectToken, err := jwt.NewToken(signingKey, entity.User{ID: 1, Email: "test@mail.com"}, entity.App{ID: sourceId, Secret: "s"}, time.Hour)
+	assert.Nil(t, err)
+
+	valid := TokenRequest{
+		GrantType:        GrantTypeTokenExchange,
+		ClientID:         clientId,
+		ClientSecret:     "secret",
+		SubjectToken:     subjectToken,
+		SubjectTokenType: TokenTypeAccessToken,
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		req     func(req TokenRequest) TokenRequest
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange success test: for the client"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().ExchangeToken(gomock.Any(), subjectToken, "", clientId, []string(nil)).
+					Return("token", time.Hour, nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange success test: subject app for an audience with an actor"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().ExchangeToken(gomock.Any(), subjectToken, "actor", 3, []string{"read"}).
+					Return("token", time.Hour, nil)
+			},
+			req: func(req TokenRequest) TokenRequest {
+				req.ClientID = sourceId
+				req.Audience = "3"
+				req.ActorToken = "actor"
+				req.ActorTokenType = TokenTypeJWT
+				req.Scopes = []string{"read"}
+				return req
+			},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: client is not a party"),
+			req:     func(req TokenRequest) TokenRequest { req.Audience = "3"; return req },
+			wantErr: ErrUnauthorizedClient,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: unsupported subject token type"),
+			req: func(req TokenRequest) TokenRequest {
+				req.SubjectTokenType = "urn:ietf:params:oauth:token-type:saml2"
+				return req
+			},
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: actor token without type"),
+			req:     func(req TokenRequest) TokenRequest { req.ActorToken = "actor"; return req },
+			wantErr: ErrInvalidRequest,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: malformed audience"),
+			req:     func(req TokenRequest) TokenRequest { req.Audience = "https://billing.example.com"; return req },
+			wantErr: ErrInvalidTarget,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: malformed subject token"),
+			req:     func(req TokenRequest) TokenRequest { req.SubjectToken = "garbage"; return req },
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: audience doesn't trust the app"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().ExchangeToken(gomock.Any(), subjectToken, "", clientId, gomock.Any()).
+					Return("", time.Duration(0), auth.ErrExchangeNotAllowed)
+			},
+			wantErr: ErrInvalidTarget,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: invalid subject token"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().ExchangeToken(gomock.Any(), subjectToken, "", clientId, gomock.Any()).
+					Return("", time.Duration(0), auth.ErrInvalidToken)
+			},
+			wantErr: ErrInvalidGrant,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "token exchange negative test: wider scope"),
+			prepare: func(f *fields) {
+				f.authenticator.EXPECT().ExchangeToken(gomock.Any(), subjectToken, "", clientId, gomock.Any()).
+					Return("", time.Duration(0), auth.ErrScopeNotGranted)
+			},
+			req:     func(req TokenRequest) TokenRequest { req.Scopes = []string{"admin"}; return req },
+			wantErr: ErrInvalidScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			f.appProvider.EXPECT().App(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, appId int) (entity.App, error) {
+					app := client
+					app.ID = appId
+					return app, nil
+				})
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			req := valid
+			if tt.req != nil {
+				req = tt.req(req)
+			}
+
+			resp, err := f.service().TokenExchange(context.Background(), req)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, "token", resp.AccessToken)
+				assert.Equal(t, TokenTypeBearer, resp.TokenType)
+				assert.Equal(t, TokenTypeAccessToken, resp.IssuedTokenType)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestOAuth_tokenExchangeClientAuthentication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := newFields(ctrl)
+	f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(entity.App{ID: clientId, Secret: "secret"}, nil)
+
+	// Token exchange is for confidential clients only.
+	_, err := f.service().TokenExchange(context.Background(), TokenRequest{
+		GrantType:        GrantTypeTokenExchange,
+		ClientID:         clientId,
+		SubjectToken:     "token",
+		SubjectTokenType: TokenTypeAccessToken,
+	})
+	assert.True(t, errors.Is(err, ErrInvalidClient), err)
+}
@@ -0,0 +1,226 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// OpenID Connect scopes. Requesting openid makes the token endpoint return an
+// ID token; profile and email select the user claims in it and at userinfo.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// oidcScopes are the scopes every app may request on behalf of its users.
+var oidcScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// Paths of the endpoints, relative to the issuer.
+const (
+	AuthorizePath = "/authorize"
+	ConsentPath   = "/authorize/consent"
+	TokenPath     = "/token"
+	UserInfoPath  = "/userinfo"
+	LogoutPath    = "/logout"
+	JWKSPath      = "/jwks.json"
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	DeviceAuthorizationPath = "/device_authorization"
+	DeviceVerificationPath  = "/device"
+	RegistrationPath        = "/register"
+	IntrospectionPath       = "/introspect"
+)
+
+// ProviderMetadata is the OpenID Provider configuration served at DiscoveryPath
+// (OpenID Connect Discovery 1.0, section 3).
+type ProviderMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint,omitempty"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+	PersonalAccessToken(ctx context.Context, tokenId int64) (entity.PersonalAccessToken, error)
+}
+
+// Metadata describes the provider for discovery.
+func (o *OAuth) Metadata() ProviderMetadata {
+	metadata := ProviderMetadata{
+		Issuer:                                     o.issuer,
+		AuthorizationEndpoint:                      o.issuer + AuthorizePath,
+		TokenEndpoint:                              o.issuer + TokenPath,
+		UserInfoEndpoint:                           o.issuer + UserInfoPath,
+		JWKSURI:                                    o.issuer + JWKSPath,
+		DeviceAuthorizationEndpoint:                o.issuer + DeviceAuthorizationPath,
+		EndSessionEndpoint:                         o.issuer + LogoutPath,
+		IntrospectionEndpoint:                      o.issuer + IntrospectionPath,
+		ScopesSupported:                            slices.Clone(oidcScopes),
+		ResponseTypesSupported:                     []string{ResponseTypeCode},
+		GrantTypesSupported:                        []string{GrantTypeAuthorizationCode, GrantTypeClientCredentials, GrantTypeDeviceCode, GrantTypeTokenExchange},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:          []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		TokenEndpointAuthSigningAlgValuesSupported: []string{"RS256", "ES256"},
+		CodeChallengeMethodsSupported:              []string{entity.CodeChallengeS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr", "azp",
+			"email", "email_verified", "preferred_username",
+		},
+	}
+	if o.cfg.Registration {
+		metadata.RegistrationEndpoint = o.issuer + RegistrationPath
+	}
+
+	return metadata
+}
+
+// JWKS returns the keys access and ID tokens are signed with.
+func (o *OAuth) JWKS() jwk.Set {
+	return jwk.Set{Keys: []jwk.PublicKey{o.signingKey.JWK()}}
+}
+
+// UserInfo returns the claims about the user of an access token issued by this
+// service (OpenID Connect Core 1.0, section 5.3). The token must have been
+// granted the openid scope; the other scopes select the claims returned. Tokens
+// of a third-party app are refused once the user revokes their consent, and a
+// request made by browser code must come from one of the web origins of the app.
+func (o *OAuth) UserInfo(ctx context.Context, accessToken string, origin string) (map[string]any, error) {
+	const op = "oauth.UserInfo"
+
+	log := o.log.With(slog.String("op", op))
+
+	claims, err := jwt.Parse(accessToken, o.signingKey.Public())
+	if err != nil {
+		log.Info("invalid access token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	app, err := o.appProvider.App(ctx, jwt.AppID(claims))
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := o.checkOrigin(ctx, app, origin); err != nil {
+		if errors.Is(err, ErrUnauthorizedClient) {
+			return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the token may not be used from %s", origin))
+		}
+		log.Error("failed to get web origins", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	uid, ok := claims["uid"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the token was not issued to a user"))
+	}
+
+	if app.Settings.ThirdParty {
+		grantId, _ := claims["consent_id"].(string)
+		consented, err := o.consentCurrent(ctx, int64(uid), app.ID, grantId)
+		if err != nil {
+			log.Error("failed to get consent", slog.Any("error", err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !consented {
+			return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the user revoked the consent to the client"))
+		}
+	}
+
+	scope, _ := claims["scope"].(string)
+	scopes := strings.Fields(scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrInsufficientScope, "the openid scope is required"))
+	}
+
+	user, err := o.userProvider.UserByID(ctx, int64(uid))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to get user", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Status == entity.UserStatusDisabled {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the user is disabled"))
+	}
+	if user.TokenRevoked(jwt.IssuedAt(claims)) {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the sessions of the user were revoked"))
+	}
+	patActive, err := o.personalAccessTokenActive(ctx, claims, user.ID)
+	if err != nil {
+		log.Error("failed to get personal access token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !patActive {
+		return nil, fmt.Errorf("%s: %w", op, errorf(ErrInvalidToken, "the personal access token was revoked"))
+	}
+
+	return userClaims(user, scopes), nil
+}
+
+// idToken issues the OpenID Connect ID token of the grant.
+func (o *OAuth) idToken(user entity.User, g grant, expiresIn time.Duration) (string, error) {
+	now := time.Now()
+	clientId := strconv.Itoa(g.appId)
+
+	claims := userClaims(user, g.scopes)
+	claims["iss"] = o.issuer
+	claims["aud"] = clientId
+	claims["azp"] = clientId
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(expiresIn).Unix()
+	claims["auth_time"] = g.authTime.Unix()
+	claims["amr"] = g.amr
+	claims["acr"] = entity.ACRForMethods(g.amr)
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	return o.signingKey.Sign(claims)
+}
+
+// userClaims returns the standard claims about the user the scopes give access to.
+// There is no profile beyond the email, which doubles as the preferred username.
+func userClaims(user entity.User, scopes []string) map[string]any {
+	claims := map[string]any{"sub": strconv.FormatInt(user.ID, 10)}
+
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		claims["preferred_username"] = user.Email
+	}
+
+	return claims
+}
@@ -0,0 +1,299 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var signingKey, otherKey = generateKey(), generateKey()
+
+func generateKey() *jwk.Key {
+	key, err := jwk.Generate()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func TestOAuth_exchangeIDToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	f := newFields(ctrl)
+	f.registeredClient()
+
+	code := "code"
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	f.codeStorage.EXPECT().UseAuthorizationCode(gomock.Any(), hash(code)).Return(entity.AuthorizationCode{
+		AppID:         clientId,
+		UserID:        5,
+		RedirectURI:   redirectURI,
+		Scopes:        []string{ScopeOpenID, ScopeEmail},
+		CodeChallenge: challenge(verifier),
+		Nonce:         "n-0S6_WzA2Mj",
+		AuthTime:      authTime,
+		AMR:           []string{entity.AMRPassword},
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}, nil)
+	f.authenticator.EXPECT().IssueToken(gomock.Any(), int64(5), clientId, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return("token", time.Hour, nil)
+	f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).
+		Return(entity.User{ID: 5, Email: "user@corp.com", EmailVerified: true}, nil)
+
+	resp, err := f.service().Exchange(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     clientId,
+		Code:         code,
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	})
+	assert.Nil(t, err)
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(resp.IDToken, claims, func(*jwt.Token) (interface{}, error) {
+		return signingKey.Public(), nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(issuer), jwt.WithAudience(strconv.Itoa(clientId)))
+	assert.Nil(t, err)
+	assert.Equal(t, signingKey.ID, token.Header["kid"])
+	assert.Equal(t, "5", claims["sub"])
+	assert.Equal(t, "n-0S6_WzA2Mj", claims["nonce"])
+	assert.Equal(t, float64(authTime.Unix()), claims["auth_time"])
+	assert.Equal(t, "user@corp.com", claims["email"])
+	assert.Equal(t, true, claims["email_verified"])
+	assert.NotContains(t, claims, "preferred_username")
+}
+
+func TestOAuth_userInfo(t *testing.T) {
+	prefixName := "oauth service"
+	app := entity.App{ID: clientId, Secret: "secret"}
+	user := entity.User{ID: 5, Email: "user@corp.com", Status: entity.UserStatusActive}
+	thirdParty := app
+	thirdParty.Settings.ThirdParty = true
+
+	signedToken := func(key *jwk.Key, claims jwt.MapClaims) string {
+		claims["app_id"] = clientId
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		token, err := key.SignType("at+jwt", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	accessToken := func(claims jwt.MapClaims) string {
+		return signedToken(signingKey, claims)
+	}
+
+	type test struct {
+		name       string
+		prepare    func(f *fields)
+		token      string
+		origin     string
+		wantClaims map[string]any
+		wantErr    error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo success test"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+			},
+			token: accessToken(jwt.MapClaims{"uid": 5, "scope": "openid profile"}),
+			wantClaims: map[string]any{
+				"sub":                "5",
+				"preferred_username": "user@corp.com",
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo success test: third-party app with consent"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(thirdParty, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, GrantID: "grant-1"}, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+			},
+			token:      accessToken(jwt.MapClaims{"uid": 5, "scope": "openid", "consent_id": "grant-1"}),
+			wantClaims: map[string]any{"sub": "5"},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: consent revoked"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(thirdParty, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{}, storage.ErrConsentNotFound)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid", "consent_id": "grant-1"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: consent given again after the token"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(thirdParty, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, GrantID: "grant-2"}, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid", "consent_id": "grant-1"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: third-party token without consent"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(thirdParty, nil)
+				f.consentStorage.EXPECT().Consent(gomock.Any(), int64(5), clientId).
+					Return(entity.Consent{UserID: 5, AppID: clientId, GrantID: "grant-1"}, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo success test: allowed web origin"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				f.appProvider.EXPECT().WebOrigins(gomock.Any(), clientId).Return([]string{"https://shop.example.com"}, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(user, nil)
+			},
+			token:      accessToken(jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			origin:     "https://shop.example.com",
+			wantClaims: map[string]any{"sub": "5"},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: web origin not allowed"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				f.appProvider.EXPECT().WebOrigins(gomock.Any(), clientId).Return([]string{"https://shop.example.com"}, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			origin:  "https://evil.example.com",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: malformed token"),
+			token:   "not a token",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			// Clients know their secret, so a token signed with it proves nothing.
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: signed with the app secret"),
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"uid": 5, "scope": "openid", "app_id": clientId, "exp": time.Now().Add(time.Hour).Unix(),
+				})
+				token.Header["typ"] = "at+jwt"
+				signed, err := token.SignedString([]byte(app.Secret))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return signed
+			}(),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: id token"),
+			token: func() string {
+				idToken, err := signingKey.Sign(map[string]any{
+					"uid": 5, "scope": "openid", "app_id": clientId, "exp": time.Now().Add(time.Hour).Unix(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return idToken
+			}(),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: signed with another key"),
+			token:   signedToken(otherKey, jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: no openid scope"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "email"}),
+			wantErr: ErrInsufficientScope,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: client token"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"sub": "2", "scope": "openid"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: user deleted"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{}, storage.ErrUserNotFound)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: user disabled"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				disabled := user
+				disabled.Status = entity.UserStatusDisabled
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(disabled, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid"}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo negative test: sessions revoked"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				revoked := user
+				revoked.SessionsRevokedAt = time.Now()
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(revoked, nil)
+			},
+			token:   accessToken(jwt.MapClaims{"uid": 5, "scope": "openid", "iat": time.Now().Add(-time.Minute).Unix()}),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "userinfo success test: issued after sessions were revoked"),
+			prepare: func(f *fields) {
+				f.appProvider.EXPECT().App(gomock.Any(), clientId).Return(app, nil)
+				revoked := user
+				revoked.SessionsRevokedAt = time.Now().Add(-time.Hour)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(revoked, nil)
+			},
+			token:      accessToken(jwt.MapClaims{"uid": 5, "scope": "openid", "iat": time.Now().Unix()}),
+			wantClaims: map[string]any{"sub": "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := newFields(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			claims, err := f.service().UserInfo(context.Background(), tt.token, tt.origin)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantClaims, claims)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
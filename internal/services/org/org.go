@@ -0,0 +1,302 @@
+package org
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_org.go -package=org . OrgStorage,UserProvider,Mailer
+
+const invitationTokenBytes = 32
+
+var (
+	ErrInvalidName       = errors.New("organization name required")
+	ErrInvalidRole       = errors.New("invalid organization role")
+	ErrInvalidEmail      = errors.New("email required")
+	ErrOrgExists         = errors.New("organization already exists")
+	ErrOrgNotFound       = errors.New("organization not found")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrInvalidInvitation = errors.New("invalid invitation")
+	ErrEmailMismatch     = errors.New("invitation was sent to another email")
+	ErrUserNotFound      = errors.New("user not found")
+)
+
+type Org struct {
+	log           *slog.Logger
+	orgStorage    OrgStorage
+	userProvider  UserProvider
+	mailer        Mailer
+	invitationTTL time.Duration
+}
+
+type OrgStorage interface {
+	SaveOrganization(ctx context.Context, name string, ownerId int64) (int64, error)
+	Organization(ctx context.Context, orgId int64) (entity.Organization, error)
+	Membership(ctx context.Context, orgId int64, userId int64) (entity.Membership, error)
+	Memberships(ctx context.Context, userId int64) ([]entity.Membership, error)
+	Members(ctx context.Context, orgId int64) ([]entity.Membership, error)
+	SaveInvitation(ctx context.Context, invitation entity.Invitation) (int64, error)
+	InvitationByHash(ctx context.Context, hash []byte) (entity.Invitation, error)
+	AcceptInvitationByUser(ctx context.Context, invitation entity.Invitation, userId int64) error
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+// New returns a new instance of the organization service
+func New(
+	log *slog.Logger,
+	orgStorage OrgStorage,
+	userProvider UserProvider,
+	mailer Mailer,
+	invitationTTL time.Duration,
+) *Org {
+	return &Org{
+		log:           log,
+		orgStorage:    orgStorage,
+		userProvider:  userProvider,
+		mailer:        mailer,
+		invitationTTL: invitationTTL,
+	}
+}
+
+// CreateOrganization creates an organization owned by the user.
+func (o *Org) CreateOrganization(ctx context.Context, userId int64, name string) (entity.Organization, error) {
+	const op = "org.CreateOrganization"
+
+	log := o.log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return entity.Organization{}, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	id, err := o.orgStorage.SaveOrganization(ctx, name, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgExists) {
+			return entity.Organization{}, fmt.Errorf("%s: %w", op, ErrOrgExists)
+		}
+		log.Error("failed to save organization", slog.Any("error", err))
+		return entity.Organization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("organization created", slog.Int64("org_id", id))
+
+	return entity.Organization{ID: id, Name: name}, nil
+}
+
+// UserOrganizations returns the memberships of the user.
+func (o *Org) UserOrganizations(ctx context.Context, userId int64) ([]entity.Membership, error) {
+	const op = "org.UserOrganizations"
+
+	memberships, err := o.orgStorage.Memberships(ctx, userId)
+	if err != nil {
+		o.log.Error("failed to list memberships", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return memberships, nil
+}
+
+// ListMembers returns the members of the organization. Only organization owners
+// and admins, and global admins, can list members.
+func (o *Org) ListMembers(ctx context.Context, actorId int64, orgId int64) ([]entity.Membership, error) {
+	const op = "org.ListMembers"
+
+	if _, err := o.requireManager(ctx, orgId, actorId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	members, err := o.orgStorage.Members(ctx, orgId)
+	if err != nil {
+		o.log.Error("failed to list members", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return members, nil
+}
+
+// Invite emails an invitation to join the organization with the given role.
+//
+// Organization owners and admins, and global admins, can invite. Only owners
+// and global admins can invite new owners. The invitation token is sent by email
+// only and is never stored in plain text.
+//
+// The invitation is kept with the sign-up invitations of the invitations service:
+// admins list and revoke it there, and a person without an account accepts it by
+// signing up with it.
+func (o *Org) Invite(
+	ctx context.Context,
+	actorId int64,
+	orgId int64,
+	email string,
+	role string,
+) (entity.Invitation, error) {
+	const op = "org.Invite"
+
+	log := o.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("org_id", orgId),
+	)
+
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrInvalidEmail)
+	}
+	if !entity.ValidOrgRole(role) {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+
+	actorRole, err := o.requireManager(ctx, orgId, actorId)
+	if err != nil {
+		log.Warn("invitation denied", slog.Any("error", err))
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if role == entity.OrgRoleOwner && actorRole == entity.OrgRoleAdmin {
+		log.Warn("organization admin tried to invite an owner")
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrPermissionDenied)
+	}
+
+	org, err := o.orgStorage.Organization(ctx, orgId)
+	if err != nil {
+		if errors.Is(err, storage.ErrOrgNotFound) {
+			return entity.Invitation{}, fmt.Errorf("%s: %w", op, ErrOrgNotFound)
+		}
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	invitation := entity.Invitation{
+		OrgID:     orgId,
+		Email:     email,
+		OrgRole:   role,
+		TokenHash: hash(token),
+		InvitedBy: actorId,
+		ExpiresAt: time.Now().Add(o.invitationTTL).UTC(),
+	}
+
+	id, err := o.orgStorage.SaveInvitation(ctx, invitation)
+	if err != nil {
+		log.Error("failed to save invitation", slog.Any("error", err))
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+	invitation.ID = id
+
+	body := fmt.Sprintf("You have been invited to join %s as %s.\n\nInvitation code: %s\n\nThe code expires at %s.",
+		org.Name, role, token, invitation.ExpiresAt.Format(time.RFC1123))
+
+	if err := o.mailer.Send(ctx, email, "Invitation to "+org.Name, body); err != nil {
+		log.Error("failed to send invitation", slog.Any("error", err))
+		return entity.Invitation{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation sent", slog.Int64("invitation_id", id))
+
+	invitation.TokenHash = nil
+
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the organization the invitation was issued for.
+// The invitation must have been sent to the user's email. Roles the invitation
+// grants besides the membership are given as well.
+func (o *Org) AcceptInvitation(ctx context.Context, userId int64, token string) (entity.Membership, error) {
+	const op = "org.AcceptInvitation"
+
+	log := o.log.With(slog.String("op", op), slog.Int64("user_id", userId))
+
+	invitation, err := o.orgStorage.InvitationByHash(ctx, hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return entity.Membership{}, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+		}
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if invitation.OrgID == 0 || !invitation.Pending(time.Now()) {
+		log.Info("invitation is not a pending organization invitation", slog.Int64("invitation_id", invitation.ID))
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+	}
+
+	user, err := o.userProvider.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return entity.Membership{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		log.Warn("invitation accepted by another user", slog.Int64("invitation_id", invitation.ID))
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, ErrEmailMismatch)
+	}
+
+	if err := o.orgStorage.AcceptInvitationByUser(ctx, invitation, userId); err != nil {
+		if errors.Is(err, storage.ErrInvitationNotFound) {
+			return entity.Membership{}, fmt.Errorf("%s: %w", op, ErrInvalidInvitation)
+		}
+		log.Error("failed to accept invitation", slog.Any("error", err))
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	membership, err := o.orgStorage.Membership(ctx, invitation.OrgID, userId)
+	if err != nil {
+		return entity.Membership{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("invitation accepted", slog.Int64("org_id", invitation.OrgID))
+
+	return membership, nil
+}
+
+// requireManager checks that the user can manage the organization and returns
+// their role in it. Global admins manage every organization as owners.
+func (o *Org) requireManager(ctx context.Context, orgId int64, userId int64) (string, error) {
+	membership, err := o.orgStorage.Membership(ctx, orgId, userId)
+	if err == nil && membership.CanManage() {
+		return membership.Role, nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrMemberNotFound) {
+		return "", err
+	}
+
+	isAdmin, err := o.userProvider.IsAdmin(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", ErrPermissionDenied
+		}
+		return "", err
+	}
+	if !isAdmin {
+		return "", ErrPermissionDenied
+	}
+
+	return entity.OrgRoleOwner, nil
+}
+
+func hash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,263 @@
+package org
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrg_invite(t *testing.T) {
+	prefixName := "org service"
+	type fields struct {
+		orgStorage   *MockOrgStorage
+		userProvider *MockUserProvider
+		mailer       *MockMailer
+	}
+	type args struct {
+		actorId int64
+		orgId   int64
+		email   string
+		role    string
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "invite success test"),
+			prepare: func(f *fields, arg args) {
+				f.orgStorage.EXPECT().Membership(gomock.Any(), arg.orgId, arg.actorId).
+					Return(entity.Membership{OrgID: arg.orgId, UserID: arg.actorId, Role: entity.OrgRoleAdmin}, nil)
+				f.orgStorage.EXPECT().Organization(gomock.Any(), arg.orgId).Return(entity.Organization{ID: arg.orgId, Name: "Acme"}, nil)
+				f.orgStorage.EXPECT().SaveInvitation(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, invitation entity.Invitation) (int64, error) {
+						assert.Equal(t, arg.email, invitation.Email)
+						assert.Equal(t, arg.role, invitation.OrgRole)
+						assert.Len(t, invitation.TokenHash, 32)
+						return 3, nil
+					})
+				f.mailer.EXPECT().Send(gomock.Any(), arg.email, "Invitation to Acme", gomock.Any()).Return(nil)
+			},
+			args: args{actorId: 1, orgId: 2, email: "new@mail.com", role: entity.OrgRoleMember},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "invite negative test: invalid role"),
+			args:    args{actorId: 1, orgId: 2, email: "new@mail.com", role: "superuser"},
+			wantErr: ErrInvalidRole,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "invite negative test: plain member"),
+			prepare: func(f *fields, arg args) {
+				f.orgStorage.EXPECT().Membership(gomock.Any(), arg.orgId, arg.actorId).
+					Return(entity.Membership{Role: entity.OrgRoleMember}, nil)
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(false, nil)
+			},
+			args:    args{actorId: 1, orgId: 2, email: "new@mail.com", role: entity.OrgRoleMember},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "invite negative test: org admin invites owner"),
+			prepare: func(f *fields, arg args) {
+				f.orgStorage.EXPECT().Membership(gomock.Any(), arg.orgId, arg.actorId).
+					Return(entity.Membership{Role: entity.OrgRoleAdmin}, nil)
+			},
+			args:    args{actorId: 1, orgId: 2, email: "new@mail.com", role: entity.OrgRoleOwner},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "invite success test: global admin outside the org"),
+			prepare: func(f *fields, arg args) {
+				f.orgStorage.EXPECT().Membership(gomock.Any(), arg.orgId, arg.actorId).
+					Return(entity.Membership{}, storage.ErrMemberNotFound)
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.actorId).Return(true, nil)
+				f.orgStorage.EXPECT().Organization(gomock.Any(), arg.orgId).Return(entity.Organization{ID: arg.orgId, Name: "Acme"}, nil)
+				f.orgStorage.EXPECT().SaveInvitation(gomock.Any(), gomock.Any()).Return(int64(3), nil)
+				f.mailer.EXPECT().Send(gomock.Any(), arg.email, gomock.Any(), gomock.Any()).Return(nil)
+			},
+			args: args{actorId: 1, orgId: 2, email: "new@mail.com", role: entity.OrgRoleOwner},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				orgStorage:   NewMockOrgStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+				mailer:       NewMockMailer(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			service := New(slog.Default(), f.orgStorage, f.userProvider, f.mailer, time.Hour)
+			invitation, err := service.Invite(context.Background(), tt.args.actorId, tt.args.orgId, tt.args.email, tt.args.role)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(3), invitation.ID)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestOrg_acceptInvitation(t *testing.T) {
+	prefixName := "org service"
+	user := entity.User{ID: 5, Email: "new@mail.com"}
+	type fields struct {
+		orgStorage   *MockOrgStorage
+		userProvider *MockUserProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		wantErr error
+	}
+	invitation := entity.Invitation{
+		ID:        3,
+		OrgID:     2,
+		Email:     "New@mail.com",
+		OrgRole:   entity.OrgRoleMember,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation success test"),
+			prepare: func(f *fields) {
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), hash("code")).Return(invitation, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.orgStorage.EXPECT().AcceptInvitationByUser(gomock.Any(), invitation, user.ID).Return(nil)
+				f.orgStorage.EXPECT().Membership(gomock.Any(), invitation.OrgID, user.ID).
+					Return(entity.Membership{OrgID: invitation.OrgID, UserID: user.ID, Role: invitation.OrgRole}, nil)
+			},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: unknown code"),
+			prepare: func(f *fields) {
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).
+					Return(entity.Invitation{}, storage.ErrInvitationNotFound)
+			},
+			wantErr: ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: expired"),
+			prepare: func(f *fields) {
+				expired := invitation
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).Return(expired, nil)
+			},
+			wantErr: ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: revoked"),
+			prepare: func(f *fields) {
+				revoked := invitation
+				revoked.RevokedAt = time.Now()
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).Return(revoked, nil)
+			},
+			wantErr: ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: not an organization invitation"),
+			prepare: func(f *fields) {
+				signUp := invitation
+				signUp.OrgID = 0
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).Return(signUp, nil)
+			},
+			wantErr: ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: already accepted"),
+			prepare: func(f *fields) {
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).Return(invitation, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.orgStorage.EXPECT().AcceptInvitationByUser(gomock.Any(), invitation, user.ID).
+					Return(storage.ErrInvitationNotFound)
+			},
+			wantErr: ErrInvalidInvitation,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "accept invitation negative test: another email"),
+			prepare: func(f *fields) {
+				f.orgStorage.EXPECT().InvitationByHash(gomock.Any(), gomock.Any()).Return(invitation, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(entity.User{ID: user.ID, Email: "other@mail.com"}, nil)
+			},
+			wantErr: ErrEmailMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				orgStorage:   NewMockOrgStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.orgStorage, f.userProvider, NewMockMailer(ctrl), time.Hour)
+			membership, err := service.AcceptInvitation(context.Background(), user.ID, "code")
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, entity.OrgRoleMember, membership.Role)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestOrg_invitationCodeRoundTrip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orgStorage := NewMockOrgStorage(ctrl)
+	mailer := NewMockMailer(ctrl)
+
+	var saved entity.Invitation
+	orgStorage.EXPECT().Membership(gomock.Any(), int64(2), int64(1)).Return(entity.Membership{Role: entity.OrgRoleOwner}, nil)
+	orgStorage.EXPECT().Organization(gomock.Any(), int64(2)).Return(entity.Organization{ID: 2, Name: "Acme"}, nil)
+	orgStorage.EXPECT().SaveInvitation(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, invitation entity.Invitation) (int64, error) {
+			saved = invitation
+			return 3, nil
+		})
+
+	var body string
+	mailer.EXPECT().Send(gomock.Any(), "new@mail.com", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _, b string) error {
+			body = b
+			return nil
+		})
+
+	service := New(slog.Default(), orgStorage, NewMockUserProvider(ctrl), mailer, time.Hour)
+	_, err := service.Invite(context.Background(), 1, 2, "new@mail.com", entity.OrgRoleAdmin)
+	assert.Nil(t, err)
+
+	code := regexp.MustCompile(`Invitation code: (\S+)`).FindStringSubmatch(body)
+	assert.Len(t, code, 2)
+	assert.Equal(t, saved.TokenHash, hash(code[1]))
+}
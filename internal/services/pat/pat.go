@@ -0,0 +1,338 @@
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_pat.go -package=pat . TokenStorage,UserProvider,AppProvider
+
+const (
+	// TokenPrefix makes personal access tokens recognizable, e.g. by secret scanners.
+	TokenPrefix = "ssopat_"
+
+	// AMRPersonalAccessToken is the amr value of JWTs obtained in exchange for a personal access token.
+	AMRPersonalAccessToken = entity.AMRPersonalAccessToken
+
+	secretBytes = 32
+	prefixLen   = len(TokenPrefix) + 8
+)
+
+var (
+	ErrInvalidName  = errors.New("token name required")
+	ErrInvalidTTL   = errors.New("invalid token ttl")
+	ErrTokenExists  = errors.New("token with this name already exists")
+	ErrNotFound     = errors.New("token not found")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrInvalidAppId = errors.New("invalid app id")
+	ErrInvalidScope = errors.New("invalid scope")
+
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed by app")
+	ErrLoginMethodNotAllowed = errors.New("personal access tokens are not allowed by app")
+	ErrStepUpRequired        = errors.New("app requires a stronger authentication")
+)
+
+type PAT struct {
+	log          *slog.Logger
+	tokenStorage TokenStorage
+	userProvider UserProvider
+	appProvider  AppProvider
+	signingKey   *jwk.Key
+	maxTTL       time.Duration
+	tokenTTL     time.Duration
+	scopes       []string
+}
+
+type TokenStorage interface {
+	SavePersonalAccessToken(ctx context.Context, token entity.PersonalAccessToken) (int64, error)
+	PersonalAccessTokens(ctx context.Context, userId int64) ([]entity.PersonalAccessToken, error)
+	PersonalAccessTokenByHash(ctx context.Context, hash []byte) (entity.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userId int64, tokenId int64) error
+	TouchPersonalAccessToken(ctx context.Context, tokenId int64) error
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+	UserRoles(ctx context.Context, userId int64, appId int) ([]entity.Role, error)
+}
+
+type AppProvider interface {
+	App(ctx context.Context, appId int) (entity.App, error)
+}
+
+// New returns a new instance of the personal access token service. The JWTs
+// given in exchange for tokens are signed with the signing key. Tokens can only
+// carry the given scopes, and none when there are none.
+func New(
+	log *slog.Logger,
+	tokenStorage TokenStorage,
+	userProvider UserProvider,
+	appProvider AppProvider,
+	signingKey *jwk.Key,
+	maxTTL time.Duration,
+	tokenTTL time.Duration,
+	scopes []string,
+) *PAT {
+	return &PAT{
+		log:          log,
+		tokenStorage: tokenStorage,
+		userProvider: userProvider,
+		appProvider:  appProvider,
+		signingKey:   signingKey,
+		maxTTL:       maxTTL,
+		tokenTTL:     tokenTTL,
+		scopes:       scopes,
+	}
+}
+
+// Create issues a new personal access token for the user and returns it in plain text.
+//
+// The plain token is never stored and can't be retrieved again, only its hash is kept.
+// Names are unique among the tokens of the user that aren't revoked: the name of
+// a revoked token can be reused.
+func (p *PAT) Create(
+	ctx context.Context,
+	userId int64,
+	name string,
+	scopes []string,
+	ttl time.Duration,
+) (string, entity.PersonalAccessToken, error) {
+	const op = "pat.Create"
+
+	log := p.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+	)
+	log.Info("creating personal access token")
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	if ttl <= 0 || ttl > p.maxTTL {
+		return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w", op, ErrInvalidTTL)
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(p.scopes, scope) {
+			log.Warn("scope is not allowed for personal access tokens", slog.String("scope", scope))
+			return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w: %q", op, ErrInvalidScope, scope)
+		}
+	}
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	plain := TokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	token := entity.PersonalAccessToken{
+		UserID:    userId,
+		Name:      name,
+		Prefix:    plain[:prefixLen],
+		TokenHash: hash(plain),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}
+
+	id, err := p.tokenStorage.SavePersonalAccessToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenExists) {
+			return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w", op, ErrTokenExists)
+		}
+		log.Error("failed to save personal access token", slog.Any("error", err))
+		return "", entity.PersonalAccessToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token.ID = id
+
+	log.Info("personal access token created", slog.Int64("token_id", id))
+
+	return plain, token, nil
+}
+
+// List returns all personal access tokens of the user, including revoked and expired ones.
+func (p *PAT) List(ctx context.Context, userId int64) ([]entity.PersonalAccessToken, error) {
+	const op = "pat.List"
+
+	tokens, err := p.tokenStorage.PersonalAccessTokens(ctx, userId)
+	if err != nil {
+		p.log.Error("failed to list personal access tokens", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke revokes a personal access token owned by the user.
+func (p *PAT) Revoke(ctx context.Context, userId int64, tokenId int64) error {
+	const op = "pat.Revoke"
+
+	log := p.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userId),
+		slog.Int64("token_id", tokenId),
+	)
+
+	if err := p.tokenStorage.RevokePersonalAccessToken(ctx, userId, tokenId); err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrNotFound)
+		}
+		log.Error("failed to revoke personal access token", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("personal access token revoked")
+
+	return nil
+}
+
+// Validate checks that the plain token is known, not revoked and not expired,
+// that its owner isn't disabled and that the app lets the owner in with a
+// personal access token, and returns it together with the owner and the app.
+func (p *PAT) Validate(
+	ctx context.Context,
+	plain string,
+	appId int,
+) (entity.PersonalAccessToken, entity.User, entity.App, error) {
+	const op = "pat.Validate"
+
+	log := p.log.With(slog.String("op", op), slog.Int("app_id", appId))
+
+	if !strings.HasPrefix(plain, TokenPrefix) {
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	token, err := p.tokenStorage.PersonalAccessTokenByHash(ctx, hash(plain))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to get personal access token", slog.Any("error", err))
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("token_id", token.ID))
+
+	if token.Revoked() || token.Expired(time.Now()) {
+		log.Info("revoked or expired personal access token used")
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	user, err := p.userProvider.UserByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Status == entity.UserStatusDisabled {
+		log.Info("personal access token of a disabled user used")
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	app, err := p.appProvider.App(ctx, appId)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, ErrInvalidAppId)
+		}
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := checkLoginPolicy(log, user, app); err != nil {
+		return entity.PersonalAccessToken{}, entity.User{}, entity.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := p.tokenStorage.TouchPersonalAccessToken(ctx, token.ID); err != nil {
+		log.Error("failed to update token last used time", slog.Any("error", err))
+	}
+
+	return token, user, app, nil
+}
+
+// Exchange trades a personal access token for a regular app token, so it can be
+// used wherever a JWT issued by Login is expected. The JWT carries the token scopes
+// and never outlives the personal access token. It names the personal access
+// token, so it is refused once the personal access token is revoked.
+func (p *PAT) Exchange(ctx context.Context, plain string, appId int) (string, error) {
+	const op = "pat.Exchange"
+
+	log := p.log.With(
+		slog.String("op", op),
+		slog.Int("app_id", appId),
+	)
+
+	token, user, app, err := p.Validate(ctx, plain, appId)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := p.userProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		log.Error("failed to get user roles", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	ttl := p.tokenTTL
+	if left := time.Until(token.ExpiresAt); left < ttl {
+		ttl = left
+	}
+
+	jwtToken, err := jwt.NewToken(p.signingKey, user, app, ttl,
+		jwt.WithAuthContext(time.Now(), []string{AMRPersonalAccessToken}),
+		jwt.WithScopes(token.Scopes),
+		jwt.WithRoles(roles),
+		jwt.WithPersonalAccessToken(token.ID),
+	)
+	if err != nil {
+		log.Error("failed to generate token", slog.Any("error", err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("personal access token exchanged", slog.Int64("token_id", token.ID))
+
+	return jwtToken, nil
+}
+
+// checkLoginPolicy verifies the app lets the user in with a personal access
+// token, the way the auth service checks a login with other methods: a token
+// is a single factor, so apps that require more refuse it.
+func checkLoginPolicy(log *slog.Logger, user entity.User, app entity.App) error {
+	if !app.Settings.AllowsEmail(user.Email) {
+		log.Info("email domain is not allowed by app")
+		return ErrEmailDomainNotAllowed
+	}
+
+	if !app.Settings.AllowsMethod(AMRPersonalAccessToken) {
+		log.Info("personal access tokens are not allowed by app")
+		return ErrLoginMethodNotAllowed
+	}
+
+	achieved := entity.ACRForMethods([]string{AMRPersonalAccessToken})
+	if !entity.ACRSatisfies(achieved, app.Settings.RequiredACR) {
+		log.Info("app requires a stronger authentication", slog.String("app_acr", app.Settings.RequiredACR))
+		return ErrStepUpRequired
+	}
+
+	return nil
+}
+
+func hash(plain string) []byte {
+	sum := sha256.Sum256([]byte(plain))
+	return sum[:]
+}
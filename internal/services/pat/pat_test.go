@@ -0,0 +1,271 @@
+package pat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwt"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+var signingKey = func() *jwk.Key {
+	key, err := jwk.Generate()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func TestPAT_create(t *testing.T) {
+	prefixName := "pat service"
+	type fields struct {
+		tokenStorage *MockTokenStorage
+		userProvider *MockUserProvider
+		appProvider  *MockAppProvider
+	}
+	type args struct {
+		userId int64
+		name   string
+		scopes []string
+		ttl    time.Duration
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create success test"),
+			prepare: func(f *fields, arg args) {
+				f.tokenStorage.EXPECT().SavePersonalAccessToken(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, token entity.PersonalAccessToken) (int64, error) {
+						assert.Equal(t, arg.userId, token.UserID)
+						assert.True(t, strings.HasPrefix(token.Prefix, TokenPrefix))
+						assert.Len(t, token.TokenHash, 32)
+						return 5, nil
+					})
+			},
+			args: args{userId: 1, name: "ci", scopes: []string{"read"}, ttl: time.Hour},
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "create negative test: scope not allowed"),
+			args:    args{userId: 1, name: "ci", scopes: []string{"read", "admin"}, ttl: time.Hour},
+			wantErr: ErrInvalidScope,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "create negative test: empty name"),
+			args:    args{userId: 1, name: " ", ttl: time.Hour},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "create negative test: ttl above maximum"),
+			args:    args{userId: 1, name: "ci", ttl: 48 * time.Hour},
+			wantErr: ErrInvalidTTL,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create negative test: duplicate name"),
+			prepare: func(f *fields, arg args) {
+				f.tokenStorage.EXPECT().SavePersonalAccessToken(gomock.Any(), gomock.Any()).
+					Return(int64(0), storage.ErrTokenExists)
+			},
+			args:    args{userId: 1, name: "ci", ttl: time.Hour},
+			wantErr: ErrTokenExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				tokenStorage: NewMockTokenStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+				appProvider:  NewMockAppProvider(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			service := New(slog.Default(), f.tokenStorage, f.userProvider, f.appProvider, signingKey, 24*time.Hour, time.Hour, []string{"read", "write"})
+			plain, token, err := service.Create(context.Background(), tt.args.userId, tt.args.name, tt.args.scopes, tt.args.ttl)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.True(t, strings.HasPrefix(plain, token.Prefix))
+				assert.Equal(t, int64(5), token.ID)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestPAT_exchange(t *testing.T) {
+	prefixName := "pat service"
+	plain := TokenPrefix + "secret"
+	user := entity.User{ID: 1, Email: "test@mail.com"}
+	valid := entity.PersonalAccessToken{ID: 5, UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	type fields struct {
+		tokenStorage *MockTokenStorage
+		userProvider *MockUserProvider
+		appProvider  *MockAppProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		plain   string
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange success test"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), hash(plain)).Return(entity.PersonalAccessToken{
+					ID:        5,
+					UserID:    user.ID,
+					Scopes:    []string{"read"},
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Secret: "secret"}, nil)
+				f.tokenStorage.EXPECT().TouchPersonalAccessToken(gomock.Any(), int64(5)).Return(nil)
+				f.userProvider.EXPECT().UserRoles(gomock.Any(), user.ID, 1).Return(nil, nil)
+			},
+			plain: plain,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: email domain not allowed"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), hash(plain)).Return(valid, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Settings: entity.AppSettings{
+					AllowedEmailDomains: []string{"corp.com"},
+				}}, nil)
+			},
+			plain:   plain,
+			wantErr: ErrEmailDomainNotAllowed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: personal access tokens not allowed"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), hash(plain)).Return(valid, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Settings: entity.AppSettings{
+					LoginMethods: []string{entity.AMRPassword},
+				}}, nil)
+			},
+			plain:   plain,
+			wantErr: ErrLoginMethodNotAllowed,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: app requires multi-factor"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), hash(plain)).Return(valid, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(user, nil)
+				f.appProvider.EXPECT().App(gomock.Any(), 1).Return(entity.App{ID: 1, Settings: entity.AppSettings{
+					RequiredACR: entity.ACRMultiFactor,
+				}}, nil)
+			},
+			plain:   plain,
+			wantErr: ErrStepUpRequired,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "exchange negative test: not a personal access token"),
+			plain:   "eyJhbGciOiJIUzI1NiJ9",
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: unknown token"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), gomock.Any()).
+					Return(entity.PersonalAccessToken{}, storage.ErrTokenNotFound)
+			},
+			plain:   plain,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: revoked token"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), gomock.Any()).Return(entity.PersonalAccessToken{
+					ID:        5,
+					UserID:    user.ID,
+					ExpiresAt: time.Now().Add(time.Hour),
+					RevokedAt: time.Now(),
+				}, nil)
+			},
+			plain:   plain,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: expired token"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), gomock.Any()).Return(entity.PersonalAccessToken{
+					ID:        5,
+					UserID:    user.ID,
+					ExpiresAt: time.Now().Add(-time.Minute),
+				}, nil)
+			},
+			plain:   plain,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "exchange negative test: user disabled"),
+			prepare: func(f *fields) {
+				f.tokenStorage.EXPECT().PersonalAccessTokenByHash(gomock.Any(), hash(plain)).Return(entity.PersonalAccessToken{
+					ID:        5,
+					UserID:    user.ID,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil)
+				disabled := user
+				disabled.Status = entity.UserStatusDisabled
+				f.userProvider.EXPECT().UserByID(gomock.Any(), user.ID).Return(disabled, nil)
+			},
+			plain:   plain,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				tokenStorage: NewMockTokenStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+				appProvider:  NewMockAppProvider(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.tokenStorage, f.userProvider, f.appProvider, signingKey, 24*time.Hour, time.Hour, []string{"read", "write"})
+			token, err := service.Exchange(context.Background(), tt.plain, 1)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				claims, err := jwt.Parse(token, signingKey.Public())
+				assert.Nil(t, err)
+				tokenId, ok := jwt.PersonalAccessTokenID(claims)
+				assert.True(t, ok)
+				assert.Equal(t, int64(5), tokenId)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package rbac
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+const (
+	// maxAuditBatch limits how many events are written in one storage call.
+	maxAuditBatch = 100
+	// auditWriteTimeout bounds a single batch write.
+	auditWriteTimeout = 5 * time.Second
+)
+
+// AuditWriter records audit events in the background, in batches, so permission
+// checks neither wait for the audit storage nor fail when it does.
+//
+// Events that don't fit into the queue are dropped and logged: authorization
+// must keep working while the audit storage is slow or down.
+type AuditWriter struct {
+	log     *slog.Logger
+	storage AuditStorage
+	events  chan entity.AuditEvent
+	wg      sync.WaitGroup
+}
+
+// NewAuditWriter starts a writer with a queue of the given size.
+func NewAuditWriter(log *slog.Logger, storage AuditStorage, queueSize int) *AuditWriter {
+	w := &AuditWriter{
+		log:     log,
+		storage: storage,
+		events:  make(chan entity.AuditEvent, queueSize),
+	}
+
+	w.wg.Add(1)
+	go w.work()
+
+	return w
+}
+
+// Record queues the events for writing without blocking.
+func (w *AuditWriter) Record(events ...entity.AuditEvent) {
+	for i, event := range events {
+		select {
+		case w.events <- event:
+		default:
+			w.log.Error("audit queue is full, events dropped",
+				slog.String("op", "rbac.AuditWriter.Record"),
+				slog.Int("dropped", len(events)-i),
+			)
+			return
+		}
+	}
+}
+
+// Stop writes the queued events and stops the writer. It must not be used afterwards.
+func (w *AuditWriter) Stop() {
+	close(w.events)
+	w.wg.Wait()
+}
+
+func (w *AuditWriter) work() {
+	defer w.wg.Done()
+
+	for event := range w.events {
+		batch := []entity.AuditEvent{event}
+	collect:
+		for len(batch) < maxAuditBatch {
+			select {
+			case event, ok := <-w.events:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, event)
+			default:
+				break collect
+			}
+		}
+
+		w.write(batch)
+	}
+}
+
+func (w *AuditWriter) write(batch []entity.AuditEvent) {
+	const op = "rbac.AuditWriter.write"
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+
+	if err := w.storage.SaveAuditEvents(ctx, batch); err != nil {
+		w.log.Error("failed to save audit events",
+			slog.String("op", op),
+			slog.Int("events", len(batch)),
+			slog.Any("error", err),
+		)
+	}
+}
@@ -0,0 +1,79 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditWriter_record(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		mu      sync.Mutex
+		written []entity.AuditEvent
+	)
+	storage := NewMockAuditStorage(ctrl)
+	storage.EXPECT().SaveAuditEvents(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, events []entity.AuditEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			written = append(written, events...)
+			return nil
+		}).MinTimes(1)
+
+	writer := NewAuditWriter(slog.Default(), storage, 10)
+	writer.Record(entity.AuditEvent{ActorID: 1}, entity.AuditEvent{ActorID: 2})
+	writer.Record(entity.AuditEvent{ActorID: 3})
+	writer.Stop()
+
+	assert.Equal(t, []entity.AuditEvent{{ActorID: 1}, {ActorID: 2}, {ActorID: 3}}, written)
+}
+
+func TestAuditWriter_storageError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := NewMockAuditStorage(ctrl)
+	storage.EXPECT().SaveAuditEvents(gomock.Any(), gomock.Any()).Return(errors.New("testError")).MinTimes(1)
+
+	writer := NewAuditWriter(slog.Default(), storage, 10)
+	writer.Record(entity.AuditEvent{ActorID: 1})
+	writer.Stop()
+}
+
+func TestAuditWriter_queueFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var written []entity.AuditEvent
+	storage := NewMockAuditStorage(ctrl)
+	storage.EXPECT().SaveAuditEvents(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, events []entity.AuditEvent) error {
+			if len(written) == 0 {
+				close(started)
+				<-release
+			}
+			written = append(written, events...)
+			return nil
+		}).Times(2)
+
+	writer := NewAuditWriter(slog.Default(), storage, 1)
+	writer.Record(entity.AuditEvent{ActorID: 1})
+	<-started
+	// The writer is busy and the queue has room for one event only.
+	writer.Record(entity.AuditEvent{ActorID: 2}, entity.AuditEvent{ActorID: 3})
+	close(release)
+	writer.Stop()
+
+	assert.Equal(t, []entity.AuditEvent{{ActorID: 1}, {ActorID: 2}}, written)
+}
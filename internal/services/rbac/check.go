@@ -0,0 +1,150 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/lib/policy"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// maxBatchChecks limits how many checks a single CheckPermissions call may carry.
+const maxBatchChecks = 100
+
+var (
+	ErrInvalidCheck  = errors.New("resource and action required")
+	ErrTooManyChecks = errors.New("too many permission checks")
+)
+
+// CheckPermission decides whether the user may perform the action on the resource
+// in the app, based on the user's roles. A user that doesn't exist or isn't
+// active is denied everything, whatever roles are left on record.
+//
+// Every decision is recorded in the audit trail in the background, with the
+// actor who asked: the user themselves, another user, or zero for the app
+// asking with its own client token. Audit failures never fail the check.
+func (r *RBAC) CheckPermission(
+	ctx context.Context,
+	actorId int64,
+	userId int64,
+	appId int,
+	resource string,
+	action string,
+) (bool, error) {
+	const op = "rbac.CheckPermission"
+
+	allowed, err := r.CheckPermissions(ctx, actorId, userId, appId, []entity.PermissionCheck{{Resource: resource, Action: action}})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed[0], nil
+}
+
+// CheckPermissions is the batch variant of CheckPermission. Decisions are returned
+// in the order of the checks.
+func (r *RBAC) CheckPermissions(
+	ctx context.Context,
+	actorId int64,
+	userId int64,
+	appId int,
+	checks []entity.PermissionCheck,
+) ([]bool, error) {
+	const op = "rbac.CheckPermissions"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int64("actor_id", actorId),
+		slog.Int64("user_id", userId),
+		slog.Int("app_id", appId),
+	)
+
+	if len(checks) > maxBatchChecks {
+		return nil, fmt.Errorf("%s: %w", op, ErrTooManyChecks)
+	}
+	for _, check := range checks {
+		if check.Resource == "" || check.Action == "" {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCheck)
+		}
+	}
+
+	inactive, err := r.inactiveReason(ctx, userId)
+	if err != nil {
+		log.Error("failed to get user", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var roles []entity.Role
+	if inactive == "" {
+		roles, err = r.roleStorage.UserRoles(ctx, userId, appId)
+		if err != nil {
+			log.Error("failed to get user roles", slog.Any("error", err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		log.Warn("permission checked for inactive user", slog.String("reason", inactive))
+	}
+
+	allowed := make([]bool, len(checks))
+	events := make([]entity.AuditEvent, len(checks))
+	for i, check := range checks {
+		var decision policy.Decision
+		if inactive == "" {
+			decision = policy.Evaluate(roles, check.Resource, check.Action)
+		}
+		allowed[i] = decision.Allowed
+
+		log.Info("permission checked",
+			slog.String("resource", check.Resource),
+			slog.String("action", check.Action),
+			slog.Bool("allowed", decision.Allowed),
+			slog.String("role", decision.Role),
+			slog.String("permission", decision.Permission),
+		)
+
+		events[i] = entity.AuditEvent{
+			ActorID:      actorId,
+			Action:       entity.AuditActionCheck,
+			TargetUserID: userId,
+			AppID:        appId,
+			Details:      decisionDetails(check, decision, inactive),
+		}
+	}
+
+	r.auditor.Record(events...)
+
+	return allowed, nil
+}
+
+// inactiveReason says why the user can't be granted anything, empty when the
+// user exists and is active.
+func (r *RBAC) inactiveReason(ctx context.Context, userId int64) (string, error) {
+	user, err := r.userProvider.UserByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "user not found", nil
+		}
+		return "", err
+	}
+	if user.Status != entity.UserStatusActive {
+		return "user " + user.Status, nil
+	}
+
+	return "", nil
+}
+
+func decisionDetails(check entity.PermissionCheck, decision policy.Decision, inactive string) string {
+	if inactive != "" {
+		return fmt.Sprintf("%s:%s denied, %s", check.Resource, check.Action, inactive)
+	}
+	if !decision.Allowed {
+		return fmt.Sprintf("%s:%s denied", check.Resource, check.Action)
+	}
+	if decision.Permission == "" {
+		return fmt.Sprintf("%s:%s allowed by role %s", check.Resource, check.Action, decision.Role)
+	}
+	return fmt.Sprintf("%s:%s allowed by role %s via %s", check.Resource, check.Action, decision.Role, decision.Permission)
+}
@@ -0,0 +1,237 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBAC_checkPermission(t *testing.T) {
+	prefixName := "rbac service"
+	editor := entity.Role{Name: "editor", AppID: 1, Permissions: []string{"docs/*:read", "docs/drafts/*:*", "publish"}}
+	admin := entity.Role{Name: entity.RoleAdmin, AppID: entity.GlobalAppID}
+	type args struct {
+		resource string
+		action   string
+	}
+	type test struct {
+		name    string
+		status  string
+		userErr error
+		roles   []entity.Role
+		args    args
+		allowed bool
+		details string
+	}
+	tests := []test{
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission allowed by resource pattern"),
+			roles:   []entity.Role{editor},
+			args:    args{resource: "docs/readme", action: "read"},
+			allowed: true,
+			details: "docs/readme:read allowed by role editor via docs/*:read",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission allowed by action wildcard"),
+			roles:   []entity.Role{editor},
+			args:    args{resource: "docs/drafts/plan", action: "delete"},
+			allowed: true,
+			details: "docs/drafts/plan:delete allowed by role editor via docs/drafts/*:*",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: action not granted"),
+			roles:   []entity.Role{editor},
+			args:    args{resource: "docs/readme", action: "write"},
+			details: "docs/readme:write denied",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: nested resource"),
+			roles:   []entity.Role{{Name: "reader", Permissions: []string{"docs/*:read"}}},
+			args:    args{resource: "docs/drafts/plan", action: "read"},
+			details: "docs/drafts/plan:read denied",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: label permission"),
+			roles:   []entity.Role{editor},
+			args:    args{resource: "publish", action: "read"},
+			details: "publish:read denied",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: no roles"),
+			args:    args{resource: "docs/readme", action: "read"},
+			details: "docs/readme:read denied",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission allowed for global admin"),
+			roles:   []entity.Role{admin},
+			args:    args{resource: "billing", action: "refund"},
+			allowed: true,
+			details: "billing:refund allowed by role admin",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: disabled admin"),
+			status:  entity.UserStatusDisabled,
+			roles:   []entity.Role{admin},
+			args:    args{resource: "billing", action: "refund"},
+			details: "billing:refund denied, user disabled",
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permission denied: deleted user"),
+			userErr: storage.ErrUserNotFound,
+			roles:   []entity.Role{editor},
+			args:    args{resource: "docs/readme", action: "read"},
+			details: "docs/readme:read denied, user not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			roleStorage := NewMockRoleStorage(ctrl)
+			userProvider := NewMockUserProvider(ctrl)
+			auditor := NewMockAuditor(ctrl)
+
+			status := tt.status
+			if status == "" {
+				status = entity.UserStatusActive
+			}
+			userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{ID: 5, Status: status}, tt.userErr)
+			// Roles left on record for an inactive user are never looked at.
+			if status == entity.UserStatusActive && tt.userErr == nil {
+				roleStorage.EXPECT().UserRoles(gomock.Any(), int64(5), 1).Return(tt.roles, nil)
+			}
+			auditor.EXPECT().Record(entity.AuditEvent{
+				ActorID:      3,
+				Action:       entity.AuditActionCheck,
+				TargetUserID: 5,
+				AppID:        1,
+				Details:      tt.details,
+			})
+
+			service := New(slog.Default(), roleStorage, userProvider, auditor)
+			allowed, err := service.CheckPermission(context.Background(), 3, 5, 1, tt.args.resource, tt.args.action)
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestRBAC_checkPermissions(t *testing.T) {
+	prefixName := "rbac service"
+	type fields struct {
+		roleStorage  *MockRoleStorage
+		userProvider *MockUserProvider
+		auditor      *MockAuditor
+	}
+	type test struct {
+		name        string
+		prepare     func(f *fields)
+		checks      []entity.PermissionCheck
+		wantAllowed []bool
+		wantErr     error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "check permissions success test"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{ID: 5, Status: entity.UserStatusActive}, nil)
+				f.roleStorage.EXPECT().UserRoles(gomock.Any(), int64(5), 1).
+					Return([]entity.Role{{Name: "viewer", Permissions: []string{"reports:read"}}}, nil)
+				f.auditor.EXPECT().Record(gomock.Any(), gomock.Any())
+			},
+			checks: []entity.PermissionCheck{
+				{Resource: "reports", Action: "read"},
+				{Resource: "reports", Action: "write"},
+			},
+			wantAllowed: []bool{true, false},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "check permissions success test: disabled user denied everything"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{ID: 5, Status: entity.UserStatusDisabled}, nil)
+				f.auditor.EXPECT().Record(gomock.Any(), gomock.Any())
+			},
+			checks: []entity.PermissionCheck{
+				{Resource: "reports", Action: "read"},
+				{Resource: "reports", Action: "write"},
+			},
+			wantAllowed: []bool{false, false},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "check permissions success test: unknown user denied"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{}, storage.ErrUserNotFound)
+				f.auditor.EXPECT().Record(gomock.Any())
+			},
+			checks:      []entity.PermissionCheck{{Resource: "reports", Action: "read"}},
+			wantAllowed: []bool{false},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "check permissions negative test: user provider returns error"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{}, errors.New("testError"))
+			},
+			checks:  []entity.PermissionCheck{{Resource: "reports", Action: "read"}},
+			wantErr: errors.New("testError"),
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permissions negative test: empty action"),
+			checks:  []entity.PermissionCheck{{Resource: "reports"}},
+			wantErr: ErrInvalidCheck,
+		},
+		{
+			name:    fmt.Sprintf("%s: %s", prefixName, "check permissions negative test: too many checks"),
+			checks:  make([]entity.PermissionCheck, maxBatchChecks+1),
+			wantErr: ErrTooManyChecks,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "check permissions negative test: role storage returns error"),
+			prepare: func(f *fields) {
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{ID: 5, Status: entity.UserStatusActive}, nil)
+				f.roleStorage.EXPECT().UserRoles(gomock.Any(), int64(5), 1).Return(nil, errors.New("testError"))
+			},
+			checks:  []entity.PermissionCheck{{Resource: "reports", Action: "read"}},
+			wantErr: errors.New("testError"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				roleStorage:  NewMockRoleStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+				auditor:      NewMockAuditor(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.roleStorage, f.userProvider, f.auditor)
+			allowed, err := service.CheckPermissions(context.Background(), 5, 5, 1, tt.checks)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantAllowed, allowed)
+			} else {
+				assert.NotNil(t, err)
+				if !errors.Is(err, tt.wantErr) {
+					assert.ErrorContains(t, err, tt.wantErr.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+//go:generate mockgen -destination=mock_rbac.go -package=rbac . RoleStorage,UserProvider,AuditStorage,Auditor
+
+var (
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrInvalidName       = errors.New("invalid name")
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrPermissionMissing = errors.New("permission not found")
+	ErrPermissionExists  = errors.New("permission already exists")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrBuiltinRole       = errors.New("built-in role can't be deleted")
+	ErrAdminRole         = errors.New("the admin role is only granted and revoked with SetAdmin and RevokeAdmin")
+)
+
+type RBAC struct {
+	log          *slog.Logger
+	roleStorage  RoleStorage
+	userProvider UserProvider
+	auditor      Auditor
+}
+
+type RoleStorage interface {
+	SaveRole(ctx context.Context, role entity.Role) (int64, error)
+	Role(ctx context.Context, roleId int64) (entity.Role, error)
+	Roles(ctx context.Context) ([]entity.Role, error)
+	UserRoles(ctx context.Context, userId int64, appId int) ([]entity.Role, error)
+	DeleteRole(ctx context.Context, roleId int64) error
+	SavePermission(ctx context.Context, permission entity.Permission) (int64, error)
+	Permissions(ctx context.Context) ([]entity.Permission, error)
+	DeletePermission(ctx context.Context, permissionId int64) error
+	AddRolePermission(ctx context.Context, roleId int64, permissionId int64) error
+	RemoveRolePermission(ctx context.Context, roleId int64, permissionId int64) error
+	AssignRole(ctx context.Context, userId int64, roleId int64) error
+	UnassignRole(ctx context.Context, userId int64, roleId int64) error
+}
+
+type UserProvider interface {
+	UserByID(ctx context.Context, userId int64) (entity.User, error)
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+}
+
+type AuditStorage interface {
+	SaveAuditEvents(ctx context.Context, events []entity.AuditEvent) error
+}
+
+// Auditor records audit events without holding up the caller, see AuditWriter.
+type Auditor interface {
+	Record(events ...entity.AuditEvent)
+}
+
+// New returns a new instance of the RBAC service
+func New(
+	log *slog.Logger,
+	roleStorage RoleStorage,
+	userProvider UserProvider,
+	auditor Auditor,
+) *RBAC {
+	return &RBAC{
+		log:          log,
+		roleStorage:  roleStorage,
+		userProvider: userProvider,
+		auditor:      auditor,
+	}
+}
+
+// CreateRole creates a role. Roles with zero app id apply to every app.
+func (r *RBAC) CreateRole(
+	ctx context.Context,
+	adminId int64,
+	name string,
+	appId int,
+	description string,
+) (entity.Role, error) {
+	const op = "rbac.CreateRole"
+
+	log := r.log.With(slog.String("op", op), slog.Int64("admin_id", adminId))
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return entity.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !validName(name) {
+		return entity.Role{}, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	role := entity.Role{Name: name, AppID: appId, Description: description}
+
+	id, err := r.roleStorage.SaveRole(ctx, role)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleExists) {
+			return entity.Role{}, fmt.Errorf("%s: %w", op, ErrRoleExists)
+		}
+		log.Error("failed to save role", slog.Any("error", err))
+		return entity.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+	role.ID = id
+
+	log.Info("role created", slog.Int64("role_id", id), slog.String("name", name), slog.Int("app_id", appId))
+
+	return role, nil
+}
+
+// ListRoles returns all roles with their permissions.
+func (r *RBAC) ListRoles(ctx context.Context, adminId int64) ([]entity.Role, error) {
+	const op = "rbac.ListRoles"
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := r.roleStorage.Roles(ctx)
+	if err != nil {
+		r.log.Error("failed to list roles", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// DeleteRole deletes a role and all its assignments. The global admin role can't be deleted.
+func (r *RBAC) DeleteRole(ctx context.Context, adminId int64, roleId int64) error {
+	const op = "rbac.DeleteRole"
+
+	log := r.log.With(slog.String("op", op), slog.Int64("admin_id", adminId), slog.Int64("role_id", roleId))
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	role, err := r.role(ctx, roleId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if role.Admin() {
+		return fmt.Errorf("%s: %w", op, ErrBuiltinRole)
+	}
+
+	if err := r.roleStorage.DeleteRole(ctx, roleId); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("failed to delete role", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role deleted")
+
+	return nil
+}
+
+// CreatePermission creates a permission that can then be granted to roles.
+func (r *RBAC) CreatePermission(
+	ctx context.Context,
+	adminId int64,
+	name string,
+	description string,
+) (entity.Permission, error) {
+	const op = "rbac.CreatePermission"
+
+	log := r.log.With(slog.String("op", op), slog.Int64("admin_id", adminId))
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return entity.Permission{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !validName(name) {
+		return entity.Permission{}, fmt.Errorf("%s: %w", op, ErrInvalidName)
+	}
+
+	permission := entity.Permission{Name: name, Description: description}
+
+	id, err := r.roleStorage.SavePermission(ctx, permission)
+	if err != nil {
+		if errors.Is(err, storage.ErrPermissionExists) {
+			return entity.Permission{}, fmt.Errorf("%s: %w", op, ErrPermissionExists)
+		}
+		log.Error("failed to save permission", slog.Any("error", err))
+		return entity.Permission{}, fmt.Errorf("%s: %w", op, err)
+	}
+	permission.ID = id
+
+	log.Info("permission created", slog.Int64("permission_id", id), slog.String("name", name))
+
+	return permission, nil
+}
+
+// ListPermissions returns all permissions.
+func (r *RBAC) ListPermissions(ctx context.Context, adminId int64) ([]entity.Permission, error) {
+	const op = "rbac.ListPermissions"
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	permissions, err := r.roleStorage.Permissions(ctx)
+	if err != nil {
+		r.log.Error("failed to list permissions", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+// DeletePermission deletes a permission and revokes it from every role.
+func (r *RBAC) DeletePermission(ctx context.Context, adminId int64, permissionId int64) error {
+	const op = "rbac.DeletePermission"
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.roleStorage.DeletePermission(ctx, permissionId); err != nil {
+		if errors.Is(err, storage.ErrPermissionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPermissionMissing)
+		}
+		r.log.Error("failed to delete permission", slog.String("op", op), slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GrantPermission grants a permission to a role.
+func (r *RBAC) GrantPermission(ctx context.Context, adminId int64, roleId int64, permissionId int64) error {
+	const op = "rbac.GrantPermission"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int64("admin_id", adminId),
+		slog.Int64("role_id", roleId),
+		slog.Int64("permission_id", permissionId),
+	)
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := r.role(ctx, roleId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	permissions, err := r.roleStorage.Permissions(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !containsPermission(permissions, permissionId) {
+		return fmt.Errorf("%s: %w", op, ErrPermissionMissing)
+	}
+
+	if err := r.roleStorage.AddRolePermission(ctx, roleId, permissionId); err != nil {
+		log.Error("failed to grant permission", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("permission granted")
+
+	return nil
+}
+
+// RevokePermission revokes a permission from a role.
+func (r *RBAC) RevokePermission(ctx context.Context, adminId int64, roleId int64, permissionId int64) error {
+	const op = "rbac.RevokePermission"
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.roleStorage.RemoveRolePermission(ctx, roleId, permissionId); err != nil {
+		if errors.Is(err, storage.ErrPermissionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPermissionMissing)
+		}
+		r.log.Error("failed to revoke permission", slog.String("op", op), slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AssignRole gives a role to a user. The admin role is refused: it goes
+// through SetAdmin, which records who granted it.
+func (r *RBAC) AssignRole(ctx context.Context, adminId int64, userId int64, roleId int64) error {
+	const op = "rbac.AssignRole"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int64("admin_id", adminId),
+		slog.Int64("user_id", userId),
+		slog.Int64("role_id", roleId),
+	)
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	role, err := r.role(ctx, roleId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if role.Admin() {
+		log.Warn("tried to assign the admin role")
+		return fmt.Errorf("%s: %w", op, ErrAdminRole)
+	}
+
+	if _, err := r.userProvider.UserByID(ctx, userId); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.roleStorage.AssignRole(ctx, userId, roleId); err != nil {
+		log.Error("failed to assign role", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+// UnassignRole takes a role away from a user. The admin role is refused: it
+// goes through RevokeAdmin, which keeps the last admin.
+func (r *RBAC) UnassignRole(ctx context.Context, adminId int64, userId int64, roleId int64) error {
+	const op = "rbac.UnassignRole"
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.Int64("admin_id", adminId),
+		slog.Int64("user_id", userId),
+		slog.Int64("role_id", roleId),
+	)
+
+	if err := r.requireAdmin(ctx, adminId); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	role, err := r.role(ctx, roleId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if role.Admin() {
+		log.Warn("tried to unassign the admin role")
+		return fmt.Errorf("%s: %w", op, ErrAdminRole)
+	}
+
+	if err := r.roleStorage.UnassignRole(ctx, userId, roleId); err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("failed to unassign role", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role unassigned")
+
+	return nil
+}
+
+// UserRoles returns the roles the user has in the app, global roles included.
+func (r *RBAC) UserRoles(ctx context.Context, userId int64, appId int) ([]entity.Role, error) {
+	const op = "rbac.UserRoles"
+
+	roles, err := r.roleStorage.UserRoles(ctx, userId, appId)
+	if err != nil {
+		r.log.Error("failed to get user roles", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (r *RBAC) requireAdmin(ctx context.Context, userId int64) error {
+	isAdmin, err := r.userProvider.IsAdmin(ctx, userId)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrPermissionDenied
+		}
+		return err
+	}
+	if !isAdmin {
+		r.log.Warn("non-admin user tried to manage roles", slog.Int64("user_id", userId))
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+func (r *RBAC) role(ctx context.Context, roleId int64) (entity.Role, error) {
+	role, err := r.roleStorage.Role(ctx, roleId)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			return entity.Role{}, ErrRoleNotFound
+		}
+		return entity.Role{}, err
+	}
+
+	return role, nil
+}
+
+// validName reports whether the name can be used for a role or permission.
+// Names end up space-separated in token claims, so they can't contain whitespace.
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n")
+}
+
+func containsPermission(permissions []entity.Permission, id int64) bool {
+	for _, permission := range permissions {
+		if permission.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBAC_createRole(t *testing.T) {
+	prefixName := "rbac service"
+	type fields struct {
+		roleStorage  *MockRoleStorage
+		userProvider *MockUserProvider
+	}
+	type args struct {
+		adminId int64
+		name    string
+		appId   int
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields, arg args)
+		args    args
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create role success test"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.adminId).Return(true, nil)
+				f.roleStorage.EXPECT().SaveRole(gomock.Any(), entity.Role{Name: arg.name, AppID: arg.appId}).
+					Return(int64(2), nil)
+			},
+			args: args{adminId: 1, name: "editor", appId: 1},
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create role negative test: caller is not admin"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.adminId).Return(false, nil)
+			},
+			args:    args{adminId: 1, name: "editor", appId: 1},
+			wantErr: ErrPermissionDenied,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create role negative test: name with spaces"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.adminId).Return(true, nil)
+			},
+			args:    args{adminId: 1, name: "chief editor", appId: 1},
+			wantErr: ErrInvalidName,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "create role negative test: role exists"),
+			prepare: func(f *fields, arg args) {
+				f.userProvider.EXPECT().IsAdmin(gomock.Any(), arg.adminId).Return(true, nil)
+				f.roleStorage.EXPECT().SaveRole(gomock.Any(), gomock.Any()).Return(int64(0), storage.ErrRoleExists)
+			},
+			args:    args{adminId: 1, name: "editor", appId: 1},
+			wantErr: ErrRoleExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				roleStorage:  NewMockRoleStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f, tt.args)
+			}
+
+			service := New(slog.Default(), f.roleStorage, f.userProvider, NewMockAuditor(ctrl))
+			role, err := service.CreateRole(context.Background(), tt.args.adminId, tt.args.name, tt.args.appId, "")
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(2), role.ID)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestRBAC_deleteRole(t *testing.T) {
+	prefixName := "rbac service"
+	type fields struct {
+		roleStorage  *MockRoleStorage
+		userProvider *MockUserProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		roleId  int64
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "delete role success test"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(2)).Return(entity.Role{ID: 2, Name: "editor", AppID: 1}, nil)
+				f.roleStorage.EXPECT().DeleteRole(gomock.Any(), int64(2)).Return(nil)
+			},
+			roleId: 2,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "delete role negative test: global admin role"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(1)).Return(entity.Role{ID: 1, Name: entity.RoleAdmin}, nil)
+			},
+			roleId:  1,
+			wantErr: ErrBuiltinRole,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "delete role negative test: role not found"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(3)).Return(entity.Role{}, storage.ErrRoleNotFound)
+			},
+			roleId:  3,
+			wantErr: ErrRoleNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				roleStorage:  NewMockRoleStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+			f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.roleStorage, f.userProvider, NewMockAuditor(ctrl))
+			err := service.DeleteRole(context.Background(), 1, tt.roleId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
+
+func TestRBAC_assignRole(t *testing.T) {
+	prefixName := "rbac service"
+	type fields struct {
+		roleStorage  *MockRoleStorage
+		userProvider *MockUserProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		userId  int64
+		roleId  int64
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "assign role success test"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(2)).Return(entity.Role{ID: 2, Name: "editor"}, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(5)).Return(entity.User{ID: 5}, nil)
+				f.roleStorage.EXPECT().AssignRole(gomock.Any(), int64(5), int64(2)).Return(nil)
+			},
+			userId: 5,
+			roleId: 2,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "assign role negative test: user not found"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(2)).Return(entity.Role{ID: 2, Name: "editor"}, nil)
+				f.userProvider.EXPECT().UserByID(gomock.Any(), int64(6)).Return(entity.User{}, storage.ErrUserNotFound)
+			},
+			userId:  6,
+			roleId:  2,
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "assign role negative test: global admin role"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(1)).Return(entity.Role{ID: 1, Name: entity.RoleAdmin}, nil)
+			},
+			userId:  5,
+			roleId:  1,
+			wantErr: ErrAdminRole,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				roleStorage:  NewMockRoleStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+			f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.roleStorage, f.userProvider, NewMockAuditor(ctrl))
+			err := service.AssignRole(context.Background(), 1, tt.userId, tt.roleId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
+
+func TestRBAC_unassignRole(t *testing.T) {
+	prefixName := "rbac service"
+	type fields struct {
+		roleStorage  *MockRoleStorage
+		userProvider *MockUserProvider
+	}
+	type test struct {
+		name    string
+		prepare func(f *fields)
+		roleId  int64
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "unassign role success test"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(2)).Return(entity.Role{ID: 2, Name: "editor"}, nil)
+				f.roleStorage.EXPECT().UnassignRole(gomock.Any(), int64(5), int64(2)).Return(nil)
+			},
+			roleId: 2,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "unassign role negative test: global admin role"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(1)).Return(entity.Role{ID: 1, Name: entity.RoleAdmin}, nil)
+			},
+			roleId:  1,
+			wantErr: ErrAdminRole,
+		},
+		{
+			name: fmt.Sprintf("%s: %s", prefixName, "unassign role negative test: role not found"),
+			prepare: func(f *fields) {
+				f.roleStorage.EXPECT().Role(gomock.Any(), int64(3)).Return(entity.Role{}, storage.ErrRoleNotFound)
+			},
+			roleId:  3,
+			wantErr: ErrRoleNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				roleStorage:  NewMockRoleStorage(ctrl),
+				userProvider: NewMockUserProvider(ctrl),
+			}
+			f.userProvider.EXPECT().IsAdmin(gomock.Any(), int64(1)).Return(true, nil)
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			service := New(slog.Default(), f.roleStorage, f.userProvider, NewMockAuditor(ctrl))
+			err := service.UnassignRole(context.Background(), 1, 5, tt.roleId)
+
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr), err)
+			}
+		})
+	}
+}
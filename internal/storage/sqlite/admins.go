@@ -0,0 +1,230 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// SetAdmin gives the user the global admin role and records who did it.
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, actorID int64) error {
+	const op = "storage.sqlite.SetAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := userExists(ctx, tx, userID); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_roles(user_id, role_id)
+		SELECT ?, id FROM roles WHERE name=? AND app_id=?
+		ON CONFLICT DO NOTHING`, userID, entity.RoleAdmin, entity.GlobalAppID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+		ActorID:      actorID,
+		Action:       entity.AuditActionGrantAdmin,
+		TargetUserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// RevokeAdmin takes the global admin role away from the user and records who did it.
+// The last remaining admin can't be revoked.
+func (s *Storage) RevokeAdmin(ctx context.Context, userID int64, actorID int64) error {
+	const op = "storage.sqlite.RevokeAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := userExists(ctx, tx, userID); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	// The count check and the delete are a single statement, so two concurrent
+	// revokes can't both pass the check and leave no admin at all.
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_roles
+		WHERE user_id = ?
+		  AND role_id = (SELECT id FROM roles WHERE name = ? AND app_id = ?)
+		  AND (SELECT COUNT(*) FROM user_roles
+		       WHERE role_id = (SELECT id FROM roles WHERE name = ? AND app_id = ?)) > 1`,
+		userID, entity.RoleAdmin, entity.GlobalAppID, entity.RoleAdmin, entity.GlobalAppID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if affected == 0 {
+		var isAdmin bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM user_roles
+			JOIN roles ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = ? AND roles.name = ? AND roles.app_id = ?)`,
+			userID, entity.RoleAdmin, entity.GlobalAppID).Scan(&isAdmin)
+		if err != nil {
+			return fmt.Errorf("%s : %s", op, err)
+		}
+		if isAdmin {
+			return fmt.Errorf("%s : %w", op, storage.ErrLastAdmin)
+		}
+		return fmt.Errorf("%s : %w", op, storage.ErrNotAdmin)
+	}
+
+	err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+		ActorID:      actorID,
+		Action:       entity.AuditActionRevokeAdmin,
+		TargetUserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// ResetPassword replaces the password hash of the user and records who did it.
+func (s *Storage) ResetPassword(ctx context.Context, userID int64, passHash []byte, actorID int64) error {
+	const op = "storage.sqlite.ResetPassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET pass_hash=? WHERE id=?", passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrUserNotFound)
+	}
+
+	err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+		ActorID:      actorID,
+		Action:       entity.AuditActionResetPassword,
+		TargetUserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes every active personal access token of the user, sets
+// the time access tokens issued before are refused from and forgets their known
+// devices, so the next login is treated as a new device. Returns the number of
+// personal access tokens revoked.
+func (s *Storage) RevokeSessions(ctx context.Context, userID int64, actorID int64) (int64, error) {
+	const op = "storage.sqlite.RevokeSessions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := userExists(ctx, tx, userID); err != nil {
+		return 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE personal_access_tokens SET revoked_at=CURRENT_TIMESTAMP
+		WHERE user_id=? AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	revoked, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET sessions_revoked_at=? WHERE id=?", time.Now().UTC(), userID); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_devices WHERE user_id=?", userID); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+		ActorID:      actorID,
+		Action:       entity.AuditActionRevokeSessions,
+		TargetUserID: userID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return revoked, nil
+}
+
+func userExists(ctx context.Context, tx *sql.Tx, userID int64) error {
+	var id int64
+
+	err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id=?", userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func insertAuditEvent(ctx context.Context, tx *sql.Tx, event entity.AuditEvent) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO audit_log(actor_id, action, target_user_id, app_id, details)
+		VALUES(?,?,?,?,?)`,
+		event.ActorID,
+		event.Action,
+		sql.NullInt64{Int64: event.TargetUserID, Valid: event.TargetUserID != 0},
+		sql.NullInt64{Int64: int64(event.AppID), Valid: event.AppID != 0},
+		event.Details,
+	)
+
+	return err
+}
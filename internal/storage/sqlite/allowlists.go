@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// PostLogoutRedirectURIs returns the URIs the app may send users to after they log out.
+func (s *Storage) PostLogoutRedirectURIs(ctx context.Context, appID int) ([]string, error) {
+	const op = "storage.sqlite.PostLogoutRedirectURIs"
+
+	uris, err := s.appList(ctx, "SELECT uri FROM app_post_logout_redirect_uris WHERE app_id=? ORDER BY uri", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return uris, nil
+}
+
+// SetPostLogoutRedirectURIs replaces the post-logout redirect URIs of the app.
+func (s *Storage) SetPostLogoutRedirectURIs(ctx context.Context, appID int, uris []string) error {
+	const op = "storage.sqlite.SetPostLogoutRedirectURIs"
+
+	return s.setAppList(ctx, op, appID, "DELETE FROM app_post_logout_redirect_uris WHERE app_id=?",
+		"INSERT INTO app_post_logout_redirect_uris(app_id, uri) VALUES(?,?) ON CONFLICT DO NOTHING", uris)
+}
+
+// WebOrigins returns the origins browser code of the app may call the endpoints from.
+func (s *Storage) WebOrigins(ctx context.Context, appID int) ([]string, error) {
+	const op = "storage.sqlite.WebOrigins"
+
+	origins, err := s.appList(ctx, "SELECT origin FROM app_web_origins WHERE app_id=? ORDER BY origin", appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return origins, nil
+}
+
+// SetWebOrigins replaces the web origins of the app.
+func (s *Storage) SetWebOrigins(ctx context.Context, appID int, origins []string) error {
+	const op = "storage.sqlite.SetWebOrigins"
+
+	return s.setAppList(ctx, op, appID, "DELETE FROM app_web_origins WHERE app_id=?",
+		"INSERT INTO app_web_origins(app_id, origin) VALUES(?,?) ON CONFLICT DO NOTHING", origins)
+}
+
+// OriginAllowed reports whether the origin is a web origin of any app.
+func (s *Storage) OriginAllowed(ctx context.Context, origin string) (bool, error) {
+	const op = "storage.sqlite.OriginAllowed"
+
+	var allowed bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM app_web_origins WHERE origin=?)", origin).
+		Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return allowed, nil
+}
+
+// appList returns the single text column the query selects for the app.
+func (s *Storage) appList(ctx context.Context, query string, appID int) ([]string, error) {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+// setAppList replaces the values of the app in one transaction: it runs the
+// delete statement, then the insert statement once per value.
+func (s *Storage) setAppList(ctx context.Context, op string, appID int, deleteQuery, insertQuery string,
+	values []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM apps WHERE id=?", appID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s : %w", op, storage.ErrAppNotFound)
+		}
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, deleteQuery, appID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	for _, value := range values {
+		if _, err := tx.ExecContext(ctx, insertQuery, appID, value); err != nil {
+			return fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
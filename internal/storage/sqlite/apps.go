@@ -0,0 +1,324 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const appColumns = `id, name, secret, access_token_ttl, allow_registration, login_methods,
+	required_acr, allowed_email_domains, client_scopes, client_public_key, token_exchange_from, third_party,
+	grant_types, token_auth_method, loopback_any_port, user_scopes`
+
+const insertAppQuery = `INSERT INTO apps(name, secret, access_token_ttl, allow_registration,
+	login_methods, required_acr, allowed_email_domains, client_scopes, client_public_key, token_exchange_from,
+	third_party, grant_types, token_auth_method, loopback_any_port, user_scopes)
+	VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+const updateAppQuery = `UPDATE apps SET name=?, access_token_ttl=?, allow_registration=?,
+	login_methods=?, required_acr=?, allowed_email_domains=?, client_scopes=?, client_public_key=?,
+	token_exchange_from=?, third_party=?, grant_types=?, token_auth_method=?,
+	loopback_any_port=?, user_scopes=? WHERE id=?`
+
+func (s *Storage) SaveApp(ctx context.Context, app entity.App) (int, error) {
+	const op = "storage.sqlite.SaveApp"
+
+	stmt, err := s.db.Prepare(insertAppQuery)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, append([]any{app.Name, app.Secret}, settingsArgs(app.Settings)...)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrAppExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return int(id), nil
+}
+
+func (s *Storage) Apps(ctx context.Context) ([]entity.App, error) {
+	const op = "storage.sqlite.Apps"
+
+	stmt, err := s.db.Prepare("SELECT " + appColumns + " FROM apps ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var apps []entity.App
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		apps = append(apps, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp updates the name and settings of the app. The secret only changes through UpdateAppSecret.
+func (s *Storage) UpdateApp(ctx context.Context, app entity.App) error {
+	const op = "storage.sqlite.UpdateApp"
+
+	stmt, err := s.db.Prepare(updateAppQuery)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	args := append([]any{app.Name}, settingsArgs(app.Settings)...)
+	res, err := stmt.ExecContext(ctx, append(args, app.ID)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s : %w", op, storage.ErrAppExists)
+		}
+
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrAppNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateAppSecret(ctx context.Context, id int, secret string) error {
+	const op = "storage.sqlite.UpdateAppSecret"
+
+	return s.execAffectingOne(ctx, op, storage.ErrAppNotFound, "UPDATE apps SET secret=? WHERE id=?", secret, id)
+}
+
+// appOwnedTables hold rows of a single app, in their app_id column. Their
+// foreign keys cascade, but DeleteApp doesn't rely on the connection
+// enforcing them.
+var appOwnedTables = []string{
+	"app_redirect_uris",
+	"app_post_logout_redirect_uris",
+	"app_web_origins",
+	"authorization_codes",
+	"client_assertions",
+	"client_registrations",
+	"consent_requests",
+	"consents",
+	"device_codes",
+}
+
+// DeleteApp deletes the app together with everything that belongs to it, in
+// one transaction: the rows of appOwnedTables, its roles with their
+// assignments and permissions, and its id in the token exchange lists of
+// other apps.
+func (s *Storage) DeleteApp(ctx context.Context, id int) error {
+	const op = "storage.sqlite.DeleteApp"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM apps WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrAppNotFound)
+	}
+
+	for _, table := range appOwnedTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE app_id=?", id); err != nil {
+			return fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	// Global roles have app id 0, which no app has.
+	const appRoles = "SELECT id FROM roles WHERE app_id=?"
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE role_id IN (" + appRoles + ")",
+		"DELETE FROM role_permissions WHERE role_id IN (" + appRoles + ")",
+		"DELETE FROM roles WHERE app_id=?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	if err := removeTokenExchangeSource(ctx, tx, id); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// removeTokenExchangeSource removes the app id from the token exchange lists of all apps.
+func removeTokenExchangeSource(ctx context.Context, tx *sql.Tx, id int) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, token_exchange_from FROM apps WHERE token_exchange_from != ''")
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[int]string)
+	for rows.Next() {
+		var (
+			appID int
+			from  string
+		)
+		if err := rows.Scan(&appID, &from); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		ids, err := parseAppIDs(from)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		if slices.Contains(ids, id) {
+			updated[appID] = formatAppIDs(slices.DeleteFunc(ids, func(from int) bool { return from == id }))
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for appID, from := range updated {
+		if _, err := tx.ExecContext(ctx, "UPDATE apps SET token_exchange_from=? WHERE id=?", from, appID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settingsArgs returns the app settings in the column order of appColumns.
+// Durations are stored in whole seconds.
+func settingsArgs(settings entity.AppSettings) []any {
+	return []any{
+		int64(settings.AccessTokenTTL / time.Second),
+		settings.AllowRegistration,
+		strings.Join(settings.LoginMethods, " "),
+		settings.RequiredACR,
+		strings.Join(settings.AllowedEmailDomains, " "),
+		strings.Join(settings.ClientScopes, " "),
+		settings.ClientPublicKey,
+		formatAppIDs(settings.TokenExchangeFrom),
+		settings.ThirdParty,
+		strings.Join(settings.GrantTypes, " "),
+		settings.TokenAuthMethod,
+		settings.LoopbackAnyPort,
+		strings.Join(settings.UserScopes, " "),
+	}
+}
+
+func scanApp(row rowScanner) (entity.App, error) {
+	var (
+		app                 entity.App
+		accessTokenTTL      int64
+		loginMethods        string
+		allowedEmailDomains string
+		clientScopes        string
+		tokenExchangeFrom   string
+		grantTypes          string
+		userScopes          string
+	)
+
+	err := row.Scan(&app.ID, &app.Name, &app.Secret, &accessTokenTTL,
+		&app.Settings.AllowRegistration, &loginMethods, &app.Settings.RequiredACR, &allowedEmailDomains,
+		&clientScopes, &app.Settings.ClientPublicKey, &tokenExchangeFrom, &app.Settings.ThirdParty,
+		&grantTypes, &app.Settings.TokenAuthMethod, &app.Settings.LoopbackAnyPort, &userScopes)
+	if err != nil {
+		return entity.App{}, err
+	}
+
+	app.Settings.AccessTokenTTL = time.Duration(accessTokenTTL) * time.Second
+	app.Settings.LoginMethods = strings.Fields(loginMethods)
+	app.Settings.AllowedEmailDomains = strings.Fields(allowedEmailDomains)
+	app.Settings.ClientScopes = strings.Fields(clientScopes)
+	app.Settings.GrantTypes = strings.Fields(grantTypes)
+	app.Settings.UserScopes = strings.Fields(userScopes)
+	if app.Settings.TokenExchangeFrom, err = parseAppIDs(tokenExchangeFrom); err != nil {
+		return entity.App{}, err
+	}
+
+	return app, nil
+}
+
+func formatAppIDs(ids []int) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, " ")
+}
+
+func parseAppIDs(s string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Fields(s) {
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid app id %q: %w", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
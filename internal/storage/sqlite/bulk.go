@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// ImportUsers inserts the users in a single transaction. Users that can't be
+// inserted, e.g. because the email is taken, don't stop the others: the returned
+// slice holds an error per record, nil for the ones imported.
+//
+// With dryRun the transaction is rolled back, so the result shows what an
+// import would do without changing anything.
+func (s *Storage) ImportUsers(ctx context.Context, records []entity.UserRecord, dryRun bool) ([]error, error) {
+	const op = "storage.sqlite.ImportUsers"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	insertUser, err := tx.PrepareContext(ctx, `INSERT INTO users(email, pass_hash, status, email_verified, created_at)
+		VALUES(?,?,?,?,?)`)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(insertUser)
+
+	errs := make([]error, len(records))
+	for i, record := range records {
+		var createdAt sql.NullString
+		if !record.CreatedAt.IsZero() {
+			createdAt = sql.NullString{String: record.CreatedAt.UTC().Format(timeFormat), Valid: true}
+		}
+
+		status := record.Status
+		if status == "" {
+			status = entity.UserStatusActive
+		}
+
+		// A failed statement only undoes itself in SQLite, the rest of the
+		// transaction stays intact.
+		res, err := insertUser.ExecContext(ctx, record.Email, record.PassHash, status, record.EmailVerified, createdAt)
+		if err != nil {
+			if isUniqueViolation(err) {
+				errs[i] = storage.ErrUserExists
+				continue
+			}
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+
+		if !record.Admin {
+			continue
+		}
+
+		userID, err := res.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_roles(user_id, role_id)
+			SELECT ?, id FROM roles WHERE name=? AND app_id=?`, userID, entity.RoleAdmin, entity.GlobalAppID)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	if dryRun {
+		return errs, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return errs, nil
+}
+
+// UserRecords returns up to limit users with ids greater than afterID, ordered by id.
+func (s *Storage) UserRecords(ctx context.Context, afterID int64, limit int) ([]entity.UserRecord, error) {
+	const op = "storage.sqlite.UserRecords"
+
+	stmt, err := s.db.Prepare(`SELECT ` + userColumns + `,
+			EXISTS(SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+				WHERE user_roles.user_id = users.id AND roles.name = ? AND roles.app_id = ?)
+		FROM users WHERE id > ? ORDER BY id LIMIT ?`)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, entity.RoleAdmin, entity.GlobalAppID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var records []entity.UserRecord
+	for rows.Next() {
+		var (
+			record            entity.UserRecord
+			createdAt         sql.NullTime
+			sessionsRevokedAt sql.NullTime
+		)
+
+		err := rows.Scan(&record.ID, &record.Email, &record.PassHash, &record.Status, &record.EmailVerified,
+			&createdAt, &sessionsRevokedAt, &record.Admin)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		record.CreatedAt = createdAt.Time
+		record.SessionsRevokedAt = sessionsRevokedAt.Time
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,263 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const consentColumns = `c.user_id, c.app_id, a.name, c.scopes, c.grant_id, c.created_at, c.updated_at`
+
+const consentRequestColumns = `id, challenge_hash, app_id, user_id, redirect_uri, scopes, state, code_challenge,
+	code_challenge_method, nonce, auth_time, amr, expires_at`
+
+// Consent returns the consent of the user to the app.
+func (s *Storage) Consent(ctx context.Context, userID int64, appID int) (entity.Consent, error) {
+	const op = "storage.sqlite.Consent"
+
+	stmt, err := s.db.Prepare(`SELECT ` + consentColumns + ` FROM consents c JOIN apps a ON a.id = c.app_id
+		WHERE c.user_id=? AND c.app_id=?`)
+	if err != nil {
+		return entity.Consent{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	consent, err := scanConsent(stmt.QueryRowContext(ctx, userID, appID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Consent{}, fmt.Errorf("%s : %w", op, storage.ErrConsentNotFound)
+		}
+		return entity.Consent{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return consent, nil
+}
+
+// Consents returns the consents the user gave, to any app.
+func (s *Storage) Consents(ctx context.Context, userID int64) ([]entity.Consent, error) {
+	const op = "storage.sqlite.Consents"
+
+	stmt, err := s.db.Prepare(`SELECT ` + consentColumns + ` FROM consents c JOIN apps a ON a.id = c.app_id
+		WHERE c.user_id=? ORDER BY c.app_id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var consents []entity.Consent
+	for rows.Next() {
+		consent, err := scanConsent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return consents, nil
+}
+
+// SaveConsent creates the consent of the user to the app, or replaces the
+// scopes of the existing one. GrantID and CreatedAt are kept on replace.
+func (s *Storage) SaveConsent(ctx context.Context, consent entity.Consent) error {
+	const op = "storage.sqlite.SaveConsent"
+
+	stmt, err := s.db.Prepare(`INSERT INTO consents(user_id, app_id, scopes, grant_id, created_at, updated_at)
+		VALUES(?,?,?,?,?,?)
+		ON CONFLICT(user_id, app_id) DO UPDATE SET scopes=excluded.scopes, updated_at=excluded.updated_at`)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	now := time.Now().UTC()
+	_, err = stmt.ExecContext(ctx, consent.UserID, consent.AppID, strings.Join(consent.Scopes, " "), consent.GrantID, now, now)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// RevokeConsent deletes the consent of the user to the app, with the
+// authorization codes not exchanged yet, the approved device codes not polled
+// yet and the consent requests pending for them. A consent that doesn't exist
+// returns ErrConsentNotFound.
+func (s *Storage) RevokeConsent(ctx context.Context, userID int64, appID int) error {
+	const op = "storage.sqlite.RevokeConsent"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM consents WHERE user_id=? AND app_id=?", userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrConsentNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM authorization_codes WHERE user_id=? AND app_id=? AND used_at IS NULL",
+		userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM device_codes WHERE user_id=? AND app_id=? AND status=?",
+		userID, appID, entity.DeviceCodeApproved)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM consent_requests WHERE user_id=? AND app_id=?", userID, appID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// SaveConsentRequest stores a new consent request. Expired requests are
+// deleted on the way.
+func (s *Storage) SaveConsentRequest(ctx context.Context, req entity.ConsentRequest) (int64, error) {
+	const op = "storage.sqlite.SaveConsentRequest"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM consent_requests WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO consent_requests(challenge_hash, app_id, user_id, redirect_uri, scopes,
+		state, code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`,
+		req.ChallengeHash, req.AppID, req.UserID, req.RedirectURI, strings.Join(req.Scopes, " "), req.State,
+		req.CodeChallenge, req.CodeChallengeMethod, req.Nonce, req.AuthTime.UTC(), strings.Join(req.AMR, " "),
+		req.ExpiresAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+// UseConsentRequest deletes the consent request with the challenge hash and
+// returns it, so it is answered once. Later calls return ErrConsentRequestNotFound.
+func (s *Storage) UseConsentRequest(ctx context.Context, hash []byte) (entity.ConsentRequest, error) {
+	const op = "storage.sqlite.UseConsentRequest"
+
+	stmt, err := s.db.Prepare(`DELETE FROM consent_requests WHERE challenge_hash=?
+		RETURNING ` + consentRequestColumns)
+	if err != nil {
+		return entity.ConsentRequest{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	req, err := scanConsentRequest(stmt.QueryRowContext(ctx, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.ConsentRequest{}, fmt.Errorf("%s : %w", op, storage.ErrConsentRequestNotFound)
+		}
+		return entity.ConsentRequest{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return req, nil
+}
+
+func scanConsent(row rowScanner) (entity.Consent, error) {
+	var (
+		consent entity.Consent
+		scopes  string
+	)
+
+	err := row.Scan(&consent.UserID, &consent.AppID, &consent.AppName, &scopes, &consent.GrantID, &consent.CreatedAt,
+		&consent.UpdatedAt)
+	if err != nil {
+		return entity.Consent{}, err
+	}
+
+	consent.Scopes = strings.Fields(scopes)
+
+	return consent, nil
+}
+
+func scanConsentRequest(row rowScanner) (entity.ConsentRequest, error) {
+	var (
+		req    entity.ConsentRequest
+		scopes string
+		amr    string
+	)
+
+	err := row.Scan(&req.ID, &req.ChallengeHash, &req.AppID, &req.UserID, &req.RedirectURI, &scopes, &req.State,
+		&req.CodeChallenge, &req.CodeChallengeMethod, &req.Nonce, &req.AuthTime, &amr, &req.ExpiresAt)
+	if err != nil {
+		return entity.ConsentRequest{}, err
+	}
+
+	req.Scopes = strings.Fields(scopes)
+	req.AMR = strings.Fields(amr)
+
+	return req, nil
+}
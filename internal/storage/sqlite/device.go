@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const deviceCodeColumns = `id, device_code_hash, user_code, app_id, scopes, status, user_id, auth_time, amr,
+	poll_interval, last_polled_at, expires_at`
+
+// SaveDeviceCode stores a new device code. Expired codes are deleted on the way.
+// A user code that is already taken returns ErrUserCodeExists.
+func (s *Storage) SaveDeviceCode(ctx context.Context, code entity.DeviceCode) (int64, error) {
+	const op = "storage.sqlite.SaveDeviceCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM device_codes WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO device_codes(device_code_hash, user_code, app_id, scopes, status,
+		poll_interval, expires_at) VALUES(?,?,?,?,?,?,?)`,
+		code.DeviceCodeHash, code.UserCode, code.AppID, strings.Join(code.Scopes, " "), entity.DeviceCodePending,
+		int64(code.PollInterval/time.Second), code.ExpiresAt.UTC())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrUserCodeExists)
+		}
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+// DeviceCodeByUserCode returns the device code with the user code.
+func (s *Storage) DeviceCodeByUserCode(ctx context.Context, userCode string) (entity.DeviceCode, error) {
+	const op = "storage.sqlite.DeviceCodeByUserCode"
+
+	stmt, err := s.db.Prepare("SELECT " + deviceCodeColumns + " FROM device_codes WHERE user_code=?")
+	if err != nil {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, userCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.DeviceCode{}, fmt.Errorf("%s : %w", op, storage.ErrDeviceCodeNotFound)
+		}
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return code, nil
+}
+
+// DecideDeviceCode records the decision of the user on a pending device code that
+// has not expired. Other codes return ErrDeviceCodeNotFound.
+func (s *Storage) DecideDeviceCode(
+	ctx context.Context,
+	userCode string,
+	status string,
+	userID int64,
+	authTime time.Time,
+	amr []string,
+) error {
+	const op = "storage.sqlite.DecideDeviceCode"
+
+	return s.execAffectingOne(ctx, op, storage.ErrDeviceCodeNotFound, `UPDATE device_codes
+		SET status=?, user_id=?, auth_time=?, amr=?
+		WHERE user_code=? AND status=? AND expires_at > ?`,
+		status, userID, authTime.UTC(), strings.Join(amr, " "), userCode, entity.DeviceCodePending, time.Now().UTC())
+}
+
+// PollDeviceCode returns the device code and records the poll. LastPolledAt of
+// the returned code is the time of the previous poll.
+//
+// A code the user has decided on is deleted as it is returned, so the device
+// gets the outcome once: later polls return ErrDeviceCodeNotFound.
+func (s *Storage) PollDeviceCode(ctx context.Context, hash []byte) (entity.DeviceCode, error) {
+	const op = "storage.sqlite.PollDeviceCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	code, err := scanDeviceCode(tx.QueryRowContext(ctx,
+		"SELECT "+deviceCodeColumns+" FROM device_codes WHERE device_code_hash=?", hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.DeviceCode{}, fmt.Errorf("%s : %w", op, storage.ErrDeviceCodeNotFound)
+		}
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	var res sql.Result
+	if code.Status == entity.DeviceCodePending {
+		res, err = tx.ExecContext(ctx, "UPDATE device_codes SET last_polled_at=? WHERE id=? AND status=?",
+			time.Now().UTC(), code.ID, entity.DeviceCodePending)
+	} else {
+		res, err = tx.ExecContext(ctx, "DELETE FROM device_codes WHERE id=?", code.ID)
+	}
+	if err != nil {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return entity.DeviceCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return code, nil
+}
+
+// SetDevicePollInterval changes how often the device may poll for the code.
+func (s *Storage) SetDevicePollInterval(ctx context.Context, id int64, interval time.Duration) error {
+	const op = "storage.sqlite.SetDevicePollInterval"
+
+	return s.execAffectingOne(ctx, op, storage.ErrDeviceCodeNotFound,
+		"UPDATE device_codes SET poll_interval=? WHERE id=?", int64(interval/time.Second), id)
+}
+
+func scanDeviceCode(row rowScanner) (entity.DeviceCode, error) {
+	var (
+		code         entity.DeviceCode
+		scopes       string
+		userID       sql.NullInt64
+		authTime     sql.NullTime
+		amr          string
+		pollInterval int64
+		lastPolledAt sql.NullTime
+	)
+
+	err := row.Scan(&code.ID, &code.DeviceCodeHash, &code.UserCode, &code.AppID, &scopes, &code.Status, &userID,
+		&authTime, &amr, &pollInterval, &lastPolledAt, &code.ExpiresAt)
+	if err != nil {
+		return entity.DeviceCode{}, err
+	}
+
+	code.Scopes = strings.Fields(scopes)
+	code.UserID = userID.Int64
+	code.AuthTime = authTime.Time
+	code.AMR = strings.Fields(amr)
+	code.PollInterval = time.Duration(pollInterval) * time.Second
+	code.LastPolledAt = lastPolledAt.Time
+
+	return code, nil
+}
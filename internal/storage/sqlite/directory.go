@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+// SyncDirectoryUser saves what the directory says about the user at login,
+// creating the user if needed, and returns the user id.
+//
+// The user is found by email case-insensitively and created with the email
+// lower-cased. The synced attributes and the roles granted by directory
+// groups are replaced. Roles that don't exist are skipped, and roles assigned
+// by hand are kept, as is the admin role.
+func (s *Storage) SyncDirectoryUser(ctx context.Context, user entity.DirectoryUser, roles []entity.RoleRef) (int64, error) {
+	const op = "storage.sqlite.SyncDirectoryUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID int64
+	// Emails are compared case-insensitively; a user saved with the exact spelling wins.
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE lower(email) = lower(?) ORDER BY email = ? DESC, id LIMIT 1",
+		user.Email, user.Email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The password stays in the directory: an empty hash never matches one.
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, "INSERT INTO users(email, pass_hash, email_verified) VALUES(lower(?),?,?)",
+			user.Email, []byte{}, true)
+		if err == nil {
+			userID, err = res.LastInsertId()
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_attributes WHERE user_id = ?", userID); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	for name, value := range user.Attributes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_attributes(user_id, name, value) VALUES(?,?,?)",
+			userID, name, value)
+		if err != nil {
+			return 0, fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = ? AND from_directory
+		AND role_id NOT IN (SELECT id FROM roles WHERE name = ? AND app_id = ?)`,
+		userID, entity.RoleAdmin, entity.GlobalAppID)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	for _, role := range roles {
+		if role.Admin() {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO user_roles(user_id, role_id, from_directory)
+			SELECT ?, id, TRUE FROM roles WHERE name = ? AND app_id = ?
+			ON CONFLICT DO NOTHING`,
+			userID, role.Name, role.AppID)
+		if err != nil {
+			return 0, fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return userID, nil
+}
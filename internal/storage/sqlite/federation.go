@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const federatedIdentityColumns = "id, provider, subject, user_id, email, created_at"
+
+// SaveFederationState stores a login started at an upstream identity provider.
+// Expired states are deleted on the way.
+func (s *Storage) SaveFederationState(ctx context.Context, state entity.FederationState) error {
+	const op = "storage.sqlite.SaveFederationState"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM federation_states WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO federation_states(state_hash, provider, nonce, code_verifier, resume,
+		expires_at) VALUES(?,?,?,?,?,?)`,
+		state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.Resume, state.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// UseFederationState deletes and returns the state with the hash, so a state
+// is used once. An unknown or already used state returns ErrFederationStateNotFound.
+func (s *Storage) UseFederationState(ctx context.Context, hash []byte) (entity.FederationState, error) {
+	const op = "storage.sqlite.UseFederationState"
+
+	stmt, err := s.db.Prepare(`DELETE FROM federation_states WHERE state_hash=?
+		RETURNING state_hash, provider, nonce, code_verifier, resume, expires_at`)
+	if err != nil {
+		return entity.FederationState{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	var state entity.FederationState
+	err = stmt.QueryRowContext(ctx, hash).Scan(&state.StateHash, &state.Provider, &state.Nonce, &state.CodeVerifier,
+		&state.Resume, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.FederationState{}, fmt.Errorf("%s : %w", op, storage.ErrFederationStateNotFound)
+		}
+		return entity.FederationState{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return state, nil
+}
+
+// FederatedIdentity returns the identity with the subject at the provider.
+func (s *Storage) FederatedIdentity(ctx context.Context, provider string, subject string) (entity.FederatedIdentity, error) {
+	const op = "storage.sqlite.FederatedIdentity"
+
+	stmt, err := s.db.Prepare("SELECT " + federatedIdentityColumns + " FROM federated_identities WHERE provider=? AND subject=?")
+	if err != nil {
+		return entity.FederatedIdentity{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	identity, err := scanFederatedIdentity(stmt.QueryRowContext(ctx, provider, subject))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.FederatedIdentity{}, fmt.Errorf("%s : %w", op, storage.ErrIdentityNotFound)
+		}
+		return entity.FederatedIdentity{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return identity, nil
+}
+
+// SaveFederatedIdentity links the identity to an existing user. An identity
+// already linked returns ErrIdentityExists.
+func (s *Storage) SaveFederatedIdentity(ctx context.Context, identity entity.FederatedIdentity) (int64, error) {
+	const op = "storage.sqlite.SaveFederatedIdentity"
+
+	stmt, err := s.db.Prepare("INSERT INTO federated_identities(provider, subject, user_id, email) VALUES(?,?,?,?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, identity.Provider, identity.Subject, identity.UserID, identity.Email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrIdentityExists)
+		}
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+// SaveFederatedUser creates a user with the identity's email and links the
+// identity to it. The user has no password, so they can only log in through
+// the provider until one is set.
+//
+// Returns ErrUserExists if the email is taken and ErrIdentityExists if the
+// identity is already linked.
+func (s *Storage) SaveFederatedUser(ctx context.Context, identity entity.FederatedIdentity, emailVerified bool) (int64, error) {
+	const op = "storage.sqlite.SaveFederatedUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// An empty hash never matches a password.
+	res, err := tx.ExecContext(ctx, "INSERT INTO users(email, pass_hash, email_verified) VALUES(?,?,?)",
+		identity.Email, []byte{}, emailVerified)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO federated_identities(provider, subject, user_id, email) VALUES(?,?,?,?)",
+		identity.Provider, identity.Subject, userID, identity.Email)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrIdentityExists)
+		}
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return userID, nil
+}
+
+func scanFederatedIdentity(row rowScanner) (entity.FederatedIdentity, error) {
+	var identity entity.FederatedIdentity
+
+	err := row.Scan(&identity.ID, &identity.Provider, &identity.Subject, &identity.UserID, &identity.Email,
+		&identity.CreatedAt)
+	if err != nil {
+		return entity.FederatedIdentity{}, err
+	}
+
+	return identity, nil
+}
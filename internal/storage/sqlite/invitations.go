@@ -0,0 +1,333 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const invitationColumns = `id, email, token_hash, role_ids, org_id, org_role, invited_by, expires_at, created_at,
+	accepted_at, revoked_at, user_id`
+
+func (s *Storage) SaveInvitation(ctx context.Context, invitation entity.Invitation) (int64, error) {
+	const op = "storage.sqlite.SaveInvitation"
+
+	stmt, err := s.db.Prepare(`INSERT INTO invitations(email, token_hash, role_ids, org_id, org_role, invited_by, expires_at)
+		VALUES(?,?,?,?,?,?,?)`)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, invitation.Email, invitation.TokenHash, formatIDs(invitation.RoleIDs),
+		sql.NullInt64{Int64: invitation.OrgID, Valid: invitation.OrgID != 0}, invitation.OrgRole,
+		invitation.InvitedBy, invitation.ExpiresAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Invitations(ctx context.Context) ([]entity.Invitation, error) {
+	const op = "storage.sqlite.Invitations"
+
+	stmt, err := s.db.Prepare("SELECT " + invitationColumns + " FROM invitations ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var invitations []entity.Invitation
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return invitations, nil
+}
+
+func (s *Storage) InvitationByHash(ctx context.Context, hash []byte) (entity.Invitation, error) {
+	const op = "storage.sqlite.InvitationByHash"
+
+	stmt, err := s.db.Prepare("SELECT " + invitationColumns + " FROM invitations WHERE token_hash=?")
+	if err != nil {
+		return entity.Invitation{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	invitation, err := scanInvitation(stmt.QueryRowContext(ctx, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Invitation{}, fmt.Errorf("%s : %w", op, storage.ErrInvitationNotFound)
+		}
+
+		return entity.Invitation{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return invitation, nil
+}
+
+// RevokeInvitation revokes a pending invitation. Accepted and already revoked
+// invitations are reported as not found.
+func (s *Storage) RevokeInvitation(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.RevokeInvitation"
+
+	return s.execAffectingOne(ctx, op, storage.ErrInvitationNotFound, `UPDATE invitations SET revoked_at=CURRENT_TIMESTAMP
+		WHERE id=? AND accepted_at IS NULL AND revoked_at IS NULL`, id)
+}
+
+// AcceptInvitation creates the invited user with the given password hash, grants
+// the roles and organization membership of the invitation and marks it accepted,
+// all in one transaction. Returns the id of the new user.
+func (s *Storage) AcceptInvitation(ctx context.Context, invitation entity.Invitation, passHash []byte) (int64, error) {
+	const op = "storage.sqlite.AcceptInvitation"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := claimInvitation(ctx, tx, invitation.ID); err != nil {
+		return 0, fmt.Errorf("%s : %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO users(email, pass_hash, email_verified) VALUES(?,?,TRUE)", invitation.Email, passHash)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrUserExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := grantInvitation(ctx, tx, invitation, userID); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return userID, nil
+}
+
+// AcceptInvitationByUser grants the roles and organization membership of the
+// invitation to an existing user and marks it accepted, all in one transaction.
+// Accepting an invitation into an organization the user already belongs to
+// keeps their current role there.
+func (s *Storage) AcceptInvitationByUser(ctx context.Context, invitation entity.Invitation, userID int64) error {
+	const op = "storage.sqlite.AcceptInvitationByUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := claimInvitation(ctx, tx, invitation.ID); err != nil {
+		return fmt.Errorf("%s : %w", op, err)
+	}
+
+	if err := grantInvitation(ctx, tx, invitation, userID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+// claimInvitation marks the invitation accepted if it is still pending, so it
+// can't be accepted twice. Otherwise it reports storage.ErrInvitationNotFound.
+func claimInvitation(ctx context.Context, tx *sql.Tx, id int64) error {
+	res, err := tx.ExecContext(ctx, `UPDATE invitations SET accepted_at=CURRENT_TIMESTAMP
+		WHERE id=? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?`, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// grantInvitation gives the user the roles and organization membership of the
+// invitation, records each grant in the audit trail on behalf of the inviter
+// and links the invitation to the user.
+//
+// Roles deleted since the invitation was sent are skipped, and so is the admin
+// role: admin is only granted through GrantAdmin.
+func grantInvitation(ctx context.Context, tx *sql.Tx, invitation entity.Invitation, userID int64) error {
+	for _, roleID := range invitation.RoleIDs {
+		var role entity.Role
+		err := tx.QueryRowContext(ctx, "SELECT id, name, app_id FROM roles WHERE id=?", roleID).
+			Scan(&role.ID, &role.Name, &role.AppID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if role.Admin() {
+			continue
+		}
+
+		res, err := tx.ExecContext(ctx, "INSERT INTO user_roles(user_id, role_id) VALUES(?,?) ON CONFLICT DO NOTHING",
+			userID, role.ID)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			continue
+		}
+
+		err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+			ActorID:      invitation.InvitedBy,
+			Action:       entity.AuditActionGrantRole,
+			TargetUserID: userID,
+			AppID:        role.AppID,
+			Details:      fmt.Sprintf("role %q by invitation %d", role.Name, invitation.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if invitation.OrgID != 0 {
+		res, err := tx.ExecContext(ctx, `INSERT INTO organization_members(org_id, user_id, role)
+			VALUES(?,?,?) ON CONFLICT DO NOTHING`, invitation.OrgID, userID, invitation.OrgRole)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected != 0 {
+			err = insertAuditEvent(ctx, tx, entity.AuditEvent{
+				ActorID:      invitation.InvitedBy,
+				Action:       entity.AuditActionJoinOrg,
+				TargetUserID: userID,
+				Details:      fmt.Sprintf("organization %d as %s by invitation %d", invitation.OrgID, invitation.OrgRole, invitation.ID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE invitations SET user_id=? WHERE id=?", userID, invitation.ID)
+
+	return err
+}
+
+func scanInvitation(row rowScanner) (entity.Invitation, error) {
+	var (
+		invitation entity.Invitation
+		roleIDs    string
+		orgID      sql.NullInt64
+		acceptedAt sql.NullTime
+		revokedAt  sql.NullTime
+		userID     sql.NullInt64
+	)
+
+	err := row.Scan(&invitation.ID, &invitation.Email, &invitation.TokenHash, &roleIDs, &orgID, &invitation.OrgRole,
+		&invitation.InvitedBy, &invitation.ExpiresAt, &invitation.CreatedAt, &acceptedAt, &revokedAt, &userID)
+	if err != nil {
+		return entity.Invitation{}, err
+	}
+
+	invitation.RoleIDs, err = parseIDs(roleIDs)
+	if err != nil {
+		return entity.Invitation{}, err
+	}
+	invitation.OrgID = orgID.Int64
+	invitation.AcceptedAt = acceptedAt.Time
+	invitation.RevokedAt = revokedAt.Time
+	invitation.UserID = userID.Int64
+
+	return invitation, nil
+}
+
+func formatIDs(ids []int64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+func parseIDs(s string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Fields(s) {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// TOTPFactor returns the authenticator app of the user, confirmed or not.
+func (s *Storage) TOTPFactor(ctx context.Context, userID int64) (entity.TOTPFactor, error) {
+	const op = "storage.sqlite.TOTPFactor"
+
+	var (
+		factor      entity.TOTPFactor
+		confirmedAt sql.NullTime
+	)
+
+	err := s.db.QueryRowContext(ctx, `SELECT user_id, secret, confirmed_at, last_step FROM totp_factors
+		WHERE user_id=?`, userID).Scan(&factor.UserID, &factor.Secret, &confirmedAt, &factor.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.TOTPFactor{}, fmt.Errorf("%s : %w", op, storage.ErrFactorNotFound)
+		}
+		return entity.TOTPFactor{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	factor.ConfirmedAt = confirmedAt.Time
+
+	return factor, nil
+}
+
+// SaveTOTPFactor saves an unconfirmed authenticator app of the user, replacing
+// an earlier unconfirmed one. A confirmed one is never replaced: returns
+// ErrFactorExists.
+func (s *Storage) SaveTOTPFactor(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.sqlite.SaveTOTPFactor"
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO totp_factors(user_id, secret) VALUES(?,?)
+		ON CONFLICT(user_id) DO UPDATE SET secret=excluded.secret, last_step=0 WHERE confirmed_at IS NULL`,
+		userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrFactorExists)
+	}
+
+	return nil
+}
+
+// ConfirmTOTPFactor confirms the authenticator app of the user with a code of
+// the time step. Returns ErrFactorNotFound if there is no unconfirmed one.
+func (s *Storage) ConfirmTOTPFactor(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.sqlite.ConfirmTOTPFactor"
+
+	res, err := s.db.ExecContext(ctx, `UPDATE totp_factors SET confirmed_at=?, last_step=?
+		WHERE user_id=? AND confirmed_at IS NULL`, time.Now().UTC(), step, userID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrFactorNotFound)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that a code of the time step was accepted for the
+// confirmed authenticator app of the user. The step must be later than the
+// last one used, otherwise returns ErrOTPReplayed: of two concurrent logins
+// with the same code, only one succeeds.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.sqlite.UseTOTPStep"
+
+	res, err := s.db.ExecContext(ctx, `UPDATE totp_factors SET last_step=?
+		WHERE user_id=? AND confirmed_at IS NOT NULL AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrOTPReplayed)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const authorizationCodeColumns = `id, code_hash, app_id, user_id, redirect_uri, scopes, code_challenge,
+	code_challenge_method, nonce, auth_time, amr, expires_at, used_at`
+
+// RedirectURIs returns the redirect URIs registered for the app.
+func (s *Storage) RedirectURIs(ctx context.Context, appID int) ([]string, error) {
+	const op = "storage.sqlite.RedirectURIs"
+
+	stmt, err := s.db.Prepare("SELECT uri FROM app_redirect_uris WHERE app_id=? ORDER BY uri")
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var uris []string
+	for rows.Next() {
+		var uri string
+		if err := rows.Scan(&uri); err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		uris = append(uris, uri)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return uris, nil
+}
+
+// SetRedirectURIs replaces the redirect URIs registered for the app.
+func (s *Storage) SetRedirectURIs(ctx context.Context, appID int, uris []string) error {
+	const op = "storage.sqlite.SetRedirectURIs"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM apps WHERE id=?", appID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s : %w", op, storage.ErrAppNotFound)
+		}
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM app_redirect_uris WHERE app_id=?", appID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := insertRedirectURIs(ctx, tx, appID, uris); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+func insertRedirectURIs(ctx context.Context, tx *sql.Tx, appID int, uris []string) error {
+	for _, uri := range uris {
+		_, err := tx.ExecContext(ctx, `INSERT INTO app_redirect_uris(app_id, uri) VALUES(?,?)
+			ON CONFLICT DO NOTHING`, appID, uri)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveAuthorizationCode stores a new authorization code. Codes that have expired
+// are deleted on the way, so the table only ever holds the codes in flight.
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code entity.AuthorizationCode) (int64, error) {
+	const op = "storage.sqlite.SaveAuthorizationCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM authorization_codes WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO authorization_codes(code_hash, app_id, user_id, redirect_uri, scopes,
+		code_challenge, code_challenge_method, nonce, auth_time, amr, expires_at) VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
+		code.CodeHash, code.AppID, code.UserID, code.RedirectURI, strings.Join(code.Scopes, " "),
+		code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime.UTC(), strings.Join(code.AMR, " "),
+		code.ExpiresAt.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+// UseAuthorizationCode marks the code as used and returns it. A code can only
+// be used once: later calls with the same hash return ErrCodeNotFound.
+func (s *Storage) UseAuthorizationCode(ctx context.Context, hash []byte) (entity.AuthorizationCode, error) {
+	const op = "storage.sqlite.UseAuthorizationCode"
+
+	stmt, err := s.db.Prepare(`UPDATE authorization_codes SET used_at=CURRENT_TIMESTAMP
+		WHERE code_hash=? AND used_at IS NULL
+		RETURNING ` + authorizationCodeColumns)
+	if err != nil {
+		return entity.AuthorizationCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	code, err := scanAuthorizationCode(stmt.QueryRowContext(ctx, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.AuthorizationCode{}, fmt.Errorf("%s : %w", op, storage.ErrCodeNotFound)
+		}
+		return entity.AuthorizationCode{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return code, nil
+}
+
+func scanAuthorizationCode(row rowScanner) (entity.AuthorizationCode, error) {
+	var (
+		code   entity.AuthorizationCode
+		scopes string
+		amr    string
+		usedAt sql.NullTime
+	)
+
+	err := row.Scan(&code.ID, &code.CodeHash, &code.AppID, &code.UserID, &code.RedirectURI, &scopes,
+		&code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, &amr, &code.ExpiresAt, &usedAt)
+	if err != nil {
+		return entity.AuthorizationCode{}, err
+	}
+
+	code.Scopes = strings.Fields(scopes)
+	code.AMR = strings.Fields(amr)
+	code.UsedAt = usedAt.Time
+
+	return code, nil
+}
+
+// SaveClientAssertion records the id (jti) of a client assertion until it expires.
+// An assertion seen before returns ErrAssertionReplayed. Expired records are
+// deleted on the way.
+func (s *Storage) SaveClientAssertion(ctx context.Context, appID int, jti string, expiresAt time.Time) error {
+	const op = "storage.sqlite.SaveClientAssertion"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM client_assertions WHERE expires_at < ?", time.Now().UTC()); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO client_assertions(app_id, jti, expires_at) VALUES(?,?,?)
+		ON CONFLICT DO NOTHING`, appID, jti, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrAssertionReplayed)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
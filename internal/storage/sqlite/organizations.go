@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+const membershipColumns = `organization_members.org_id, organization_members.user_id, users.email,
+	organization_members.role, organization_members.created_at`
+
+// SaveOrganization creates an organization with the given user as its owner.
+func (s *Storage) SaveOrganization(ctx context.Context, name string, ownerID int64) (int64, error) {
+	const op = "storage.sqlite.SaveOrganization"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO organizations(name) VALUES(?)", name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrOrgExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO organization_members(org_id, user_id, role) VALUES(?,?,?)",
+		id, ownerID, entity.OrgRoleOwner)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Organization(ctx context.Context, id int64) (entity.Organization, error) {
+	const op = "storage.sqlite.Organization"
+
+	stmt, err := s.db.Prepare("SELECT id, name, created_at FROM organizations WHERE id=?")
+	if err != nil {
+		return entity.Organization{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	var org entity.Organization
+
+	err = stmt.QueryRowContext(ctx, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Organization{}, fmt.Errorf("%s : %w", op, storage.ErrOrgNotFound)
+		}
+
+		return entity.Organization{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return org, nil
+}
+
+func (s *Storage) Membership(ctx context.Context, orgID int64, userID int64) (entity.Membership, error) {
+	const op = "storage.sqlite.Membership"
+
+	stmt, err := s.db.Prepare("SELECT " + membershipColumns + ` FROM organization_members
+		JOIN users ON users.id = organization_members.user_id
+		WHERE organization_members.org_id=? AND organization_members.user_id=?`)
+	if err != nil {
+		return entity.Membership{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	membership, err := scanMembership(stmt.QueryRowContext(ctx, orgID, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Membership{}, fmt.Errorf("%s : %w", op, storage.ErrMemberNotFound)
+		}
+
+		return entity.Membership{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return membership, nil
+}
+
+// Memberships returns the organizations the user belongs to.
+func (s *Storage) Memberships(ctx context.Context, userID int64) ([]entity.Membership, error) {
+	const op = "storage.sqlite.Memberships"
+
+	return s.queryMemberships(ctx, op, "SELECT "+membershipColumns+` FROM organization_members
+		JOIN users ON users.id = organization_members.user_id
+		WHERE organization_members.user_id=? ORDER BY organization_members.org_id`, userID)
+}
+
+// Members returns the members of the organization.
+func (s *Storage) Members(ctx context.Context, orgID int64) ([]entity.Membership, error) {
+	const op = "storage.sqlite.Members"
+
+	return s.queryMemberships(ctx, op, "SELECT "+membershipColumns+` FROM organization_members
+		JOIN users ON users.id = organization_members.user_id
+		WHERE organization_members.org_id=? ORDER BY organization_members.user_id`, orgID)
+}
+
+func (s *Storage) queryMemberships(ctx context.Context, op string, query string, args ...any) ([]entity.Membership, error) {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var memberships []entity.Membership
+	for rows.Next() {
+		membership, err := scanMembership(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return memberships, nil
+}
+
+func scanMembership(row rowScanner) (entity.Membership, error) {
+	var membership entity.Membership
+
+	err := row.Scan(&membership.OrgID, &membership.UserID, &membership.Email, &membership.Role, &membership.CreatedAt)
+	if err != nil {
+		return entity.Membership{}, err
+	}
+
+	return membership, nil
+}
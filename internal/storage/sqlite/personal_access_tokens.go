@@ -0,0 +1,226 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const personalAccessTokenColumns = `id, user_id, name, prefix, token_hash, scopes, expires_at, created_at,
+	last_used_at, revoked_at`
+
+func (s *Storage) SavePersonalAccessToken(ctx context.Context, token entity.PersonalAccessToken) (int64, error) {
+	const op = "storage.sqlite.SavePersonalAccessToken"
+
+	stmt, err := s.db.Prepare(`INSERT INTO personal_access_tokens(user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES(?,?,?,?,?,?)`)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, token.UserID, token.Name, token.Prefix, token.TokenHash,
+		strings.Join(token.Scopes, " "), token.ExpiresAt.UTC())
+	if err != nil {
+		var sqliteErr sqlite3.Error
+
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrTokenExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) PersonalAccessTokens(ctx context.Context, userID int64) ([]entity.PersonalAccessToken, error) {
+	const op = "storage.sqlite.PersonalAccessTokens"
+
+	stmt, err := s.db.Prepare("SELECT " + personalAccessTokenColumns +
+		" FROM personal_access_tokens WHERE user_id=? ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var tokens []entity.PersonalAccessToken
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return tokens, nil
+}
+
+// PersonalAccessToken returns the personal access token with the id, revoked or not.
+func (s *Storage) PersonalAccessToken(ctx context.Context, id int64) (entity.PersonalAccessToken, error) {
+	const op = "storage.sqlite.PersonalAccessToken"
+
+	stmt, err := s.db.Prepare("SELECT " + personalAccessTokenColumns +
+		" FROM personal_access_tokens WHERE id=?")
+	if err != nil {
+		return entity.PersonalAccessToken{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	token, err := scanPersonalAccessToken(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.PersonalAccessToken{}, fmt.Errorf("%s : %w", op, storage.ErrTokenNotFound)
+		}
+
+		return entity.PersonalAccessToken{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return token, nil
+}
+
+func (s *Storage) PersonalAccessTokenByHash(ctx context.Context, hash []byte) (entity.PersonalAccessToken, error) {
+	const op = "storage.sqlite.PersonalAccessTokenByHash"
+
+	stmt, err := s.db.Prepare("SELECT " + personalAccessTokenColumns +
+		" FROM personal_access_tokens WHERE token_hash=?")
+	if err != nil {
+		return entity.PersonalAccessToken{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	token, err := scanPersonalAccessToken(stmt.QueryRowContext(ctx, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.PersonalAccessToken{}, fmt.Errorf("%s : %w", op, storage.ErrTokenNotFound)
+		}
+
+		return entity.PersonalAccessToken{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return token, nil
+}
+
+func (s *Storage) RevokePersonalAccessToken(ctx context.Context, userID int64, id int64) error {
+	const op = "storage.sqlite.RevokePersonalAccessToken"
+
+	stmt, err := s.db.Prepare(`UPDATE personal_access_tokens SET revoked_at=CURRENT_TIMESTAMP
+		WHERE id=? AND user_id=? AND revoked_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, id, userID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrTokenNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) TouchPersonalAccessToken(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.TouchPersonalAccessToken"
+
+	stmt, err := s.db.Prepare("UPDATE personal_access_tokens SET last_used_at=CURRENT_TIMESTAMP WHERE id=?")
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	if _, err := stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPersonalAccessToken(row rowScanner) (entity.PersonalAccessToken, error) {
+	var (
+		token      entity.PersonalAccessToken
+		scopes     string
+		lastUsedAt sql.NullTime
+		revokedAt  sql.NullTime
+	)
+
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, &scopes,
+		&token.ExpiresAt, &token.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return entity.PersonalAccessToken{}, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.LastUsedAt = lastUsedAt.Time
+	token.RevokedAt = revokedAt.Time
+
+	return token, nil
+}
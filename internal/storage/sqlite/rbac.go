@@ -0,0 +1,351 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+const roleColumns = `roles.id, roles.name, roles.app_id, roles.description, roles.created_at,
+	COALESCE((SELECT GROUP_CONCAT(permissions.name, ' ') FROM role_permissions
+		JOIN permissions ON permissions.id = role_permissions.permission_id
+		WHERE role_permissions.role_id = roles.id), '')`
+
+func (s *Storage) SaveRole(ctx context.Context, role entity.Role) (int64, error) {
+	const op = "storage.sqlite.SaveRole"
+
+	stmt, err := s.db.Prepare("INSERT INTO roles(name, app_id, description) VALUES(?,?,?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, role.Name, role.AppID, role.Description)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrRoleExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Role(ctx context.Context, id int64) (entity.Role, error) {
+	const op = "storage.sqlite.Role"
+
+	stmt, err := s.db.Prepare("SELECT " + roleColumns + " FROM roles WHERE id=?")
+	if err != nil {
+		return entity.Role{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	role, err := scanRole(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Role{}, fmt.Errorf("%s : %w", op, storage.ErrRoleNotFound)
+		}
+
+		return entity.Role{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return role, nil
+}
+
+func (s *Storage) RoleByName(ctx context.Context, name string, appID int) (entity.Role, error) {
+	const op = "storage.sqlite.RoleByName"
+
+	stmt, err := s.db.Prepare("SELECT " + roleColumns + " FROM roles WHERE name=? AND app_id=?")
+	if err != nil {
+		return entity.Role{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	role, err := scanRole(stmt.QueryRowContext(ctx, name, appID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Role{}, fmt.Errorf("%s : %w", op, storage.ErrRoleNotFound)
+		}
+
+		return entity.Role{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return role, nil
+}
+
+// Roles returns all roles, global ones first.
+func (s *Storage) Roles(ctx context.Context) ([]entity.Role, error) {
+	const op = "storage.sqlite.Roles"
+
+	return s.queryRoles(ctx, op, "SELECT "+roleColumns+" FROM roles ORDER BY app_id, name")
+}
+
+// UserRoles returns the global roles of the user and the roles it has in the given app.
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int) ([]entity.Role, error) {
+	const op = "storage.sqlite.UserRoles"
+
+	return s.queryRoles(ctx, op, "SELECT "+roleColumns+` FROM roles
+		JOIN user_roles ON user_roles.role_id = roles.id
+		WHERE user_roles.user_id=? AND roles.app_id IN (?, ?)
+		ORDER BY roles.app_id, roles.name`, userID, entity.GlobalAppID, appID)
+}
+
+func (s *Storage) DeleteRole(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.DeleteRole"
+
+	return s.execAffectingOne(ctx, op, storage.ErrRoleNotFound, "DELETE FROM roles WHERE id=?", id)
+}
+
+func (s *Storage) SavePermission(ctx context.Context, permission entity.Permission) (int64, error) {
+	const op = "storage.sqlite.SavePermission"
+
+	stmt, err := s.db.Prepare("INSERT INTO permissions(name, description) VALUES(?,?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, permission.Name, permission.Description)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrPermissionExists)
+		}
+
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) Permissions(ctx context.Context) ([]entity.Permission, error) {
+	const op = "storage.sqlite.Permissions"
+
+	stmt, err := s.db.Prepare("SELECT id, name, description FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var permissions []entity.Permission
+	for rows.Next() {
+		var permission entity.Permission
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return permissions, nil
+}
+
+func (s *Storage) DeletePermission(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.DeletePermission"
+
+	return s.execAffectingOne(ctx, op, storage.ErrPermissionNotFound, "DELETE FROM permissions WHERE id=?", id)
+}
+
+func (s *Storage) AddRolePermission(ctx context.Context, roleID int64, permissionID int64) error {
+	const op = "storage.sqlite.AddRolePermission"
+
+	stmt, err := s.db.Prepare(`INSERT INTO role_permissions(role_id, permission_id)
+		SELECT roles.id, permissions.id FROM roles, permissions WHERE roles.id=? AND permissions.id=?
+		ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	if _, err := stmt.ExecContext(ctx, roleID, permissionID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RemoveRolePermission(ctx context.Context, roleID int64, permissionID int64) error {
+	const op = "storage.sqlite.RemoveRolePermission"
+
+	return s.execAffectingOne(ctx, op, storage.ErrPermissionNotFound,
+		"DELETE FROM role_permissions WHERE role_id=? AND permission_id=?", roleID, permissionID)
+}
+
+func (s *Storage) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.sqlite.AssignRole"
+
+	stmt, err := s.db.Prepare(`INSERT INTO user_roles(user_id, role_id)
+		SELECT users.id, roles.id FROM users, roles WHERE users.id=? AND roles.id=?
+		ON CONFLICT DO UPDATE SET from_directory = FALSE`)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	if _, err := stmt.ExecContext(ctx, userID, roleID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.sqlite.UnassignRole"
+
+	return s.execAffectingOne(ctx, op, storage.ErrRoleNotFound,
+		"DELETE FROM user_roles WHERE user_id=? AND role_id=?", userID, roleID)
+}
+
+func (s *Storage) queryRoles(ctx context.Context, op string, query string, args ...any) ([]entity.Role, error) {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var roles []entity.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return roles, nil
+}
+
+// execAffectingOne runs a modifying statement and returns notFound if it changed nothing.
+func (s *Storage) execAffectingOne(ctx context.Context, op string, notFound error, query string, args ...any) error {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, notFound)
+	}
+
+	return nil
+}
+
+func scanRole(row rowScanner) (entity.Role, error) {
+	var (
+		role        entity.Role
+		permissions string
+	)
+
+	err := row.Scan(&role.ID, &role.Name, &role.AppID, &role.Description, &role.CreatedAt, &permissions)
+	if err != nil {
+		return entity.Role{}, err
+	}
+
+	role.Permissions = strings.Fields(permissions)
+
+	return role, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	return errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique)
+}
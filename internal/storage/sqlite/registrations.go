@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+	"github.com/KRYST4L614/auth_service/internal/storage"
+)
+
+// RegisterClient creates the app with its redirect URIs and the registration
+// of its owner at once. The ID of the new app is returned.
+func (s *Storage) RegisterClient(
+	ctx context.Context,
+	app entity.App,
+	redirectURIs []string,
+	reg entity.ClientRegistration,
+) (int, error) {
+	const op = "storage.sqlite.RegisterClient"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, insertAppQuery, append([]any{app.Name, app.Secret}, settingsArgs(app.Settings)...)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrAppExists)
+		}
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := insertRedirectURIs(ctx, tx, int(id), redirectURIs); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, `INSERT INTO client_registrations(app_id, access_token_hash, logo_uri, contacts,
+		created_at, updated_at) VALUES(?,?,?,?,?,?)`,
+		id, reg.AccessTokenHash, reg.LogoURI, strings.Join(reg.Contacts, " "), now, now)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return int(id), nil
+}
+
+// ClientRegistration returns the registration of the app. Apps created by an
+// admin have none and return ErrRegistrationNotFound.
+func (s *Storage) ClientRegistration(ctx context.Context, appID int) (entity.ClientRegistration, error) {
+	const op = "storage.sqlite.ClientRegistration"
+
+	stmt, err := s.db.Prepare(`SELECT app_id, access_token_hash, logo_uri, contacts, created_at, updated_at
+		FROM client_registrations WHERE app_id=?`)
+	if err != nil {
+		return entity.ClientRegistration{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	var (
+		reg      entity.ClientRegistration
+		contacts string
+	)
+
+	err = stmt.QueryRowContext(ctx, appID).Scan(&reg.AppID, &reg.AccessTokenHash, &reg.LogoURI, &contacts,
+		&reg.CreatedAt, &reg.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.ClientRegistration{}, fmt.Errorf("%s : %w", op, storage.ErrRegistrationNotFound)
+		}
+		return entity.ClientRegistration{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	reg.Contacts = strings.Fields(contacts)
+
+	return reg, nil
+}
+
+// UpdateClientRegistration replaces the name, settings and redirect URIs of a
+// registered app and the metadata of its registration at once.
+func (s *Storage) UpdateClientRegistration(
+	ctx context.Context,
+	app entity.App,
+	redirectURIs []string,
+	reg entity.ClientRegistration,
+) error {
+	const op = "storage.sqlite.UpdateClientRegistration"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `UPDATE client_registrations SET logo_uri=?, contacts=?, updated_at=?
+		WHERE app_id=?`, reg.LogoURI, strings.Join(reg.Contacts, " "), time.Now().UTC(), app.ID)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s : %w", op, storage.ErrRegistrationNotFound)
+	}
+
+	args := append([]any{app.Name}, settingsArgs(app.Settings)...)
+	if _, err := tx.ExecContext(ctx, updateAppQuery, append(args, app.ID)...); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%s : %w", op, storage.ErrAppExists)
+		}
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM app_redirect_uris WHERE app_id=?", app.ID); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := insertRedirectURIs(ctx, tx, app.ID, redirectURIs); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/KRYST4L614/auth_service/internal/storage"
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
 )
 
 type Storage struct {
@@ -18,7 +19,14 @@ type Storage struct {
 func NewStorage(storagePath string) (*Storage, error) {
 	const op = "storage.sqlite.NewStorage"
 
-	db, err := sql.Open("sqlite3", storagePath)
+	// Cascading deletes of roles, devices and tokens rely on foreign keys,
+	// which SQLite only enforces when asked to.
+	dsn := storagePath + "?_foreign_keys=on"
+	if strings.Contains(storagePath, "?") {
+		dsn = storagePath + "&_foreign_keys=on"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("%s : %s", op, err)
 	}
@@ -43,10 +51,10 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 
 	res, err := stmt.ExecContext(ctx, email, passHash)
 	if err != nil {
-		var sqliteErr *sqlite3.Error
+		var sqliteErr sqlite3.Error
 
-		if errors.As(err, &sqliteErr) && errors.Is(sqlite3.ErrConstraintUnique, sqliteErr.ExtendedCode) {
-			return 0, fmt.Errorf("%s : %s", op, storage.ErrUserExists)
+		if errors.As(err, &sqliteErr) && errors.Is(sqliteErr.ExtendedCode, sqlite3.ErrConstraintUnique) {
+			return 0, fmt.Errorf("%s : %w", op, storage.ErrUserExists)
 		}
 
 		return 0, fmt.Errorf("%s : %s", op, err)
@@ -63,7 +71,7 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 func (s *Storage) User(ctx context.Context, email string) (entity.User, error) {
 	const op = "storage.sqlite.User"
 
-	stmt, err := s.db.Prepare("SELECT id, email, pass_hash FROM users WHERE email=?")
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE email=?")
 	if err != nil {
 		return entity.User{}, fmt.Errorf("%s : %s", op, err)
 	}
@@ -75,13 +83,10 @@ func (s *Storage) User(ctx context.Context, email string) (entity.User, error) {
 		}
 	}(stmt)
 
-	row := stmt.QueryRowContext(ctx, email)
-
-	var user entity.User
-	err = row.Scan(&user.ID, &user.Email, &user.PassHash)
+	user, err := scanUser(stmt.QueryRowContext(ctx, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return entity.User{}, fmt.Errorf("%s : %s", op, storage.ErrUserNotFound)
+			return entity.User{}, fmt.Errorf("%s : %w", op, storage.ErrUserNotFound)
 		}
 
 		return entity.User{}, fmt.Errorf("%s : %s", op, err)
@@ -93,7 +98,10 @@ func (s *Storage) User(ctx context.Context, email string) (entity.User, error) {
 func (s *Storage) IsAdmin(ctx context.Context, id int64) (bool, error) {
 	const op = "storage.sqlite.IsAdmin"
 
-	stmt, err := s.db.Prepare("SELECT is_admin FROM users WHERE id=?")
+	stmt, err := s.db.Prepare(`SELECT EXISTS(SELECT 1 FROM user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+		WHERE user_roles.user_id = users.id AND roles.name = ? AND roles.app_id = ?)
+		FROM users WHERE id=?`)
 	if err != nil {
 		return false, fmt.Errorf("%s : %s", op, err)
 	}
@@ -105,12 +113,12 @@ func (s *Storage) IsAdmin(ctx context.Context, id int64) (bool, error) {
 		}
 	}(stmt)
 
-	row := stmt.QueryRowContext(ctx, id)
+	row := stmt.QueryRowContext(ctx, entity.RoleAdmin, entity.GlobalAppID, id)
 	var isAdmin bool
 	err = row.Scan(&isAdmin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, fmt.Errorf("%s : %s", op, storage.ErrUserNotFound)
+			return false, fmt.Errorf("%s : %w", op, storage.ErrUserNotFound)
 		}
 		return false, fmt.Errorf("%s : %s", op, err)
 	}
@@ -121,7 +129,7 @@ func (s *Storage) IsAdmin(ctx context.Context, id int64) (bool, error) {
 func (s *Storage) App(ctx context.Context, id int) (entity.App, error) {
 	const op = "storage.sqlite.App"
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id=?")
+	stmt, err := s.db.Prepare("SELECT " + appColumns + " FROM apps WHERE id=?")
 	if err != nil {
 		return entity.App{}, fmt.Errorf("%s : %s", op, err)
 	}
@@ -133,14 +141,188 @@ func (s *Storage) App(ctx context.Context, id int) (entity.App, error) {
 		}
 	}(stmt)
 
-	row := stmt.QueryRowContext(ctx, id)
-	var app entity.App
-	err = row.Scan(&app.ID, &app.Name, &app.Secret)
+	app, err := scanApp(stmt.QueryRowContext(ctx, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return entity.App{}, fmt.Errorf("%s : %s", op, storage.ErrAppNotFound)
+			return entity.App{}, fmt.Errorf("%s : %w", op, storage.ErrAppNotFound)
 		}
 		return entity.App{}, fmt.Errorf("%s : %s", op, err)
 	}
 	return app, nil
 }
+
+func (s *Storage) Devices(ctx context.Context, userID int64) ([]entity.Device, error) {
+	const op = "storage.sqlite.Devices"
+
+	stmt, err := s.db.Prepare(`SELECT id, user_id, fingerprint, user_agent, ip_prefix, created_at, last_seen_at
+		FROM user_devices WHERE user_id=? ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var devices []entity.Device
+	for rows.Next() {
+		var device entity.Device
+		err = rows.Scan(&device.ID, &device.UserID, &device.Fingerprint, &device.UserAgent, &device.IPPrefix,
+			&device.CreatedAt, &device.LastSeenAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		devices = append(devices, device)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return devices, nil
+}
+
+func (s *Storage) SaveDevice(ctx context.Context, device entity.Device) (int64, error) {
+	const op = "storage.sqlite.SaveDevice"
+
+	stmt, err := s.db.Prepare(`INSERT INTO user_devices(user_id, fingerprint, user_agent, ip_prefix)
+		VALUES(?,?,?,?)`)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx, device.UserID, device.Fingerprint, device.UserAgent, device.IPPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) TouchDevice(ctx context.Context, id int64) error {
+	const op = "storage.sqlite.TouchDevice"
+
+	stmt, err := s.db.Prepare("UPDATE user_devices SET last_seen_at=CURRENT_TIMESTAMP WHERE id=?")
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	if _, err := stmt.ExecContext(ctx, id); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) UserByID(ctx context.Context, id int64) (entity.User, error) {
+	const op = "storage.sqlite.UserByID"
+
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE id=?")
+	if err != nil {
+		return entity.User{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	user, err := scanUser(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.User{}, fmt.Errorf("%s : %w", op, storage.ErrUserNotFound)
+		}
+
+		return entity.User{}, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) SaveAuditEvent(ctx context.Context, event entity.AuditEvent) (int64, error) {
+	const op = "storage.sqlite.SaveAuditEvent"
+
+	stmt, err := s.db.Prepare(`INSERT INTO audit_log(actor_id, action, target_user_id, app_id, details)
+		VALUES(?,?,?,?,?)`)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	res, err := stmt.ExecContext(ctx,
+		event.ActorID,
+		event.Action,
+		sql.NullInt64{Int64: event.TargetUserID, Valid: event.TargetUserID != 0},
+		sql.NullInt64{Int64: int64(event.AppID), Valid: event.AppID != 0},
+		event.Details,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return id, nil
+}
+
+// SaveAuditEvents records the events in one transaction.
+func (s *Storage) SaveAuditEvents(ctx context.Context, events []entity.AuditEvent) error {
+	const op = "storage.sqlite.SaveAuditEvents"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, event := range events {
+		if err := insertAuditEvent(ctx, tx, event); err != nil {
+			return fmt.Errorf("%s : %s", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s : %s", op, err)
+	}
+
+	return nil
+}
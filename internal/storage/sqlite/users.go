@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/KRYST4L614/auth_service/internal/domain/entity"
+)
+
+const userColumns = "id, email, pass_hash, status, email_verified, created_at, sessions_revoked_at"
+
+// timeFormat is the layout of CURRENT_TIMESTAMP. Times compared against DATETIME
+// columns filled in by SQLite must be formatted the same way to compare correctly.
+const timeFormat = "2006-01-02 15:04:05"
+
+var userSortColumns = map[string]string{
+	entity.UserSortID:        "id",
+	entity.UserSortEmail:     "email",
+	entity.UserSortCreatedAt: "created_at",
+}
+
+// ListUsers returns a page of users matching the query, using keyset pagination
+// so pages stay stable and cheap however deep the listing goes.
+func (s *Storage) ListUsers(ctx context.Context, query entity.UserQuery) ([]entity.User, error) {
+	const op = "storage.sqlite.ListUsers"
+
+	column, ok := userSortColumns[query.SortBy]
+	if !ok {
+		column = "id"
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+
+	if prefix := query.Filter.EmailPrefix; prefix != "" {
+		// A range instead of LIKE, so the email index is used. No UTF-8 byte is 0xff.
+		where = append(where, "email >= ? AND email < ?")
+		args = append(args, prefix, prefix+"\xff")
+	}
+
+	if query.Filter.Admin != nil {
+		cond := `EXISTS(SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = users.id AND roles.name = ? AND roles.app_id = ?)`
+		if !*query.Filter.Admin {
+			cond = "NOT " + cond
+		}
+		where = append(where, cond)
+		args = append(args, entity.RoleAdmin, entity.GlobalAppID)
+	}
+
+	if !query.Filter.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.Filter.CreatedAfter.UTC().Format(timeFormat))
+	}
+
+	if !query.Filter.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.Filter.CreatedBefore.UTC().Format(timeFormat))
+	}
+
+	if query.Filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, query.Filter.Status)
+	}
+
+	cmp, order := ">", "ASC"
+	if query.Desc {
+		cmp, order = "<", "DESC"
+	}
+
+	if after := query.After; after != nil {
+		switch column {
+		case "id":
+			where = append(where, "id "+cmp+" ?")
+			args = append(args, after.ID)
+		default:
+			var key any = after.Email
+			if column == "created_at" {
+				key = after.CreatedAt.UTC().Format(timeFormat)
+			}
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, cmp))
+			args = append(args, key, key, after.ID)
+		}
+	}
+
+	var q strings.Builder
+	q.WriteString("SELECT " + userColumns + " FROM users")
+	if len(where) > 0 {
+		q.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	if column == "id" {
+		q.WriteString(" ORDER BY id " + order)
+	} else {
+		q.WriteString(fmt.Sprintf(" ORDER BY %s %s, id %s", column, order, order))
+	}
+	q.WriteString(" LIMIT ?")
+	args = append(args, query.Limit)
+
+	stmt, err := s.db.Prepare(q.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		err := stmt.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(stmt)
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+	defer rows.Close()
+
+	var users []entity.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", op, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", op, err)
+	}
+
+	return users, nil
+}
+
+func scanUser(row rowScanner) (entity.User, error) {
+	var (
+		user              entity.User
+		createdAt         sql.NullTime
+		sessionsRevokedAt sql.NullTime
+	)
+
+	err := row.Scan(&user.ID, &user.Email, &user.PassHash, &user.Status, &user.EmailVerified, &createdAt,
+		&sessionsRevokedAt)
+	if err != nil {
+		return entity.User{}, err
+	}
+	user.CreatedAt = createdAt.Time
+	user.SessionsRevokedAt = sessionsRevokedAt.Time
+
+	return user, nil
+}
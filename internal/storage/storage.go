@@ -6,4 +6,39 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrAppNotFound  = errors.New("app not found")
 	ErrUserExists   = errors.New("user already exists")
+	ErrAppExists    = errors.New("app already exists")
+
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExists   = errors.New("token already exists")
+
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrPermissionExists   = errors.New("permission already exists")
+
+	ErrNotAdmin  = errors.New("user is not an admin")
+	ErrLastAdmin = errors.New("last admin can't be revoked")
+
+	ErrOrgNotFound        = errors.New("organization not found")
+	ErrOrgExists          = errors.New("organization already exists")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrInvitationNotFound = errors.New("invitation not found")
+
+	ErrCodeNotFound       = errors.New("authorization code not found")
+	ErrAssertionReplayed  = errors.New("client assertion already used")
+	ErrDeviceCodeNotFound = errors.New("device code not found")
+	ErrUserCodeExists     = errors.New("user code already exists")
+
+	ErrConsentNotFound        = errors.New("consent not found")
+	ErrConsentRequestNotFound = errors.New("consent request not found")
+
+	ErrRegistrationNotFound = errors.New("client registration not found")
+
+	ErrFederationStateNotFound = errors.New("federation state not found")
+	ErrIdentityNotFound        = errors.New("federated identity not found")
+	ErrIdentityExists          = errors.New("federated identity already exists")
+
+	ErrFactorNotFound = errors.New("authentication factor not found")
+	ErrFactorExists   = errors.New("authentication factor already exists")
+	ErrOTPReplayed    = errors.New("one-time code already used")
 )
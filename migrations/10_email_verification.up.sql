@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Invited users received their invitation by email, which proves they own the address.
+UPDATE users
+SET email_verified = TRUE
+WHERE id IN (SELECT user_id FROM invitations WHERE user_id IS NOT NULL);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_authorization_codes_expires_at;
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS app_redirect_uris;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS app_redirect_uris
+(
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    uri    TEXT    NOT NULL,
+    PRIMARY KEY (app_id, uri)
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    id                    INTEGER PRIMARY KEY,
+    code_hash             BLOB     NOT NULL UNIQUE,
+    app_id                INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id               INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri          TEXT     NOT NULL,
+    scopes                TEXT     NOT NULL DEFAULT '',
+    code_challenge        TEXT     NOT NULL,
+    code_challenge_method TEXT     NOT NULL,
+    auth_time             DATETIME NOT NULL,
+    amr                   TEXT     NOT NULL DEFAULT '',
+    expires_at            DATETIME NOT NULL,
+    created_at            DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used_at               DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_authorization_codes_expires_at ON authorization_codes (expires_at);
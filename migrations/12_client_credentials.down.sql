@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_client_assertions_expires_at;
+DROP TABLE IF EXISTS client_assertions;
+ALTER TABLE apps DROP COLUMN client_public_key;
+ALTER TABLE apps DROP COLUMN client_scopes;
@@ -0,0 +1,11 @@
+ALTER TABLE apps ADD COLUMN client_scopes TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN client_public_key TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS client_assertions
+(
+    app_id     INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    jti        TEXT     NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (app_id, jti)
+);
+CREATE INDEX IF NOT EXISTS idx_client_assertions_expires_at ON client_assertions (expires_at);
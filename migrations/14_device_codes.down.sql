@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_device_codes_expires_at;
+DROP TABLE IF EXISTS device_codes;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    id               INTEGER PRIMARY KEY,
+    device_code_hash BLOB     NOT NULL UNIQUE,
+    user_code        TEXT     NOT NULL UNIQUE,
+    app_id           INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    scopes           TEXT     NOT NULL DEFAULT '',
+    status           TEXT     NOT NULL DEFAULT 'pending',
+    user_id          INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    auth_time        DATETIME,
+    amr              TEXT     NOT NULL DEFAULT '',
+    poll_interval    INTEGER  NOT NULL,
+    last_polled_at   DATETIME,
+    expires_at       DATETIME NOT NULL,
+    created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_device_codes_expires_at ON device_codes (expires_at);
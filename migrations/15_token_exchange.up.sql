@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN token_exchange_from TEXT NOT NULL DEFAULT '';
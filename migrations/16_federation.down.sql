@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_federated_identities_user_id;
+DROP TABLE IF EXISTS federated_identities;
+DROP INDEX IF EXISTS idx_federation_states_expires_at;
+DROP TABLE IF EXISTS federation_states;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS federation_states
+(
+    state_hash    BLOB PRIMARY KEY,
+    provider      TEXT     NOT NULL,
+    nonce         TEXT     NOT NULL,
+    code_verifier TEXT     NOT NULL,
+    resume        TEXT     NOT NULL DEFAULT '',
+    expires_at    DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_federation_states_expires_at ON federation_states (expires_at);
+
+CREATE TABLE IF NOT EXISTS federated_identities
+(
+    id         INTEGER PRIMARY KEY,
+    provider   TEXT     NOT NULL,
+    subject    TEXT     NOT NULL,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      TEXT     NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities (user_id);
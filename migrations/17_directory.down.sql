@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_attributes;
+
+ALTER TABLE user_roles DROP COLUMN from_directory;
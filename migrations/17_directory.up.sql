@@ -0,0 +1,11 @@
+-- Roles granted by directory groups are replaced at every directory login,
+-- roles assigned by hand are kept.
+ALTER TABLE user_roles ADD COLUMN from_directory BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS user_attributes
+(
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name    TEXT    NOT NULL,
+    value   TEXT    NOT NULL,
+    PRIMARY KEY (user_id, name)
+);
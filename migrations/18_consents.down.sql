@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_consent_requests_expires_at;
+DROP TABLE IF EXISTS consent_requests;
+DROP TABLE IF EXISTS consents;
+
+ALTER TABLE apps DROP COLUMN third_party;
@@ -0,0 +1,29 @@
+ALTER TABLE apps ADD COLUMN third_party BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS consents
+(
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    scopes     TEXT     NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, app_id)
+);
+
+CREATE TABLE IF NOT EXISTS consent_requests
+(
+    id                    INTEGER PRIMARY KEY,
+    challenge_hash        BLOB     NOT NULL UNIQUE,
+    app_id                INTEGER  NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    user_id               INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri          TEXT     NOT NULL,
+    scopes                TEXT     NOT NULL DEFAULT '',
+    state                 TEXT     NOT NULL DEFAULT '',
+    code_challenge        TEXT     NOT NULL,
+    code_challenge_method TEXT     NOT NULL,
+    nonce                 TEXT     NOT NULL DEFAULT '',
+    auth_time             DATETIME NOT NULL,
+    amr                   TEXT     NOT NULL DEFAULT '',
+    expires_at            DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_consent_requests_expires_at ON consent_requests (expires_at);
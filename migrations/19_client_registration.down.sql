@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS client_registrations;
+
+ALTER TABLE apps DROP COLUMN token_auth_method;
+ALTER TABLE apps DROP COLUMN grant_types;
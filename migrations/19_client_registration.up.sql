@@ -0,0 +1,12 @@
+ALTER TABLE apps ADD COLUMN grant_types TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN token_auth_method TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS client_registrations
+(
+    app_id            INTEGER PRIMARY KEY REFERENCES apps (id) ON DELETE CASCADE,
+    access_token_hash BLOB     NOT NULL UNIQUE,
+    logo_uri          TEXT     NOT NULL DEFAULT '',
+    contacts          TEXT     NOT NULL DEFAULT '',
+    created_at        DATETIME NOT NULL,
+    updated_at        DATETIME NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_app_web_origins_origin;
+DROP TABLE IF EXISTS app_web_origins;
+DROP TABLE IF EXISTS app_post_logout_redirect_uris;
+
+ALTER TABLE apps DROP COLUMN loopback_any_port;
@@ -0,0 +1,16 @@
+ALTER TABLE apps ADD COLUMN loopback_any_port BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS app_post_logout_redirect_uris
+(
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    uri    TEXT    NOT NULL,
+    PRIMARY KEY (app_id, uri)
+);
+
+CREATE TABLE IF NOT EXISTS app_web_origins
+(
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    origin TEXT    NOT NULL,
+    PRIMARY KEY (app_id, origin)
+);
+CREATE INDEX IF NOT EXISTS idx_app_web_origins_origin ON app_web_origins (origin);
@@ -0,0 +1 @@
+ALTER TABLE consents DROP COLUMN grant_id;
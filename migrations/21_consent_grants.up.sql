@@ -0,0 +1,3 @@
+ALTER TABLE consents ADD COLUMN grant_id TEXT NOT NULL DEFAULT '';
+
+UPDATE consents SET grant_id = lower(hex(randomblob(16))) WHERE grant_id = '';
@@ -0,0 +1,9 @@
+-- Directory users are looked up by email case-insensitively.
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
+
+-- Directory groups no longer grant the admin role: admins who got it from a
+-- group keep it as if it was granted by hand.
+UPDATE user_roles
+SET from_directory = FALSE
+WHERE from_directory
+  AND role_id IN (SELECT id FROM roles WHERE name = 'admin' AND app_id = 0);
@@ -0,0 +1,25 @@
+CREATE TABLE apps_old
+(
+    id                    INTEGER PRIMARY KEY,
+    name                  TEXT    NOT NULL UNIQUE,
+    secret                TEXT    NOT NULL UNIQUE,
+    access_token_ttl      INTEGER NOT NULL DEFAULT 0,
+    refresh_token_ttl     INTEGER NOT NULL DEFAULT 0,
+    allow_registration    BOOLEAN NOT NULL DEFAULT TRUE,
+    login_methods         TEXT    NOT NULL DEFAULT '',
+    required_acr          TEXT    NOT NULL DEFAULT '',
+    allowed_email_domains TEXT    NOT NULL DEFAULT '',
+    client_scopes         TEXT    NOT NULL DEFAULT '',
+    client_public_key     TEXT    NOT NULL DEFAULT '',
+    token_exchange_from   TEXT    NOT NULL DEFAULT '',
+    third_party           BOOLEAN NOT NULL DEFAULT FALSE,
+    grant_types           TEXT    NOT NULL DEFAULT '',
+    token_auth_method     TEXT    NOT NULL DEFAULT '',
+    loopback_any_port     BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO apps_old SELECT * FROM apps;
+
+DROP TABLE apps;
+
+ALTER TABLE apps_old RENAME TO apps;
@@ -0,0 +1,36 @@
+-- Ids of deleted apps are never given to new apps, so tokens and settings
+-- naming a deleted app can't come to name another one. SQLite can't add
+-- AUTOINCREMENT to a column, so the table is rebuilt. The migrator doesn't
+-- enforce foreign keys, so dropping the old table leaves the rows referencing
+-- it in place, and they reference the new table after the rename.
+CREATE TABLE apps_new
+(
+    id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+    name                  TEXT    NOT NULL UNIQUE,
+    secret                TEXT    NOT NULL UNIQUE,
+    access_token_ttl      INTEGER NOT NULL DEFAULT 0,
+    refresh_token_ttl     INTEGER NOT NULL DEFAULT 0,
+    allow_registration    BOOLEAN NOT NULL DEFAULT TRUE,
+    login_methods         TEXT    NOT NULL DEFAULT '',
+    required_acr          TEXT    NOT NULL DEFAULT '',
+    allowed_email_domains TEXT    NOT NULL DEFAULT '',
+    client_scopes         TEXT    NOT NULL DEFAULT '',
+    client_public_key     TEXT    NOT NULL DEFAULT '',
+    token_exchange_from   TEXT    NOT NULL DEFAULT '',
+    third_party           BOOLEAN NOT NULL DEFAULT FALSE,
+    grant_types           TEXT    NOT NULL DEFAULT '',
+    token_auth_method     TEXT    NOT NULL DEFAULT '',
+    loopback_any_port     BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO apps_new (id, name, secret, access_token_ttl, refresh_token_ttl, allow_registration, login_methods,
+                      required_acr, allowed_email_domains, client_scopes, client_public_key, token_exchange_from,
+                      third_party, grant_types, token_auth_method, loopback_any_port)
+SELECT id, name, secret, access_token_ttl, refresh_token_ttl, allow_registration, login_methods,
+       required_acr, allowed_email_domains, client_scopes, client_public_key, token_exchange_from,
+       third_party, grant_types, token_auth_method, loopback_any_port
+FROM apps;
+
+DROP TABLE apps;
+
+ALTER TABLE apps_new RENAME TO apps;
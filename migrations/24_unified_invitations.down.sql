@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS organization_invitations
+(
+    id          INTEGER PRIMARY KEY,
+    org_id      INTEGER  NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email       TEXT     NOT NULL,
+    role        TEXT     NOT NULL DEFAULT 'member',
+    token_hash  BLOB     NOT NULL UNIQUE,
+    invited_by  INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at  DATETIME NOT NULL,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    accepted_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_org_id ON organization_invitations (org_id);
+
+INSERT INTO organization_invitations (org_id, email, role, token_hash, invited_by, expires_at, created_at, accepted_at)
+SELECT org_id, email, org_role, token_hash, invited_by, expires_at, created_at, accepted_at
+FROM invitations
+WHERE org_id IS NOT NULL
+  AND role_ids = ''
+  AND revoked_at IS NULL;
+
+DELETE
+FROM invitations
+WHERE org_id IS NOT NULL
+  AND role_ids = ''
+  AND revoked_at IS NULL;
@@ -0,0 +1,18 @@
+-- Organization invitations are kept with the sign-up invitations, so every
+-- invitation can be listed and revoked in one place and is accepted the same way.
+INSERT INTO invitations (email, token_hash, org_id, org_role, invited_by, expires_at, created_at, accepted_at, user_id)
+SELECT organization_invitations.email,
+       organization_invitations.token_hash,
+       organization_invitations.org_id,
+       organization_invitations.role,
+       organization_invitations.invited_by,
+       organization_invitations.expires_at,
+       organization_invitations.created_at,
+       organization_invitations.accepted_at,
+       CASE
+           WHEN organization_invitations.accepted_at IS NOT NULL
+               THEN (SELECT id FROM users WHERE lower(email) = lower(organization_invitations.email) LIMIT 1)
+           END
+FROM organization_invitations;
+
+DROP TABLE IF EXISTS organization_invitations;
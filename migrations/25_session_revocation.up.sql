@@ -0,0 +1,2 @@
+-- Access tokens of the user issued up to this time are refused, see RevokeSessions.
+ALTER TABLE users ADD COLUMN sessions_revoked_at DATETIME;
@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN refresh_token_ttl INTEGER NOT NULL DEFAULT 0;
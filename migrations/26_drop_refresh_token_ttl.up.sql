@@ -0,0 +1,2 @@
+-- The service issues no refresh tokens, so their lifetime can't be set per app.
+ALTER TABLE apps DROP COLUMN refresh_token_ttl;
@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN user_scopes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS totp_factors
+(
+    user_id      INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret       TEXT     NOT NULL,
+    confirmed_at DATETIME,
+    last_step    INTEGER  NOT NULL DEFAULT 0
+);
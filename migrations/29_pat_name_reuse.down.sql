@@ -0,0 +1,31 @@
+-- Names reused after a revocation can't be unique again: of the tokens sharing
+-- a name, only the newest is kept.
+DELETE FROM personal_access_tokens
+WHERE EXISTS (SELECT 1
+              FROM personal_access_tokens newer
+              WHERE newer.user_id = personal_access_tokens.user_id
+                AND newer.name = personal_access_tokens.name
+                AND newer.id > personal_access_tokens.id);
+
+CREATE TABLE personal_access_tokens_old
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT     NOT NULL,
+    prefix       TEXT     NOT NULL,
+    token_hash   BLOB     NOT NULL UNIQUE,
+    scopes       TEXT     NOT NULL DEFAULT '',
+    expires_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    revoked_at   DATETIME,
+    UNIQUE (user_id, name)
+);
+
+INSERT INTO personal_access_tokens_old SELECT * FROM personal_access_tokens;
+
+DROP TABLE personal_access_tokens;
+
+ALTER TABLE personal_access_tokens_old RENAME TO personal_access_tokens;
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
@@ -0,0 +1,29 @@
+-- Token names are unique among the tokens of a user that aren't revoked, so a
+-- revoked token's name can be given to a new one. SQLite can't drop a table
+-- constraint, so the table is rebuilt without UNIQUE (user_id, name).
+CREATE TABLE personal_access_tokens_new
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT     NOT NULL,
+    prefix       TEXT     NOT NULL,
+    token_hash   BLOB     NOT NULL UNIQUE,
+    scopes       TEXT     NOT NULL DEFAULT '',
+    expires_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    revoked_at   DATETIME
+);
+
+INSERT INTO personal_access_tokens_new (id, user_id, name, prefix, token_hash, scopes, expires_at, created_at,
+                                        last_used_at, revoked_at)
+SELECT id, user_id, name, prefix, token_hash, scopes, expires_at, created_at, last_used_at, revoked_at
+FROM personal_access_tokens;
+
+DROP TABLE personal_access_tokens;
+
+ALTER TABLE personal_access_tokens_new RENAME TO personal_access_tokens;
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_active_name ON personal_access_tokens (user_id, name)
+    WHERE revoked_at IS NULL;
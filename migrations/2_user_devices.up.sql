@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_devices
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    fingerprint  TEXT     NOT NULL,
+    user_agent   TEXT     NOT NULL,
+    ip_prefix    TEXT     NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, fingerprint)
+);
+CREATE INDEX IF NOT EXISTS idx_user_devices_user_id ON user_devices (user_id);
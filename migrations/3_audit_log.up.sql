@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id             INTEGER PRIMARY KEY,
+    actor_id       INTEGER  NOT NULL,
+    action         TEXT     NOT NULL,
+    target_user_id INTEGER,
+    app_id         INTEGER,
+    details        TEXT     NOT NULL DEFAULT '',
+    created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target_user_id ON audit_log (target_user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT     NOT NULL,
+    prefix       TEXT     NOT NULL,
+    token_hash   BLOB     NOT NULL UNIQUE,
+    scopes       TEXT     NOT NULL DEFAULT '',
+    expires_at   DATETIME NOT NULL,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    revoked_at   DATETIME,
+    UNIQUE (user_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
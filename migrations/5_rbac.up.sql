@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          INTEGER PRIMARY KEY,
+    name        TEXT     NOT NULL,
+    app_id      INTEGER  NOT NULL DEFAULT 0,
+    description TEXT     NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (name, app_id)
+);
+
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          INTEGER PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    INTEGER  NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
+
+INSERT INTO roles (name, app_id, description)
+VALUES ('admin', 0, 'Full administrative access')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT users.id, roles.id
+FROM users,
+     roles
+WHERE users.is_admin
+  AND roles.name = 'admin'
+  AND roles.app_id = 0
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users DROP COLUMN is_admin;
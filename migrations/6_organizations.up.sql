@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS organizations
+(
+    id         INTEGER PRIMARY KEY,
+    name       TEXT     NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organization_members
+(
+    org_id     INTEGER  NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id    INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       TEXT     NOT NULL DEFAULT 'member',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations
+(
+    id          INTEGER PRIMARY KEY,
+    org_id      INTEGER  NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email       TEXT     NOT NULL,
+    role        TEXT     NOT NULL DEFAULT 'member',
+    token_hash  BLOB     NOT NULL UNIQUE,
+    invited_by  INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at  DATETIME NOT NULL,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    accepted_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_org_id ON organization_invitations (org_id);
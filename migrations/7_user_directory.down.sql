@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_status;
+DROP INDEX IF EXISTS idx_users_created_at;
+DROP TRIGGER IF EXISTS users_created_at;
+
+ALTER TABLE users DROP COLUMN status;
+ALTER TABLE users DROP COLUMN created_at;
@@ -0,0 +1,19 @@
+-- SQLite can't add a column with a non-constant default, so created_at is
+-- backfilled here and filled in for new users by a trigger.
+ALTER TABLE users ADD COLUMN created_at DATETIME;
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+UPDATE users
+SET created_at = CURRENT_TIMESTAMP
+WHERE created_at IS NULL;
+
+CREATE TRIGGER IF NOT EXISTS users_created_at
+    AFTER INSERT
+    ON users
+    WHEN NEW.created_at IS NULL
+BEGIN
+    UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
@@ -0,0 +1,6 @@
+ALTER TABLE apps DROP COLUMN allowed_email_domains;
+ALTER TABLE apps DROP COLUMN required_acr;
+ALTER TABLE apps DROP COLUMN login_methods;
+ALTER TABLE apps DROP COLUMN allow_registration;
+ALTER TABLE apps DROP COLUMN refresh_token_ttl;
+ALTER TABLE apps DROP COLUMN access_token_ttl;
@@ -0,0 +1,6 @@
+ALTER TABLE apps ADD COLUMN access_token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN refresh_token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN allow_registration BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE apps ADD COLUMN login_methods TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN required_acr TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps ADD COLUMN allowed_email_domains TEXT NOT NULL DEFAULT '';
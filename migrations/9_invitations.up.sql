@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS invitations
+(
+    id          INTEGER PRIMARY KEY,
+    email       TEXT     NOT NULL,
+    token_hash  BLOB     NOT NULL UNIQUE,
+    role_ids    TEXT     NOT NULL DEFAULT '',
+    org_id      INTEGER REFERENCES organizations (id) ON DELETE SET NULL,
+    org_role    TEXT     NOT NULL DEFAULT '',
+    invited_by  INTEGER  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at  DATETIME NOT NULL,
+    created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    accepted_at DATETIME,
+    revoked_at  DATETIME,
+    user_id     INTEGER REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
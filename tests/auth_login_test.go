@@ -7,6 +7,8 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -14,7 +16,6 @@ import (
 const (
 	passDefaultLen    = 10
 	appId             = 1
-	appSecret         = "test-secret"
 	tokenDeltaSeconds = 10
 )
 
@@ -24,7 +25,8 @@ func TestLogin_HappyPath(t *testing.T) {
 	email := gofakeit.Email()
 	password := gofakeit.Password(true, true, true, true, true, passDefaultLen)
 
-	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+	regCtx := metadata.AppendToOutgoingContext(ctx, "x-app-id", strconv.Itoa(appId))
+	respReg, err := st.AuthClient.Register(regCtx, &ssov1.RegisterRequest{
 		Email:    email,
 		Password: password,
 	})
@@ -44,9 +46,10 @@ func TestLogin_HappyPath(t *testing.T) {
 	token := respLogin.GetToken()
 	require.NotEmpty(t, token)
 
+	signingKey := st.SigningKey(ctx)
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		return []byte(appSecret), nil
-	})
+		return signingKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
 	require.NoError(t, err)
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
@@ -56,4 +59,7 @@ func TestLogin_HappyPath(t *testing.T) {
 	assert.Equal(t, appId, int(claims["app_id"].(float64)))
 	assert.Equal(t, respReg.GetUserId(), int64(claims["uid"].(float64)))
 	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTl).Unix(), claims["exp"].(float64), tokenDeltaSeconds)
+	assert.InDelta(t, loginTime.Unix(), claims["auth_time"].(float64), tokenDeltaSeconds)
+	assert.Equal(t, []interface{}{"pwd"}, claims["amr"])
+	assert.Equal(t, "1", claims["acr"].(string))
 }
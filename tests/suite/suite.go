@@ -2,11 +2,16 @@ package suite
 
 import (
 	"context"
+	"crypto/rsa"
+	"encoding/json"
 	"github.com/KRYST4L614/auth_service/internal/config"
+	"github.com/KRYST4L614/auth_service/internal/lib/jwk"
 	ssov1 "github.com/KRYST4L614/auth_service_protos/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"net"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -47,3 +52,32 @@ func New(t *testing.T) (context.Context, *Suite) {
 		AuthClient: ssov1.NewAuthClient(clientConn),
 	}
 }
+
+// SigningKey fetches the public key tokens are signed with from the JWKS the HTTP server publishes.
+func (s *Suite) SigningKey(ctx context.Context) *rsa.PublicKey {
+	s.Helper()
+
+	url := strings.TrimSuffix(s.Cfg.OAuth.Issuer, "/") + "/jwks.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		s.Fatalf("jwks request failed: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.Fatalf("jwks request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil || len(set.Keys) == 0 {
+		s.Fatalf("invalid jwks: %v", err)
+	}
+
+	key, err := set.Keys[0].RSA()
+	if err != nil {
+		s.Fatalf("invalid jwks: %v", err)
+	}
+
+	return key
+}